@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/mauroue/cereja-corp/config"
+	"github.com/mauroue/cereja-corp/internal/db"
+)
+
+// checkConfigCommand prints the effective configuration, after the file and
+// environment are layered and validated, with secrets masked. With -db it also
+// checks the database can be reached.
+func checkConfigCommand(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := findCommand("check-config").flags()
+	checkDB := fs.Bool("db", false, "also connect to the database")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(cfg.Redacted(), "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	log.Printf("Configuration is valid")
+
+	if *checkDB {
+		if _, err := db.Connect(); err != nil {
+			return fmt.Errorf("failed to connect to database: %w", err)
+		}
+		if err := db.Close(); err != nil {
+			log.Printf("Failed to close database: %v", err)
+		}
+		log.Printf("Connected to database %s", cfg.DB.Target())
+	}
+	return nil
+}
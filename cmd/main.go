@@ -1,76 +1,212 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"os"
-	"path/filepath"
-	"time"
+	"os/signal"
+	"syscall"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mauroue/cereja-corp/config"
+	"github.com/mauroue/cereja-corp/internal/api"
 	"github.com/mauroue/cereja-corp/internal/db"
+	"github.com/mauroue/cereja-corp/internal/migrate"
+	"github.com/mauroue/cereja-corp/internal/models"
 	"github.com/mauroue/cereja-corp/internal/receipts"
+	"github.com/mauroue/cereja-corp/internal/server"
 )
 
+// command is a subcommand of the binary
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(ctx context.Context, cfg *config.Config, args []string) error
+}
+
+// commands lists the subcommands in the order shown by the usage
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{"serve", "serve", "Serve the web app and API (the default)", serveCommand},
+		{"migrate", "migrate up|down [steps]|status|baseline [module/version]", "Apply, roll back, list or adopt database migrations", migrateCommand},
+		{"reprocess", "reprocess [-user name] [-from id] [-to id] [-all] [-parse-only]", "Run OCR or item parsing again for a range of receipts", reprocessCommand},
+		{"import", "import -user name [-currency code] <dir>", "Scan every receipt image or NFC-e XML in a folder", importCommand},
+		{"export", "export -user name [-format csv|json] [-from date] [-to date] [-o file]", "Export receipts with their items", exportCommand},
+		{"user", "user create [-password-file file] <username>", "Create a user account", userCommand},
+		{"check-config", "check-config [-db]", "Validate and print the effective configuration", checkConfigCommand},
+	}
+}
+
+// errUsage is returned by commands called with invalid arguments, after
+// printing their usage
+var errUsage = errors.New("invalid usage")
+
 func main() {
-	// Connect to database
-	_, err := db.Connect()
+	os.Exit(run())
+}
+
+// run runs the command named on the command line and returns the exit code:
+// 0 on success, 2 for invalid usage and 1 for any other failure. Commands
+// return instead of exiting, so their deferred cleanup always runs.
+func run() int {
+	configPath := flag.String("config", "", "configuration file, .json or .yaml (default $"+config.PathEnv+" or config.json)")
+	flag.Usage = usage
+	flag.Parse()
+
+	name := flag.Arg(0)
+	if name == "" {
+		name = "serve"
+	}
+	cmd := findCommand(name)
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		usage()
+		return 2
+	}
+
+	cfg, err := config.Load(*configPath)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		log.Printf("Failed to load configuration: %v", err)
+		return 1
+	}
+
+	// Stop gracefully on SIGINT or SIGTERM; a second signal exits at once
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	var args []string
+	if flag.NArg() > 0 {
+		args = flag.Args()[1:]
+	}
+	err = cmd.run(ctx, cfg, args)
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errUsage):
+		return 2
+	default:
+		log.Printf("%s failed: %v", cmd.name, err)
+		return 1
+	}
+}
+
+// usage prints the global flags and the commands
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [-config file] <command> [arguments]\n\nCommands:\n", os.Args[0])
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-14s %s\n", cmd.name, cmd.summary)
 	}
-	defer db.Close()
+	fmt.Fprintf(out, "\nFlags:\n")
+	flag.PrintDefaults()
+}
 
-	// Initialize router
-	router := gin.Default()
+// findCommand returns the command with the given name, or nil
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// flags returns the flag set of a command. Parse it with parseFlags.
+func (cmd *command) flags() *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s\n\n%s\n", os.Args[0], cmd.usage, cmd.summary)
+		fs.PrintDefaults()
+	}
+	return fs
+}
 
-	// Set HTML templates - load all template files
-	router.LoadHTMLGlob("internal/receipts/templates/*.html")
-	router.LoadHTMLGlob("internal/receipts/templates/partials/*.html")
+// parseFlags parses a command's arguments. The flag package prints the
+// problem and the usage itself, so bad flags come back as errUsage, and -h as
+// flag.ErrHelp.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	err := fs.Parse(args)
+	if err == nil || errors.Is(err, flag.ErrHelp) {
+		return err
+	}
+	return errUsage
+}
 
-	// Add current year to all templates
-	router.Use(func(c *gin.Context) {
-		c.Set("currentYear", time.Now().Year())
-		c.Next()
-	})
+// usageError prints a command's usage and returns errUsage
+func usageError(fs *flag.FlagSet) error {
+	fs.Usage()
+	return errUsage
+}
 
-	// Setup a basic route
-	router.GET("/", func(c *gin.Context) {
-		c.JSON(200, gin.H{
-			"message": "Welcome to Cereja Corp",
-		})
-	})
+// app is the database connection and modules shared by the commands
+type app struct {
+	db  *sql.DB
+	srv *server.Server
+}
 
-	// Health check endpoint
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{
-			"status": "ok",
-		})
-	})
+// openApp connects to the database and mounts every module, as the server does
+func openApp(cfg *config.Config) (*app, error) {
+	database, err := db.Connect()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
 
-	// Setup receipt scanner app
-	uploadDir := filepath.Join(".", "uploads", "receipts")
-	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		log.Fatalf("Failed to create upload directory: %v", err)
+	if err := os.MkdirAll(cfg.Storage.UploadDir, 0755); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create upload directory: %w", err)
 	}
 
-	// Set up API handler
-	receiptHandler, err := receipts.NewHandler(uploadDir)
+	receiptsModule, err := receipts.NewModule(database, cfg.Storage.UploadDir)
 	if err != nil {
-		log.Fatalf("Failed to initialize receipt handler: %v", err)
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize receipts module: %w", err)
+	}
+
+	// Mount every module; receipts comes first as its migrations create users
+	srv := server.NewServer(gin.New(), database,
+		receiptsModule,
+		api.NewTasksModule(database),
+		api.NewNotesModule(database),
+	)
+	return &app{db: database, srv: srv}, nil
+}
+
+// close closes the database connection
+func (a *app) close() {
+	if err := db.Close(); err != nil {
+		log.Printf("Failed to close database: %v", err)
 	}
-	receiptHandler.RegisterRoutes(router)
+}
 
-	// Set up Web handler
-	templatesDir := filepath.Join("internal", "receipts", "templates")
-	webHandler, err := receipts.NewWebHandler(receiptHandler, templatesDir)
+// migrations returns the runner for every module's migrations
+func (a *app) migrations() (*migrate.Runner, error) {
+	sources, err := a.srv.MigrationSources()
 	if err != nil {
-		log.Fatalf("Failed to initialize web handler: %v", err)
+		return nil, err
 	}
-	webHandler.RegisterRoutes(router)
+	runner, err := migrate.New(a.db, sources...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load migrations: %w", err)
+	}
+	return runner, nil
+}
 
-	// Start the server
-	port := ":8080"
-	log.Printf("Starting server on %s", port)
-	if err := router.Run(port); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+// user looks up the account a command acts for
+func (a *app) user(username string) (*models.User, error) {
+	user, err := a.srv.Users.GetUserByUsername(username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("user %q not found", username)
 	}
+	return user, err
 }
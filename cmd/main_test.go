@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"testing"
+)
+
+func TestParseFlags(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		err  error
+	}{
+		{"no arguments", nil, nil},
+		{"known flag", []string{"-user", "ana", "receipts"}, nil},
+		{"unknown flag", []string{"-usr", "ana"}, errUsage},
+		{"missing value", []string{"-user"}, errUsage},
+		{"help", []string{"-h"}, flag.ErrHelp},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := findCommand("import").flags()
+			fs.SetOutput(io.Discard)
+			fs.String("user", "", "user")
+
+			if err := parseFlags(fs, tt.args); !errors.Is(err, tt.err) {
+				t.Errorf("parseFlags(%q) = %v, want %v", tt.args, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestUsageError(t *testing.T) {
+	fs := findCommand("migrate").flags()
+	fs.SetOutput(io.Discard)
+	if err := usageError(fs); !errors.Is(err, errUsage) {
+		t.Errorf("usageError() = %v, want errUsage", err)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/mauroue/cereja-corp/config"
+)
+
+// migrateCommand runs "up", "down [steps]" (one migration by default),
+// "status" or "baseline [module/version]" against the database
+func migrateCommand(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := findCommand("migrate").flags()
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	args = fs.Args()
+	if len(args) == 0 {
+		return usageError(fs)
+	}
+
+	a, err := openApp(cfg)
+	if err != nil {
+		return err
+	}
+	defer a.close()
+
+	runner, err := a.migrations()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := runner.Up(ctx)
+		for _, m := range applied {
+			log.Printf("Applied %s", m.ID())
+		}
+		if err == nil && len(applied) == 0 {
+			log.Printf("Database is up to date")
+		}
+		return err
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil {
+				return fmt.Errorf("steps must be a number, got %q", args[1])
+			}
+			steps = n
+		}
+		reverted, err := runner.Down(ctx, steps)
+		for _, m := range reverted {
+			log.Printf("Rolled back %s", m.ID())
+		}
+		return err
+
+	case "status":
+		statuses, err := runner.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "MODULE\tMIGRATION\tAPPLIED\tDOWN")
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = status.AppliedAt.Format("2006-01-02 15:04:05")
+				if status.Modified {
+					applied += " (modified since)"
+				}
+			}
+			down := "no"
+			if status.Down != "" {
+				down = "yes"
+			}
+			fmt.Fprintf(w, "%s\t%s_%s\t%s\t%s\n", status.Module, status.Version, status.Name, applied, down)
+		}
+		return w.Flush()
+
+	case "baseline":
+		through := ""
+		if len(args) > 1 {
+			through = args[1]
+		}
+		recorded, err := runner.Baseline(ctx, through)
+		if err != nil {
+			return err
+		}
+		for _, m := range recorded {
+			log.Printf("Recorded %s as applied", m.ID())
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown migrate command %q: use up, down [steps], status or baseline [module/version]", args[0])
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mauroue/cereja-corp/config"
+	"github.com/mauroue/cereja-corp/internal/receipts"
+)
+
+// reprocessCommand runs OCR again on the images of a range of receipts, or
+// with -parse-only only parses the units of their items again. Receipts that
+// fail are reported and skipped.
+func reprocessCommand(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := findCommand("reprocess").flags()
+	username := fs.String("user", "", "only reprocess this user's receipts")
+	fromID := fs.Int64("from", 0, "first receipt ID")
+	toID := fs.Int64("to", 0, "last receipt ID")
+	all := fs.Bool("all", false, "reprocess every receipt")
+	parseOnly := fs.Bool("parse-only", false, "parse item units again without running OCR")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *fromID == 0 && *toID == 0 && !*all {
+		return fmt.Errorf("give a range with -from and -to, or -all")
+	}
+	if *toID != 0 && *fromID > *toID {
+		return fmt.Errorf("-from %d is after -to %d", *fromID, *toID)
+	}
+
+	a, err := openApp(cfg)
+	if err != nil {
+		return err
+	}
+	defer a.close()
+
+	var userID int64
+	if *username != "" {
+		user, err := a.user(*username)
+		if err != nil {
+			return err
+		}
+		userID = user.ID
+	}
+
+	repo := receipts.NewRepository(a.db)
+	processor := receipts.NewProcessor(repo, cfg.Storage.UploadDir)
+
+	list, err := repo.ReceiptsInRange(userID, *fromID, *toID)
+	if err != nil {
+		return fmt.Errorf("failed to list receipts: %w", err)
+	}
+
+	failed := 0
+	for _, receipt := range list {
+		if ctx.Err() != nil {
+			break
+		}
+
+		if *parseOnly {
+			n, err := repo.RenormalizeItems(receipt.ID)
+			if err != nil {
+				failed++
+				log.Printf("Receipt %d: %v", receipt.ID, err)
+				continue
+			}
+			log.Printf("Receipt %d: parsed %d items", receipt.ID, n)
+			continue
+		}
+
+		items, err := processor.Reprocess(receipt)
+		if errors.Is(err, receipts.ErrOCRUnavailable) {
+			return err
+		}
+		if err != nil {
+			failed++
+			log.Printf("Receipt %d: %v", receipt.ID, err)
+			continue
+		}
+		log.Printf("Receipt %d: %s, %.2f, %d items", receipt.ID, receipt.StoreName, receipt.TotalAmount, len(items))
+	}
+
+	if err := repo.RefreshAnalytics(); err != nil {
+		log.Printf("Failed to refresh analytics: %v", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d receipts failed", failed, len(list))
+	}
+	log.Printf("Reprocessed %d receipts", len(list))
+	return nil
+}
+
+// importCommand scans every receipt image, and reads every NFC-e XML, in a
+// folder for a user, skipping other files. Files that fail are reported and
+// the rest still imported.
+func importCommand(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := findCommand("import").flags()
+	username := fs.String("user", "", "user the receipts belong to (required)")
+	currency := fs.String("currency", "", "currency of the receipts (default the base currency)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *username == "" || fs.NArg() != 1 {
+		return usageError(fs)
+	}
+	dir := fs.Arg(0)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	a, err := openApp(cfg)
+	if err != nil {
+		return err
+	}
+	defer a.close()
+
+	user, err := a.user(*username)
+	if err != nil {
+		return err
+	}
+
+	repo := receipts.NewRepository(a.db)
+	processor := receipts.NewProcessor(repo, cfg.Storage.UploadDir)
+	maxSize := int64(cfg.Upload.MaxSizeMB) << 20
+
+	imported, failed := 0, 0
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			break
+		}
+		if entry.IsDir() || !receipts.IsReceiptFile(entry.Name()) {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+
+		info, err := entry.Info()
+		if err != nil {
+			failed++
+			log.Printf("%s: %v", path, err)
+			continue
+		}
+		if info.Size() > maxSize {
+			failed++
+			log.Printf("%s: larger than the %d MB upload limit", path, cfg.Upload.MaxSizeMB)
+			continue
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			failed++
+			log.Printf("%s: %v", path, err)
+			continue
+		}
+
+		receipt, items, err := processor.Ingest(user.ID, data, entry.Name(), *currency)
+		if errors.Is(err, receipts.ErrOCRUnavailable) {
+			return err
+		}
+		if err != nil {
+			failed++
+			log.Printf("%s: %v", path, err)
+			continue
+		}
+		imported++
+		log.Printf("%s: receipt %d, %s, %.2f, %d items", path, receipt.ID, receipt.StoreName, receipt.TotalAmount, len(items))
+	}
+
+	if imported > 0 {
+		if err := repo.RefreshAnalytics(); err != nil {
+			log.Printf("Failed to refresh analytics: %v", err)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("imported %d receipts, %d files failed", imported, failed)
+	}
+	log.Printf("Imported %d receipts", imported)
+	return nil
+}
+
+// exportCommand writes a user's receipts as CSV or JSON, like the export API
+func exportCommand(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := findCommand("export").flags()
+	username := fs.String("user", "", "user whose receipts to export (required)")
+	format := fs.String("format", receipts.ExportCSV, "csv or json")
+	from := fs.String("from", "", "first purchase date, YYYY-MM-DD")
+	to := fs.String("to", "", "last purchase date, YYYY-MM-DD")
+	output := fs.String("o", "", "file to write (default standard output)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *username == "" || fs.NArg() != 0 {
+		return usageError(fs)
+	}
+	if *format != receipts.ExportCSV && *format != receipts.ExportJSON {
+		return fmt.Errorf("format must be csv or json")
+	}
+
+	filter := &receipts.ReceiptFilter{}
+	var err error
+	if filter.From, err = parseDate("from", *from, false); err != nil {
+		return err
+	}
+	if filter.To, err = parseDate("to", *to, true); err != nil {
+		return err
+	}
+
+	a, err := openApp(cfg)
+	if err != nil {
+		return err
+	}
+	defer a.close()
+
+	user, err := a.user(*username)
+	if err != nil {
+		return err
+	}
+	filter.UserID = user.ID
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	count, err := receipts.NewRepository(a.db).WriteExport(w, *format, filter, nil)
+	if err != nil {
+		return err
+	}
+	log.Printf("Exported %d receipts", count)
+	return nil
+}
+
+// parseDate parses an optional YYYY-MM-DD flag. An upper bound is moved to
+// the next day so the whole day is included.
+func parseDate(name, value string, upperBound bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("-%s must be a date (YYYY-MM-DD)", name)
+	}
+	if upperBound {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/mauroue/cereja-corp/config"
+)
+
+// serveCommand serves HTTP until signalled, then drains requests and
+// background work
+func serveCommand(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := findCommand("serve").flags()
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	a, err := openApp(cfg)
+	if err != nil {
+		return err
+	}
+	defer a.close()
+
+	if cfg.DB.AutoMigrate {
+		runner, err := a.migrations()
+		if err != nil {
+			return err
+		}
+		applied, err := runner.Up(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to migrate database: %w", err)
+		}
+		log.Printf("Applied %d migrations", len(applied))
+	}
+
+	a.srv.SetupRoutes()
+
+	if err := a.srv.Start(ctx); err != nil {
+		return fmt.Errorf("failed to start modules: %w", err)
+	}
+
+	if err := a.srv.Run(ctx, cfg.Server); err != nil {
+		return fmt.Errorf("server stopped with errors: %w", err)
+	}
+	log.Printf("Server stopped")
+	return nil
+}
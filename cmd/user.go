@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/mauroue/cereja-corp/config"
+)
+
+// userCommand manages accounts; "create" is the only action. The password is
+// read from -password-file or the first line of standard input, so it never
+// shows up in the process list or shell history.
+func userCommand(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := findCommand("user").flags()
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.Arg(0) != "create" {
+		return usageError(fs)
+	}
+
+	create := findCommand("user").flags()
+	passwordFile := create.String("password-file", "", "file holding the password (default read from standard input)")
+	if err := parseFlags(create, fs.Args()[1:]); err != nil {
+		return err
+	}
+	if create.NArg() != 1 {
+		return usageError(create)
+	}
+	username := create.Arg(0)
+
+	password, err := readPassword(*passwordFile)
+	if err != nil {
+		return err
+	}
+
+	a, err := openApp(cfg)
+	if err != nil {
+		return err
+	}
+	defer a.close()
+
+	user, err := a.srv.Users.CreateUser(username, password)
+	if err != nil {
+		return err
+	}
+	log.Printf("Created user %s (id %d)", user.Username, user.ID)
+	return nil
+}
+
+// readPassword reads the first line of the file, or of standard input when
+// path is empty
+func readPassword(path string) (string, error) {
+	in := os.Stdin
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		in = f
+	} else if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		fmt.Fprint(os.Stderr, "Password: ")
+	}
+
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,249 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// clearEnv unsets every variable the configuration reads, so that the
+// environment running the tests does not leak into them
+func clearEnv(t *testing.T) {
+	t.Helper()
+	t.Setenv(PathEnv, "")
+
+	var walk func(typ reflect.Type)
+	walk = func(typ reflect.Type) {
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			if field.Type.Kind() == reflect.Struct {
+				walk(field.Type)
+				continue
+			}
+			if name := field.Tag.Get("env"); name != "" {
+				t.Setenv(name, "")
+				t.Setenv(name+"_FILE", "")
+			}
+		}
+	}
+	walk(reflect.TypeOf(Config{}))
+}
+
+// writeFile writes a file in a test's temporary directory and returns its path
+func writeFile(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadLayers(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		data  string
+		env   map[string]string
+		check func(t *testing.T, cfg *Config)
+	}{
+		{"defaults", "config.json", `{}`, nil, func(t *testing.T, cfg *Config) {
+			if cfg.Server.Port != "8080" || cfg.DB.Host != "postgres" || cfg.Upload.MaxSizeMB != 10 || cfg.Currency.Base != "BRL" {
+				t.Errorf("defaults not applied: %+v", cfg)
+			}
+		}},
+		{"json file over defaults", "config.json", `{"server": {"port": "9090"}, "db": {"host": "db.local"}}`, nil, func(t *testing.T, cfg *Config) {
+			if cfg.Server.Port != "9090" || cfg.DB.Host != "db.local" {
+				t.Errorf("file not applied: port %q, host %q", cfg.Server.Port, cfg.DB.Host)
+			}
+			if cfg.Server.ReadTimeout != 30 || cfg.DB.Port != "5432" {
+				t.Errorf("defaults of unset keys lost: read_timeout %d, db port %q", cfg.Server.ReadTimeout, cfg.DB.Port)
+			}
+		}},
+		{"yaml file", "config.yaml", "server:\n  port: \"9191\"\nledger:\n  categories:\n    Mercado: Expenses:Food\n", nil, func(t *testing.T, cfg *Config) {
+			if cfg.Server.Port != "9191" || cfg.Ledger.Categories["Mercado"] != "Expenses:Food" {
+				t.Errorf("yaml not applied: port %q, categories %v", cfg.Server.Port, cfg.Ledger.Categories)
+			}
+		}},
+		{"empty yaml file", "config.yml", "", nil, func(t *testing.T, cfg *Config) {
+			if cfg.Server.Port != "8080" {
+				t.Errorf("port = %q, want the default", cfg.Server.Port)
+			}
+		}},
+		{"environment over file", "config.json", `{"server": {"port": "9090", "write_timeout": 10}}`, map[string]string{
+			"SERVER_PORT":             "7070",
+			"DB_AUTO_MIGRATE":         "true",
+			"LEDGER_PAYMENT_ACCOUNTS": `{"123": "Assets:Bank"}`,
+		}, func(t *testing.T, cfg *Config) {
+			if cfg.Server.Port != "7070" {
+				t.Errorf("port = %q, want the environment's", cfg.Server.Port)
+			}
+			if cfg.Server.WriteTimeout != 10 {
+				t.Errorf("write_timeout = %d, want the file's", cfg.Server.WriteTimeout)
+			}
+			if !cfg.DB.AutoMigrate || cfg.Ledger.PaymentAccounts["123"] != "Assets:Bank" {
+				t.Errorf("environment not applied: auto_migrate %v, payment accounts %v", cfg.DB.AutoMigrate, cfg.Ledger.PaymentAccounts)
+			}
+		}},
+		{"empty variables ignored", "config.json", `{"server": {"port": "9090"}}`, map[string]string{"SERVER_PORT": ""}, func(t *testing.T, cfg *Config) {
+			if cfg.Server.Port != "9090" {
+				t.Errorf("port = %q, want the file's", cfg.Server.Port)
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			path := writeFile(t, tt.file, tt.data)
+			cfg, resolved, err := load(path)
+			if err != nil {
+				t.Fatalf("load: %v", err)
+			}
+			if resolved != path {
+				t.Errorf("path = %q, want %q", resolved, path)
+			}
+			tt.check(t, cfg)
+		})
+	}
+}
+
+func TestLoadPath(t *testing.T) {
+	clearEnv(t)
+	fromEnv := writeFile(t, "env.json", `{"server": {"port": "6060"}}`)
+	t.Setenv(PathEnv, fromEnv)
+
+	cfg, resolved, err := load("")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if resolved != fromEnv || cfg.Server.Port != "6060" {
+		t.Errorf("loaded %q with port %q, want %s from %s", resolved, cfg.Server.Port, "6060", PathEnv)
+	}
+
+	explicit := writeFile(t, "explicit.json", `{"server": {"port": "6161"}}`)
+	cfg, _, err = load(explicit)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.Server.Port != "6161" {
+		t.Errorf("port = %q, want the explicit file's over %s", cfg.Server.Port, PathEnv)
+	}
+}
+
+func TestLoadSecretFiles(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("DB_PASSWORD_FILE", writeFile(t, "db_password", "s3cret\n"))
+
+	cfg, _, err := load(writeFile(t, "config.json", `{"db": {"password": "from-file"}}`))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.DB.Password != "s3cret" {
+		t.Errorf("password = %q, want the secret file's without the newline", cfg.DB.Password)
+	}
+
+	t.Setenv("DB_PASSWORD", "other")
+	if _, _, err := load(writeFile(t, "config.json", `{}`)); err == nil || !strings.Contains(err.Error(), "DB_PASSWORD_FILE") {
+		t.Errorf("load with DB_PASSWORD and DB_PASSWORD_FILE = %v, want an error naming both", err)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		data string
+		env  map[string]string
+		err  string
+	}{
+		{"unknown json key", "config.json", `{"server": {"prot": "8080"}}`, nil, "prot"},
+		{"unknown yaml key", "config.yaml", "serve:\n  port: \"8080\"\n", nil, "serve"},
+		{"unsupported format", "config.toml", `port = 8080`, nil, "unsupported config file format"},
+		{"bad number", "config.json", `{}`, map[string]string{"UPLOAD_MAX_SIZE_MB": "ten"}, "UPLOAD_MAX_SIZE_MB must be a whole number"},
+		{"bad bool", "config.json", `{}`, map[string]string{"DB_AUTO_MIGRATE": "sometimes"}, "DB_AUTO_MIGRATE must be true or false"},
+		{"bad map", "config.json", `{}`, map[string]string{"LEDGER_CATEGORIES": "Mercado=Food"}, "LEDGER_CATEGORIES must be a JSON object"},
+		{"invalid after layering", "config.json", `{"server": {"port": "8080"}}`, map[string]string{"SERVER_PORT": "99999"}, "server.port"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			_, _, err := load(writeFile(t, tt.file, tt.data))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("load() = %v, want an error mentioning %q", err, tt.err)
+			}
+		})
+	}
+
+	t.Run("missing explicit file", func(t *testing.T) {
+		clearEnv(t)
+		if _, _, err := load(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+			t.Error("load accepted a missing file")
+		}
+	})
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(cfg *Config)
+		err    string
+	}{
+		{"defaults", func(cfg *Config) {}, ""},
+		{"negative timeout", func(cfg *Config) { cfg.Server.IdleTimeout = -1 }, "server.idle_timeout"},
+		{"database url", func(cfg *Config) { cfg.DB.URL, cfg.DB.Host = "postgres://u:p@db:5432/cereja", "" }, ""},
+		{"bad database url", func(cfg *Config) { cfg.DB.URL = "mysql://db/cereja" }, "db.url"},
+		{"database url sslmode", func(cfg *Config) { cfg.DB.URL = "postgres://db/cereja?sslmode=maybe" }, `sslmode "maybe"`},
+		{"one aws key", func(cfg *Config) { cfg.OCR.AWSAccessKeyID = "AKIA" }, "AWS_SECRET_ACCESS_KEY"},
+		{"both aws keys", func(cfg *Config) { cfg.OCR.AWSAccessKeyID, cfg.OCR.AWSSecretAccessKey = "AKIA", "secret" }, ""},
+		{"base currency", func(cfg *Config) { cfg.Currency.Base = "REAL" }, "currency.base"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaults()
+			tt.modify(cfg)
+			err := cfg.Validate()
+			if tt.err == "" && err != nil {
+				t.Errorf("Validate() = %v, want no error", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("Validate() = %v, want an error mentioning %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestDSN(t *testing.T) {
+	tests := []struct {
+		name string
+		db   DBConfig
+		want string
+	}{
+		{"settings", DBConfig{Host: "db", Port: "5432", Username: "app", Password: `it's\here`, Database: "cereja", SSLMode: "disable"},
+			`host='db' port='5432' user='app' password='it\'s\\here' dbname='cereja' sslmode='disable'`},
+		{"url without sslmode", DBConfig{URL: "postgres://app:pw@db:5432/cereja", Host: "ignored", SSLMode: "require"},
+			"postgres://app:pw@db:5432/cereja?sslmode=require"},
+		{"url with sslmode", DBConfig{URL: "postgres://app:pw@db/cereja?sslmode=verify-full", SSLMode: "disable"},
+			"postgres://app:pw@db/cereja?sslmode=verify-full"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.db.DSN(); got != tt.want {
+				t.Errorf("DSN() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,2 @@
+-- Drop the tasks table
+DROP TABLE IF EXISTS tasks;
@@ -0,0 +1,2 @@
+-- Drop the notes table
+DROP TABLE IF EXISTS notes;
@@ -0,0 +1,18 @@
+-- Create notes table. Tags are stored lowercased in a text array, and a
+-- generated tsvector over the title and content backs full-text search.
+CREATE TABLE IF NOT EXISTS notes (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    title VARCHAR(255) NOT NULL,
+    content TEXT NOT NULL DEFAULT '',
+    tags TEXT[] NOT NULL DEFAULT '{}',
+    search TSVECTOR GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', title), 'A') || setweight(to_tsvector('simple', content), 'B')
+    ) STORED,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_notes_user_id ON notes(user_id, id);
+CREATE INDEX IF NOT EXISTS idx_notes_tags ON notes USING GIN (tags);
+CREATE INDEX IF NOT EXISTS idx_notes_search ON notes USING GIN (search);
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"io/fs"
+
+	"github.com/mauroue/cereja-corp/internal/server"
+)
+
+//go:embed migrations/001_create_tasks.sql migrations/001_create_tasks.down.sql
+var taskMigrations embed.FS
+
+//go:embed migrations/002_create_notes.sql migrations/002_create_notes.down.sql
+var noteMigrations embed.FS
+
+// TasksModule serves the tasks API under /api/v1/tasks
+type TasksModule struct {
+	handler *Handler
+}
+
+// NewTasksModule creates the tasks module
+func NewTasksModule(database *sql.DB) *TasksModule {
+	return &TasksModule{handler: NewHandler(NewRepository(database))}
+}
+
+// Name returns the module name
+func (m *TasksModule) Name() string { return "tasks" }
+
+// RegisterRoutes mounts the tasks API
+func (m *TasksModule) RegisterRoutes(routes server.Routes) {
+	m.handler.SetupTaskRoutes(routes.API)
+}
+
+// Migrations returns the tasks table migrations
+func (m *TasksModule) Migrations() (fs.FS, error) { return subMigrations(taskMigrations) }
+
+// MigrationsRequire returns the receipts module, whose migrations create the
+// users table tasks reference
+func (m *TasksModule) MigrationsRequire() []string { return []string{"receipts"} }
+
+// Start does nothing; tasks have no background work
+func (m *TasksModule) Start(ctx context.Context) error { return nil }
+
+// Stop does nothing; tasks have no background work
+func (m *TasksModule) Stop(ctx context.Context) error { return nil }
+
+// NotesModule serves the notes API under /api/v1/notes
+type NotesModule struct {
+	handler *Handler
+}
+
+// NewNotesModule creates the notes module
+func NewNotesModule(database *sql.DB) *NotesModule {
+	return &NotesModule{handler: NewHandler(NewRepository(database))}
+}
+
+// Name returns the module name
+func (m *NotesModule) Name() string { return "notes" }
+
+// RegisterRoutes mounts the notes API
+func (m *NotesModule) RegisterRoutes(routes server.Routes) {
+	m.handler.SetupNoteRoutes(routes.API)
+}
+
+// Migrations returns the notes table migrations
+func (m *NotesModule) Migrations() (fs.FS, error) { return subMigrations(noteMigrations) }
+
+// MigrationsRequire returns the receipts module, whose migrations create the
+// users table notes reference
+func (m *NotesModule) MigrationsRequire() []string { return []string{"receipts"} }
+
+// Start does nothing; notes have no background work
+func (m *NotesModule) Start(ctx context.Context) error { return nil }
+
+// Stop does nothing; notes have no background work
+func (m *NotesModule) Stop(ctx context.Context) error { return nil }
+
+// subMigrations roots an embedded migrations directory at its .sql files
+func subMigrations(files embed.FS) (fs.FS, error) {
+	return fs.Sub(files, "migrations")
+}
@@ -1,102 +1,300 @@
 package api
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/mauroue/cereja-corp/internal/models"
+	"github.com/lib/pq"
+	"github.com/mauroue/cereja-corp/internal/auth"
 )
 
-// Note represents a note in the system
+// maxNoteTagLength bounds a single note tag
+const maxNoteTagLength = 100
+
+// ErrInvalidNoteTag is returned for note tags that are too long
+var ErrInvalidNoteTag = errors.New("invalid tag")
+
+// Note represents a note in the system. Like task IDs, its ID is sent as a
+// string.
 type Note struct {
-	ID      string   `json:"id"`
-	Title   string   `json:"title" binding:"required"`
-	Content string   `json:"content"`
-	Tags    []string `json:"tags"`
+	UserID    int64     `json:"-"`
+	ID        int64     `json:"id,string"`
+	Title     string    `json:"title" binding:"required"`
+	Content   string    `json:"content"`
+	Tags      []string  `json:"tags"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// NoteFilter narrows a note listing. Notes must carry every tag in Tags, and
+// when Search is set they must match it and are ranked by relevance.
+type NoteFilter struct {
+	Tags   []string
+	Search string
+}
+
+// normalizeNoteTags trims, lowercases and deduplicates tags, so that tag
+// filters match regardless of case
+func normalizeNoteTags(names []string) ([]string, error) {
+	seen := make(map[string]bool)
+	tags := []string{}
+	for _, name := range names {
+		name = strings.ToLower(strings.Join(strings.Fields(name), " "))
+		if name == "" || seen[name] {
+			continue
+		}
+		if len(name) > maxNoteTagLength {
+			return nil, fmt.Errorf("%w: %q is longer than %d characters", ErrInvalidNoteTag, name, maxNoteTagLength)
+		}
+		seen[name] = true
+		tags = append(tags, name)
+	}
+	return tags, nil
+}
+
+// ListNotes returns the user's notes matching the filter, newest first, or by
+// relevance when searching
+func (r *Repository) ListNotes(ctx context.Context, userID int64, filter NoteFilter) ([]*Note, error) {
+	conditions := []string{"user_id = $1"}
+	args := []any{userID}
+	order := "id DESC"
+
+	if len(filter.Tags) > 0 {
+		args = append(args, pq.Array(filter.Tags))
+		conditions = append(conditions, fmt.Sprintf("tags @> $%d", len(args)))
+	}
+	if filter.Search != "" {
+		args = append(args, filter.Search)
+		query := fmt.Sprintf("websearch_to_tsquery('simple', $%d)", len(args))
+		conditions = append(conditions, "search @@ "+query)
+		order = fmt.Sprintf("ts_rank(search, %s) DESC, id DESC", query)
+	}
+
+	rows, err := r.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT id, user_id, title, content, tags, created_at, updated_at
+		FROM notes
+		WHERE %s
+		ORDER BY %s
+	`, strings.Join(conditions, " AND "), order), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notes := []*Note{}
+	for rows.Next() {
+		note, err := scanNote(rows)
+		if err != nil {
+			return nil, err
+		}
+		notes = append(notes, note)
+	}
+
+	return notes, rows.Err()
+}
+
+// GetNote retrieves one of the user's notes
+func (r *Repository) GetNote(ctx context.Context, userID, id int64) (*Note, error) {
+	return scanNote(r.db.QueryRowContext(ctx, `
+		SELECT id, user_id, title, content, tags, created_at, updated_at
+		FROM notes
+		WHERE id = $1 AND user_id = $2
+	`, id, userID))
+}
+
+// CreateNote stores a new note, filling in its ID and timestamps
+func (r *Repository) CreateNote(ctx context.Context, note *Note) error {
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO notes (user_id, title, content, tags)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, updated_at
+	`, note.UserID, note.Title, note.Content, pq.Array(note.Tags),
+	).Scan(&note.ID, &note.CreatedAt, &note.UpdatedAt)
+}
+
+// UpdateNote replaces a note's title, content and tags. It returns
+// sql.ErrNoRows if the user has no such note.
+func (r *Repository) UpdateNote(ctx context.Context, note *Note) error {
+	return r.db.QueryRowContext(ctx, `
+		UPDATE notes SET title = $1, content = $2, tags = $3, updated_at = NOW()
+		WHERE id = $4 AND user_id = $5
+		RETURNING created_at, updated_at
+	`, note.Title, note.Content, pq.Array(note.Tags), note.ID, note.UserID,
+	).Scan(&note.CreatedAt, &note.UpdatedAt)
+}
+
+// DeleteNote deletes one of the user's notes. It returns sql.ErrNoRows if the
+// user has no such note.
+func (r *Repository) DeleteNote(ctx context.Context, userID, id int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM notes WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
 
-// In-memory storage for notes - in a real application, use a database
-var notes = []Note{}
+// scanNote scans a note row
+func scanNote(row interface{ Scan(...any) error }) (*Note, error) {
+	var note Note
+	if err := row.Scan(
+		&note.ID,
+		&note.UserID,
+		&note.Title,
+		&note.Content,
+		pq.Array(&note.Tags),
+		&note.CreatedAt,
+		&note.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &note, nil
+}
 
 // SetupNoteRoutes configures the routes for note management
-func SetupNoteRoutes(router *gin.RouterGroup) {
-	noteRoutes := router.Group("/notes")
+func (h *Handler) SetupNoteRoutes(router *gin.RouterGroup) {
+	noteRoutes := router.Group("/notes", auth.RequireScope("notes"))
 	{
-		noteRoutes.GET("", getAllNotes)
-		noteRoutes.GET("/:id", getNoteByID)
-		noteRoutes.POST("", createNote)
-		noteRoutes.PUT("/:id", updateNote)
-		noteRoutes.DELETE("/:id", deleteNote)
+		noteRoutes.GET("", h.getAllNotes)
+		noteRoutes.GET("/:id", h.getNoteByID)
+		noteRoutes.POST("", h.createNote)
+		noteRoutes.PUT("/:id", h.updateNote)
+		noteRoutes.DELETE("/:id", h.deleteNote)
 	}
 }
 
-// getAllNotes returns all notes
-func getAllNotes(c *gin.Context) {
+// getAllNotes returns the signed-in user's notes. Repeated or comma-separated
+// tag parameters keep notes carrying all of the tags, and q runs a full-text
+// search over title and content.
+func (h *Handler) getAllNotes(c *gin.Context) {
+	var names []string
+	for _, value := range c.QueryArray("tag") {
+		names = append(names, strings.Split(value, ",")...)
+	}
+	tags, err := normalizeNoteTags(names)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter := NoteFilter{Tags: tags, Search: strings.TrimSpace(c.Query("q"))}
+	notes, err := h.repo.ListNotes(c.Request.Context(), auth.UserID(c), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve notes"})
+		return
+	}
 	c.JSON(http.StatusOK, notes)
 }
 
 // getNoteByID returns a specific note by ID
-func getNoteByID(c *gin.Context) {
-	id := c.Param("id")
+func (h *Handler) getNoteByID(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid note ID"})
+		return
+	}
 
-	for _, note := range notes {
-		if note.ID == id {
-			c.JSON(http.StatusOK, note)
+	note, err := h.repo.GetNote(c.Request.Context(), auth.UserID(c), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
 			return
 		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve note"})
+		return
 	}
 
-	c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
+	c.JSON(http.StatusOK, note)
 }
 
-// createNote creates a new note
-func createNote(c *gin.Context) {
-	var newNote Note
-	if err := c.ShouldBindJSON(&newNote); err != nil {
+// bindNote binds a note from the request body and normalizes its tags
+func bindNote(c *gin.Context) (*Note, bool) {
+	var note Note
+	if err := c.ShouldBindJSON(&note); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	tags, err := normalizeNoteTags(note.Tags)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	note.Tags = tags
+	note.UserID = auth.UserID(c)
+	return &note, true
+}
+
+// createNote creates a new note
+func (h *Handler) createNote(c *gin.Context) {
+	newNote, ok := bindNote(c)
+	if !ok {
 		return
 	}
 
-	// Generate a simple ID - in a real app, use UUID or similar
-	newNote.ID = models.GenerateID()
-	notes = append(notes, newNote)
+	if err := h.repo.CreateNote(c.Request.Context(), newNote); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create note"})
+		return
+	}
 
 	c.JSON(http.StatusCreated, newNote)
 }
 
 // updateNote updates an existing note
-func updateNote(c *gin.Context) {
-	id := c.Param("id")
-	var updatedNote Note
+func (h *Handler) updateNote(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid note ID"})
+		return
+	}
 
-	if err := c.ShouldBindJSON(&updatedNote); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	updatedNote, ok := bindNote(c)
+	if !ok {
 		return
 	}
 
-	for i, note := range notes {
-		if note.ID == id {
-			updatedNote.ID = id
-			notes[i] = updatedNote
-			c.JSON(http.StatusOK, updatedNote)
+	updatedNote.ID = id
+	if err := h.repo.UpdateNote(c.Request.Context(), updatedNote); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
 			return
 		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update note"})
+		return
 	}
 
-	c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
+	c.JSON(http.StatusOK, updatedNote)
 }
 
 // deleteNote deletes a note by ID
-func deleteNote(c *gin.Context) {
-	id := c.Param("id")
+func (h *Handler) deleteNote(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid note ID"})
+		return
+	}
 
-	for i, note := range notes {
-		if note.ID == id {
-			notes = append(notes[:i], notes[i+1:]...)
-			c.JSON(http.StatusOK, gin.H{"message": "Note deleted"})
+	if err := h.repo.DeleteNote(c.Request.Context(), auth.UserID(c), id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
 			return
 		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete note"})
+		return
 	}
 
-	c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
+	c.JSON(http.StatusOK, gin.H{"message": "Note deleted"})
 }
@@ -0,0 +1,25 @@
+package api
+
+import (
+	"database/sql"
+)
+
+// Repository handles database operations for tasks and notes
+type Repository struct {
+	db *sql.DB
+}
+
+// NewRepository creates a new task and note repository
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// Handler handles the task and note API requests
+type Handler struct {
+	repo *Repository
+}
+
+// NewHandler creates a new task and note handler
+func NewHandler(repo *Repository) *Handler {
+	return &Handler{repo: repo}
+}
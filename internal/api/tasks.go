@@ -1,102 +1,222 @@
 package api
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/mauroue/cereja-corp/internal/models"
+	"github.com/mauroue/cereja-corp/internal/auth"
 )
 
-// Task represents a task in the system
+// Task represents a task in the system. Its ID is sent as a string, as it
+// was before tasks were stored in Postgres.
 type Task struct {
-	ID          string `json:"id"`
-	Title       string `json:"title" binding:"required"`
-	Description string `json:"description"`
-	Completed   bool   `json:"completed"`
+	UserID      int64     `json:"-"`
+	ID          int64     `json:"id,string"`
+	Title       string    `json:"title" binding:"required"`
+	Description string    `json:"description"`
+	Completed   bool      `json:"completed"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
 }
 
-// In-memory storage for tasks - in a real application, use a database
-var tasks = []Task{}
+// ListTasks returns the user's tasks, oldest first
+func (r *Repository) ListTasks(ctx context.Context, userID int64) ([]*Task, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, user_id, title, description, completed, created_at, updated_at
+		FROM tasks
+		WHERE user_id = $1
+		ORDER BY id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := []*Task{}
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+
+	return tasks, rows.Err()
+}
+
+// GetTask retrieves one of the user's tasks
+func (r *Repository) GetTask(ctx context.Context, userID, id int64) (*Task, error) {
+	return scanTask(r.db.QueryRowContext(ctx, `
+		SELECT id, user_id, title, description, completed, created_at, updated_at
+		FROM tasks
+		WHERE id = $1 AND user_id = $2
+	`, id, userID))
+}
+
+// CreateTask stores a new task, filling in its ID and timestamps
+func (r *Repository) CreateTask(ctx context.Context, task *Task) error {
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO tasks (user_id, title, description, completed)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, updated_at
+	`, task.UserID, task.Title, task.Description, task.Completed,
+	).Scan(&task.ID, &task.CreatedAt, &task.UpdatedAt)
+}
+
+// UpdateTask replaces a task's title, description and completion. It returns
+// sql.ErrNoRows if the user has no such task.
+func (r *Repository) UpdateTask(ctx context.Context, task *Task) error {
+	return r.db.QueryRowContext(ctx, `
+		UPDATE tasks SET title = $1, description = $2, completed = $3, updated_at = NOW()
+		WHERE id = $4 AND user_id = $5
+		RETURNING created_at, updated_at
+	`, task.Title, task.Description, task.Completed, task.ID, task.UserID,
+	).Scan(&task.CreatedAt, &task.UpdatedAt)
+}
+
+// DeleteTask deletes one of the user's tasks. It returns sql.ErrNoRows if the
+// user has no such task.
+func (r *Repository) DeleteTask(ctx context.Context, userID, id int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM tasks WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// scanTask scans a task row
+func scanTask(row interface{ Scan(...any) error }) (*Task, error) {
+	var task Task
+	if err := row.Scan(
+		&task.ID,
+		&task.UserID,
+		&task.Title,
+		&task.Description,
+		&task.Completed,
+		&task.CreatedAt,
+		&task.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
 
 // SetupTaskRoutes configures the routes for task management
-func SetupTaskRoutes(router *gin.RouterGroup) {
-	taskRoutes := router.Group("/tasks")
+func (h *Handler) SetupTaskRoutes(router *gin.RouterGroup) {
+	taskRoutes := router.Group("/tasks", auth.RequireScope("tasks"))
 	{
-		taskRoutes.GET("", getAllTasks)
-		taskRoutes.GET("/:id", getTaskByID)
-		taskRoutes.POST("", createTask)
-		taskRoutes.PUT("/:id", updateTask)
-		taskRoutes.DELETE("/:id", deleteTask)
+		taskRoutes.GET("", h.getAllTasks)
+		taskRoutes.GET("/:id", h.getTaskByID)
+		taskRoutes.POST("", h.createTask)
+		taskRoutes.PUT("/:id", h.updateTask)
+		taskRoutes.DELETE("/:id", h.deleteTask)
 	}
 }
 
-// getAllTasks returns all tasks
-func getAllTasks(c *gin.Context) {
+// getAllTasks returns the signed-in user's tasks
+func (h *Handler) getAllTasks(c *gin.Context) {
+	tasks, err := h.repo.ListTasks(c.Request.Context(), auth.UserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve tasks"})
+		return
+	}
 	c.JSON(http.StatusOK, tasks)
 }
 
 // getTaskByID returns a specific task by ID
-func getTaskByID(c *gin.Context) {
-	id := c.Param("id")
+func (h *Handler) getTaskByID(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return
+	}
 
-	for _, task := range tasks {
-		if task.ID == id {
-			c.JSON(http.StatusOK, task)
+	task, err := h.repo.GetTask(c.Request.Context(), auth.UserID(c), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
 			return
 		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve task"})
+		return
 	}
 
-	c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+	c.JSON(http.StatusOK, task)
 }
 
 // createTask creates a new task
-func createTask(c *gin.Context) {
+func (h *Handler) createTask(c *gin.Context) {
 	var newTask Task
 	if err := c.ShouldBindJSON(&newTask); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Generate a simple ID - in a real app, use UUID or similar
-	newTask.ID = models.GenerateID()
-	tasks = append(tasks, newTask)
+	newTask.UserID = auth.UserID(c)
+	if err := h.repo.CreateTask(c.Request.Context(), &newTask); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create task"})
+		return
+	}
 
 	c.JSON(http.StatusCreated, newTask)
 }
 
 // updateTask updates an existing task
-func updateTask(c *gin.Context) {
-	id := c.Param("id")
-	var updatedTask Task
+func (h *Handler) updateTask(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return
+	}
 
+	var updatedTask Task
 	if err := c.ShouldBindJSON(&updatedTask); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	for i, task := range tasks {
-		if task.ID == id {
-			updatedTask.ID = id
-			tasks[i] = updatedTask
-			c.JSON(http.StatusOK, updatedTask)
+	updatedTask.ID = id
+	updatedTask.UserID = auth.UserID(c)
+	if err := h.repo.UpdateTask(c.Request.Context(), &updatedTask); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
 			return
 		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update task"})
+		return
 	}
 
-	c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+	c.JSON(http.StatusOK, updatedTask)
 }
 
 // deleteTask deletes a task by ID
-func deleteTask(c *gin.Context) {
-	id := c.Param("id")
+func (h *Handler) deleteTask(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return
+	}
 
-	for i, task := range tasks {
-		if task.ID == id {
-			tasks = append(tasks[:i], tasks[i+1:]...)
-			c.JSON(http.StatusOK, gin.H{"message": "Task deleted"})
+	if err := h.repo.DeleteTask(c.Request.Context(), auth.UserID(c), id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
 			return
 		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete task"})
+		return
 	}
 
-	c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+	c.JSON(http.StatusOK, gin.H{"message": "Task deleted"})
 }
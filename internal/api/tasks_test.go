@@ -0,0 +1,129 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeRow scans fixed values, like a single database row
+type fakeRow struct {
+	values []any
+	err    error
+}
+
+func (r fakeRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	for i, d := range dest {
+		reflect.ValueOf(d).Elem().Set(reflect.ValueOf(r.values[i]))
+	}
+	return nil
+}
+
+func TestScanTask(t *testing.T) {
+	created := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	updated := created.Add(time.Hour)
+
+	task, err := scanTask(fakeRow{values: []any{int64(7), int64(2), "Buy milk", "2 litres", true, created, updated}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := &Task{ID: 7, UserID: 2, Title: "Buy milk", Description: "2 litres", Completed: true, CreatedAt: created, UpdatedAt: updated}
+	if !reflect.DeepEqual(task, want) {
+		t.Errorf("scanTask() = %+v, want %+v", task, want)
+	}
+
+	scanErr := errors.New("scan failed")
+	if task, err := scanTask(fakeRow{err: scanErr}); !errors.Is(err, scanErr) || task != nil {
+		t.Errorf("scanTask() = %v, %v, want nil, %v", task, err, scanErr)
+	}
+}
+
+func TestTaskJSON(t *testing.T) {
+	data, err := json.Marshal(Task{UserID: 2, ID: 7, Title: "Buy milk"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(data), `"id":"7"`) {
+		t.Errorf("task ID should be sent as a string, got %s", data)
+	}
+	if strings.Contains(string(data), "user_id") || strings.Contains(string(data), "UserID") {
+		t.Errorf("task owner should not be sent, got %s", data)
+	}
+
+	var task Task
+	if err := json.Unmarshal([]byte(`{"id":"12","title":"Call"}`), &task); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if task.ID != 12 || task.Title != "Call" {
+		t.Errorf("decoded task = %+v, want ID 12 titled Call", task)
+	}
+}
+
+func TestTaskHandlersRejectBadRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := NewHandler(nil)
+
+	tests := []struct {
+		name    string
+		handler gin.HandlerFunc
+		method  string
+		id      string
+		body    string
+	}{
+		{"get with a non-numeric ID", h.getTaskByID, http.MethodGet, "abc", ""},
+		{"update with a non-numeric ID", h.updateTask, http.MethodPut, "abc", `{"title":"x"}`},
+		{"update without a title", h.updateTask, http.MethodPut, "1", `{"description":"x"}`},
+		{"delete with a non-numeric ID", h.deleteTask, http.MethodDelete, "1.5", ""},
+		{"create without a title", h.createTask, http.MethodPost, "", `{"description":"x"}`},
+		{"create with malformed JSON", h.createTask, http.MethodPost, "", `{"title":`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(tt.method, "/api/v1/tasks", strings.NewReader(tt.body))
+			c.Request.Header.Set("Content-Type", "application/json")
+			if tt.id != "" {
+				c.Params = gin.Params{{Key: "id", Value: tt.id}}
+			}
+
+			tt.handler(c)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func TestTasksModuleMigrations(t *testing.T) {
+	m := NewTasksModule(nil)
+
+	migrations, err := m.Migrations()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	names, err := fs.Glob(migrations, "*.sql")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"001_create_tasks.down.sql", "001_create_tasks.sql"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("migrations = %q, want %q", names, want)
+	}
+	if got := m.MigrationsRequire(); !reflect.DeepEqual(got, []string{"receipts"}) {
+		t.Errorf("MigrationsRequire() = %q, want the receipts module", got)
+	}
+}
@@ -0,0 +1,256 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mauroue/cereja-corp/internal/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// SessionTTL is how long a login session lasts
+const SessionTTL = 30 * 24 * time.Hour
+
+// MinPasswordLength is the shortest password accepted for new accounts
+const MinPasswordLength = 8
+
+var (
+	// ErrInvalidCredentials is returned when the username or password is wrong
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	// ErrUsernameTaken is returned when creating a user whose username already exists
+	ErrUsernameTaken = errors.New("username is already taken")
+	// ErrSetupDone is returned when creating the first account once one exists
+	ErrSetupDone = errors.New("an account already exists")
+)
+
+// Repository handles database operations for users and sessions
+type Repository struct {
+	db *sql.DB
+}
+
+// NewRepository creates a new user repository
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// ValidateCredentials checks a new username and password
+func ValidateCredentials(username, password string) error {
+	if strings.TrimSpace(username) == "" {
+		return errors.New("username is required")
+	}
+	if len(password) < MinPasswordLength {
+		return errors.New("password must be at least 8 characters")
+	}
+	// bcrypt ignores everything past 72 bytes
+	if len(password) > 72 {
+		return errors.New("password must be at most 72 bytes")
+	}
+	return nil
+}
+
+// CountUsers returns the number of user accounts
+func (r *Repository) CountUsers() (int, error) {
+	var count int
+	err := r.db.QueryRow(`SELECT COUNT(*) FROM users`).Scan(&count)
+	return count, err
+}
+
+// CreateUser creates an account with a bcrypt hash of the password. The first
+// account created takes ownership of the data recorded before users existed.
+func (r *Repository) CreateUser(username, password string) (*models.User, error) {
+	return r.createUser(username, password, false)
+}
+
+// CreateFirstUser creates the first account like CreateUser, returning
+// ErrSetupDone if any account already exists
+func (r *Repository) CreateFirstUser(username, password string) (*models.User, error) {
+	return r.createUser(username, password, true)
+}
+
+// createUser creates an account, only while there are none if firstOnly is set
+func (r *Repository) createUser(username, password string, firstOnly bool) (*models.User, error) {
+	username = strings.TrimSpace(username)
+	if err := ValidateCredentials(username, password); err != nil {
+		return nil, err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Serialize account creation so only one account can be the first
+	if _, err := tx.Exec(`LOCK TABLE users IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		return nil, err
+	}
+
+	var existing int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM users`).Scan(&existing); err != nil {
+		return nil, err
+	}
+	if firstOnly && existing > 0 {
+		return nil, ErrSetupDone
+	}
+
+	user := &models.User{Username: username, PasswordHash: string(hash)}
+	err = tx.QueryRow(`
+		INSERT INTO users (username, password_hash)
+		VALUES ($1, $2)
+		RETURNING id, created_at, updated_at
+	`, user.Username, user.PasswordHash).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return nil, ErrUsernameTaken
+		}
+		return nil, err
+	}
+
+	if existing == 0 {
+		for _, table := range ownedTables {
+			if _, err := tx.Exec(`UPDATE `+table+` SET user_id = $1 WHERE user_id IS NULL`, user.ID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// ownedTables are the tables with a user_id column, claimed by the first account
+var ownedTables = []string{"stores", "categories", "tags", "receipts", "budgets", "import_batches", "transactions", "ledger_exports", "exchange_rates"}
+
+// GetUser retrieves a user by ID
+func (r *Repository) GetUser(id int64) (*models.User, error) {
+	return r.scanUser(r.db.QueryRow(`
+		SELECT id, username, password_hash, created_at, updated_at
+		FROM users
+		WHERE id = $1
+	`, id))
+}
+
+// GetUserByUsername retrieves a user by username, ignoring case
+func (r *Repository) GetUserByUsername(username string) (*models.User, error) {
+	return r.scanUser(r.db.QueryRow(`
+		SELECT id, username, password_hash, created_at, updated_at
+		FROM users
+		WHERE LOWER(username) = LOWER($1)
+	`, strings.TrimSpace(username)))
+}
+
+// Authenticate returns the user with the given username and password
+func (r *Repository) Authenticate(username, password string) (*models.User, error) {
+	user, err := r.scanUser(r.db.QueryRow(`
+		SELECT id, username, password_hash, created_at, updated_at
+		FROM users
+		WHERE LOWER(username) = LOWER($1)
+	`, strings.TrimSpace(username)))
+	if errors.Is(err, sql.ErrNoRows) {
+		// Compare anyway so unknown usernames take as long as wrong passwords
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// dummyHash is compared against when a login names an unknown user
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("cereja-dummy-password"), bcrypt.DefaultCost)
+
+// SetPassword replaces a user's password
+func (r *Repository) SetPassword(userID int64, password string) error {
+	if len(password) < MinPasswordLength || len(password) > 72 {
+		return errors.New("password must be between 8 and 72 bytes")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.db.Exec(`UPDATE users SET password_hash = $1, updated_at = NOW() WHERE id = $2`, string(hash), userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	// Changing the password signs out every session
+	_, err = r.db.Exec(`DELETE FROM sessions WHERE user_id = $1`, userID)
+	return err
+}
+
+func (r *Repository) scanUser(row *sql.Row) (*models.User, error) {
+	var user models.User
+	if err := row.Scan(&user.ID, &user.Username, &user.PasswordHash, &user.CreatedAt, &user.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// hashToken returns the hex SHA-256 of a token. Only hashes are stored, so a
+// leaked sessions table cannot be used to sign in.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateSession starts a session for the user and returns its token
+func (r *Repository) CreateSession(userID int64) (string, time.Time, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", time.Time{}, err
+	}
+	token := hex.EncodeToString(buf)
+	expires := time.Now().Add(SessionTTL)
+
+	_, err := r.db.Exec(`
+		INSERT INTO sessions (token_hash, user_id, expires_at)
+		VALUES ($1, $2, $3)
+	`, hashToken(token), userID, expires)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expires, nil
+}
+
+// SessionUser returns the user of an unexpired session
+func (r *Repository) SessionUser(token string) (*models.User, error) {
+	return r.scanUser(r.db.QueryRow(`
+		SELECT u.id, u.username, u.password_hash, u.created_at, u.updated_at
+		FROM sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.token_hash = $1 AND s.expires_at > NOW()
+	`, hashToken(token)))
+}
+
+// DeleteSession ends a session, along with any expired ones
+func (r *Repository) DeleteSession(token string) error {
+	_, err := r.db.Exec(`DELETE FROM sessions WHERE token_hash = $1 OR expires_at <= NOW()`, hashToken(token))
+	return err
+}
@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mauroue/cereja-corp/internal/models"
+)
+
+// SessionCookie is the name of the cookie holding the session token
+const SessionCookie = "cereja_session"
+
+// LoginPath is where the web UI sends anonymous visitors
+const LoginPath = "/login"
+
+// userKey is the gin context key of the signed-in user
+const userKey = "user"
+
+// scopesKey is the gin context key of the scopes of the request's API token.
+// It is unset for session requests, which may use every scope.
+const scopesKey = "token_scopes"
+
+// Middleware loads the user of the session cookie, if any, into the request context
+func Middleware(repo *Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token, err := c.Cookie(SessionCookie); err == nil && token != "" {
+			if user, err := repo.SessionUser(token); err == nil {
+				c.Set(userKey, user)
+			}
+		}
+		c.Next()
+	}
+}
+
+// APIMiddleware authenticates JSON API requests with an "Authorization: Bearer"
+// personal API token, falling back to the session cookie. Requests with an
+// invalid token are rejected rather than treated as anonymous.
+func APIMiddleware(repo *Repository) gin.HandlerFunc {
+	session := Middleware(repo)
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if header == "" {
+			session(c)
+			return
+		}
+
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok || strings.TrimSpace(token) == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization header must be a Bearer token"})
+			return
+		}
+
+		user, scopes, err := repo.TokenUser(strings.TrimSpace(token))
+		if err != nil {
+			if errors.Is(err, ErrInvalidToken) {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check token"})
+			return
+		}
+
+		c.Set(userKey, user)
+		c.Set(scopesKey, scopes)
+		c.Next()
+	}
+}
+
+// RequireScope rejects token requests whose token lacks the resource's read
+// scope, or its write scope for anything other than GET and HEAD
+func RequireScope(resource string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, ok := c.Get(scopesKey)
+		if !ok {
+			c.Next()
+			return
+		}
+
+		scopes, _ := value.([]string)
+		write := c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead
+		if !HasScope(scopes, resource, write) {
+			needed := resource + ":read"
+			if write {
+				needed = resource + ":write"
+			}
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Token lacks the " + needed + " scope"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireUser rejects JSON API requests without a signed-in user
+func RequireUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if CurrentUser(c) == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireWebUser sends web requests without a signed-in user to the login page.
+// HTMX requests are redirected with HX-Redirect so the whole page changes.
+func RequireWebUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if CurrentUser(c) != nil {
+			c.Next()
+			return
+		}
+
+		target := LoginPath
+		if c.Request.Method == http.MethodGet && c.GetHeader("HX-Request") == "" {
+			target += "?next=" + url.QueryEscape(c.Request.URL.RequestURI())
+		}
+		if c.GetHeader("HX-Request") != "" {
+			c.Header("HX-Redirect", target)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Redirect(http.StatusSeeOther, target)
+		c.Abort()
+	}
+}
+
+// CurrentUser returns the signed-in user, or nil
+func CurrentUser(c *gin.Context) *models.User {
+	if value, ok := c.Get(userKey); ok {
+		if user, ok := value.(*models.User); ok {
+			return user
+		}
+	}
+	return nil
+}
+
+// UserID returns the ID of the signed-in user, or 0, which owns nothing
+func UserID(c *gin.Context) int64 {
+	if user := CurrentUser(c); user != nil {
+		return user.ID
+	}
+	return 0
+}
+
+// SafeRedirect returns next if it is a local path, so login cannot be used to
+// send users to another site
+func SafeRedirect(next, fallback string) string {
+	if next == "" || !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return fallback
+	}
+	return next
+}
@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mauroue/cereja-corp/internal/models"
+)
+
+// TokenPrefix starts every personal API token so leaked tokens are easy to spot
+const TokenPrefix = "cereja_"
+
+// Scopes a token can be granted. A resource's "*" scope grants both reading
+// and writing.
+const (
+	ScopeReceiptsRead  = "receipts:read"
+	ScopeReceiptsWrite = "receipts:write"
+	ScopeReceiptsAll   = "receipts:*"
+	ScopeTasksRead     = "tasks:read"
+	ScopeTasksWrite    = "tasks:write"
+	ScopeTasksAll      = "tasks:*"
+	ScopeNotesRead     = "notes:read"
+	ScopeNotesWrite    = "notes:write"
+	ScopeNotesAll      = "notes:*"
+)
+
+// Scopes lists every valid scope
+var Scopes = []string{
+	ScopeReceiptsRead, ScopeReceiptsWrite, ScopeReceiptsAll,
+	ScopeTasksRead, ScopeTasksWrite, ScopeTasksAll,
+	ScopeNotesRead, ScopeNotesWrite, ScopeNotesAll,
+}
+
+// ErrInvalidToken is returned for unknown, revoked or expired tokens
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// ValidateScopes checks that scopes is a non-empty list of known scopes
+func ValidateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return errors.New("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		known := false
+		for _, valid := range Scopes {
+			if scope == valid {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+	return nil
+}
+
+// HasScope reports whether the granted scopes allow access to resource, reading
+// if write is false
+func HasScope(granted []string, resource string, write bool) bool {
+	wanted := resource + ":read"
+	if write {
+		wanted = resource + ":write"
+	}
+	for _, scope := range granted {
+		if scope == wanted || scope == resource+":*" {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateToken creates a personal API token and returns it along with its
+// record. Only the token's hash is stored, so it cannot be shown again.
+func (r *Repository) CreateToken(userID int64, name string, scopes []string, expiresAt *time.Time) (string, *models.APIToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", nil, errors.New("name is required")
+	}
+	if err := ValidateScopes(scopes); err != nil {
+		return "", nil, err
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, err
+	}
+	secret := hex.EncodeToString(buf)
+	token := TokenPrefix + secret
+
+	apiToken := &models.APIToken{
+		Name:      name,
+		Prefix:    TokenPrefix + secret[:8],
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}
+	err := r.db.QueryRow(`
+		INSERT INTO api_tokens (user_id, name, token_hash, prefix, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`, userID, apiToken.Name, hashToken(token), apiToken.Prefix, pq.Array(apiToken.Scopes), apiToken.ExpiresAt,
+	).Scan(&apiToken.ID, &apiToken.CreatedAt)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, apiToken, nil
+}
+
+// ListTokens returns a user's tokens, newest first
+func (r *Repository) ListTokens(userID int64) ([]*models.APIToken, error) {
+	rows, err := r.db.Query(`
+		SELECT id, name, prefix, scopes, expires_at, last_used_at, revoked_at, created_at
+		FROM api_tokens
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []*models.APIToken
+	for rows.Next() {
+		var token models.APIToken
+		if err := rows.Scan(
+			&token.ID,
+			&token.Name,
+			&token.Prefix,
+			pq.Array(&token.Scopes),
+			&token.ExpiresAt,
+			&token.LastUsedAt,
+			&token.RevokedAt,
+			&token.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, &token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// RevokeToken revokes one of the user's tokens. It returns sql.ErrNoRows if
+// the user has no such active token.
+func (r *Repository) RevokeToken(userID, id int64) error {
+	result, err := r.db.Exec(`
+		UPDATE api_tokens SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`, id, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// TokenUser returns the owner and scopes of an active token and records that
+// it was used
+func (r *Repository) TokenUser(token string) (*models.User, []string, error) {
+	var user models.User
+	var scopes []string
+	err := r.db.QueryRow(`
+		WITH used AS (
+			UPDATE api_tokens SET last_used_at = NOW()
+			WHERE token_hash = $1
+			  AND revoked_at IS NULL
+			  AND (expires_at IS NULL OR expires_at > NOW())
+			RETURNING user_id, scopes
+		)
+		SELECT u.id, u.username, u.password_hash, u.created_at, u.updated_at, used.scopes
+		FROM used
+		JOIN users u ON u.id = used.user_id
+	`, hashToken(token)).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.CreatedAt, &user.UpdatedAt, pq.Array(&scopes))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return &user, scopes, nil
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHasScope(t *testing.T) {
+	tests := []struct {
+		name     string
+		granted  []string
+		resource string
+		write    bool
+		want     bool
+	}{
+		{"read with read", []string{ScopeReceiptsRead}, "receipts", false, true},
+		{"write with read", []string{ScopeReceiptsRead}, "receipts", true, false},
+		{"write with write", []string{ScopeReceiptsWrite}, "receipts", true, true},
+		{"write does not imply read", []string{ScopeReceiptsWrite}, "receipts", false, false},
+		{"all reads", []string{ScopeReceiptsAll}, "receipts", false, true},
+		{"all writes", []string{ScopeReceiptsAll}, "receipts", true, true},
+		{"other resource", []string{ScopeTasksAll, ScopeNotesRead}, "receipts", false, false},
+		{"one of several", []string{ScopeTasksRead, ScopeNotesWrite}, "notes", true, true},
+		{"resource prefix", []string{"receipts-archive:read"}, "receipts", false, false},
+		{"none", nil, "tasks", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HasScope(tt.granted, tt.resource, tt.write); got != tt.want {
+				t.Errorf("HasScope(%q, %q, %v) = %v, want %v", tt.granted, tt.resource, tt.write, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateScopes(t *testing.T) {
+	tests := []struct {
+		name   string
+		scopes []string
+		ok     bool
+	}{
+		{"one", []string{ScopeTasksRead}, true},
+		{"every scope", Scopes, true},
+		{"empty", nil, false},
+		{"unknown", []string{ScopeNotesRead, "notes:delete"}, false},
+		{"wildcard resource", []string{"*:read"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateScopes(tt.scopes); (err == nil) != tt.ok {
+				t.Errorf("ValidateScopes(%q) = %v, want ok = %v", tt.scopes, err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		scopes []string
+		method string
+		status int
+	}{
+		{"session", nil, http.MethodDelete, http.StatusOK},
+		{"token reading", []string{ScopeTasksRead}, http.MethodGet, http.StatusOK},
+		{"token head", []string{ScopeTasksRead}, http.MethodHead, http.StatusOK},
+		{"token writing without write", []string{ScopeTasksRead}, http.MethodPost, http.StatusForbidden},
+		{"token writing", []string{ScopeTasksWrite}, http.MethodPut, http.StatusOK},
+		{"token for another resource", []string{ScopeNotesAll}, http.MethodGet, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				if tt.scopes != nil {
+					c.Set(scopesKey, tt.scopes)
+				}
+			})
+			router.Handle(tt.method, "/tasks", RequireScope("tasks"), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(tt.method, "/tasks", nil))
+			if w.Code != tt.status {
+				t.Errorf("%s /tasks = %d, want %d", tt.method, w.Code, tt.status)
+			}
+		})
+	}
+}
@@ -2,7 +2,6 @@ package db
 
 import (
 	"database/sql"
-	"fmt"
 	"log"
 	"sync"
 
@@ -21,15 +20,11 @@ func Connect() (*sql.DB, error) {
 
 	dbOnce.Do(func() {
 		cfg := config.Get()
-		connStr := fmt.Sprintf(
-			"host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-			cfg.DB.Host, cfg.DB.Port, cfg.DB.Username, cfg.DB.Password, cfg.DB.Database,
-		)
 
-		// Log the connection string for debugging
-		log.Printf("Connecting to database with: host=%s port=%s dbname=%s", cfg.DB.Host, cfg.DB.Port, cfg.DB.Database)
+		// Log the target without credentials for debugging
+		log.Printf("Connecting to database with: %s", cfg.DB.Target())
 
-		db, err = sql.Open("postgres", connStr)
+		db, err = sql.Open("postgres", cfg.DB.DSN())
 		if err != nil {
 			return
 		}
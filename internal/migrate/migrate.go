@@ -0,0 +1,429 @@
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// lockKey identifies the advisory lock held while migrating, so that app
+// instances starting together don't apply the same migration twice
+const lockKey int64 = 0x63657265_6a61 // "cereja"
+
+// downSuffix marks the file rolling back a migration
+const downSuffix = ".down.sql"
+
+// ErrChecksumMismatch is returned when an applied migration's file has
+// changed since it was applied
+var ErrChecksumMismatch = errors.New("migration changed after it was applied")
+
+// ErrIrreversible is returned when rolling back a migration without a down file
+var ErrIrreversible = errors.New("migration has no down migration")
+
+// ErrHistoryExists is returned when baselining a database that already
+// records applied migrations
+var ErrHistoryExists = errors.New("schema_migrations already records migrations")
+
+// Source is the migrations of one module: the files NNN_name.sql at the root
+// of Files, applied in version order. A migration can be rolled back if a
+// matching NNN_name.down.sql exists.
+type Source struct {
+	Module string
+	Files  fs.FS
+	// Requires names the modules whose migrations must be applied first,
+	// e.g. because this module's tables reference theirs
+	Requires []string
+}
+
+// Migration is a single migration of a module
+type Migration struct {
+	Module   string
+	Version  string
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// ID identifies the migration in logs, e.g. receipts/016_add_item_tags_and_notes
+func (m *Migration) ID() string {
+	return m.Module + "/" + m.Version + "_" + m.Name
+}
+
+// Status is a migration with its state in the database
+type Status struct {
+	*Migration
+	AppliedAt *time.Time
+	// Modified is set when the file no longer matches the applied checksum
+	Modified bool
+}
+
+// Runner applies and rolls back migrations
+type Runner struct {
+	db         *sql.DB
+	migrations []*Migration
+}
+
+// New discovers the migrations of the sources. Sources are migrated in the
+// order given, so a module's tables may reference those of the modules before
+// it; New fails if a source comes before a module it requires.
+func New(db *sql.DB, sources ...Source) (*Runner, error) {
+	r := &Runner{db: db}
+	seen := make(map[string]bool, len(sources))
+	for _, source := range sources {
+		for _, required := range source.Requires {
+			if !seen[required] {
+				return nil, fmt.Errorf("%s migrations require the %s migrations, which must come first", source.Module, required)
+			}
+		}
+		seen[source.Module] = true
+
+		migrations, err := discover(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s migrations: %w", source.Module, err)
+		}
+		r.migrations = append(r.migrations, migrations...)
+	}
+	return r, nil
+}
+
+// discover reads a module's migrations, sorted by version
+func discover(source Source) ([]*Migration, error) {
+	if source.Files == nil {
+		return nil, nil
+	}
+
+	names, err := fs.Glob(source.Files, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[string]*Migration)
+	downs := make(map[string]string)
+	for _, name := range names {
+		data, err := fs.ReadFile(source.Files, name)
+		if err != nil {
+			return nil, err
+		}
+
+		base, isDown := strings.CutSuffix(name, downSuffix)
+		if !isDown {
+			base = strings.TrimSuffix(name, path.Ext(name))
+		}
+		version, label, ok := strings.Cut(base, "_")
+		if !ok || version == "" || strings.Trim(version, "0123456789") != "" {
+			return nil, fmt.Errorf("%s: migration files must be named NNN_name.sql", name)
+		}
+
+		if isDown {
+			downs[version] = string(data)
+			continue
+		}
+		if existing, ok := byVersion[version]; ok {
+			return nil, fmt.Errorf("%s: version %s is also used by %s", name, version, existing.Name)
+		}
+		sum := sha256.Sum256(data)
+		byVersion[version] = &Migration{
+			Module:   source.Module,
+			Version:  version,
+			Name:     label,
+			Up:       string(data),
+			Checksum: hex.EncodeToString(sum[:]),
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for version, down := range downs {
+		m, ok := byVersion[version]
+		if !ok {
+			return nil, fmt.Errorf("down migration %s has no up migration", version)
+		}
+		m.Down = down
+	}
+	for _, m := range byVersion {
+		migrations = append(migrations, m)
+	}
+	// Versions are numeric, so a shorter one sorts first
+	sort.Slice(migrations, func(i, j int) bool {
+		a, b := strings.TrimLeft(migrations[i].Version, "0"), strings.TrimLeft(migrations[j].Version, "0")
+		if len(a) != len(b) {
+			return len(a) < len(b)
+		}
+		return a < b
+	})
+	return migrations, nil
+}
+
+// applied is the record of an applied migration
+type applied struct {
+	checksum  string
+	appliedAt time.Time
+}
+
+// withLock runs fn on a single connection holding the migration lock, after
+// making sure schema_migrations exists
+func (r *Runner) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockKey); err != nil {
+		return fmt.Errorf("failed to take the migration lock: %w", err)
+	}
+	defer func() {
+		// The lock is released with the session anyway if this fails
+		if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockKey); err != nil {
+			log.Printf("Failed to release the migration lock: %v", err)
+		}
+	}()
+
+	if _, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			id SERIAL PRIMARY KEY,
+			module VARCHAR(100) NOT NULL,
+			version VARCHAR(20) NOT NULL,
+			name VARCHAR(255) NOT NULL,
+			checksum CHAR(64) NOT NULL,
+			applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			UNIQUE (module, version)
+		)
+	`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	return fn(conn)
+}
+
+// loadApplied returns the applied migrations, keyed by module and version
+func loadApplied(ctx context.Context, conn *sql.Conn) (map[string]applied, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT module, version, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := make(map[string]applied)
+	for rows.Next() {
+		var module, version string
+		var record applied
+		if err := rows.Scan(&module, &version, &record.checksum, &record.appliedAt); err != nil {
+			return nil, err
+		}
+		records[module+"/"+version] = record
+	}
+	return records, rows.Err()
+}
+
+// Up applies every pending migration in order, each in its own transaction,
+// and returns the ones applied. It refuses to run if an applied migration's
+// file has changed.
+func (r *Runner) Up(ctx context.Context) ([]*Migration, error) {
+	var done []*Migration
+	err := r.withLock(ctx, func(conn *sql.Conn) error {
+		records, err := loadApplied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		var pending []*Migration
+		for _, m := range r.migrations {
+			record, ok := records[m.Module+"/"+m.Version]
+			if !ok {
+				pending = append(pending, m)
+			} else if record.checksum != m.Checksum {
+				return fmt.Errorf("%w: %s", ErrChecksumMismatch, m.ID())
+			}
+		}
+
+		for _, m := range pending {
+			if err := r.apply(ctx, conn, m); err != nil {
+				return err
+			}
+			done = append(done, m)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// apply runs a migration and records it
+func (r *Runner) apply(ctx context.Context, conn *sql.Conn, m *Migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, m.Up); err != nil {
+		return fmt.Errorf("failed to apply %s: %w", m.ID(), err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO schema_migrations (module, version, name, checksum) VALUES ($1, $2, $3, $4)
+	`, m.Module, m.Version, m.Name, m.Checksum); err != nil {
+		return fmt.Errorf("failed to record %s: %w", m.ID(), err)
+	}
+	return tx.Commit()
+}
+
+// Down rolls back the last steps applied migrations, most recent first, and
+// returns the ones rolled back. Nothing is rolled back if any of them has no
+// down migration.
+func (r *Runner) Down(ctx context.Context, steps int) ([]*Migration, error) {
+	if steps < 1 {
+		return nil, fmt.Errorf("steps must be at least 1, got %d", steps)
+	}
+
+	known := make(map[string]*Migration, len(r.migrations))
+	for _, m := range r.migrations {
+		known[m.Module+"/"+m.Version] = m
+	}
+
+	var done []*Migration
+	err := r.withLock(ctx, func(conn *sql.Conn) error {
+		rows, err := conn.QueryContext(ctx, `
+			SELECT module, version, name FROM schema_migrations ORDER BY id DESC LIMIT $1
+		`, steps)
+		if err != nil {
+			return err
+		}
+
+		var targets []*Migration
+		for rows.Next() {
+			var module, version, name string
+			if err := rows.Scan(&module, &version, &name); err != nil {
+				rows.Close()
+				return err
+			}
+			m, ok := known[module+"/"+version]
+			if !ok {
+				rows.Close()
+				return fmt.Errorf("%s/%s_%s is applied but no longer exists", module, version, name)
+			}
+			if m.Down == "" {
+				rows.Close()
+				return fmt.Errorf("%w: %s", ErrIrreversible, m.ID())
+			}
+			targets = append(targets, m)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, m := range targets {
+			if err := r.revert(ctx, conn, m); err != nil {
+				return err
+			}
+			done = append(done, m)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// revert runs a migration's down file and removes its record
+func (r *Runner) revert(ctx context.Context, conn *sql.Conn, m *Migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, m.Down); err != nil {
+		return fmt.Errorf("failed to roll back %s: %w", m.ID(), err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM schema_migrations WHERE module = $1 AND version = $2
+	`, m.Module, m.Version); err != nil {
+		return fmt.Errorf("failed to unrecord %s: %w", m.ID(), err)
+	}
+	return tx.Commit()
+}
+
+// Baseline records migrations as applied without running them, adopting a
+// database whose schema was set up by hand: every migration, or those up to
+// and including through (module/version, e.g. receipts/011). It refuses to
+// touch a database that already records any migration.
+func (r *Runner) Baseline(ctx context.Context, through string) ([]*Migration, error) {
+	targets, err := r.upTo(through)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.withLock(ctx, func(conn *sql.Conn) error {
+		var recorded bool
+		if err := conn.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM schema_migrations)`).Scan(&recorded); err != nil {
+			return err
+		}
+		if recorded {
+			return ErrHistoryExists
+		}
+
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		for _, m := range targets {
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO schema_migrations (module, version, name, checksum) VALUES ($1, $2, $3, $4)
+			`, m.Module, m.Version, m.Name, m.Checksum); err != nil {
+				return fmt.Errorf("failed to record %s: %w", m.ID(), err)
+			}
+		}
+		return tx.Commit()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return targets, nil
+}
+
+// upTo returns the migrations in order up to and including the one named
+// module/version or by its full ID, or all of them if through is empty
+func (r *Runner) upTo(through string) ([]*Migration, error) {
+	if through == "" {
+		return r.migrations, nil
+	}
+	for i, m := range r.migrations {
+		if through == m.Module+"/"+m.Version || through == m.ID() {
+			return r.migrations[:i+1], nil
+		}
+	}
+	return nil, fmt.Errorf("unknown migration %q: use module/version, e.g. receipts/011", through)
+}
+
+// Status returns every known migration with when it was applied
+func (r *Runner) Status(ctx context.Context) ([]*Status, error) {
+	var statuses []*Status
+	err := r.withLock(ctx, func(conn *sql.Conn) error {
+		records, err := loadApplied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range r.migrations {
+			status := &Status{Migration: m}
+			if record, ok := records[m.Module+"/"+m.Version]; ok {
+				appliedAt := record.appliedAt
+				status.AppliedAt = &appliedAt
+				status.Modified = record.checksum != m.Checksum
+			}
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+	return statuses, err
+}
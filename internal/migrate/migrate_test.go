@@ -0,0 +1,174 @@
+package migrate
+
+import (
+	"embed"
+	"io/fs"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+//go:embed testdata
+var testdata embed.FS
+
+func TestNewRequires(t *testing.T) {
+	tests := []struct {
+		name    string
+		sources []Source
+		err     string
+	}{
+		{"no requirements", []Source{{Module: "receipts"}, {Module: "tasks"}}, ""},
+		{"required module first", []Source{{Module: "receipts"}, {Module: "tasks", Requires: []string{"receipts"}}}, ""},
+		{"required module later", []Source{{Module: "tasks", Requires: []string{"receipts"}}, {Module: "receipts"}}, "tasks migrations require the receipts migrations"},
+		{"required module missing", []Source{{Module: "notes", Requires: []string{"receipts"}}}, "notes migrations require the receipts migrations"},
+		{"requiring itself", []Source{{Module: "notes", Requires: []string{"notes"}}}, "notes migrations require the notes migrations"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(nil, tt.sources...)
+			if tt.err == "" && err != nil {
+				t.Fatalf("New() = %v, want no error", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("New() = %v, want it to mention %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	files := fstest.MapFS{
+		"010_add_index.sql":          {Data: []byte("CREATE INDEX;")},
+		"002_add_column.sql":         {Data: []byte("ALTER TABLE;")},
+		"002_add_column.down.sql":    {Data: []byte("ALTER TABLE DROP;")},
+		"001_create_table.sql":       {Data: []byte("CREATE TABLE;")},
+		"1000_much_later.sql":        {Data: []byte("SELECT 1;")},
+		"README.md":                  {Data: []byte("not a migration")},
+		"nested/003_ignored.sql":     {Data: []byte("SELECT 1;")},
+		"009_name_with_under_sc.sql": {Data: []byte("SELECT 9;")},
+	}
+
+	migrations, err := discover(Source{Module: "receipts", Files: files})
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+
+	var ids []string
+	for _, m := range migrations {
+		ids = append(ids, m.ID())
+	}
+	want := []string{
+		"receipts/001_create_table",
+		"receipts/002_add_column",
+		"receipts/009_name_with_under_sc",
+		"receipts/010_add_index",
+		"receipts/1000_much_later",
+	}
+	if !reflect.DeepEqual(ids, want) {
+		t.Fatalf("migrations = %v, want %v", ids, want)
+	}
+
+	if migrations[1].Up != "ALTER TABLE;" || migrations[1].Down != "ALTER TABLE DROP;" {
+		t.Errorf("002 up = %q, down = %q", migrations[1].Up, migrations[1].Down)
+	}
+	if migrations[0].Down != "" {
+		t.Errorf("001 down = %q, want none", migrations[0].Down)
+	}
+	if migrations[0].Checksum == migrations[1].Checksum || len(migrations[0].Checksum) != 64 {
+		t.Errorf("checksums %q and %q, want distinct SHA-256 hex digests", migrations[0].Checksum, migrations[1].Checksum)
+	}
+
+	again, err := discover(Source{Module: "receipts", Files: files})
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+	if again[0].Checksum != migrations[0].Checksum {
+		t.Error("checksum changed between reads of the same file")
+	}
+}
+
+func TestDiscoverErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+		err   string
+	}{
+		{"no version", fstest.MapFS{"create_table.sql": {}}, "must be named NNN_name.sql"},
+		{"version not a number", fstest.MapFS{"v1_create_table.sql": {}}, "must be named NNN_name.sql"},
+		{"no name", fstest.MapFS{"001.sql": {}}, "must be named NNN_name.sql"},
+		{"version used twice", fstest.MapFS{"001_a.sql": {}, "001_b.sql": {}}, "version 001 is also used"},
+		{"down without up", fstest.MapFS{"001_a.sql": {}, "002_b.down.sql": {}}, "down migration 002 has no up migration"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := discover(Source{Module: "receipts", Files: tt.files})
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("discover() = %v, want an error mentioning %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestNewOrder(t *testing.T) {
+	sub := func(dir string) fs.FS {
+		files, err := fs.Sub(testdata, "testdata/"+dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return files
+	}
+
+	r, err := New(nil,
+		Source{Module: "receipts", Files: sub("receipts")},
+		Source{Module: "tasks", Files: sub("tasks"), Requires: []string{"receipts"}},
+		Source{Module: "empty"},
+	)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	var ids []string
+	for _, m := range r.migrations {
+		ids = append(ids, m.ID())
+	}
+	want := []string{"receipts/001_create_users", "receipts/002_add_email", "tasks/001_create_tasks"}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("migrations = %v, want every module's in module order: %v", ids, want)
+	}
+}
+
+func TestUpTo(t *testing.T) {
+	r := &Runner{migrations: []*Migration{
+		{Module: "receipts", Version: "001", Name: "create_users"},
+		{Module: "receipts", Version: "002", Name: "add_email"},
+		{Module: "tasks", Version: "001", Name: "create_tasks"},
+	}}
+
+	tests := []struct {
+		through string
+		want    int
+		ok      bool
+	}{
+		{"", 3, true},
+		{"receipts/001", 1, true},
+		{"receipts/002_add_email", 2, true},
+		{"tasks/001", 3, true},
+		{"receipts/003", 0, false},
+		{"001", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.through, func(t *testing.T) {
+			got, err := r.upTo(tt.through)
+			if (err == nil) != tt.ok {
+				t.Fatalf("upTo(%q) = %v, want ok = %v", tt.through, err, tt.ok)
+			}
+			if len(got) != tt.want {
+				t.Errorf("upTo(%q) returned %d migrations, want %d", tt.through, len(got), tt.want)
+			}
+		})
+	}
+}
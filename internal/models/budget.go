@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+)
+
+// Budget is a monthly spending limit for a category, store or chain
+type Budget struct {
+	ID         int64     `json:"id"`
+	Scope      string    `json:"scope" binding:"required"`
+	CategoryID *int64    `json:"category_id"`
+	StoreID    *int64    `json:"store_id"`
+	Chain      string    `json:"chain"`
+	Name       string    `json:"name"`
+	Amount     float64   `json:"amount" binding:"required,gt=0"`
+	Rollover   bool      `json:"rollover"`
+	Thresholds []int64   `json:"thresholds"`
+	StartMonth time.Time `json:"start_month"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// BudgetAlert records that a budget's spending reached one of its thresholds in a month
+type BudgetAlert struct {
+	ID         int64     `json:"id"`
+	BudgetID   int64     `json:"budget_id"`
+	BudgetName string    `json:"budget_name"`
+	Month      time.Time `json:"month"`
+	Threshold  int64     `json:"threshold"`
+	Spent      float64   `json:"spent"`
+	Limit      float64   `json:"limit"`
+	CreatedAt  time.Time `json:"created_at"`
+}
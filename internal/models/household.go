@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+)
+
+// Household is a group of users who share receipts and split their costs
+type Household struct {
+	ID        int64              `json:"id"`
+	Name      string             `json:"name" binding:"required"`
+	OwnerID   int64              `json:"owner_id"`
+	Members   []*HouseholdMember `json:"members,omitempty"`
+	CreatedAt time.Time          `json:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at"`
+}
+
+// HouseholdMember is a user belonging to a household
+type HouseholdMember struct {
+	UserID   int64     `json:"user_id"`
+	Username string    `json:"username"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+// ReceiptShare records that a receipt is shared with a household, who paid it
+// and how its total is split between the participants
+type ReceiptShare struct {
+	ReceiptID    int64               `json:"receipt_id"`
+	HouseholdID  int64               `json:"household_id"`
+	PaidBy       int64               `json:"paid_by"`
+	SplitMethod  string              `json:"split_method"`
+	Participants []*ShareParticipant `json:"participants"`
+	Items        []*ShareItem        `json:"items,omitempty"`
+	CreatedAt    time.Time           `json:"created_at"`
+	UpdatedAt    time.Time           `json:"updated_at"`
+}
+
+// ShareParticipant is a member taking part in a shared receipt. Percent is only
+// used by percentage splits.
+type ShareParticipant struct {
+	UserID  int64    `json:"user_id"`
+	Percent *float64 `json:"percent,omitempty"`
+}
+
+// ShareItem assigns a receipt item to the members splitting it in a per-item split
+type ShareItem struct {
+	ItemID  int64   `json:"item_id"`
+	UserIDs []int64 `json:"user_ids"`
+}
+
+// Settlement is a payment from one household member to another
+type Settlement struct {
+	ID          int64     `json:"id"`
+	HouseholdID int64     `json:"household_id"`
+	FromUserID  int64     `json:"from_user_id" binding:"required"`
+	ToUserID    int64     `json:"to_user_id" binding:"required"`
+	Amount      float64   `json:"amount" binding:"required,gt=0"`
+	CreatedAt   time.Time `json:"created_at"`
+}
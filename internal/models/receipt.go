@@ -6,27 +6,56 @@ import (
 
 // Receipt represents a purchase receipt with metadata
 type Receipt struct {
-	ID           int64     `json:"id"`
-	StoreID      int64     `json:"store_id"`
-	StoreName    string    `json:"store_name"`
-	PurchaseDate time.Time `json:"purchase_date"`
-	TotalAmount  float64   `json:"total_amount"`
-	ImagePath    string    `json:"image_path"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID            int64     `json:"id"`
+	UserID        int64     `json:"user_id"`
+	StoreID       int64     `json:"store_id"`
+	StoreName     string    `json:"store_name"`
+	PurchaseDate  time.Time `json:"purchase_date"`
+	TotalAmount   float64   `json:"total_amount"`
+	Currency      string    `json:"currency"`
+	ImagePath     string    `json:"image_path"`
+	CategoryID    *int64    `json:"category_id"`
+	CategoryName  string    `json:"category_name,omitempty"`
+	ReviewStatus  string    `json:"review_status"`
+	ImportBatchID *int64    `json:"import_batch_id,omitempty"`
+	Note          string    `json:"note"`
+	Tags          []string  `json:"tags"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
 }
 
 // ReceiptItem represents an individual item from a purchase receipt
 type ReceiptItem struct {
-	ID          int64     `json:"id"`
-	ReceiptID   int64     `json:"receipt_id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	Quantity    float64   `json:"quantity"`
-	UnitPrice   float64   `json:"unit_price"`
-	TotalPrice  float64   `json:"total_price"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID                  int64     `json:"id"`
+	ReceiptID           int64     `json:"receipt_id"`
+	Name                string    `json:"name"`
+	Description         string    `json:"description"`
+	Quantity            float64   `json:"quantity"`
+	Unit                string    `json:"unit"`
+	UnitPrice           float64   `json:"unit_price"`
+	TotalPrice          float64   `json:"total_price"`
+	BaseUnit            string    `json:"base_unit"`
+	BaseQuantity        float64   `json:"base_quantity"`
+	NormalizedUnitPrice float64   `json:"normalized_unit_price"`
+	Tags                []string  `json:"tags"`
+	Warranty            *Warranty `json:"warranty,omitempty"`
+	CreatedAt           time.Time `json:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at"`
+}
+
+// Warranty tracks an item's warranty. ExpiresOn is the receipt's purchase date
+// plus DurationMonths.
+type Warranty struct {
+	ItemID         int64     `json:"item_id"`
+	ReceiptID      int64     `json:"receipt_id"`
+	ItemName       string    `json:"item_name"`
+	StoreName      string    `json:"store_name"`
+	PurchaseDate   time.Time `json:"purchase_date"`
+	DurationMonths int       `json:"duration_months"`
+	SerialNumber   string    `json:"serial_number"`
+	ExpiresOn      time.Time `json:"expires_on"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
 }
 
 // Store represents a store where purchases are made
@@ -34,6 +63,80 @@ type Store struct {
 	ID        int64     `json:"id"`
 	Name      string    `json:"name"`
 	Address   string    `json:"address"`
+	Chain     string    `json:"chain"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
+
+// Category groups receipts for filtering and reporting, e.g. "Groceries"
+type Category struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name" binding:"required"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Tag labels a user's receipts and items, e.g. "reimbursable"
+type Tag struct {
+	ID           int64     `json:"id"`
+	Name         string    `json:"name"`
+	ReceiptCount int       `json:"receipt_count"`
+	ItemCount    int       `json:"item_count"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// ImportBatch is one CSV import; its receipts are tagged with the batch ID so
+// that the whole import can be rolled back. The stores and categories the
+// import created are deleted with it when nothing else uses them.
+type ImportBatch struct {
+	ID                 int64      `json:"id"`
+	Filename           string     `json:"filename"`
+	ReceiptCount       int        `json:"receipt_count"`
+	ItemCount          int        `json:"item_count"`
+	CreatedStoreIDs    []int64    `json:"created_store_ids"`
+	CreatedCategoryIDs []int64    `json:"created_category_ids"`
+	RemovedStores      int        `json:"removed_stores,omitempty"`
+	RemovedCategories  int        `json:"removed_categories,omitempty"`
+	RolledBackAt       *time.Time `json:"rolled_back_at,omitempty"`
+	CreatedAt          time.Time  `json:"created_at"`
+}
+
+// LedgerExport is one incremental journal export. The next export of the same
+// format continues with the receipts created after Until.
+type LedgerExport struct {
+	ID           int64      `json:"id"`
+	Format       string     `json:"format"`
+	Since        *time.Time `json:"since,omitempty"`
+	Until        time.Time  `json:"until"`
+	ReceiptCount int        `json:"receipt_count"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// Transaction is a bank or credit card statement entry, optionally linked to the
+// receipt of the purchase. Debits are negative, as in OFX statements.
+type Transaction struct {
+	ID          int64     `json:"id"`
+	Account     string    `json:"account"`
+	PostedAt    time.Time `json:"posted_at"`
+	Amount      float64   `json:"amount"`
+	Currency    string    `json:"currency"`
+	Description string    `json:"description"`
+	FitID       string    `json:"fit_id"`
+	Source      string    `json:"source"`
+	ReceiptID   *int64    `json:"receipt_id"`
+	MatchMethod string    `json:"match_method,omitempty"`
+	MatchScore  *float64  `json:"match_score,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ExchangeRate is what one unit of Currency is worth in QuoteCurrency on a date
+type ExchangeRate struct {
+	ID            int64     `json:"id"`
+	Date          time.Time `json:"date"`
+	Currency      string    `json:"currency"`
+	QuoteCurrency string    `json:"quote_currency"`
+	Rate          float64   `json:"rate"`
+	Source        string    `json:"source"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
@@ -0,0 +1,207 @@
+package receipts
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mauroue/cereja-corp/internal/auth"
+	"github.com/mauroue/cereja-corp/internal/models"
+)
+
+// homePath is where visitors land after signing in
+const homePath = "/receipts-web/"
+
+// RegisterAuthRoutes registers the login, logout and first-account pages
+func (h *WebHandler) RegisterAuthRoutes(router *gin.Engine) {
+	account := router.Group("", auth.Middleware(h.api.users))
+	{
+		account.GET(auth.LoginPath, h.LoginPage)
+		account.POST(auth.LoginPath, h.Login)
+		account.POST("/logout", h.Logout)
+		account.POST("/setup", h.Setup)
+	}
+}
+
+// LoginPage renders the login form, or the form creating the first account
+// while there are no users yet
+func (h *WebHandler) LoginPage(c *gin.Context) {
+	next := auth.SafeRedirect(c.Query("next"), homePath)
+	if auth.CurrentUser(c) != nil {
+		c.Redirect(http.StatusSeeOther, next)
+		return
+	}
+
+	count, err := h.api.users.CountUsers()
+	if err != nil {
+		c.Data(http.StatusInternalServerError, "text/html; charset=utf-8",
+			[]byte(renderLayout("Log in", "", createErrorResponse("Failed to load accounts"))))
+		return
+	}
+	if count == 0 {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(renderSetupPage("")))
+		return
+	}
+
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(renderLoginPage(next, "", "")))
+}
+
+// Login checks the submitted credentials and starts a session
+func (h *WebHandler) Login(c *gin.Context) {
+	username := c.PostForm("username")
+	next := auth.SafeRedirect(c.PostForm("next"), homePath)
+
+	user, err := h.api.users.Authenticate(username, c.PostForm("password"))
+	if err != nil {
+		message := "Failed to log in"
+		status := http.StatusInternalServerError
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			message = "Invalid username or password"
+			status = http.StatusUnauthorized
+		}
+		c.Data(status, "text/html; charset=utf-8", []byte(renderLoginPage(next, username, message)))
+		return
+	}
+
+	if err := h.startSession(c, user); err != nil {
+		c.Data(http.StatusInternalServerError, "text/html; charset=utf-8",
+			[]byte(renderLoginPage(next, username, "Failed to start a session")))
+		return
+	}
+	c.Redirect(http.StatusSeeOther, next)
+}
+
+// Logout ends the session and returns to the login page
+func (h *WebHandler) Logout(c *gin.Context) {
+	if token, err := c.Cookie(auth.SessionCookie); err == nil && token != "" {
+		if err := h.api.users.DeleteSession(token); err != nil {
+			log.Printf("Failed to delete session: %v", err)
+		}
+	}
+	setSessionCookie(c, "", -1)
+	c.Redirect(http.StatusSeeOther, auth.LoginPath)
+}
+
+// Setup creates the first account, which takes ownership of any existing receipts.
+// Once an account exists it is refused, also when another setup request
+// created it in the meantime.
+func (h *WebHandler) Setup(c *gin.Context) {
+	count, err := h.api.users.CountUsers()
+	if err != nil || count > 0 {
+		c.Redirect(http.StatusSeeOther, auth.LoginPath)
+		return
+	}
+
+	password := c.PostForm("password")
+	if password != c.PostForm("password_confirm") {
+		c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte(renderSetupPage("The passwords do not match")))
+		return
+	}
+
+	user, err := h.api.users.CreateFirstUser(c.PostForm("username"), password)
+	if errors.Is(err, auth.ErrSetupDone) {
+		c.Redirect(http.StatusSeeOther, auth.LoginPath)
+		return
+	}
+	if err != nil {
+		message := "Failed to create the account"
+		if validationErr := auth.ValidateCredentials(c.PostForm("username"), password); validationErr != nil {
+			message = validationErr.Error()
+		}
+		c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte(renderSetupPage(message)))
+		return
+	}
+
+	// Claimed receipts only show up in the analytics once the views are refreshed
+	h.repo.refreshAnalyticsAsync()
+
+	if err := h.startSession(c, user); err != nil {
+		c.Redirect(http.StatusSeeOther, auth.LoginPath)
+		return
+	}
+	c.Redirect(http.StatusSeeOther, homePath)
+}
+
+// startSession creates a session for the user and sets its cookie
+func (h *WebHandler) startSession(c *gin.Context, user *models.User) error {
+	token, _, err := h.api.users.CreateSession(user.ID)
+	if err != nil {
+		return err
+	}
+	setSessionCookie(c, token, int(auth.SessionTTL.Seconds()))
+	return nil
+}
+
+// setSessionCookie sets the HTTP-only session cookie; a negative maxAge deletes it
+func setSessionCookie(c *gin.Context, token string, maxAge int) {
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(auth.SessionCookie, token, maxAge, "/", "", secure, true)
+}
+
+// renderLoginPage renders the login form with an optional error message
+func renderLoginPage(next, username, message string) string {
+	if message != "" {
+		message = createErrorResponse(template.HTMLEscapeString(message))
+	}
+
+	content := fmt.Sprintf(`
+<div class="card login-card">
+    <div class="card-header">
+        <h1 class="card-title">Log in</h1>
+    </div>
+    %s
+    <form method="post" action="%s">
+        <input type="hidden" name="next" value="%s">
+        <div class="form-group">
+            <label for="username">Username</label>
+            <input type="text" id="username" name="username" value="%s" autocomplete="username" required autofocus>
+        </div>
+        <div class="form-group">
+            <label for="password">Password</label>
+            <input type="password" id="password" name="password" autocomplete="current-password" required>
+        </div>
+        <button type="submit" class="btn btn-primary">Log in</button>
+    </form>
+</div>
+`, message, auth.LoginPath, template.HTMLEscapeString(next), template.HTMLEscapeString(username))
+
+	return renderLayout("Log in", "", content)
+}
+
+// renderSetupPage renders the form creating the first account
+func renderSetupPage(message string) string {
+	if message != "" {
+		message = createErrorResponse(template.HTMLEscapeString(message))
+	}
+
+	content := fmt.Sprintf(`
+<div class="card login-card">
+    <div class="card-header">
+        <h1 class="card-title">Create your account</h1>
+    </div>
+    <p>There are no accounts yet. The first account owns every receipt recorded so far.</p>
+    %s
+    <form method="post" action="/setup">
+        <div class="form-group">
+            <label for="username">Username</label>
+            <input type="text" id="username" name="username" autocomplete="username" required autofocus>
+        </div>
+        <div class="form-group">
+            <label for="password">Password</label>
+            <input type="password" id="password" name="password" minlength="%d" autocomplete="new-password" required>
+        </div>
+        <div class="form-group">
+            <label for="password_confirm">Confirm password</label>
+            <input type="password" id="password_confirm" name="password_confirm" autocomplete="new-password" required>
+        </div>
+        <button type="submit" class="btn btn-primary">Create account</button>
+    </form>
+</div>
+`, message, auth.MinPasswordLength)
+
+	return renderLayout("Create your account", "", content)
+}
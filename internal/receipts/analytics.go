@@ -0,0 +1,380 @@
+package receipts
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mauroue/cereja-corp/internal/auth"
+)
+
+// Periods spending can be grouped by
+const (
+	PeriodDay   = "day"
+	PeriodWeek  = "week"
+	PeriodMonth = "month"
+	PeriodYear  = "year"
+)
+
+// Dimensions spending can be broken down by
+const (
+	BreakdownStore    = "store"
+	BreakdownChain    = "chain"
+	BreakdownCategory = "category"
+	BreakdownProduct  = "product"
+)
+
+const (
+	defaultTopN = 10
+	maxTopN     = 100
+)
+
+// breakdownQueries maps each dimension to the view and column it is aggregated from
+var breakdownQueries = map[string]struct{ view, column string }{
+	BreakdownStore:    {"spending_daily", "store_name"},
+	BreakdownChain:    {"spending_daily", "chain"},
+	BreakdownCategory: {"spending_daily", "category"},
+	BreakdownProduct:  {"product_spending_daily", "product"},
+}
+
+// DateRange is a half-open interval of days [From, To)
+type DateRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// Previous returns the range of the same length ending where this one starts
+func (d DateRange) Previous() DateRange {
+	return DateRange{From: d.From.Add(-d.To.Sub(d.From)), To: d.From}
+}
+
+// SpendingPoint is the spending of one period
+type SpendingPoint struct {
+	PeriodStart time.Time `json:"period_start"`
+	Total       float64   `json:"total"`
+	Receipts    int       `json:"receipts"`
+}
+
+// SpendingSeries is spending over time with a comparison to the previous range
+type SpendingSeries struct {
+	Period        string           `json:"period"`
+	Range         DateRange        `json:"range"`
+	Currency      string           `json:"currency"`
+	Points        []*SpendingPoint `json:"points"`
+	Total         float64          `json:"total"`
+	Receipts      int              `json:"receipts"`
+	Unconverted   int              `json:"unconverted"`
+	PreviousTotal float64          `json:"previous_total"`
+	Change        *float64         `json:"change_percent"`
+}
+
+// BreakdownEntry is the spending on one store, chain, category or product
+type BreakdownEntry struct {
+	Key           string   `json:"key"`
+	Total         float64  `json:"total"`
+	Count         int      `json:"count"`
+	Share         float64  `json:"share"`
+	PreviousTotal float64  `json:"previous_total"`
+	Change        *float64 `json:"change_percent"`
+}
+
+// SpendingBreakdown is the top-N spending entries of a dimension, with the rest summed as "other"
+type SpendingBreakdown struct {
+	By          string            `json:"by"`
+	Range       DateRange         `json:"range"`
+	Currency    string            `json:"currency"`
+	Total       float64           `json:"total"`
+	Entries     []*BreakdownEntry `json:"entries"`
+	Other       float64           `json:"other"`
+	Unconverted int               `json:"unconverted"`
+}
+
+// RefreshAnalytics recomputes the spending views. Refreshes are serialized
+// and run concurrently with reads, so they never block the analytics queries.
+func (r *Repository) RefreshAnalytics() error {
+	r.refreshMu.Lock()
+	defer r.refreshMu.Unlock()
+
+	for _, view := range []string{"spending_daily", "product_spending_daily"} {
+		if _, err := r.db.Exec(`REFRESH MATERIALIZED VIEW CONCURRENTLY ` + view); err != nil {
+			return fmt.Errorf("failed to refresh %s: %w", view, err)
+		}
+	}
+	return nil
+}
+
+// refreshAnalyticsAsync refreshes the spending views in the background after
+// an ingest. Calls are coalesced: while a refresh runs, at most one more is
+// queued, and it picks up every change made before it starts.
+func (r *Repository) refreshAnalyticsAsync() {
+	r.refreshState.Lock()
+	defer r.refreshState.Unlock()
+
+	r.refreshQueued = true
+	if r.refreshing {
+		return
+	}
+	r.refreshing = true
+	r.background.Add(1)
+	go r.refreshQueuedAnalytics()
+}
+
+// refreshQueuedAnalytics refreshes the spending views until no refresh is queued
+func (r *Repository) refreshQueuedAnalytics() {
+	defer r.background.Done()
+	for {
+		r.refreshState.Lock()
+		if !r.refreshQueued {
+			r.refreshing = false
+			r.refreshState.Unlock()
+			return
+		}
+		r.refreshQueued = false
+		r.refreshState.Unlock()
+
+		if err := r.RefreshAnalytics(); err != nil {
+			log.Printf("Failed to refresh analytics: %v", err)
+		}
+	}
+}
+
+// WaitBackground waits for the background analytics refreshes to finish, or
+// until ctx is done
+func (r *Repository) WaitBackground(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		r.background.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("analytics refresh still running: %w", ctx.Err())
+	}
+}
+
+// convertedSpending selects a spending view with a base_total column holding
+// each row's total in the base currency passed as baseParam, using the owner's
+// rate of its day. base_total is NULL for currencies without a known rate.
+func convertedSpending(view, baseParam string) string {
+	return fmt.Sprintf(`(SELECT v.*, v.total * exchange_rate(v.user_id, v.currency, %s, v.day) AS base_total FROM %s v) converted`, baseParam, view)
+}
+
+// SpendingOverTime aggregates the user's spending per period within the range,
+// in the base currency. Receipts without a known exchange rate are counted but
+// left out of the totals.
+func (r *Repository) SpendingOverTime(userID int64, period string, rng DateRange) (*SpendingSeries, error) {
+	base := baseCurrency()
+	query := `
+		SELECT date_trunc($1, day)::date AS period_start,
+			COALESCE(SUM(base_total), 0),
+			SUM(receipt_count),
+			COALESCE(SUM(receipt_count) FILTER (WHERE base_total IS NULL), 0)
+		FROM ` + convertedSpending("spending_daily", "$5") + `
+		WHERE day >= $2 AND day < $3 AND user_id = $4
+		GROUP BY 1
+		ORDER BY 1
+	`
+
+	rows, err := r.db.Query(query, period, rng.From, rng.To, userID, base)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	series := &SpendingSeries{Period: period, Range: rng, Currency: base, Points: []*SpendingPoint{}}
+	for rows.Next() {
+		var p SpendingPoint
+		var unconverted int
+		if err := rows.Scan(&p.PeriodStart, &p.Total, &p.Receipts, &unconverted); err != nil {
+			return nil, err
+		}
+		series.Points = append(series.Points, &p)
+		series.Total += p.Total
+		series.Receipts += p.Receipts
+		series.Unconverted += unconverted
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	previous := rng.Previous()
+	err = r.db.QueryRow(
+		`SELECT COALESCE(SUM(base_total), 0) FROM `+convertedSpending("spending_daily", "$4")+` WHERE day >= $1 AND day < $2 AND user_id = $3`,
+		previous.From, previous.To, userID, base,
+	).Scan(&series.PreviousTotal)
+	if err != nil {
+		return nil, err
+	}
+	series.Change = percentChange(series.PreviousTotal, series.Total)
+
+	return series, nil
+}
+
+// SpendingBreakdown returns the user's top entries of a dimension within the range,
+// each compared with its spending in the previous range. Totals are in the base
+// currency; entries without a known exchange rate are counted as unconverted.
+func (r *Repository) SpendingBreakdown(userID int64, by string, rng DateRange, top int) (*SpendingBreakdown, error) {
+	source, ok := breakdownQueries[by]
+	if !ok {
+		return nil, fmt.Errorf("unsupported breakdown %q", by)
+	}
+
+	countColumn := "receipt_count"
+	if by == BreakdownProduct {
+		countColumn = "item_count"
+	}
+
+	previous := rng.Previous()
+	query := fmt.Sprintf(`
+		SELECT %[1]s,
+			COALESCE(SUM(base_total) FILTER (WHERE day >= $1), 0),
+			SUM(%[3]s) FILTER (WHERE day >= $1),
+			COALESCE(SUM(base_total) FILTER (WHERE day < $1), 0),
+			COALESCE(SUM(%[3]s) FILTER (WHERE day >= $1 AND base_total IS NULL), 0)
+		FROM %[2]s
+		WHERE day >= $3 AND day < $2 AND user_id = $4
+		GROUP BY %[1]s
+		HAVING COUNT(*) FILTER (WHERE day >= $1) > 0
+		ORDER BY 2 DESC, 1
+	`, source.column, convertedSpending(source.view, "$5"), countColumn)
+
+	base := baseCurrency()
+	rows, err := r.db.Query(query, rng.From, rng.To, previous.From, userID, base)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	breakdown := &SpendingBreakdown{By: by, Range: rng, Currency: base, Entries: []*BreakdownEntry{}}
+	for rows.Next() {
+		var e BreakdownEntry
+		var unconverted int
+		if err := rows.Scan(&e.Key, &e.Total, &e.Count, &e.PreviousTotal, &unconverted); err != nil {
+			return nil, err
+		}
+		e.Change = percentChange(e.PreviousTotal, e.Total)
+		breakdown.Unconverted += unconverted
+
+		breakdown.Total += e.Total
+		if len(breakdown.Entries) < top {
+			breakdown.Entries = append(breakdown.Entries, &e)
+		} else {
+			breakdown.Other += e.Total
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if breakdown.Total > 0 {
+		for _, e := range breakdown.Entries {
+			e.Share = e.Total / breakdown.Total * 100
+		}
+	}
+
+	return breakdown, nil
+}
+
+// percentChange returns the change from previous to current in percent, or nil without a previous value
+func percentChange(previous, current float64) *float64 {
+	if previous == 0 {
+		return nil
+	}
+	change := (current - previous) / previous * 100
+	return &change
+}
+
+// rangeFromQuery reads the from/to query parameters, defaulting to the last year up to today
+func rangeFromQuery(c *gin.Context) (DateRange, error) {
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	rng := DateRange{From: today.AddDate(-1, 0, 1), To: today.AddDate(0, 0, 1)}
+
+	from, err := queryDate(c, "from", false)
+	if err != nil {
+		return rng, err
+	}
+	to, err := queryDate(c, "to", true)
+	if err != nil {
+		return rng, err
+	}
+
+	if from != nil {
+		rng.From = *from
+	}
+	if to != nil {
+		rng.To = *to
+	}
+	if !rng.From.Before(rng.To) {
+		return rng, fmt.Errorf("from must be before to")
+	}
+	return rng, nil
+}
+
+// GetSpendingOverTime handles spending totals grouped by day, week, month or year
+func (h *Handler) GetSpendingOverTime(c *gin.Context) {
+	period := c.DefaultQuery("period", PeriodMonth)
+	switch period {
+	case PeriodDay, PeriodWeek, PeriodMonth, PeriodYear:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "period must be day, week, month or year"})
+		return
+	}
+
+	rng, err := rangeFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	series, err := h.repo.SpendingOverTime(auth.UserID(c), period, rng)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute spending"})
+		return
+	}
+
+	c.JSON(http.StatusOK, series)
+}
+
+// GetSpendingBreakdown handles the top-N spending by store, chain, category or product
+func (h *Handler) GetSpendingBreakdown(c *gin.Context) {
+	by := c.DefaultQuery("by", BreakdownCategory)
+	if _, ok := breakdownQueries[by]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "by must be store, chain, category or product"})
+		return
+	}
+
+	top := defaultTopN
+	if value := c.Query("top"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "top must be a positive integer"})
+			return
+		}
+		top = n
+	}
+	if top > maxTopN {
+		top = maxTopN
+	}
+
+	rng, err := rangeFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	breakdown, err := h.repo.SpendingBreakdown(auth.UserID(c), by, rng, top)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute spending breakdown"})
+		return
+	}
+
+	c.JSON(http.StatusOK, breakdown)
+}
@@ -0,0 +1,96 @@
+package receipts
+
+import (
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPercentChange(t *testing.T) {
+	tests := []struct {
+		name              string
+		previous, current float64
+		want              *float64
+	}{
+		{"no previous value", 0, 50, nil},
+		{"increase", 80, 100, ptr(25.0)},
+		{"decrease", 200, 50, ptr(-75.0)},
+		{"unchanged", 10, 10, ptr(0.0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := percentChange(tt.previous, tt.current)
+			if (got == nil) != (tt.want == nil) || (got != nil && !approx(*got, *tt.want)) {
+				t.Errorf("percentChange(%v, %v) = %v, want %v", tt.previous, tt.current, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRangeFromQuery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.Local) }
+
+	tests := []struct {
+		name     string
+		query    string
+		from, to time.Time
+		err      string
+	}{
+		{"both bounds", "from=2024-01-01&to=2024-03-31", day(2024, 1, 1), day(2024, 4, 1), ""},
+		{"to is inclusive", "from=2024-05-10&to=2024-05-10", day(2024, 5, 10), day(2024, 5, 11), ""},
+		{"bad date", "from=10/05/2024", time.Time{}, time.Time{}, "from must be a date"},
+		{"reversed", "from=2024-05-10&to=2024-05-01", time.Time{}, time.Time{}, "from must be before to"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", "/?"+tt.query, nil)
+
+			rng, err := rangeFromQuery(c)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("rangeFromQuery = %v, want an error mentioning %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("rangeFromQuery: %v", err)
+			}
+			if !rng.From.Equal(tt.from) || !rng.To.Equal(tt.to) {
+				t.Errorf("range = %v – %v, want %v – %v", rng.From, rng.To, tt.from, tt.to)
+			}
+		})
+	}
+
+	t.Run("defaults to the last year", func(t *testing.T) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/", nil)
+
+		rng, err := rangeFromQuery(c)
+		if err != nil {
+			t.Fatalf("rangeFromQuery: %v", err)
+		}
+		if days := math.Round(rng.To.Sub(rng.From).Hours() / 24); days < 365 || days > 366 {
+			t.Errorf("default range spans %v days, want a year", days)
+		}
+		if !rng.To.After(time.Now()) {
+			t.Errorf("default range ends %v, want it to include today", rng.To)
+		}
+	})
+}
+
+func TestConvertedSpending(t *testing.T) {
+	got := convertedSpending("spending_daily", "$5")
+	for _, want := range []string{"FROM spending_daily v", "exchange_rate(v.user_id, v.currency, $5, v.day) AS base_total"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("convertedSpending = %s, want it to contain %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,546 @@
+package receipts
+
+import (
+	"database/sql"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mauroue/cereja-corp/internal/auth"
+)
+
+// Basket grouping options
+const (
+	GroupByStore = "store"
+	GroupByChain = "chain"
+)
+
+const (
+	// defaultMaxStores is the number of stores a basket may be split across by default
+	defaultMaxStores = 2
+	// maxSplitStores caps the split size to keep the search over store combinations small
+	maxSplitStores = 4
+	// maxSplitCandidates is the number of best-covering stores considered for a split
+	maxSplitCandidates = 15
+)
+
+// BasketItem is one product of a shopping list. Quantity is in Unit, or in the
+// product's usual base unit (kg, l or un) when Unit is empty.
+type BasketItem struct {
+	Product  string  `json:"product" binding:"required"`
+	Quantity float64 `json:"quantity"`
+	Unit     string  `json:"unit"`
+}
+
+// BasketRequest is a shopping list to price against receipt history
+type BasketRequest struct {
+	Items     []BasketItem `json:"items" binding:"required,min=1,dive"`
+	GroupBy   string       `json:"group_by"`
+	MaxStores int          `json:"max_stores"`
+}
+
+// LatestPrice is the most recent normalized price of a product at a store or
+// chain. Price is in the base currency, converted from OriginalPrice in
+// Currency; without a known exchange rate the price is not Converted.
+type LatestPrice struct {
+	Store         string    `json:"store"`
+	ItemName      string    `json:"item_name"`
+	Price         float64   `json:"price"`
+	Currency      string    `json:"currency"`
+	OriginalPrice float64   `json:"original_price"`
+	BaseUnit      string    `json:"base_unit"`
+	PurchaseDate  time.Time `json:"purchase_date"`
+	Converted     bool      `json:"-"`
+}
+
+// BasketLine is the cost of one basket item at one store
+type BasketLine struct {
+	Product   string    `json:"product"`
+	Store     string    `json:"store"`
+	ItemName  string    `json:"item_name"`
+	Quantity  float64   `json:"quantity"`
+	BaseUnit  string    `json:"base_unit"`
+	UnitPrice float64   `json:"unit_price"`
+	Cost      float64   `json:"cost"`
+	PriceDate time.Time `json:"price_date"`
+}
+
+// BasketQuote is the cost of a basket at one store, or split across several
+type BasketQuote struct {
+	Stores  []string      `json:"stores"`
+	Total   float64       `json:"total"`
+	Covered int           `json:"covered"`
+	Missing []string      `json:"missing"`
+	Lines   []*BasketLine `json:"lines"`
+}
+
+// UnitMismatch is a basket item whose unit the matching products were never
+// sold by, e.g. "un" for a product sold by the liter
+type UnitMismatch struct {
+	Product string   `json:"product"`
+	Unit    string   `json:"unit"`
+	SoldBy  []string `json:"sold_by"`
+}
+
+// BasketResult holds the quotes for every store and the best split, in the
+// base currency. Latest prices without a known exchange rate are left out and
+// counted as Unconverted.
+type BasketResult struct {
+	GroupBy        string          `json:"group_by"`
+	Currency       string          `json:"currency"`
+	Items          int             `json:"items"`
+	Unconverted    int             `json:"unconverted"`
+	Quotes         []*BasketQuote  `json:"quotes"`
+	BestSplit      *BasketQuote    `json:"best_split"`
+	UnitMismatches []*UnitMismatch `json:"unit_mismatches"`
+}
+
+// GetLatestPrices retrieves the most recent normalized price per store (or chain)
+// and base unit for the user's items whose name matches product, converted to
+// the base currency with the rate of the purchase date
+func (r *Repository) GetLatestPrices(userID int64, product, groupBy string) ([]*LatestPrice, error) {
+	group := "r.store_name"
+	if groupBy == GroupByChain {
+		group = "COALESCE(NULLIF(s.chain, ''), r.store_name)"
+	}
+
+	query := fmt.Sprintf(`
+		SELECT DISTINCT ON (grp, ri.base_unit)
+			%s AS grp, ri.name, ri.normalized_unit_price, r.currency,
+			ri.normalized_unit_price * exchange_rate(r.user_id, r.currency, $3, r.purchase_date::date),
+			ri.base_unit, r.purchase_date
+		FROM receipt_items ri
+		JOIN receipts r ON r.id = ri.receipt_id
+		LEFT JOIN stores s ON s.id = r.store_id
+		WHERE ri.name ILIKE $1 ESCAPE '\' AND ri.normalized_unit_price > 0 AND r.user_id = $2
+		ORDER BY grp, ri.base_unit, r.purchase_date DESC, r.id DESC
+	`, group)
+
+	rows, err := r.db.Query(query, containsPattern(product), userID, baseCurrency())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var prices []*LatestPrice
+	for rows.Next() {
+		var p LatestPrice
+		var converted sql.NullFloat64
+		if err := rows.Scan(
+			&p.Store,
+			&p.ItemName,
+			&p.OriginalPrice,
+			&p.Currency,
+			&converted,
+			&p.BaseUnit,
+			&p.PurchaseDate,
+		); err != nil {
+			return nil, err
+		}
+		p.Price, p.Converted = converted.Float64, converted.Valid
+		prices = append(prices, &p)
+	}
+
+	return prices, rows.Err()
+}
+
+// priceBasket looks up the latest prices of every basket item and computes
+// the quotes per store and the best split across at most maxStores stores
+func (r *Repository) priceBasket(userID int64, req *BasketRequest) (*BasketResult, error) {
+	if req.GroupBy != GroupByChain {
+		req.GroupBy = GroupByStore
+	}
+	if req.MaxStores < 1 {
+		req.MaxStores = defaultMaxStores
+	}
+	if req.MaxStores > maxSplitStores {
+		req.MaxStores = maxSplitStores
+	}
+
+	// lines[i][store] is the cost of item i at that store
+	lines := make([]map[string]*BasketLine, len(req.Items))
+	mismatches := []*UnitMismatch{}
+	unconverted := 0
+	for i, item := range req.Items {
+		prices, err := r.GetLatestPrices(userID, item.Product, req.GroupBy)
+		if err != nil {
+			return nil, err
+		}
+		var skipped int
+		prices, skipped = convertedPrices(prices)
+		unconverted += skipped
+		var mismatch *UnitMismatch
+		lines[i], mismatch = basketLines(item, prices)
+		if mismatch != nil {
+			mismatches = append(mismatches, mismatch)
+		}
+	}
+
+	result := buildBasketResult(req, lines)
+	result.UnitMismatches = mismatches
+	result.Unconverted = unconverted
+	return result, nil
+}
+
+// convertedPrices drops the prices that could not be converted to the base
+// currency, returning the rest and how many were dropped
+func convertedPrices(prices []*LatestPrice) ([]*LatestPrice, int) {
+	var converted []*LatestPrice
+	for _, p := range prices {
+		if p.Converted {
+			converted = append(converted, p)
+		}
+	}
+	return converted, len(prices) - len(converted)
+}
+
+// basketLines prices one basket item at every store that sold it.
+// Prices are only comparable within one base unit: the requested unit's base
+// unit is used when given, otherwise the one most stores sold it by. If the
+// product was found but never sold by the requested unit, the mismatch is
+// returned instead of any lines.
+func basketLines(item BasketItem, prices []*LatestPrice) (map[string]*BasketLine, *UnitMismatch) {
+	quantity := item.Quantity
+	if quantity <= 0 {
+		quantity = 1
+	}
+
+	var baseUnit string
+	if unit, ok := ParseUnit(item.Unit); ok {
+		quantity, baseUnit = toBaseUnit(quantity, unit)
+	} else {
+		counts := map[string]int{}
+		for _, p := range prices {
+			counts[p.BaseUnit]++
+			if counts[p.BaseUnit] > counts[baseUnit] {
+				baseUnit = p.BaseUnit
+			}
+		}
+	}
+
+	lines := map[string]*BasketLine{}
+	for _, p := range prices {
+		if p.BaseUnit != baseUnit {
+			continue
+		}
+		lines[p.Store] = &BasketLine{
+			Product:   item.Product,
+			Store:     p.Store,
+			ItemName:  p.ItemName,
+			Quantity:  quantity,
+			BaseUnit:  baseUnit,
+			UnitPrice: p.Price,
+			Cost:      quantity * p.Price,
+			PriceDate: p.PurchaseDate,
+		}
+	}
+
+	if len(lines) == 0 && len(prices) > 0 {
+		mismatch := &UnitMismatch{Product: item.Product, Unit: item.Unit}
+		seen := map[string]bool{}
+		for _, p := range prices {
+			if !seen[p.BaseUnit] {
+				seen[p.BaseUnit] = true
+				mismatch.SoldBy = append(mismatch.SoldBy, p.BaseUnit)
+			}
+		}
+		sort.Strings(mismatch.SoldBy)
+		return lines, mismatch
+	}
+
+	return lines, nil
+}
+
+// quoteBasket prices the basket buying every item at the cheapest of the given stores
+func quoteBasket(items []BasketItem, lines []map[string]*BasketLine, stores []string) *BasketQuote {
+	quote := &BasketQuote{Stores: stores, Missing: []string{}, Lines: []*BasketLine{}}
+
+	for i, item := range items {
+		var best *BasketLine
+		for _, store := range stores {
+			if line, ok := lines[i][store]; ok && (best == nil || line.Cost < best.Cost) {
+				best = line
+			}
+		}
+
+		if best == nil {
+			quote.Missing = append(quote.Missing, item.Product)
+			continue
+		}
+		quote.Covered++
+		quote.Total += best.Cost
+		quote.Lines = append(quote.Lines, best)
+	}
+
+	return quote
+}
+
+// betterQuote reports whether a covers more items than b, or as many for less
+func betterQuote(a, b *BasketQuote) bool {
+	if a.Covered != b.Covered {
+		return a.Covered > b.Covered
+	}
+	if a.Total != b.Total {
+		return a.Total < b.Total
+	}
+	return len(a.Stores) < len(b.Stores)
+}
+
+// buildBasketResult quotes the basket at every store and searches the store
+// combinations of up to req.MaxStores stores for the best split
+func buildBasketResult(req *BasketRequest, lines []map[string]*BasketLine) *BasketResult {
+	result := &BasketResult{GroupBy: req.GroupBy, Currency: baseCurrency(), Items: len(req.Items), Quotes: []*BasketQuote{}}
+
+	seen := map[string]bool{}
+	var stores []string
+	for _, byStore := range lines {
+		for store := range byStore {
+			if !seen[store] {
+				seen[store] = true
+				stores = append(stores, store)
+			}
+		}
+	}
+	sort.Strings(stores)
+
+	for _, store := range stores {
+		result.Quotes = append(result.Quotes, quoteBasket(req.Items, lines, []string{store}))
+	}
+	sort.SliceStable(result.Quotes, func(i, j int) bool {
+		return betterQuote(result.Quotes[i], result.Quotes[j])
+	})
+
+	if len(stores) == 0 {
+		return result
+	}
+
+	// Only the best-covering stores take part in the split search
+	candidates := make([]string, 0, maxSplitCandidates)
+	for _, quote := range result.Quotes {
+		if len(candidates) == maxSplitCandidates {
+			break
+		}
+		candidates = append(candidates, quote.Stores[0])
+	}
+
+	var search func(start int, chosen []string)
+	search = func(start int, chosen []string) {
+		if len(chosen) > 0 {
+			quote := quoteBasket(req.Items, lines, append([]string(nil), chosen...))
+			if result.BestSplit == nil || betterQuote(quote, result.BestSplit) {
+				result.BestSplit = quote
+			}
+		}
+		if len(chosen) == req.MaxStores {
+			return
+		}
+		for i := start; i < len(candidates); i++ {
+			search(i+1, append(chosen, candidates[i]))
+		}
+	}
+	search(0, nil)
+
+	// Drop stores the best split ended up not buying anything from
+	used := map[string]bool{}
+	for _, line := range result.BestSplit.Lines {
+		used[line.Store] = true
+	}
+	var splitStores []string
+	for _, store := range result.BestSplit.Stores {
+		if used[store] {
+			splitStores = append(splitStores, store)
+		}
+	}
+	result.BestSplit.Stores = splitStores
+
+	return result
+}
+
+// OptimizeBasket handles pricing a shopping list against the latest known prices per store
+func (h *Handler) OptimizeBasket(c *gin.Context) {
+	var req BasketRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.repo.priceBasket(auth.UserID(c), &req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to price basket"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// basketLinePattern matches a shopping list line such as "2 kg tomate" or "3 leite"
+var basketLinePattern = regexp.MustCompile(`(?i)^(\d+(?:[.,]\d+)?)\s*(kg|g|gr|l|lt|ml|un|und|pct|dz)?\s+(.+)$`)
+
+// parseShoppingList parses one basket item per line of free text
+func parseShoppingList(text string) []BasketItem {
+	var items []BasketItem
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		item := BasketItem{Product: line, Quantity: 1}
+		if matches := basketLinePattern.FindStringSubmatch(line); matches != nil {
+			if qty, err := parseFloat(matches[1]); err == nil {
+				item.Quantity = qty
+			}
+			item.Unit = matches[2]
+			item.Product = strings.TrimSpace(matches[3])
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// BasketPage renders the shopping list optimizer page
+func (h *WebHandler) BasketPage(c *gin.Context) {
+	content := `
+<div class="card">
+    <div class="card-header">
+        <h1 class="card-title">Shopping Basket</h1>
+    </div>
+    <p>Enter one product per line, optionally starting with a quantity and unit (e.g. "2 kg tomate", "3 leite integral").</p>
+
+    <form hx-post="/receipts-web/htmx/basket"
+          hx-target="#basket-result"
+          hx-indicator="#basket-loading">
+        <div class="form-group">
+            <label for="items">Shopping List</label>
+            <textarea id="items" name="items" rows="8" required></textarea>
+        </div>
+        <div class="form-group">
+            <label for="group_by">Compare</label>
+            <select id="group_by" name="group_by">
+                <option value="store">Stores</option>
+                <option value="chain">Chains</option>
+            </select>
+        </div>
+        <div class="form-group">
+            <label for="max_stores">Split across at most</label>
+            <input type="number" id="max_stores" name="max_stores" min="1" max="4" value="2">
+        </div>
+        <button type="submit" class="btn btn-primary">Find Cheapest</button>
+    </form>
+
+    <div id="basket-loading" class="loading-spinner htmx-indicator"></div>
+    <div id="basket-result" class="mt-3"></div>
+</div>
+`
+	page := renderPageWithLayout("Shopping Basket", content)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(page))
+}
+
+// HtmxBasket returns the basket quotes for HTMX
+func (h *WebHandler) HtmxBasket(c *gin.Context) {
+	req := BasketRequest{
+		Items:   parseShoppingList(c.PostForm("items")),
+		GroupBy: c.PostForm("group_by"),
+	}
+	req.MaxStores, _ = strconv.Atoi(c.PostForm("max_stores"))
+
+	if len(req.Items) == 0 {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Please enter at least one product")))
+		return
+	}
+
+	result, err := h.repo.priceBasket(auth.UserID(c), &req)
+	if err != nil {
+		log.Printf("Failed to price basket: %v", err)
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Failed to price basket")))
+		return
+	}
+
+	var out strings.Builder
+	for _, mismatch := range result.UnitMismatches {
+		out.WriteString(fmt.Sprintf(`<div class="alert alert-warning">%s was asked for in %s but is only sold by %s on your receipts.</div>`,
+			template.HTMLEscapeString(mismatch.Product),
+			template.HTMLEscapeString(mismatch.Unit),
+			template.HTMLEscapeString(strings.Join(mismatch.SoldBy, ", "))))
+	}
+	if result.Unconverted > 0 {
+		out.WriteString(fmt.Sprintf(`<div class="alert alert-warning">%d store prices are left out until an <a href="/receipts-web/exchange-rates">exchange rate</a> to %s is known.</div>`,
+			result.Unconverted, result.Currency))
+	}
+
+	if len(result.Quotes) == 0 {
+		if len(result.UnitMismatches) == 0 && result.Unconverted == 0 {
+			out.WriteString(`<p>None of these products were found on your receipts.</p>`)
+		}
+		c.Data(http.StatusOK, "text/html", []byte(out.String()))
+		return
+	}
+
+	split := result.BestSplit
+	out.WriteString(fmt.Sprintf(`
+	<div class="receipt-items">
+		<h2>Best Split: %s</h2>
+		<p>%d of %d items for %s</p>
+		%s
+	</div>
+	`,
+		template.HTMLEscapeString(strings.Join(split.Stores, " + ")),
+		split.Covered, result.Items, formatCurrency(split.Total),
+		renderBasketLines(split)))
+
+	out.WriteString(`<h2 class="mt-4">By Store</h2><div class="table-responsive"><table class="table"><thead><tr><th>Store</th><th>Total</th><th>Coverage</th><th>Missing</th></tr></thead><tbody>`)
+	for _, quote := range result.Quotes {
+		out.WriteString(fmt.Sprintf(`
+		<tr>
+			<td>%s</td>
+			<td>%s</td>
+			<td>%d/%d</td>
+			<td>%s</td>
+		</tr>
+		`,
+			template.HTMLEscapeString(quote.Stores[0]),
+			formatCurrency(quote.Total),
+			quote.Covered, result.Items,
+			template.HTMLEscapeString(strings.Join(quote.Missing, ", "))))
+	}
+	out.WriteString(`</tbody></table></div>`)
+
+	c.Data(http.StatusOK, "text/html", []byte(out.String()))
+}
+
+// renderBasketLines renders the lines of a quote as a table
+func renderBasketLines(quote *BasketQuote) string {
+	var out strings.Builder
+	out.WriteString(`<div class="table-responsive"><table class="table"><thead><tr><th>Product</th><th>Store</th><th>Matched Item</th><th>Quantity</th><th>Price</th><th>Cost</th></tr></thead><tbody>`)
+	for _, line := range quote.Lines {
+		out.WriteString(fmt.Sprintf(`
+		<tr>
+			<td>%s</td>
+			<td>%s</td>
+			<td>%s</td>
+			<td>%s</td>
+			<td>%s/%s</td>
+			<td>%s</td>
+		</tr>
+		`,
+			template.HTMLEscapeString(line.Product),
+			template.HTMLEscapeString(line.Store),
+			template.HTMLEscapeString(line.ItemName),
+			formatQuantity(line.Quantity, line.BaseUnit),
+			formatCurrency(line.UnitPrice), line.BaseUnit,
+			formatCurrency(line.Cost)))
+	}
+	if len(quote.Missing) > 0 {
+		out.WriteString(fmt.Sprintf(`<tr><td colspan="6">Not found: %s</td></tr>`,
+			template.HTMLEscapeString(strings.Join(quote.Missing, ", "))))
+	}
+	out.WriteString(`</tbody></table></div>`)
+	return out.String()
+}
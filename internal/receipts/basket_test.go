@@ -0,0 +1,155 @@
+package receipts
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBasketLines(t *testing.T) {
+	milk := []*LatestPrice{
+		{Store: "A", ItemName: "LEITE 1L", Price: 4, BaseUnit: UnitLiter},
+		{Store: "B", ItemName: "LEITE 1L", Price: 5, BaseUnit: UnitLiter},
+		{Store: "C", ItemName: "LEITE CX", Price: 30, BaseUnit: UnitPiece},
+	}
+	tomato := []*LatestPrice{
+		{Store: "A", ItemName: "TOMATE", Price: 8, BaseUnit: UnitKilogram},
+	}
+
+	tests := []struct {
+		name     string
+		item     BasketItem
+		prices   []*LatestPrice
+		costs    map[string]float64
+		mismatch *UnitMismatch
+	}{
+		{"most common base unit", BasketItem{Product: "leite", Quantity: 2}, milk, map[string]float64{"A": 8, "B": 10}, nil},
+		{"requested unit", BasketItem{Product: "leite", Quantity: 1, Unit: "un"}, milk, map[string]float64{"C": 30}, nil},
+		{"converted to the base unit", BasketItem{Product: "tomate", Quantity: 500, Unit: "g"}, tomato, map[string]float64{"A": 4}, nil},
+		{"no quantity counts as one", BasketItem{Product: "tomate"}, tomato, map[string]float64{"A": 8}, nil},
+		{"unit never sold", BasketItem{Product: "tomate", Quantity: 1, Unit: "l"}, tomato, map[string]float64{},
+			&UnitMismatch{Product: "tomate", Unit: "l", SoldBy: []string{UnitKilogram}}},
+		{"mismatch lists every unit", BasketItem{Product: "leite", Quantity: 1, Unit: "kg"}, milk, map[string]float64{},
+			&UnitMismatch{Product: "leite", Unit: "kg", SoldBy: []string{UnitLiter, UnitPiece}}},
+		{"not found", BasketItem{Product: "cafe", Quantity: 1, Unit: "kg"}, nil, map[string]float64{}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, mismatch := basketLines(tt.item, tt.prices)
+			costs := map[string]float64{}
+			for store, line := range lines {
+				costs[store] = line.Cost
+			}
+			if !reflect.DeepEqual(costs, tt.costs) {
+				t.Errorf("costs = %v, want %v", costs, tt.costs)
+			}
+			if !reflect.DeepEqual(mismatch, tt.mismatch) {
+				t.Errorf("mismatch = %+v, want %+v", mismatch, tt.mismatch)
+			}
+		})
+	}
+}
+
+func TestConvertedPrices(t *testing.T) {
+	prices := []*LatestPrice{
+		{Store: "A", Price: 4, Currency: "BRL", OriginalPrice: 4, BaseUnit: UnitLiter, Converted: true},
+		{Store: "B", Currency: "USD", OriginalPrice: 1, BaseUnit: UnitLiter},
+		{Store: "C", Price: 5.5, Currency: "EUR", OriginalPrice: 1, BaseUnit: UnitLiter, Converted: true},
+	}
+
+	converted, unconverted := convertedPrices(prices)
+	if unconverted != 1 {
+		t.Errorf("unconverted = %d, want 1", unconverted)
+	}
+	var stores []string
+	for _, p := range converted {
+		stores = append(stores, p.Store)
+	}
+	if !reflect.DeepEqual(stores, []string{"A", "C"}) {
+		t.Errorf("converted stores = %v, want [A C]", stores)
+	}
+
+	// Only converted prices are compared, so the USD price is not read as 1 BRL
+	lines, _ := basketLines(BasketItem{Product: "leite", Quantity: 1}, converted)
+	if _, ok := lines["B"]; ok || !approx(lines["C"].Cost, 5.5) {
+		t.Errorf("lines = %v, want A and C in the base currency", lines)
+	}
+}
+
+func TestBuildBasketResult(t *testing.T) {
+	line := func(store string, cost float64) *BasketLine {
+		return &BasketLine{Store: store, Cost: cost}
+	}
+	items := []BasketItem{{Product: "arroz"}, {Product: "feijao"}, {Product: "cafe"}}
+
+	tests := []struct {
+		name      string
+		maxStores int
+		lines     []map[string]*BasketLine
+		best      []string
+		total     float64
+		covered   int
+	}{
+		{"one store covers everything", 2, []map[string]*BasketLine{
+			{"A": line("A", 20), "B": line("B", 25)},
+			{"A": line("A", 8), "B": line("B", 9)},
+			{"A": line("A", 15), "B": line("B", 16)},
+		}, []string{"A"}, 43, 3},
+		{"split is cheaper", 2, []map[string]*BasketLine{
+			{"A": line("A", 20), "B": line("B", 30)},
+			{"A": line("A", 10), "B": line("B", 5)},
+			{"A": line("A", 15), "B": line("B", 16)},
+		}, []string{"A", "B"}, 40, 3},
+		{"split limited to one store", 1, []map[string]*BasketLine{
+			{"A": line("A", 20), "B": line("B", 30)},
+			{"A": line("A", 10), "B": line("B", 5)},
+			{"A": line("A", 15), "B": line("B", 16)},
+		}, []string{"A"}, 45, 3},
+		{"cheapest stores covering the most", 2, []map[string]*BasketLine{
+			{"A": line("A", 20)},
+			{"B": line("B", 5)},
+			{"C": line("C", 1)},
+		}, []string{"C", "B"}, 6, 2},
+		{"nothing found", 2, []map[string]*BasketLine{{}, {}, {}}, nil, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := buildBasketResult(&BasketRequest{Items: items, MaxStores: tt.maxStores}, tt.lines)
+			if tt.best == nil {
+				if result.BestSplit != nil {
+					t.Errorf("best split = %v, want none", result.BestSplit.Stores)
+				}
+				return
+			}
+			split := result.BestSplit
+			if !reflect.DeepEqual(split.Stores, tt.best) || !approx(split.Total, tt.total) || split.Covered != tt.covered {
+				t.Errorf("best split = %v %v (%d items), want %v %v (%d items)",
+					split.Stores, split.Total, split.Covered, tt.best, tt.total, tt.covered)
+			}
+		})
+	}
+}
+
+func TestParseShoppingList(t *testing.T) {
+	tests := []struct {
+		text string
+		want []BasketItem
+	}{
+		{"2 kg tomate", []BasketItem{{Product: "tomate", Quantity: 2, Unit: "kg"}}},
+		{"3 leite integral", []BasketItem{{Product: "leite integral", Quantity: 3}}},
+		{"0,5 L azeite", []BasketItem{{Product: "azeite", Quantity: 0.5, Unit: "L"}}},
+		{"cafe", []BasketItem{{Product: "cafe", Quantity: 1}}},
+		{"arroz\n\n  1 un pao  \n", []BasketItem{{Product: "arroz", Quantity: 1}, {Product: "pao", Quantity: 1, Unit: "un"}}},
+		{"", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.ReplaceAll(tt.text, "\n", "|"), func(t *testing.T) {
+			if got := parseShoppingList(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseShoppingList(%q) = %+v, want %+v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
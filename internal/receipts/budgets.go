@@ -0,0 +1,903 @@
+package receipts
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/mauroue/cereja-corp/internal/auth"
+	"github.com/mauroue/cereja-corp/internal/models"
+)
+
+// Scopes a budget can apply to
+const (
+	BudgetScopeCategory = "category"
+	BudgetScopeStore    = "store"
+	BudgetScopeChain    = "chain"
+)
+
+const maxBudgetThreshold = 1000
+
+// ErrBudgetStoreNotFound is returned when a budget targets a store the user does not have
+var ErrBudgetStoreNotFound = errors.New("store not found")
+
+// defaultBudgetThresholds are the percentages that raise alerts when a budget sets none
+var defaultBudgetThresholds = []int64{80, 100}
+
+// budgetColumns lists the budget columns read by scanBudget, selected from budgetTables
+const budgetColumns = `
+	b.id, b.scope, b.category_id, b.store_id, COALESCE(b.chain, ''), COALESCE(c.name, s.name, b.chain, ''),
+	b.amount, b.rollover, b.thresholds, b.start_month, b.created_at, b.updated_at`
+
+// budgetTables joins budgets with the tables their names are read from
+const budgetTables = `budgets b
+	LEFT JOIN categories c ON c.id = b.category_id
+	LEFT JOIN stores s ON s.id = b.store_id`
+
+// BudgetProgress is a budget's spending in one month. Only confirmed receipts count
+// as spent; receipts still waiting for review are reported as pending. Receipts
+// without a known exchange rate are left out and counted as Unconverted,
+// including those of earlier months carried over.
+type BudgetProgress struct {
+	Budget      *models.Budget `json:"budget"`
+	Month       time.Time      `json:"month"`
+	Carried     float64        `json:"carried_over"`
+	Limit       float64        `json:"limit"`
+	Spent       float64        `json:"spent"`
+	Pending     float64        `json:"pending"`
+	Remaining   float64        `json:"remaining"`
+	Percent     float64        `json:"percent"`
+	Reached     []int64        `json:"thresholds_reached"`
+	Unconverted int            `json:"unconverted"`
+}
+
+// monthSpending is a budget's confirmed and pending spending in one month, and
+// the number of its receipts that could not be converted to the base currency
+type monthSpending struct {
+	spent       float64
+	pending     float64
+	unconverted int
+}
+
+// scanBudget scans a row selected with budgetColumns
+func scanBudget(row rowScanner) (*models.Budget, error) {
+	var budget models.Budget
+	err := row.Scan(
+		&budget.ID,
+		&budget.Scope,
+		&budget.CategoryID,
+		&budget.StoreID,
+		&budget.Chain,
+		&budget.Name,
+		&budget.Amount,
+		&budget.Rollover,
+		pq.Array(&budget.Thresholds),
+		&budget.StartMonth,
+		&budget.CreatedAt,
+		&budget.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &budget, nil
+}
+
+// startOfMonth returns midnight on the first day of t's month
+func startOfMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.Local)
+}
+
+// monthKey identifies a calendar month regardless of time zone
+func monthKey(t time.Time) string {
+	return t.Format("2006-01")
+}
+
+// normalizeBudget validates a budget, clears the targets its scope does not use
+// and applies the default thresholds and start month
+func normalizeBudget(budget *models.Budget) error {
+	budget.Chain = strings.TrimSpace(budget.Chain)
+
+	switch budget.Scope {
+	case BudgetScopeCategory:
+		if budget.CategoryID == nil {
+			return errors.New("category_id is required for a category budget")
+		}
+		budget.StoreID, budget.Chain = nil, ""
+	case BudgetScopeStore:
+		if budget.StoreID == nil {
+			return errors.New("store_id is required for a store budget")
+		}
+		budget.CategoryID, budget.Chain = nil, ""
+	case BudgetScopeChain:
+		if budget.Chain == "" {
+			return errors.New("chain is required for a chain budget")
+		}
+		budget.CategoryID, budget.StoreID = nil, nil
+	default:
+		return fmt.Errorf("scope must be %q, %q or %q", BudgetScopeCategory, BudgetScopeStore, BudgetScopeChain)
+	}
+
+	if budget.Amount <= 0 {
+		return errors.New("amount must be positive")
+	}
+
+	if len(budget.Thresholds) == 0 {
+		budget.Thresholds = append([]int64(nil), defaultBudgetThresholds...)
+	}
+	sort.Slice(budget.Thresholds, func(i, j int) bool { return budget.Thresholds[i] < budget.Thresholds[j] })
+	thresholds := budget.Thresholds[:0]
+	for _, t := range budget.Thresholds {
+		if t < 1 || t > maxBudgetThreshold {
+			return fmt.Errorf("thresholds must be between 1 and %d percent", maxBudgetThreshold)
+		}
+		if len(thresholds) == 0 || thresholds[len(thresholds)-1] != t {
+			thresholds = append(thresholds, t)
+		}
+	}
+	budget.Thresholds = thresholds
+
+	if budget.StartMonth.IsZero() {
+		budget.StartMonth = time.Now()
+	}
+	budget.StartMonth = startOfMonth(budget.StartMonth)
+
+	return nil
+}
+
+// ListBudgets retrieves all budgets of the user ordered by scope and name
+func (r *Repository) ListBudgets(userID int64) ([]*models.Budget, error) {
+	query := `SELECT ` + budgetColumns + ` FROM ` + budgetTables + ` WHERE b.user_id = $1 ORDER BY b.scope, 6, b.id`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	budgets := []*models.Budget{}
+	for rows.Next() {
+		budget, err := scanBudget(rows)
+		if err != nil {
+			return nil, err
+		}
+		budgets = append(budgets, budget)
+	}
+
+	return budgets, rows.Err()
+}
+
+// GetBudget retrieves a budget of the user by its ID
+func (r *Repository) GetBudget(userID, id int64) (*models.Budget, error) {
+	query := `SELECT ` + budgetColumns + ` FROM ` + budgetTables + ` WHERE b.id = $1 AND b.user_id = $2`
+	return scanBudget(r.db.QueryRow(query, id, userID))
+}
+
+// checkBudgetTargets returns ErrCategoryNotFound or ErrBudgetStoreNotFound
+// unless the budget's category and store, if any, are the user's
+func (r *Repository) checkBudgetTargets(userID int64, budget *models.Budget) error {
+	if err := checkCategory(r.db, userID, budget.CategoryID); err != nil {
+		return err
+	}
+	if budget.StoreID == nil {
+		return nil
+	}
+
+	var exists bool
+	err := r.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM stores WHERE id = $1 AND user_id = $2)`,
+		*budget.StoreID, userID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrBudgetStoreNotFound
+	}
+	return nil
+}
+
+// CreateBudget inserts a budget for the user that has been checked with normalizeBudget
+func (r *Repository) CreateBudget(userID int64, budget *models.Budget) (*models.Budget, error) {
+	if err := r.checkBudgetTargets(userID, budget); err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO budgets (user_id, scope, category_id, store_id, chain, amount, rollover, thresholds,
+			start_month, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8, $9, $10, $11)
+		RETURNING id
+	`
+
+	now := time.Now()
+	var id int64
+	err := r.db.QueryRow(
+		query,
+		userID,
+		budget.Scope,
+		budget.CategoryID,
+		budget.StoreID,
+		budget.Chain,
+		budget.Amount,
+		budget.Rollover,
+		pq.Array(budget.Thresholds),
+		budget.StartMonth.Format("2006-01-02"),
+		now,
+		now,
+	).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.GetBudget(userID, id)
+}
+
+// UpdateBudget replaces a budget's settings with those of a budget checked with normalizeBudget
+func (r *Repository) UpdateBudget(userID int64, budget *models.Budget) (*models.Budget, error) {
+	if err := r.checkBudgetTargets(userID, budget); err != nil {
+		return nil, err
+	}
+
+	query := `
+		UPDATE budgets SET
+			scope = $1,
+			category_id = $2,
+			store_id = $3,
+			chain = NULLIF($4, ''),
+			amount = $5,
+			rollover = $6,
+			thresholds = $7,
+			start_month = $8,
+			updated_at = $9
+		WHERE id = $10 AND user_id = $11
+	`
+
+	result, err := r.db.Exec(
+		query,
+		budget.Scope,
+		budget.CategoryID,
+		budget.StoreID,
+		budget.Chain,
+		budget.Amount,
+		budget.Rollover,
+		pq.Array(budget.Thresholds),
+		budget.StartMonth.Format("2006-01-02"),
+		time.Now(),
+		budget.ID,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	return r.GetBudget(userID, budget.ID)
+}
+
+// DeleteBudget deletes a budget of the user and its alerts
+func (r *Repository) DeleteBudget(userID, id int64) error {
+	result, err := r.db.Exec(`DELETE FROM budgets WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// budgetSpending sums each of the user's budgets' receipts per month, from the
+// budget's start month up to the end of the given month, in the base currency
+func (r *Repository) budgetSpending(userID int64, month time.Time) (map[int64]map[string]monthSpending, error) {
+	query := `
+		SELECT b.id, date_trunc('month', r.purchase_date)::date,
+			COALESCE(SUM(r.total_amount * exchange_rate(r.user_id, r.currency, $4, r.purchase_date::date)) FILTER (WHERE r.review_status = $1), 0),
+			COALESCE(SUM(r.total_amount * exchange_rate(r.user_id, r.currency, $4, r.purchase_date::date)) FILTER (WHERE r.review_status <> $1), 0),
+			COUNT(*) FILTER (WHERE exchange_rate(r.user_id, r.currency, $4, r.purchase_date::date) IS NULL)
+		FROM budgets b
+		JOIN receipts r ON r.user_id = b.user_id
+			AND r.purchase_date >= b.start_month AND r.purchase_date < $2
+		LEFT JOIN stores s ON s.id = r.store_id
+		WHERE b.user_id = $3
+			AND ((b.scope = 'category' AND r.category_id = b.category_id)
+				OR (b.scope = 'store' AND r.store_id = b.store_id)
+				OR (b.scope = 'chain' AND LOWER(s.chain) = LOWER(b.chain)))
+		GROUP BY 1, 2
+	`
+
+	rows, err := r.db.Query(query, ReviewConfirmed, startOfMonth(month).AddDate(0, 1, 0), userID, baseCurrency())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	spending := make(map[int64]map[string]monthSpending)
+	for rows.Next() {
+		var budgetID int64
+		var day time.Time
+		var s monthSpending
+		if err := rows.Scan(&budgetID, &day, &s.spent, &s.pending, &s.unconverted); err != nil {
+			return nil, err
+		}
+		if spending[budgetID] == nil {
+			spending[budgetID] = make(map[string]monthSpending)
+		}
+		spending[budgetID][monthKey(day)] = s
+	}
+
+	return spending, rows.Err()
+}
+
+// BudgetProgress computes the progress of every budget active in the given month.
+// With rollover, the unspent amount of each earlier month is added to the next one,
+// and overspending is taken from it.
+func (r *Repository) BudgetProgress(userID int64, month time.Time) ([]*BudgetProgress, error) {
+	month = startOfMonth(month)
+
+	budgets, err := r.ListBudgets(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	spending, err := r.budgetSpending(userID, month)
+	if err != nil {
+		return nil, err
+	}
+
+	progress := []*BudgetProgress{}
+	for _, budget := range budgets {
+		if p := budgetMonthProgress(budget, month, spending[budget.ID]); p != nil {
+			progress = append(progress, p)
+		}
+	}
+
+	return progress, nil
+}
+
+// budgetMonthProgress computes a budget's progress in a month from its
+// spending per month, or returns nil if the budget starts after that month
+func budgetMonthProgress(budget *models.Budget, month time.Time, spending map[string]monthSpending) *BudgetProgress {
+	start := time.Date(budget.StartMonth.Year(), budget.StartMonth.Month(), 1, 0, 0, 0, 0, time.Local)
+	if start.After(month) {
+		return nil
+	}
+
+	p := &BudgetProgress{Budget: budget, Month: month, Reached: []int64{}}
+	if budget.Rollover {
+		for m := start; m.Before(month); m = m.AddDate(0, 1, 0) {
+			p.Carried += budget.Amount - spending[monthKey(m)].spent
+			p.Unconverted += spending[monthKey(m)].unconverted
+		}
+	}
+
+	current := spending[monthKey(month)]
+	p.Limit = budget.Amount + p.Carried
+	p.Spent = current.spent
+	p.Pending = current.pending
+	p.Unconverted += current.unconverted
+	p.Remaining = p.Limit - p.Spent
+	if p.Limit > 0 {
+		p.Percent = p.Spent / p.Limit * 100
+	} else if p.Spent > 0 {
+		// Earlier overspending used up this month's budget
+		p.Percent = maxBudgetThreshold
+	}
+	for _, t := range budget.Thresholds {
+		if p.Percent >= float64(t) {
+			p.Reached = append(p.Reached, t)
+		}
+	}
+
+	return p
+}
+
+// CheckBudgetAlerts records an alert for every threshold of the user's budgets reached
+// in the given month that has not alerted before, and returns the new alerts
+func (r *Repository) CheckBudgetAlerts(userID int64, month time.Time) ([]*models.BudgetAlert, error) {
+	progress, err := r.BudgetProgress(userID, month)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO budget_alerts (budget_id, month, threshold, spent, budget_limit, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (budget_id, month, threshold) DO NOTHING
+		RETURNING id, created_at
+	`
+
+	var alerts []*models.BudgetAlert
+	for _, p := range progress {
+		for _, threshold := range p.Reached {
+			alert := &models.BudgetAlert{
+				BudgetID:   p.Budget.ID,
+				BudgetName: p.Budget.Name,
+				Month:      p.Month,
+				Threshold:  threshold,
+				Spent:      p.Spent,
+				Limit:      p.Limit,
+			}
+
+			err := r.db.QueryRow(query, alert.BudgetID, monthKey(alert.Month)+"-01", alert.Threshold,
+				alert.Spent, alert.Limit, time.Now()).Scan(&alert.ID, &alert.CreatedAt)
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			alerts = append(alerts, alert)
+		}
+	}
+
+	return alerts, nil
+}
+
+// receiptConfirmed updates the budget alerts after a receipt was confirmed, logging
+// the alerts it raises. Failures are logged so that they never fail the confirmation.
+func (r *Repository) receiptConfirmed(receipt *models.Receipt) []*models.BudgetAlert {
+	return r.spendingConfirmed(receipt.UserID, receipt.PurchaseDate)
+}
+
+// spendingConfirmed updates the user's budget alerts of a month after receipts
+// dated in it were confirmed, logging the alerts it raises
+func (r *Repository) spendingConfirmed(userID int64, month time.Time) []*models.BudgetAlert {
+	alerts, err := r.CheckBudgetAlerts(userID, month)
+	if err != nil {
+		log.Printf("Failed to check budget alerts: %v", err)
+		return nil
+	}
+
+	for _, alert := range alerts {
+		log.Printf("Budget alert: %s reached %d%% of its %s budget (%.2f of %.2f)",
+			alert.BudgetName, alert.Threshold, monthKey(alert.Month), alert.Spent, alert.Limit)
+	}
+	return alerts
+}
+
+// ListBudgetAlerts retrieves the most recent alerts of the user's budgets
+func (r *Repository) ListBudgetAlerts(userID int64, limit int) ([]*models.BudgetAlert, error) {
+	query := `
+		SELECT a.id, a.budget_id, COALESCE(c.name, s.name, b.chain, ''), a.month, a.threshold,
+			a.spent, a.budget_limit, a.created_at
+		FROM budget_alerts a
+		JOIN budgets b ON b.id = a.budget_id
+		LEFT JOIN categories c ON c.id = b.category_id
+		LEFT JOIN stores s ON s.id = b.store_id
+		WHERE b.user_id = $2
+		ORDER BY a.created_at DESC, a.id DESC
+		LIMIT $1
+	`
+
+	rows, err := r.db.Query(query, limit, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts := []*models.BudgetAlert{}
+	for rows.Next() {
+		var alert models.BudgetAlert
+		if err := rows.Scan(
+			&alert.ID,
+			&alert.BudgetID,
+			&alert.BudgetName,
+			&alert.Month,
+			&alert.Threshold,
+			&alert.Spent,
+			&alert.Limit,
+			&alert.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, &alert)
+	}
+
+	return alerts, rows.Err()
+}
+
+// queryMonth parses the YYYY-MM "month" query parameter, defaulting to the current month
+func queryMonth(c *gin.Context) (time.Time, error) {
+	value := c.Query("month")
+	if value == "" {
+		return startOfMonth(time.Now()), nil
+	}
+
+	t, err := time.ParseInLocation("2006-01", value, time.Local)
+	if err != nil {
+		return time.Time{}, errors.New("month must be YYYY-MM")
+	}
+	return t, nil
+}
+
+// ListBudgets handles listing every budget with its progress in a month
+func (h *Handler) ListBudgets(c *gin.Context) {
+	month, err := queryMonth(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	progress, err := h.repo.BudgetProgress(auth.UserID(c), month)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute budgets"})
+		return
+	}
+
+	c.JSON(http.StatusOK, progress)
+}
+
+// CreateBudget handles creating a budget
+func (h *Handler) CreateBudget(c *gin.Context) {
+	var budget models.Budget
+	if err := c.ShouldBindJSON(&budget); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := normalizeBudget(&budget); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	created, err := h.repo.CreateBudget(auth.UserID(c), &budget)
+	if err != nil {
+		if errors.Is(err, ErrBudgetStoreNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "store_id does not exist"})
+			return
+		}
+		if errors.Is(err, ErrCategoryNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "category_id does not exist"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create budget"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, created)
+}
+
+// UpdateBudget handles replacing a budget's settings
+func (h *Handler) UpdateBudget(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid budget ID"})
+		return
+	}
+
+	var budget models.Budget
+	if err := c.ShouldBindJSON(&budget); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := normalizeBudget(&budget); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	budget.ID = id
+
+	updated, err := h.repo.UpdateBudget(auth.UserID(c), &budget)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Budget not found"})
+			return
+		}
+		if errors.Is(err, ErrBudgetStoreNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "store_id does not exist"})
+			return
+		}
+		if errors.Is(err, ErrCategoryNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "category_id does not exist"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update budget"})
+		return
+	}
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// DeleteBudget handles deleting a budget
+func (h *Handler) DeleteBudget(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid budget ID"})
+		return
+	}
+
+	if err := h.repo.DeleteBudget(auth.UserID(c), id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Budget not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete budget"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListBudgetAlerts handles listing the most recent budget alerts
+func (h *Handler) ListBudgetAlerts(c *gin.Context) {
+	limit, err := queryInt(c, "limit")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if limit < 1 || limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	alerts, err := h.repo.ListBudgetAlerts(auth.UserID(c), int(limit))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve budget alerts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, alerts)
+}
+
+// BudgetsPage renders the budgets page with the budget form
+func (h *WebHandler) BudgetsPage(c *gin.Context) {
+	var categoryOptions, storeOptions strings.Builder
+	if categories, err := h.repo.ListCategories(auth.UserID(c)); err == nil {
+		for _, category := range categories {
+			categoryOptions.WriteString(fmt.Sprintf(`<option value="%d">%s</option>`,
+				category.ID, template.HTMLEscapeString(category.Name)))
+		}
+	}
+	if stores, err := h.repo.ListStores(auth.UserID(c)); err == nil {
+		for _, store := range stores {
+			storeOptions.WriteString(fmt.Sprintf(`<option value="%d">%s</option>`,
+				store.ID, template.HTMLEscapeString(store.Name)))
+		}
+	}
+
+	content := fmt.Sprintf(`
+<div class="card">
+    <div class="card-header">
+        <h1 class="card-title">Budgets</h1>
+        <input type="month" id="budget-month" name="month" value="%s"
+               hx-get="/receipts-web/htmx/budgets"
+               hx-trigger="change"
+               hx-target="#budgets-list">
+    </div>
+    <p>Only confirmed receipts count towards a budget. Receipts waiting for review are shown as pending.</p>
+
+    <div id="budgets-list" hx-get="/receipts-web/htmx/budgets" hx-include="#budget-month" hx-trigger="load">
+        <div class="loading-spinner"></div>
+    </div>
+</div>
+
+<div class="card">
+    <div class="card-header">
+        <h2 class="card-title">New Budget</h2>
+    </div>
+    <form hx-post="/receipts-web/htmx/budgets"
+          hx-include="#budget-month"
+          hx-target="#budgets-list">
+        <div class="filter-form">
+            <div class="form-group">
+                <label for="scope">Applies To</label>
+                <select id="scope" name="scope">
+                    <option value="category">Category</option>
+                    <option value="store">Store</option>
+                    <option value="chain">Chain</option>
+                </select>
+            </div>
+            <div class="form-group">
+                <label for="category_id">Category</label>
+                <select id="category_id" name="category_id">%s</select>
+            </div>
+            <div class="form-group">
+                <label for="store_id">Store</label>
+                <select id="store_id" name="store_id">%s</select>
+            </div>
+            <div class="form-group">
+                <label for="chain">Chain</label>
+                <input type="text" id="chain" name="chain">
+            </div>
+            <div class="form-group">
+                <label for="amount">Monthly Amount</label>
+                <input type="number" id="amount" name="amount" min="0.01" step="0.01" required>
+            </div>
+            <div class="form-group">
+                <label for="thresholds">Alert at (%%)</label>
+                <input type="text" id="thresholds" name="thresholds" value="80, 100">
+            </div>
+            <div class="form-group">
+                <label for="rollover">
+                    <input type="checkbox" id="rollover" name="rollover" value="true">
+                    Roll over unspent amounts
+                </label>
+            </div>
+        </div>
+        <button type="submit" class="btn btn-primary">Add Budget</button>
+    </form>
+</div>
+`, time.Now().Format("2006-01"), categoryOptions.String(), storeOptions.String())
+
+	page := renderPageWithLayout("Budgets", content)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(page))
+}
+
+// HtmxBudgets returns the budgets' progress for a month
+func (h *WebHandler) HtmxBudgets(c *gin.Context) {
+	month, err := queryMonth(c)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse(err.Error())))
+		return
+	}
+	c.Data(http.StatusOK, "text/html", []byte(h.renderBudgets(auth.UserID(c), month, true)))
+}
+
+// HtmxDashboardBudgets returns this month's budget progress for the dashboard
+func (h *WebHandler) HtmxDashboardBudgets(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html", []byte(h.renderBudgets(auth.UserID(c), startOfMonth(time.Now()), false)))
+}
+
+// HtmxCreateBudget creates a budget from the budget form and returns the updated list
+func (h *WebHandler) HtmxCreateBudget(c *gin.Context) {
+	budget := models.Budget{
+		Scope:    c.PostForm("scope"),
+		Chain:    c.PostForm("chain"),
+		Rollover: c.PostForm("rollover") == "true",
+	}
+
+	amount, err := strconv.ParseFloat(strings.ReplaceAll(c.PostForm("amount"), ",", "."), 64)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Please enter a valid amount")))
+		return
+	}
+	budget.Amount = amount
+
+	if id, err := strconv.ParseInt(c.PostForm("category_id"), 10, 64); err == nil && budget.Scope == BudgetScopeCategory {
+		budget.CategoryID = &id
+	}
+	if id, err := strconv.ParseInt(c.PostForm("store_id"), 10, 64); err == nil && budget.Scope == BudgetScopeStore {
+		budget.StoreID = &id
+	}
+	for _, field := range strings.FieldsFunc(c.PostForm("thresholds"), func(r rune) bool { return r == ',' || r == ' ' }) {
+		t, err := strconv.ParseInt(strings.TrimSuffix(field, "%"), 10, 64)
+		if err != nil {
+			c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Thresholds must be whole percentages")))
+			return
+		}
+		budget.Thresholds = append(budget.Thresholds, t)
+	}
+
+	if err := normalizeBudget(&budget); err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse(template.HTMLEscapeString(err.Error()))))
+		return
+	}
+	if _, err := h.repo.CreateBudget(auth.UserID(c), &budget); err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Failed to create budget")))
+		return
+	}
+
+	month, err := time.ParseInLocation("2006-01", c.PostForm("month"), time.Local)
+	if err != nil {
+		month = time.Now()
+	}
+	c.Data(http.StatusOK, "text/html", []byte(h.renderBudgets(auth.UserID(c), startOfMonth(month), true)))
+}
+
+// HtmxDeleteBudget deletes a budget and returns the updated list
+func (h *WebHandler) HtmxDeleteBudget(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Invalid budget ID")))
+		return
+	}
+
+	if err := h.repo.DeleteBudget(auth.UserID(c), id); err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Failed to delete budget")))
+		return
+	}
+
+	month, err := queryMonth(c)
+	if err != nil {
+		month = startOfMonth(time.Now())
+	}
+	c.Data(http.StatusOK, "text/html", []byte(h.renderBudgets(auth.UserID(c), month, true)))
+}
+
+// renderBudgets renders a progress bar for each budget. Editable lists get delete buttons.
+func (h *WebHandler) renderBudgets(userID int64, month time.Time, editable bool) string {
+	progress, err := h.repo.BudgetProgress(userID, month)
+	if err != nil {
+		return createErrorResponse("Failed to load budgets")
+	}
+	if len(progress) == 0 {
+		if editable {
+			return `<p>No budgets for this month yet.</p>`
+		}
+		return `<p>No budgets yet. <a href="/receipts-web/budgets">Set up a budget</a>.</p>`
+	}
+
+	var out strings.Builder
+	for _, p := range progress {
+		level := ""
+		if len(p.Reached) > 0 {
+			level = "warning"
+		}
+		if p.Percent >= 100 {
+			level = "danger"
+		}
+		width := p.Percent
+		if width > 100 {
+			width = 100
+		}
+
+		details := fmt.Sprintf("%s of %s", formatCurrency(p.Spent), formatCurrency(p.Limit))
+		if p.Carried != 0 {
+			details += fmt.Sprintf(" (%s carried over)", formatCurrency(p.Carried))
+		}
+		if p.Pending > 0 {
+			details += fmt.Sprintf(" · %s pending review", formatCurrency(p.Pending))
+		}
+		if p.Unconverted > 0 {
+			details += fmt.Sprintf(` · %d receipts left out until an <a href="/receipts-web/exchange-rates">exchange rate</a> is known`, p.Unconverted)
+		}
+
+		actions := ""
+		if editable {
+			actions = fmt.Sprintf(`
+				<button class="btn btn-sm btn-secondary"
+						hx-delete="/receipts-web/htmx/budgets/%d"
+						hx-include="#budget-month"
+						hx-target="#budgets-list"
+						hx-confirm="Delete this budget?">
+					Delete
+				</button>`, p.Budget.ID)
+		}
+
+		out.WriteString(fmt.Sprintf(`
+		<div class="budget">
+			<div class="budget-header">
+				<strong>%s</strong> <small>%s</small>
+				<span>%.0f%%%s</span>
+			</div>
+			<div class="progress"><div class="progress-bar %s" style="width: %.1f%%"></div></div>
+			<small>%s</small>
+		</div>
+		`,
+			template.HTMLEscapeString(p.Budget.Name), p.Budget.Scope, p.Percent, actions,
+			level, width, details))
+	}
+
+	return out.String()
+}
+
+// renderBudgetAlerts renders newly raised budget alerts as warnings
+func renderBudgetAlerts(alerts []*models.BudgetAlert) string {
+	var out strings.Builder
+	for _, alert := range alerts {
+		out.WriteString(fmt.Sprintf(`
+	<div class="alert alert-warning">
+		<strong>Budget alert:</strong> %s reached %d%% of its budget (%s of %s)
+	</div>
+	`,
+			template.HTMLEscapeString(alert.BudgetName), alert.Threshold,
+			formatCurrency(alert.Spent), formatCurrency(alert.Limit)))
+	}
+	return out.String()
+}
@@ -0,0 +1,140 @@
+package receipts
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mauroue/cereja-corp/internal/models"
+)
+
+func TestBudgetMonthProgress(t *testing.T) {
+	month := func(m time.Month) time.Time {
+		return time.Date(2024, m, 1, 0, 0, 0, 0, time.Local)
+	}
+	spent := func(amounts map[time.Month]float64) map[string]monthSpending {
+		spending := map[string]monthSpending{}
+		for m, amount := range amounts {
+			spending[monthKey(month(m))] = monthSpending{spent: amount}
+		}
+		return spending
+	}
+
+	tests := []struct {
+		name     string
+		rollover bool
+		start    time.Month
+		month    time.Month
+		spending map[string]monthSpending
+		carried  float64
+		limit    float64
+		percent  float64
+		reached  []int64
+	}{
+		{"first month", true, time.March, time.March, spent(map[time.Month]float64{time.March: 50}), 0, 100, 50, []int64{}},
+		{"no rollover", false, time.January, time.March, spent(map[time.Month]float64{time.January: 20, time.March: 90}), 0, 100, 90, []int64{80}},
+		{"unspent carried over", true, time.January, time.March, spent(map[time.Month]float64{time.January: 20, time.February: 60, time.March: 90}), 120, 220, 90 / 2.2, []int64{}},
+		{"month without receipts carries the full amount", true, time.February, time.March, spent(map[time.Month]float64{time.March: 150}), 100, 200, 75, []int64{}},
+		{"overspending taken from the next month", true, time.February, time.March, spent(map[time.Month]float64{time.February: 130, time.March: 70}), -30, 70, 100, []int64{80, 100}},
+		{"budget used up by earlier overspending", true, time.January, time.March, spent(map[time.Month]float64{time.January: 250, time.March: 10}), -50, 50, 20, []int64{}},
+		{"nothing left", true, time.February, time.March, spent(map[time.Month]float64{time.February: 200, time.March: 5}), -100, 0, maxBudgetThreshold, []int64{80, 100}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			budget := &models.Budget{Amount: 100, Rollover: tt.rollover, Thresholds: []int64{80, 100}, StartMonth: month(tt.start)}
+			p := budgetMonthProgress(budget, month(tt.month), tt.spending)
+			if p == nil {
+				t.Fatal("budgetMonthProgress returned nil for an active budget")
+			}
+			if !approx(p.Carried, tt.carried) || !approx(p.Limit, tt.limit) || !approx(p.Percent, tt.percent) {
+				t.Errorf("carried %v, limit %v, percent %v; want %v, %v, %v", p.Carried, p.Limit, p.Percent, tt.carried, tt.limit, tt.percent)
+			}
+			if !reflect.DeepEqual(p.Reached, tt.reached) {
+				t.Errorf("reached %v, want %v", p.Reached, tt.reached)
+			}
+		})
+	}
+}
+
+func TestBudgetMonthProgressUnconverted(t *testing.T) {
+	month := func(m time.Month) time.Time {
+		return time.Date(2024, m, 1, 0, 0, 0, 0, time.Local)
+	}
+	spending := map[string]monthSpending{
+		monthKey(month(time.January)):  {spent: 20, unconverted: 2},
+		monthKey(month(time.February)): {spent: 30},
+		monthKey(month(time.March)):    {spent: 40, unconverted: 1},
+	}
+
+	tests := []struct {
+		name     string
+		rollover bool
+		want     int
+	}{
+		{"current month", false, 1},
+		{"carried months included", true, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			budget := &models.Budget{Amount: 100, Rollover: tt.rollover, StartMonth: month(time.January)}
+			if p := budgetMonthProgress(budget, month(time.March), spending); p.Unconverted != tt.want {
+				t.Errorf("unconverted = %d, want %d", p.Unconverted, tt.want)
+			}
+		})
+	}
+}
+
+func TestBudgetMonthProgressBeforeStart(t *testing.T) {
+	budget := &models.Budget{Amount: 100, StartMonth: time.Date(2024, time.May, 15, 0, 0, 0, 0, time.Local)}
+	if p := budgetMonthProgress(budget, time.Date(2024, time.April, 1, 0, 0, 0, 0, time.Local), nil); p != nil {
+		t.Errorf("progress = %+v before the start month, want nil", p)
+	}
+}
+
+func TestNormalizeBudget(t *testing.T) {
+	id := int64(1)
+
+	tests := []struct {
+		name       string
+		budget     models.Budget
+		ok         bool
+		thresholds []int64
+	}{
+		{"category", models.Budget{Scope: BudgetScopeCategory, CategoryID: &id, StoreID: &id, Amount: 10}, true, []int64{80, 100}},
+		{"chain", models.Budget{Scope: BudgetScopeChain, Chain: "  Pão de Açúcar ", Amount: 10, Thresholds: []int64{100, 50, 100}}, true, []int64{50, 100}},
+		{"missing category", models.Budget{Scope: BudgetScopeCategory, Amount: 10}, false, nil},
+		{"missing store", models.Budget{Scope: BudgetScopeStore, Amount: 10}, false, nil},
+		{"blank chain", models.Budget{Scope: BudgetScopeChain, Chain: " ", Amount: 10}, false, nil},
+		{"unknown scope", models.Budget{Scope: "tag", Amount: 10}, false, nil},
+		{"zero amount", models.Budget{Scope: BudgetScopeStore, StoreID: &id}, false, nil},
+		{"threshold too high", models.Budget{Scope: BudgetScopeStore, StoreID: &id, Amount: 10, Thresholds: []int64{maxBudgetThreshold + 1}}, false, nil},
+		{"threshold zero", models.Budget{Scope: BudgetScopeStore, StoreID: &id, Amount: 10, Thresholds: []int64{0}}, false, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			budget := tt.budget
+			err := normalizeBudget(&budget)
+			if (err == nil) != tt.ok {
+				t.Fatalf("normalizeBudget() error = %v, want ok = %v", err, tt.ok)
+			}
+			if !tt.ok {
+				return
+			}
+			if !reflect.DeepEqual(budget.Thresholds, tt.thresholds) {
+				t.Errorf("thresholds = %v, want %v", budget.Thresholds, tt.thresholds)
+			}
+			if budget.StartMonth.Day() != 1 || budget.StartMonth.Hour() != 0 {
+				t.Errorf("start month = %v, want the first of the month", budget.StartMonth)
+			}
+			if budget.Scope == BudgetScopeCategory && budget.StoreID != nil {
+				t.Error("store_id kept on a category budget")
+			}
+			if budget.Scope == BudgetScopeChain && budget.Chain != "Pão de Açúcar" {
+				t.Errorf("chain = %q, want it trimmed", budget.Chain)
+			}
+		})
+	}
+}
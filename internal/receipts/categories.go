@@ -0,0 +1,130 @@
+package receipts
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mauroue/cereja-corp/internal/auth"
+	"github.com/mauroue/cereja-corp/internal/models"
+)
+
+// ErrCategoryNotFound is returned when a receipt or budget is given a category
+// the user does not have
+var ErrCategoryNotFound = errors.New("category not found")
+
+// ListCategories retrieves the user's categories ordered by name
+func (r *Repository) ListCategories(userID int64) ([]*models.Category, error) {
+	query := `
+		SELECT id, name, created_at, updated_at
+		FROM categories
+		WHERE user_id = $1
+		ORDER BY name
+	`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []*models.Category
+	for rows.Next() {
+		var category models.Category
+		if err := rows.Scan(
+			&category.ID,
+			&category.Name,
+			&category.CreatedAt,
+			&category.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		categories = append(categories, &category)
+	}
+
+	return categories, rows.Err()
+}
+
+// FindOrCreateCategory returns the user's category with the given name, creating
+// it if needed. Category names are matched case-insensitively.
+func (r *Repository) FindOrCreateCategory(userID int64, name string) (*models.Category, error) {
+	category, _, err := r.findOrCreateCategory(userID, name)
+	return category, err
+}
+
+// findOrCreateCategory finds or creates a category, reporting whether it was created
+func (r *Repository) findOrCreateCategory(userID int64, name string) (*models.Category, bool, error) {
+	query := `
+		INSERT INTO categories (user_id, name, created_at, updated_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, (LOWER(name))) DO UPDATE SET name = categories.name
+		RETURNING id, name, created_at, updated_at, xmax = 0
+	`
+
+	now := time.Now()
+	var category models.Category
+	var created bool
+	err := r.db.QueryRow(query, userID, name, now, now).Scan(
+		&category.ID,
+		&category.Name,
+		&category.CreatedAt,
+		&category.UpdatedAt,
+		&created,
+	)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &category, created, nil
+}
+
+// checkCategory returns ErrCategoryNotFound unless the category, if any, is the user's
+func checkCategory(q interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}, userID int64, categoryID *int64) error {
+	if categoryID == nil {
+		return nil
+	}
+
+	var exists bool
+	err := q.QueryRow(`SELECT EXISTS (SELECT 1 FROM categories WHERE id = $1 AND user_id = $2)`,
+		*categoryID, userID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrCategoryNotFound
+	}
+	return nil
+}
+
+// ListCategories handles listing the user's categories
+func (h *Handler) ListCategories(c *gin.Context) {
+	categories, err := h.repo.ListCategories(auth.UserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve categories"})
+		return
+	}
+
+	c.JSON(http.StatusOK, categories)
+}
+
+// CreateCategory handles creating a category
+func (h *Handler) CreateCategory(c *gin.Context) {
+	var category models.Category
+	if err := c.ShouldBindJSON(&category); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	created, err := h.repo.FindOrCreateCategory(auth.UserID(c), strings.TrimSpace(category.Name))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create category"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, created)
+}
@@ -0,0 +1,196 @@
+package receipts
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"strings"
+	"time"
+)
+
+// chartPalette holds the colors used for chart series, in order
+var chartPalette = []string{
+	"#4361ee", "#e63946", "#2a9d8f", "#f4a261", "#7209b7",
+	"#06d6a0", "#ef476f", "#118ab2", "#8d99ae", "#ffb703",
+}
+
+// chartColor returns the palette color for the i-th series
+func chartColor(i int) string {
+	return chartPalette[i%len(chartPalette)]
+}
+
+// chartPoint is a single value of a time series
+type chartPoint struct {
+	X time.Time
+	Y float64
+}
+
+// chartSeries is a labelled time series drawn as one line
+type chartSeries struct {
+	Label  string
+	Points []chartPoint
+}
+
+// renderLineChart renders time series as an SVG line chart with a y axis,
+// first/last date labels and a legend. formatY formats the y axis labels.
+func renderLineChart(series []chartSeries, width, height int, formatY func(float64) string) string {
+	const (
+		padLeft   = 70
+		padRight  = 20
+		padTop    = 20
+		padBottom = 40
+		legendRow = 18
+	)
+
+	var minX, maxX time.Time
+	minY, maxY := math.Inf(1), math.Inf(-1)
+	for _, s := range series {
+		for _, p := range s.Points {
+			if minX.IsZero() || p.X.Before(minX) {
+				minX = p.X
+			}
+			if maxX.IsZero() || p.X.After(maxX) {
+				maxX = p.X
+			}
+			minY = math.Min(minY, p.Y)
+			maxY = math.Max(maxY, p.Y)
+		}
+	}
+
+	if minX.IsZero() {
+		return `<p class="text-center">No data to chart.</p>`
+	}
+
+	// Start the y axis at zero unless all values are negative, and leave headroom on top
+	minY = math.Min(minY, 0)
+	if maxY <= minY {
+		maxY = minY + 1
+	}
+	maxY += (maxY - minY) * 0.1
+
+	legendHeight := legendRow * len(series)
+	plotW := float64(width - padLeft - padRight)
+	plotH := float64(height - padTop - padBottom)
+	span := maxX.Sub(minX).Seconds()
+
+	scaleX := func(t time.Time) float64 {
+		if span == 0 {
+			return padLeft + plotW/2
+		}
+		return padLeft + t.Sub(minX).Seconds()/span*plotW
+	}
+	scaleY := func(v float64) float64 {
+		return padTop + plotH - (v-minY)/(maxY-minY)*plotH
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg class="chart" viewBox="0 0 %d %d" width="100%%" role="img" xmlns="http://www.w3.org/2000/svg">`,
+		width, height+legendHeight)
+
+	// Horizontal grid lines with y labels
+	const gridLines = 4
+	for i := 0; i <= gridLines; i++ {
+		v := minY + (maxY-minY)*float64(i)/gridLines
+		y := scaleY(v)
+		fmt.Fprintf(&b, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="#e0e0e0" />`, padLeft, y, width-padRight, y)
+		fmt.Fprintf(&b, `<text x="%d" y="%.1f" font-size="11" text-anchor="end" fill="#555">%s</text>`,
+			padLeft-6, y+4, template.HTMLEscapeString(formatY(v)))
+	}
+
+	// X axis with first and last dates
+	axisY := padTop + plotH
+	fmt.Fprintf(&b, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="#999" />`, padLeft, axisY, width-padRight, axisY)
+	fmt.Fprintf(&b, `<text x="%d" y="%.1f" font-size="11" fill="#555">%s</text>`,
+		padLeft, axisY+18, minX.Format("2006-01-02"))
+	if !maxX.Equal(minX) {
+		fmt.Fprintf(&b, `<text x="%d" y="%.1f" font-size="11" text-anchor="end" fill="#555">%s</text>`,
+			width-padRight, axisY+18, maxX.Format("2006-01-02"))
+	}
+
+	for i, s := range series {
+		color := chartColor(i)
+
+		var points []string
+		for _, p := range s.Points {
+			points = append(points, fmt.Sprintf("%.1f,%.1f", scaleX(p.X), scaleY(p.Y)))
+		}
+		if len(points) > 1 {
+			fmt.Fprintf(&b, `<polyline fill="none" stroke="%s" stroke-width="2" points="%s" />`,
+				color, strings.Join(points, " "))
+		}
+		for _, p := range s.Points {
+			fmt.Fprintf(&b, `<circle cx="%.1f" cy="%.1f" r="3" fill="%s"><title>%s: %s (%s)</title></circle>`,
+				scaleX(p.X), scaleY(p.Y), color, template.HTMLEscapeString(s.Label),
+				template.HTMLEscapeString(formatY(p.Y)), p.X.Format("2006-01-02"))
+		}
+
+		// Legend entry below the plot
+		ly := height + i*legendRow
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="12" height="12" fill="%s" />`, padLeft, ly, color)
+		fmt.Fprintf(&b, `<text x="%d" y="%d" font-size="12" fill="#333">%s</text>`,
+			padLeft+18, ly+10, template.HTMLEscapeString(s.Label))
+	}
+
+	b.WriteString(`</svg>`)
+	return b.String()
+}
+
+// chartSlice is one labelled value of a donut chart
+type chartSlice struct {
+	Label string
+	Value float64
+}
+
+// renderDonutChart renders values as an SVG donut with a legend showing each
+// slice's share. formatValue formats the values shown in the legend.
+func renderDonutChart(slices []chartSlice, size int, formatValue func(float64) string) string {
+	var total float64
+	for _, s := range slices {
+		total += s.Value
+	}
+	if total <= 0 {
+		return `<p class="text-center">No data to chart.</p>`
+	}
+
+	const (
+		legendWidth = 260
+		legendRow   = 18
+		strokeWidth = 28.0
+	)
+
+	center := float64(size) / 2
+	radius := center - strokeWidth/2 - 2
+	circumference := 2 * math.Pi * radius
+	height := size
+	if rows := len(slices) * legendRow; rows > height {
+		height = rows
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg class="chart" viewBox="0 0 %d %d" width="100%%" role="img" xmlns="http://www.w3.org/2000/svg">`,
+		size+legendWidth, height)
+
+	// Each slice is a dashed circle stroke, rotated to start where the previous one ended
+	offset := 0.0
+	for i, s := range slices {
+		length := s.Value / total * circumference
+		fmt.Fprintf(&b, `<circle cx="%.1f" cy="%.1f" r="%.1f" fill="none" stroke="%s" stroke-width="%.0f" stroke-dasharray="%.2f %.2f" stroke-dashoffset="%.2f" transform="rotate(-90 %.1f %.1f)"><title>%s: %s</title></circle>`,
+			center, center, radius, chartColor(i), strokeWidth,
+			length, circumference-length, -offset, center, center,
+			template.HTMLEscapeString(s.Label), template.HTMLEscapeString(formatValue(s.Value)))
+		offset += length
+	}
+	fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" font-size="14" font-weight="600" text-anchor="middle" fill="#333">%s</text>`,
+		center, center+5, template.HTMLEscapeString(formatValue(total)))
+
+	for i, s := range slices {
+		y := i*legendRow + 4
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="12" height="12" fill="%s" />`, size+16, y, chartColor(i))
+		fmt.Fprintf(&b, `<text x="%d" y="%d" font-size="12" fill="#333">%s — %s (%.0f%%)</text>`,
+			size+34, y+10, template.HTMLEscapeString(s.Label),
+			template.HTMLEscapeString(formatValue(s.Value)), s.Value/total*100)
+	}
+
+	b.WriteString(`</svg>`)
+	return b.String()
+}
@@ -0,0 +1,88 @@
+package receipts
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChartColor(t *testing.T) {
+	if chartColor(0) != chartPalette[0] || chartColor(len(chartPalette)+2) != chartPalette[2] {
+		t.Errorf("chartColor does not cycle through the palette")
+	}
+}
+
+func TestRenderLineChart(t *testing.T) {
+	format := func(v float64) string { return fmt.Sprintf("%.0f", v) }
+	day := func(d int) time.Time { return time.Date(2024, 5, d, 0, 0, 0, 0, time.UTC) }
+
+	if got := renderLineChart(nil, 600, 240, format); !strings.Contains(got, "No data to chart") {
+		t.Errorf("empty chart = %q, want the no-data message", got)
+	}
+
+	got := renderLineChart([]chartSeries{
+		{Label: "Mercado <A>", Points: []chartPoint{{day(1), 10}, {day(15), 30}, {day(31), 20}}},
+		{Label: "Padaria", Points: []chartPoint{{day(10), 5}}},
+	}, 600, 240, format)
+
+	if strings.Count(got, "<polyline") != 1 {
+		t.Errorf("want one line, for the series with more than one point")
+	}
+	if strings.Count(got, "<circle") != 4 {
+		t.Errorf("want a marker per point")
+	}
+	for _, want := range []string{"2024-05-01", "2024-05-31", "Mercado &lt;A&gt;", chartColor(1)} {
+		if !strings.Contains(got, want) {
+			t.Errorf("chart is missing %q", want)
+		}
+	}
+	if strings.Contains(got, "<A>") {
+		t.Error("series label is not escaped")
+	}
+}
+
+func TestRenderDonutChart(t *testing.T) {
+	format := func(v float64) string { return fmt.Sprintf("%.0f", v) }
+
+	for _, slices := range [][]chartSlice{nil, {{Label: "Zero", Value: 0}}} {
+		if got := renderDonutChart(slices, 200, format); !strings.Contains(got, "No data to chart") {
+			t.Errorf("donut of %v = %q, want the no-data message", slices, got)
+		}
+	}
+
+	got := renderDonutChart([]chartSlice{{"Mercado", 75}, {"Farmácia & Cia", 25}}, 200, format)
+	if strings.Count(got, "<circle") != 2 {
+		t.Errorf("want a circle per slice")
+	}
+	for _, want := range []string{"Mercado — 75 (75%)", "Farmácia &amp; Cia — 25 (25%)", ">100</text>"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("donut is missing %q", want)
+		}
+	}
+}
+
+func TestDashboardRanges(t *testing.T) {
+	now := time.Date(2024, 3, 15, 18, 30, 0, 0, time.Local)
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.Local) }
+
+	tests := []struct {
+		name     string
+		rng      DateRange
+		from, to time.Time
+	}{
+		{"this month", monthRange(now, 0), day(2024, 3, 1), day(2024, 4, 1)},
+		{"last month", monthRange(now, -1), day(2024, 2, 1), day(2024, 3, 1)},
+		{"across the year", monthRange(now, -3), day(2023, 12, 1), day(2024, 1, 1)},
+		{"last 30 days", lastDays(now, 30), day(2024, 2, 15), day(2024, 3, 16)},
+		{"today", lastDays(now, 1), day(2024, 3, 15), day(2024, 3, 16)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !tt.rng.From.Equal(tt.from) || !tt.rng.To.Equal(tt.to) {
+				t.Errorf("range = %v – %v, want %v – %v", tt.rng.From, tt.rng.To, tt.from, tt.to)
+			}
+		})
+	}
+}
@@ -0,0 +1,518 @@
+package receipts
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mauroue/cereja-corp/config"
+	"github.com/mauroue/cereja-corp/internal/auth"
+	"github.com/mauroue/cereja-corp/internal/models"
+)
+
+var (
+	// ErrInvalidCurrency is returned for currency codes that are not three letters
+	ErrInvalidCurrency = errors.New("invalid currency")
+	// ErrNoExchangeRate is returned when no rate between two currencies is known
+	ErrNoExchangeRate = errors.New("no exchange rate")
+)
+
+// currencySymbols are the symbols formatMoney prints for common currencies.
+// Other currencies are printed with their code.
+var currencySymbols = map[string]string{
+	"BRL": "R$",
+	"USD": "$",
+	"EUR": "€",
+	"GBP": "£",
+	"JPY": "¥",
+}
+
+// baseCurrency returns the configured currency analytics are reported in
+func baseCurrency() string {
+	if base, err := normalizeCurrency(config.Get().Currency.Base); err == nil {
+		return base
+	}
+	return "BRL"
+}
+
+// normalizeCurrency upper-cases an ISO 4217 code and checks it is three letters
+func normalizeCurrency(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) != 3 {
+		return "", fmt.Errorf("%w %q: use a three-letter code such as BRL", ErrInvalidCurrency, code)
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return "", fmt.Errorf("%w %q: use a three-letter code such as BRL", ErrInvalidCurrency, code)
+		}
+	}
+	return code, nil
+}
+
+// formatMoney formats an amount with its currency's symbol, e.g. "R$12.50" or
+// "CHF 12.50"
+func formatMoney(amount float64, currency string) string {
+	value := strconv.FormatFloat(amount, 'f', 2, 64)
+	if symbol, ok := currencySymbols[currency]; ok {
+		return symbol + value
+	}
+	if currency == "" {
+		return value
+	}
+	return currency + " " + value
+}
+
+// formCurrency reads the optional "currency" form field, defaulting to the base
+// currency
+func formCurrency(c *gin.Context) (string, error) {
+	if raw := c.PostForm("currency"); strings.TrimSpace(raw) != "" {
+		return normalizeCurrency(raw)
+	}
+	return baseCurrency(), nil
+}
+
+// ExchangeRate returns what one unit of from is worth in to on a date, using
+// the user's closest known rate
+func (r *Repository) ExchangeRate(userID int64, from, to string, on time.Time) (float64, error) {
+	var rate sql.NullFloat64
+	if err := r.db.QueryRow(`SELECT exchange_rate($1, $2, $3, $4::date)`, userID, from, to, on).Scan(&rate); err != nil {
+		return 0, err
+	}
+	if !rate.Valid {
+		return 0, fmt.Errorf("%w from %s to %s", ErrNoExchangeRate, from, to)
+	}
+	return rate.Float64, nil
+}
+
+// ListExchangeRates returns the user's exchange rates, newest first,
+// optionally only those involving currency
+func (r *Repository) ListExchangeRates(userID int64, currency string) ([]*models.ExchangeRate, error) {
+	rows, err := r.db.Query(`
+		SELECT id, rate_date, currency, quote_currency, rate, source, created_at, updated_at
+		FROM exchange_rates
+		WHERE user_id = $1 AND ($2 = '' OR currency = $2 OR quote_currency = $2)
+		ORDER BY rate_date DESC, currency, quote_currency
+	`, userID, currency)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rates []*models.ExchangeRate
+	for rows.Next() {
+		var rate models.ExchangeRate
+		if err := rows.Scan(
+			&rate.ID,
+			&rate.Date,
+			&rate.Currency,
+			&rate.QuoteCurrency,
+			&rate.Rate,
+			&rate.Source,
+			&rate.CreatedAt,
+			&rate.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		rates = append(rates, &rate)
+	}
+
+	return rates, rows.Err()
+}
+
+// SaveExchangeRate validates a rate and stores it for the user, replacing any
+// of their rates for the same pair and date
+func (r *Repository) SaveExchangeRate(userID int64, rate *models.ExchangeRate) error {
+	if err := normalizeExchangeRate(rate); err != nil {
+		return err
+	}
+
+	return r.db.QueryRow(`
+		INSERT INTO exchange_rates (user_id, rate_date, currency, quote_currency, rate, source)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id, rate_date, currency, quote_currency)
+		DO UPDATE SET rate = EXCLUDED.rate, source = EXCLUDED.source, updated_at = NOW()
+		RETURNING id, created_at, updated_at
+	`, userID, rate.Date, rate.Currency, rate.QuoteCurrency, rate.Rate, rate.Source,
+	).Scan(&rate.ID, &rate.CreatedAt, &rate.UpdatedAt)
+}
+
+// normalizeExchangeRate validates a rate and normalizes its currency codes. The
+// quote currency defaults to the base currency and the source to "manual".
+func normalizeExchangeRate(rate *models.ExchangeRate) error {
+	currency, err := normalizeCurrency(rate.Currency)
+	if err != nil {
+		return err
+	}
+	quote := baseCurrency()
+	if strings.TrimSpace(rate.QuoteCurrency) != "" {
+		if quote, err = normalizeCurrency(rate.QuoteCurrency); err != nil {
+			return err
+		}
+	}
+	if currency == quote {
+		return fmt.Errorf("%w: the currency and quote currency must differ", ErrInvalidCurrency)
+	}
+	if rate.Rate <= 0 {
+		return errors.New("rate must be greater than zero")
+	}
+	if rate.Date.IsZero() {
+		return errors.New("date is required")
+	}
+	if rate.Source == "" {
+		rate.Source = "manual"
+	}
+	rate.Currency, rate.QuoteCurrency = currency, quote
+	return nil
+}
+
+// DeleteExchangeRate deletes one of the user's rates. It returns sql.ErrNoRows
+// if there is none.
+func (r *Repository) DeleteExchangeRate(userID, id int64) error {
+	result, err := r.db.Exec(`DELETE FROM exchange_rates WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ExchangeRateImport reports the outcome of an exchange rate CSV import
+type ExchangeRateImport struct {
+	Imported int           `json:"imported"`
+	Errors   []ImportError `json:"errors,omitempty"`
+}
+
+// ImportExchangeRates stores the rates in a CSV file with date, currency, rate
+// and optionally quote_currency columns for the user. Rows with errors are
+// reported and skipped.
+func (r *Repository) ImportExchangeRates(userID int64, data []byte) (*ExchangeRateImport, error) {
+	records, err := readImportCSV(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV: %w", err)
+	}
+
+	columns := map[string]int{}
+	for i, header := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(header))] = i
+	}
+	if _, ok := columns["date"]; !ok {
+		if i, ok := columns["rate_date"]; ok {
+			columns["date"] = i
+		}
+	}
+	for _, required := range []string{"date", "currency", "rate"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("missing %q column", required)
+		}
+	}
+
+	field := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	result := &ExchangeRateImport{}
+	for n, record := range records[1:] {
+		row := n + 2
+		date, err := parseImportDate(field(record, "date"))
+		if err != nil {
+			result.Errors = append(result.Errors, ImportError{Row: row, Message: err.Error()})
+			continue
+		}
+		value, err := parseImportAmount(field(record, "rate"))
+		if err != nil {
+			result.Errors = append(result.Errors, ImportError{Row: row, Message: fmt.Sprintf("invalid rate %q", field(record, "rate"))})
+			continue
+		}
+
+		rate := &models.ExchangeRate{
+			Date:          date,
+			Currency:      field(record, "currency"),
+			QuoteCurrency: field(record, "quote_currency"),
+			Rate:          value,
+			Source:        "csv",
+		}
+		if err := r.SaveExchangeRate(userID, rate); err != nil {
+			result.Errors = append(result.Errors, ImportError{Row: row, Message: err.Error()})
+			continue
+		}
+		result.Imported++
+	}
+
+	return result, nil
+}
+
+// exchangeRateRequest is the JSON body for creating an exchange rate
+type exchangeRateRequest struct {
+	Date          string  `json:"date" binding:"required"`
+	Currency      string  `json:"currency" binding:"required"`
+	QuoteCurrency string  `json:"quote_currency"`
+	Rate          float64 `json:"rate" binding:"required"`
+}
+
+// ListExchangeRates returns the exchange rates, optionally filtered by ?currency=
+func (h *Handler) ListExchangeRates(c *gin.Context) {
+	currency := ""
+	if raw := c.Query("currency"); raw != "" {
+		var err error
+		if currency, err = normalizeCurrency(raw); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	rates, err := h.repo.ListExchangeRates(auth.UserID(c), currency)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list exchange rates"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"base_currency": baseCurrency(), "rates": rates})
+}
+
+// CreateExchangeRate stores a manually entered exchange rate
+func (h *Handler) CreateExchangeRate(c *gin.Context) {
+	var req exchangeRateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	date, err := time.Parse("2006-01-02", req.Date)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format, use YYYY-MM-DD"})
+		return
+	}
+
+	rate := &models.ExchangeRate{
+		Date:          date,
+		Currency:      req.Currency,
+		QuoteCurrency: req.QuoteCurrency,
+		Rate:          req.Rate,
+	}
+	if err := h.repo.SaveExchangeRate(auth.UserID(c), rate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, rate)
+}
+
+// ImportExchangeRates stores the rates in an uploaded CSV file
+func (h *Handler) ImportExchangeRates(c *gin.Context) {
+	data, _, err := readImportFile(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.repo.ImportExchangeRates(auth.UserID(c), data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// DeleteExchangeRate deletes an exchange rate
+func (h *Handler) DeleteExchangeRate(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid exchange rate ID"})
+		return
+	}
+
+	if err := h.repo.DeleteExchangeRate(auth.UserID(c), id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Exchange rate not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete exchange rate"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Exchange rate deleted"})
+}
+
+// ExchangeRatesPage renders the exchange rates page
+func (h *WebHandler) ExchangeRatesPage(c *gin.Context) {
+	content := fmt.Sprintf(`
+<div class="card">
+    <div class="card-header">
+        <h1 class="card-title">Exchange Rates</h1>
+    </div>
+    <p>Analytics and budgets are reported in <strong>%s</strong>. Receipts in other currencies are converted with the rate of their purchase date, or the closest known rate.</p>
+
+    <div id="exchange-rates-list" hx-get="/receipts-web/htmx/exchange-rates" hx-trigger="load">
+        <div class="loading-spinner"></div>
+    </div>
+</div>
+
+<div class="card">
+    <div class="card-header">
+        <h2 class="card-title">Add Rate</h2>
+    </div>
+    <form hx-post="/receipts-web/htmx/exchange-rates" hx-target="#exchange-rates-list">
+        <div class="filter-form">
+            <div class="form-group">
+                <label for="rate-date">Date</label>
+                <input type="date" id="rate-date" name="date" value="%s" required>
+            </div>
+            <div class="form-group">
+                <label for="rate-currency">Currency</label>
+                <input type="text" id="rate-currency" name="currency" maxlength="3" placeholder="USD" required>
+            </div>
+            <div class="form-group">
+                <label for="rate-quote">Worth in</label>
+                <input type="text" id="rate-quote" name="quote_currency" maxlength="3" value="%s" required>
+            </div>
+            <div class="form-group">
+                <label for="rate-value">Rate</label>
+                <input type="number" id="rate-value" name="rate" step="0.00000001" min="0" required>
+            </div>
+        </div>
+        <button type="submit" class="btn btn-primary">Save Rate</button>
+    </form>
+</div>
+
+<div class="card">
+    <div class="card-header">
+        <h2 class="card-title">Import Rates</h2>
+    </div>
+    <p>Upload a CSV file with <code>date</code>, <code>currency</code> and <code>rate</code> columns, and optionally <code>quote_currency</code> (defaults to %s).</p>
+    <form hx-post="/receipts-web/htmx/exchange-rates/import"
+          hx-encoding="multipart/form-data"
+          hx-target="#exchange-rates-list">
+        <div class="form-group">
+            <label for="rates-file">CSV file</label>
+            <input type="file" id="rates-file" name="file" accept=".csv,text/csv" required>
+        </div>
+        <button type="submit" class="btn btn-primary">Import</button>
+    </form>
+</div>
+`, baseCurrency(), time.Now().Format("2006-01-02"), baseCurrency(), baseCurrency())
+
+	page := renderPageWithLayout("Exchange Rates", content)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(page))
+}
+
+// HtmxExchangeRates returns the exchange rates table
+func (h *WebHandler) HtmxExchangeRates(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html", []byte(h.renderExchangeRates(auth.UserID(c))))
+}
+
+// HtmxCreateExchangeRate saves a rate from the rate form
+func (h *WebHandler) HtmxCreateExchangeRate(c *gin.Context) {
+	date, err := time.Parse("2006-01-02", c.PostForm("date"))
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Please enter a valid date")+h.renderExchangeRates(auth.UserID(c))))
+		return
+	}
+	value, err := strconv.ParseFloat(c.PostForm("rate"), 64)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Please enter a valid rate")+h.renderExchangeRates(auth.UserID(c))))
+		return
+	}
+
+	rate := &models.ExchangeRate{
+		Date:          date,
+		Currency:      c.PostForm("currency"),
+		QuoteCurrency: c.PostForm("quote_currency"),
+		Rate:          value,
+	}
+	if err := h.repo.SaveExchangeRate(auth.UserID(c), rate); err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse(template.HTMLEscapeString(err.Error()))+h.renderExchangeRates(auth.UserID(c))))
+		return
+	}
+
+	c.Data(http.StatusOK, "text/html", []byte(h.renderExchangeRates(auth.UserID(c))))
+}
+
+// HtmxImportExchangeRates imports rates from an uploaded CSV file
+func (h *WebHandler) HtmxImportExchangeRates(c *gin.Context) {
+	data, _, err := readImportFile(c)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse(template.HTMLEscapeString(err.Error()))+h.renderExchangeRates(auth.UserID(c))))
+		return
+	}
+
+	result, err := h.repo.ImportExchangeRates(auth.UserID(c), data)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse(template.HTMLEscapeString(err.Error()))+h.renderExchangeRates(auth.UserID(c))))
+		return
+	}
+
+	var out strings.Builder
+	out.WriteString(createSuccessResponse(fmt.Sprintf("Imported %d rates", result.Imported)))
+	for _, importErr := range result.Errors {
+		out.WriteString(createErrorResponse(template.HTMLEscapeString(fmt.Sprintf("Row %d: %s", importErr.Row, importErr.Message))))
+	}
+	out.WriteString(h.renderExchangeRates(auth.UserID(c)))
+	c.Data(http.StatusOK, "text/html", []byte(out.String()))
+}
+
+// HtmxDeleteExchangeRate deletes a rate and returns the updated table
+func (h *WebHandler) HtmxDeleteExchangeRate(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Invalid exchange rate ID")))
+		return
+	}
+
+	if err := h.repo.DeleteExchangeRate(auth.UserID(c), id); err != nil {
+		message := "Failed to delete exchange rate"
+		if errors.Is(err, sql.ErrNoRows) {
+			message = "Exchange rate not found"
+		}
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse(message)+h.renderExchangeRates(auth.UserID(c))))
+		return
+	}
+
+	c.Data(http.StatusOK, "text/html", []byte(h.renderExchangeRates(auth.UserID(c))))
+}
+
+// renderExchangeRates renders the user's rates table with a delete button per
+// rate
+func (h *WebHandler) renderExchangeRates(userID int64) string {
+	rates, err := h.repo.ListExchangeRates(userID, "")
+	if err != nil {
+		return createErrorResponse("Failed to load exchange rates")
+	}
+	if len(rates) == 0 {
+		return `<p>No exchange rates yet. Receipts in other currencies are left out of analytics until a rate is known.</p>`
+	}
+
+	var out strings.Builder
+	out.WriteString(`<table class="table"><thead><tr><th>Date</th><th>Currency</th><th>Rate</th><th>Source</th><th>Actions</th></tr></thead><tbody>`)
+	for _, rate := range rates {
+		out.WriteString(fmt.Sprintf(`<tr><td>%s</td><td>1 %s</td><td>%s %s</td><td>%s</td><td>
+				<button class="btn btn-sm btn-secondary"
+						hx-delete="/receipts-web/htmx/exchange-rates/%d"
+						hx-target="#exchange-rates-list"
+						hx-confirm="Delete this exchange rate?">
+					Delete
+				</button></td></tr>`,
+			formatDate(rate.Date), template.HTMLEscapeString(rate.Currency),
+			strconv.FormatFloat(rate.Rate, 'f', -1, 64), template.HTMLEscapeString(rate.QuoteCurrency),
+			template.HTMLEscapeString(rate.Source), rate.ID))
+	}
+	out.WriteString(`</tbody></table>`)
+
+	return out.String()
+}
@@ -0,0 +1,153 @@
+package receipts
+
+import (
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mauroue/cereja-corp/internal/models"
+)
+
+func TestNormalizeCurrency(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+		ok   bool
+	}{
+		{"BRL", "BRL", true},
+		{" usd ", "USD", true},
+		{"Eur", "EUR", true},
+		{"REAIS", "", false},
+		{"R$", "", false},
+		{"U5D", "", false},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			got, err := normalizeCurrency(tt.code)
+			if tt.ok && (err != nil || got != tt.want) {
+				t.Errorf("normalizeCurrency(%q) = %q, %v; want %q", tt.code, got, err, tt.want)
+			}
+			if !tt.ok && !errors.Is(err, ErrInvalidCurrency) {
+				t.Errorf("normalizeCurrency(%q) = %q, %v; want ErrInvalidCurrency", tt.code, got, err)
+			}
+		})
+	}
+}
+
+func TestFormatMoney(t *testing.T) {
+	tests := []struct {
+		amount   float64
+		currency string
+		want     string
+	}{
+		{12.5, "BRL", "R$12.50"},
+		{1234.567, "USD", "$1234.57"},
+		{-3, "EUR", "€-3.00"},
+		{7, "CHF", "CHF 7.00"},
+		{7, "", "7.00"},
+	}
+
+	for _, tt := range tests {
+		if got := formatMoney(tt.amount, tt.currency); got != tt.want {
+			t.Errorf("formatMoney(%v, %q) = %q, want %q", tt.amount, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestBaseCurrency(t *testing.T) {
+	if got := baseCurrency(); got != "BRL" {
+		t.Errorf("baseCurrency() = %q, want the default BRL", got)
+	}
+	if got := formatCurrency(2); got != "R$2.00" {
+		t.Errorf("formatCurrency(2) = %q, want it in the base currency", got)
+	}
+}
+
+func TestFormCurrency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		value string
+		want  string
+		ok    bool
+	}{
+		{"", baseCurrency(), true},
+		{"  ", baseCurrency(), true},
+		{"usd", "USD", true},
+		{"dollars", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("POST", "/", strings.NewReader(url.Values{"currency": {tt.value}}.Encode()))
+			c.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			got, err := formCurrency(c)
+			if (err == nil) != tt.ok || got != tt.want {
+				t.Errorf("formCurrency with %q = %q, %v; want %q", tt.value, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeExchangeRate(t *testing.T) {
+	day := time.Date(2024, 5, 10, 0, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name  string
+		rate  models.ExchangeRate
+		quote string
+		err   string
+	}{
+		{"quote defaults to the base currency", models.ExchangeRate{Date: day, Currency: "usd", Rate: 5.1}, baseCurrency(), ""},
+		{"explicit quote", models.ExchangeRate{Date: day, Currency: "EUR", QuoteCurrency: "usd", Rate: 1.08}, "USD", ""},
+		{"same currencies", models.ExchangeRate{Date: day, Currency: "BRL", Rate: 1}, "", "must differ"},
+		{"bad currency", models.ExchangeRate{Date: day, Currency: "dollar", Rate: 5}, "", "invalid currency"},
+		{"bad quote", models.ExchangeRate{Date: day, Currency: "USD", QuoteCurrency: "R$", Rate: 5}, "", "invalid currency"},
+		{"zero rate", models.ExchangeRate{Date: day, Currency: "USD"}, "", "greater than zero"},
+		{"no date", models.ExchangeRate{Currency: "USD", Rate: 5}, "", "date is required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate := tt.rate
+			err := normalizeExchangeRate(&rate)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("normalizeExchangeRate = %v, want an error mentioning %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("normalizeExchangeRate: %v", err)
+			}
+			if rate.QuoteCurrency != tt.quote || strings.ToUpper(tt.rate.Currency) != rate.Currency || rate.Source != "manual" {
+				t.Errorf("rate = %s/%s from %q, want %s/%s from manual", rate.Currency, rate.QuoteCurrency, rate.Source, strings.ToUpper(tt.rate.Currency), tt.quote)
+			}
+		})
+	}
+}
+
+func TestParseImportCurrency(t *testing.T) {
+	data := "store,date,total,currency\nMercado,2024-05-10,10,usd\nPadaria,2024-05-11,5,\n"
+	_, receipts, err := parseImport([]byte(data), nil)
+	if err != nil {
+		t.Fatalf("parseImport: %v", err)
+	}
+	if len(receipts) != 2 {
+		t.Fatalf("got %d receipts, want 2", len(receipts))
+	}
+	if got := receipts[0].Receipt.Currency; got != "USD" {
+		t.Errorf("currency = %q, want USD", got)
+	}
+	if got := receipts[1].Receipt.Currency; got != baseCurrency() {
+		t.Errorf("currency of a row without one = %q, want the base currency", got)
+	}
+}
@@ -0,0 +1,269 @@
+package receipts
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mauroue/cereja-corp/internal/auth"
+	"github.com/mauroue/cereja-corp/internal/models"
+)
+
+// dashboardListSize is the number of receipts shown in the dashboard lists
+const dashboardListSize = 5
+
+// SpendingTotal returns the total the user spent in the base currency and their
+// number of receipts within the range
+func (r *Repository) SpendingTotal(userID int64, rng DateRange) (float64, int, error) {
+	query := `
+		SELECT COALESCE(SUM(base_total), 0), COALESCE(SUM(receipt_count), 0)
+		FROM ` + convertedSpending("spending_daily", "$4") + `
+		WHERE day >= $1 AND day < $2 AND user_id = $3
+	`
+
+	var total float64
+	var count int
+	err := r.db.QueryRow(query, rng.From, rng.To, userID, baseCurrency()).Scan(&total, &count)
+	return total, count, err
+}
+
+// monthRange returns the calendar month containing t, offset by the given number of months
+func monthRange(t time.Time, offset int) DateRange {
+	start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.Local).AddDate(0, offset, 0)
+	return DateRange{From: start, To: start.AddDate(0, 1, 0)}
+}
+
+// lastDays returns the range covering the last n days, including today
+func lastDays(t time.Time, n int) DateRange {
+	today := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+	return DateRange{From: today.AddDate(0, 0, 1-n), To: today.AddDate(0, 0, 1)}
+}
+
+// HomePage renders the spending dashboard. Each panel is loaded as its own HTMX partial.
+func (h *WebHandler) HomePage(c *gin.Context) {
+	panel := func(title, path string) string {
+		return fmt.Sprintf(`
+    <div class="card dashboard-panel">
+        <div class="card-header">
+            <h2 class="card-title">%s</h2>
+        </div>
+        <div hx-get="/receipts-web/htmx/dashboard/%s" hx-trigger="load">
+            <div class="loading-spinner"></div>
+        </div>
+    </div>`, title, path)
+	}
+
+	content := `
+<div class="card-header">
+    <h1 class="card-title">Dashboard</h1>
+    <div>
+        <a href="/receipts-web/upload" class="btn btn-primary">Upload a Receipt</a>
+        <a href="/receipts-web/list" class="btn btn-secondary">View My Receipts</a>
+    </div>
+</div>
+<div class="dashboard-grid">` +
+		panel("This Month", "summary") +
+		panel("Categories (last 30 days)", "categories") +
+		panel("Monthly Spending", "trend") +
+		panel("Top Stores (last 30 days)", "stores") +
+		panel("Recent Receipts", "recent") +
+		panel("Needs Review", "review") +
+		panel("Budgets", "budgets") + `
+</div>
+`
+	html := renderPageWithLayout("Dashboard", content)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(html))
+}
+
+// HtmxDashboardSummary returns this month's spending compared with last month
+func (h *WebHandler) HtmxDashboardSummary(c *gin.Context) {
+	now := time.Now()
+	thisMonth, err1 := h.spendingTotal(auth.UserID(c), monthRange(now, 0))
+	lastMonth, err2 := h.spendingTotal(auth.UserID(c), monthRange(now, -1))
+	if err1 != nil || err2 != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Failed to load spending")))
+		return
+	}
+
+	change := "no spending last month"
+	if pct := percentChange(lastMonth.total, thisMonth.total); pct != nil {
+		change = formatPercentChange(pct) + " vs last month"
+	}
+
+	html := fmt.Sprintf(`
+	<div class="dashboard-stat">
+		<div class="dashboard-stat-value">%s</div>
+		<div class="dashboard-stat-label">%d receipts · %s</div>
+		<div class="dashboard-stat-label">Last month: %s (%d receipts)</div>
+	</div>
+	`,
+		formatCurrency(thisMonth.total), thisMonth.count, change,
+		formatCurrency(lastMonth.total), lastMonth.count)
+
+	c.Data(http.StatusOK, "text/html", []byte(html))
+}
+
+// periodTotal is the spending and receipt count of a date range
+type periodTotal struct {
+	total float64
+	count int
+}
+
+// spendingTotal wraps Repository.SpendingTotal for the dashboard panels
+func (h *WebHandler) spendingTotal(userID int64, rng DateRange) (periodTotal, error) {
+	total, count, err := h.repo.SpendingTotal(userID, rng)
+	return periodTotal{total: total, count: count}, err
+}
+
+// HtmxDashboardCategories returns a donut chart of spending per category
+func (h *WebHandler) HtmxDashboardCategories(c *gin.Context) {
+	breakdown, err := h.repo.SpendingBreakdown(auth.UserID(c), BreakdownCategory, lastDays(time.Now(), 30), 7)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Failed to load categories")))
+		return
+	}
+
+	var slices []chartSlice
+	for _, e := range breakdown.Entries {
+		slices = append(slices, chartSlice{Label: e.Key, Value: e.Total})
+	}
+	if breakdown.Other > 0 {
+		slices = append(slices, chartSlice{Label: "Other", Value: breakdown.Other})
+	}
+
+	c.Data(http.StatusOK, "text/html", []byte(renderDonutChart(slices, 200, formatCurrency)))
+}
+
+// HtmxDashboardTrend returns a line chart of monthly spending over the last year
+func (h *WebHandler) HtmxDashboardTrend(c *gin.Context) {
+	now := time.Now()
+	rng := DateRange{From: monthRange(now, -11).From, To: monthRange(now, 0).To}
+
+	series, err := h.repo.SpendingOverTime(auth.UserID(c), PeriodMonth, rng)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Failed to load spending trend")))
+		return
+	}
+
+	line := chartSeries{Label: "Spending per month"}
+	for _, p := range series.Points {
+		line.Points = append(line.Points, chartPoint{X: p.PeriodStart, Y: p.Total})
+	}
+
+	c.Data(http.StatusOK, "text/html", []byte(renderLineChart([]chartSeries{line}, 520, 240, formatCurrency)))
+}
+
+// HtmxDashboardStores returns the stores with the highest spending
+func (h *WebHandler) HtmxDashboardStores(c *gin.Context) {
+	breakdown, err := h.repo.SpendingBreakdown(auth.UserID(c), BreakdownStore, lastDays(time.Now(), 30), dashboardListSize)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Failed to load stores")))
+		return
+	}
+	if len(breakdown.Entries) == 0 {
+		c.Data(http.StatusOK, "text/html", []byte(`<p>No purchases in the last 30 days.</p>`))
+		return
+	}
+
+	var html strings.Builder
+	html.WriteString(`<table class="table"><thead><tr><th>Store</th><th>Receipts</th><th>Total</th><th>Share</th></tr></thead><tbody>`)
+	for _, e := range breakdown.Entries {
+		html.WriteString(fmt.Sprintf(`<tr><td>%s</td><td>%d</td><td>%s</td><td>%.0f%%</td></tr>`,
+			template.HTMLEscapeString(e.Key), e.Count, formatCurrency(e.Total), e.Share))
+	}
+	html.WriteString(`</tbody></table>`)
+
+	c.Data(http.StatusOK, "text/html", []byte(html.String()))
+}
+
+// HtmxDashboardRecent returns the most recent receipts
+func (h *WebHandler) HtmxDashboardRecent(c *gin.Context) {
+	page, err := h.repo.ListReceipts(&ReceiptFilter{UserID: auth.UserID(c), Limit: dashboardListSize})
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Failed to load receipts")))
+		return
+	}
+	if len(page.Receipts) == 0 {
+		c.Data(http.StatusOK, "text/html", []byte(`<p>No receipts yet. <a href="/receipts-web/upload">Upload your first receipt</a>.</p>`))
+		return
+	}
+
+	var html strings.Builder
+	html.WriteString(`<table class="table"><tbody>`)
+	for _, receipt := range page.Receipts {
+		html.WriteString(fmt.Sprintf(`<tr><td><a href="/receipts-web/view/%d">%s</a></td><td>%s</td><td>%s</td></tr>`,
+			receipt.ID, template.HTMLEscapeString(receipt.StoreName),
+			formatDate(receipt.PurchaseDate), formatMoney(receipt.TotalAmount, receipt.Currency)))
+	}
+	html.WriteString(`</tbody></table>`)
+
+	c.Data(http.StatusOK, "text/html", []byte(html.String()))
+}
+
+// HtmxDashboardReview returns the receipts still waiting for review
+func (h *WebHandler) HtmxDashboardReview(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html", []byte(h.renderReviewList(auth.UserID(c))))
+}
+
+// HtmxConfirmReceipt marks a receipt as reviewed and returns the updated review list
+func (h *WebHandler) HtmxConfirmReceipt(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Invalid receipt ID")))
+		return
+	}
+
+	status := ReviewConfirmed
+	receipt, confirmed, err := h.repo.UpdateReceipt(auth.UserID(c), id, &ReceiptUpdate{ReviewStatus: &status})
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Failed to confirm receipt")))
+		return
+	}
+	h.repo.refreshAnalyticsAsync()
+	var alerts []*models.BudgetAlert
+	if confirmed {
+		alerts = h.repo.receiptConfirmed(receipt)
+	}
+
+	c.Data(http.StatusOK, "text/html", []byte(renderBudgetAlerts(alerts)+h.renderReviewList(auth.UserID(c))))
+}
+
+// renderReviewList renders the pending receipts with a button to confirm each one
+func (h *WebHandler) renderReviewList(userID int64) string {
+	page, err := h.repo.ListReceipts(&ReceiptFilter{UserID: userID, ReviewStatus: ReviewPending, Limit: dashboardListSize})
+	if err != nil {
+		return createErrorResponse("Failed to load receipts")
+	}
+	if len(page.Receipts) == 0 {
+		return `<p>All receipts are reviewed.</p>`
+	}
+
+	var html strings.Builder
+	html.WriteString(fmt.Sprintf(`<div id="review-list"><p>%d receipts need review</p><table class="table"><tbody>`, page.Total))
+	for _, receipt := range page.Receipts {
+		html.WriteString(fmt.Sprintf(`
+		<tr>
+			<td><a href="/receipts-web/view/%d">%s</a></td>
+			<td>%s</td>
+			<td>%s</td>
+			<td>
+				<button class="btn btn-sm btn-info"
+						hx-post="/receipts-web/htmx/receipt/%d/confirm"
+						hx-target="#review-list"
+						hx-swap="outerHTML">
+					Confirm
+				</button>
+			</td>
+		</tr>
+		`,
+			receipt.ID, template.HTMLEscapeString(receipt.StoreName),
+			formatDate(receipt.PurchaseDate), formatMoney(receipt.TotalAmount, receipt.Currency), receipt.ID))
+	}
+	html.WriteString(`</tbody></table></div>`)
+
+	return html.String()
+}
@@ -0,0 +1,274 @@
+package receipts
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/mauroue/cereja-corp/internal/models"
+)
+
+// Export formats
+const (
+	ExportCSV  = "csv"
+	ExportJSON = "json"
+)
+
+// exportFlushEvery is the number of receipts written between flushes to the client
+const exportFlushEvery = 100
+
+// exportStatusTrailer is the HTTP trailer telling the client whether the export
+// finished (exportComplete) or stopped partway (exportFailed)
+const (
+	exportStatusTrailer = "X-Export-Status"
+	exportComplete      = "complete"
+	exportFailed        = "failed"
+)
+
+// csvExportHeader lists the CSV export columns: the receipt, store and category
+// fields repeated on every row, followed by one item per row
+var csvExportHeader = []string{
+	"receipt_id", "store_name", "purchase_date", "total_amount", "currency", "category", "review_status",
+	"tags", "note",
+	"store_id", "store_address", "store_chain",
+	"item_id", "item_name", "item_description", "quantity", "unit", "unit_price", "total_price",
+	"base_unit", "base_quantity", "normalized_unit_price", "item_tags",
+}
+
+// ExportReceipt is a receipt with its store and items, as written by the exports.
+// PaymentAccount is the statement account of the transaction linked to the receipt.
+type ExportReceipt struct {
+	*models.Receipt
+	Store          *models.Store         `json:"store,omitempty"`
+	PaymentAccount string                `json:"payment_account,omitempty"`
+	Items          []*models.ReceiptItem `json:"items"`
+}
+
+// ExportReceipts streams every receipt matching the filter, with its store and
+// items, to fn in the filter's sort order. Rows are read one at a time, so only
+// the receipt being assembled is held in memory. The filter's limit and cursor
+// are ignored.
+func (r *Repository) ExportReceipts(filter *ReceiptFilter, fn func(*ExportReceipt) error) error {
+	filter.normalize()
+	conditions, args := filter.where()
+
+	direction := "DESC"
+	if filter.Order == OrderAsc {
+		direction = "ASC"
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s,
+			COALESCE(s.id, 0), COALESCE(s.name, ''), COALESCE(s.address, ''), COALESCE(s.chain, ''),
+			COALESCE(ri.id, 0), COALESCE(ri.name, ''), COALESCE(ri.description, ''),
+			COALESCE(ri.quantity, 0), COALESCE(ri.unit, ''), COALESCE(ri.unit_price, 0),
+			COALESCE(ri.total_price, 0), COALESCE(ri.base_unit, ''), COALESCE(ri.base_quantity, 0),
+			COALESCE(ri.normalized_unit_price, 0), `+itemTagsColumn+`, COALESCE(t.account, '')
+		FROM %s
+		LEFT JOIN stores s ON s.id = r.store_id
+		LEFT JOIN transactions t ON t.receipt_id = r.id
+		LEFT JOIN receipt_items ri ON ri.receipt_id = r.id
+		%s
+		ORDER BY %s %s, r.id %s, ri.id
+	`, receiptColumns, receiptTables, whereClause(conditions), sortExpressions[filter.Sort], direction, direction)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var current *ExportReceipt
+	for rows.Next() {
+		var store models.Store
+		var item models.ReceiptItem
+		var paymentAccount string
+		receipt, err := scanReceipt(rows,
+			&store.ID, &store.Name, &store.Address, &store.Chain,
+			&item.ID, &item.Name, &item.Description, &item.Quantity, &item.Unit, &item.UnitPrice,
+			&item.TotalPrice, &item.BaseUnit, &item.BaseQuantity, &item.NormalizedUnitPrice, pq.Array(&item.Tags), &paymentAccount)
+		if err != nil {
+			return err
+		}
+
+		if current == nil || current.ID != receipt.ID {
+			if current != nil {
+				if err := fn(current); err != nil {
+					return err
+				}
+			}
+			current = &ExportReceipt{Receipt: receipt, PaymentAccount: paymentAccount, Items: []*models.ReceiptItem{}}
+			if store.ID != 0 {
+				current.Store = &store
+			}
+		}
+
+		if item.ID != 0 {
+			item.ReceiptID = receipt.ID
+			current.Items = append(current.Items, &item)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if current != nil {
+		return fn(current)
+	}
+	return nil
+}
+
+// csvExportRows returns the CSV rows of a receipt: one per item, or a single row
+// without item fields when the receipt has no items
+func csvExportRows(receipt *ExportReceipt) [][]string {
+	formatFloat := func(f float64) string {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+
+	base := []string{
+		strconv.FormatInt(receipt.ID, 10),
+		receipt.StoreName,
+		receipt.PurchaseDate.Format(time.RFC3339),
+		formatFloat(receipt.TotalAmount),
+		receipt.Currency,
+		receipt.CategoryName,
+		receipt.ReviewStatus,
+		strings.Join(receipt.Tags, ", "),
+		receipt.Note,
+		"", "", "",
+	}
+	if receipt.Store != nil {
+		base[9] = strconv.FormatInt(receipt.Store.ID, 10)
+		base[10] = receipt.Store.Address
+		base[11] = receipt.Store.Chain
+	}
+
+	if len(receipt.Items) == 0 {
+		return [][]string{append(base, make([]string, len(csvExportHeader)-len(base))...)}
+	}
+
+	rows := make([][]string, 0, len(receipt.Items))
+	for _, item := range receipt.Items {
+		row := append(append([]string(nil), base...),
+			strconv.FormatInt(item.ID, 10),
+			item.Name,
+			item.Description,
+			formatFloat(item.Quantity),
+			item.Unit,
+			formatFloat(item.UnitPrice),
+			formatFloat(item.TotalPrice),
+			item.BaseUnit,
+			formatFloat(item.BaseQuantity),
+			formatFloat(item.NormalizedUnitPrice),
+			strings.Join(item.Tags, ", "),
+		)
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// WriteExport writes the receipts matching the filter to w as CSV (one row per
+// item) or as a JSON array, and returns the number of receipts written. flush,
+// if not nil, is called every exportFlushEvery receipts. If the export fails
+// partway the JSON array is left unterminated, so it cannot be mistaken for a
+// complete export.
+func (r *Repository) WriteExport(w io.Writer, format string, filter *ReceiptFilter, flush func()) (int, error) {
+	count := 0
+	written := func() {
+		if count++; flush != nil && count%exportFlushEvery == 0 {
+			flush()
+		}
+	}
+
+	switch format {
+	case ExportCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(csvExportHeader); err != nil {
+			return 0, err
+		}
+		err := r.ExportReceipts(filter, func(receipt *ExportReceipt) error {
+			if err := cw.WriteAll(csvExportRows(receipt)); err != nil {
+				return err
+			}
+			written()
+			return nil
+		})
+		cw.Flush()
+		if err == nil {
+			err = cw.Error()
+		}
+		return count, err
+
+	case ExportJSON:
+		if _, err := io.WriteString(w, "["); err != nil {
+			return 0, err
+		}
+		err := r.ExportReceipts(filter, func(receipt *ExportReceipt) error {
+			data, err := json.Marshal(receipt)
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				if _, err := io.WriteString(w, ","); err != nil {
+					return err
+				}
+			}
+			if _, err := w.Write(data); err != nil {
+				return err
+			}
+			written()
+			return nil
+		})
+		if err != nil {
+			return count, err
+		}
+		_, err = io.WriteString(w, "]")
+		return count, err
+	}
+
+	return 0, fmt.Errorf("format must be csv or json")
+}
+
+// ExportReceipts handles streaming the filtered receipts as CSV (one row per item)
+// or as a JSON array of receipts with nested store and items
+func (h *Handler) ExportReceipts(c *gin.Context) {
+	format := c.DefaultQuery("format", ExportCSV)
+	if format != ExportCSV && format != ExportJSON {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or json"})
+		return
+	}
+
+	filter, err := filterFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filename := fmt.Sprintf("receipts-%s.%s", time.Now().Format("20060102"), format)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	if format == ExportCSV {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		c.Header("Content-Type", "application/json; charset=utf-8")
+	}
+
+	// Once the first receipt is written the status can no longer change, so
+	// the outcome is reported in the exportStatusTrailer trailer instead
+	c.Header("Trailer", exportStatusTrailer)
+	count, err := h.repo.WriteExport(c.Writer, format, filter, c.Writer.Flush)
+	if err != nil {
+		log.Printf("Failed to export receipts after %d receipts: %v", count, err)
+		c.Writer.Header().Set(exportStatusTrailer, exportFailed)
+		return
+	}
+	c.Writer.Header().Set(exportStatusTrailer, exportComplete)
+}
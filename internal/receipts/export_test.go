@@ -0,0 +1,94 @@
+package receipts
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mauroue/cereja-corp/internal/models"
+)
+
+func TestCSVExportRows(t *testing.T) {
+	receipt := &ExportReceipt{
+		Receipt: &models.Receipt{
+			ID:           7,
+			StoreName:    "Mercado, Centro",
+			PurchaseDate: time.Date(2024, 5, 10, 18, 30, 0, 0, time.UTC),
+			TotalAmount:  12.5,
+			Currency:     "BRL",
+			CategoryName: "Groceries",
+			ReviewStatus: ReviewConfirmed,
+			Tags:         []string{"trip", "work"},
+			Note:         "split with \"Ana\"",
+		},
+		Store: &models.Store{ID: 3, Address: "Rua A, 1", Chain: "Mercado"},
+	}
+
+	rows := csvExportRows(receipt)
+	want := []string{"7", "Mercado, Centro", "2024-05-10T18:30:00Z", "12.5", "BRL", "Groceries", ReviewConfirmed,
+		"trip, work", "split with \"Ana\"", "3", "Rua A, 1", "Mercado"}
+	if len(rows) != 1 || len(rows[0]) != len(csvExportHeader) {
+		t.Fatalf("receipt without items = %v, want one row of %d columns", rows, len(csvExportHeader))
+	}
+	if !reflect.DeepEqual(rows[0][:len(want)], want) || strings.Join(rows[0][len(want):], "") != "" {
+		t.Errorf("row = %q, want %q and empty item columns", rows[0], want)
+	}
+
+	receipt.Store = nil
+	receipt.Items = []*models.ReceiptItem{
+		{ID: 1, Name: "ARROZ", Quantity: 2, Unit: "un", UnitPrice: 5, TotalPrice: 10, BaseUnit: UnitPiece, BaseQuantity: 2, NormalizedUnitPrice: 5},
+		{ID: 2, Name: "LEITE", Quantity: 1, Unit: "l", UnitPrice: 2.5, TotalPrice: 2.5, BaseUnit: UnitLiter, BaseQuantity: 1, NormalizedUnitPrice: 2.5, Tags: []string{"kids"}},
+	}
+	rows = csvExportRows(receipt)
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want one per item", len(rows))
+	}
+	for i, row := range rows {
+		if len(row) != len(csvExportHeader) || row[0] != "7" || row[9] != "" {
+			t.Errorf("row %d = %q, want the receipt fields without a store", i, row)
+		}
+	}
+	if got := rows[1][12:]; !reflect.DeepEqual(got, []string{"2", "LEITE", "", "1", "l", "2.5", "2.5", UnitLiter, "1", "2.5", "kids"}) {
+		t.Errorf("item row = %q", got)
+	}
+
+	// The rows survive a CSV round trip despite commas and quotes
+	var out strings.Builder
+	w := csv.NewWriter(&out)
+	if err := w.WriteAll(rows); err != nil {
+		t.Fatal(err)
+	}
+	back, err := csv.NewReader(strings.NewReader(out.String())).ReadAll()
+	if err != nil || !reflect.DeepEqual(back, rows) {
+		t.Errorf("CSV round trip = %q, %v; want %q", back, err, rows)
+	}
+}
+
+func TestExportReceiptJSON(t *testing.T) {
+	receipt := &ExportReceipt{
+		Receipt:        &models.Receipt{ID: 7, StoreName: "Mercado", Currency: "USD"},
+		PaymentAccount: "Assets:Bank",
+		Items:          []*models.ReceiptItem{},
+	}
+	data, err := json.Marshal(receipt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if fields["id"] != float64(7) || fields["currency"] != "USD" || fields["payment_account"] != "Assets:Bank" {
+		t.Errorf("export JSON = %s, want the receipt fields inline", data)
+	}
+	if _, ok := fields["store"]; ok {
+		t.Errorf("export JSON = %s, want no store", data)
+	}
+	if items, ok := fields["items"].([]interface{}); !ok || len(items) != 0 {
+		t.Errorf("export JSON = %s, want an empty items array", data)
+	}
+}
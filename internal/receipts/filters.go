@@ -0,0 +1,325 @@
+package receipts
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mauroue/cereja-corp/internal/auth"
+	"github.com/mauroue/cereja-corp/internal/models"
+)
+
+// Review statuses of a receipt
+const (
+	ReviewPending   = "pending"
+	ReviewConfirmed = "confirmed"
+)
+
+// Sort fields and orders for receipt listings
+const (
+	SortDate   = "date"
+	SortAmount = "amount"
+	SortStore  = "store"
+
+	OrderAsc  = "asc"
+	OrderDesc = "desc"
+)
+
+const (
+	defaultPageSize = 10
+	maxPageSize     = 100
+)
+
+// sortExpressions maps sort fields to the SQL expression receipts are ordered by
+var sortExpressions = map[string]string{
+	SortDate:   "r.purchase_date",
+	SortAmount: "r.total_amount",
+	SortStore:  "LOWER(r.store_name)",
+}
+
+// sortCasts maps sort fields to the SQL type their cursor key is cast back to
+var sortCasts = map[string]string{
+	SortDate:   "timestamptz",
+	SortAmount: "numeric",
+	SortStore:  "text",
+}
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ReceiptFilter selects, sorts and pages receipts. Zero values mean "no filter",
+// except for UserID: only the receipts of that user are ever selected.
+type ReceiptFilter struct {
+	UserID        int64
+	From          *time.Time
+	To            *time.Time
+	StoreID       int64
+	Store         string
+	MinAmount     *float64
+	MaxAmount     *float64
+	CategoryID    int64
+	Tag           string
+	ReviewStatus  string
+	Search        string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Sort          string
+	Order         string
+	Limit         int
+	Cursor        string
+}
+
+// ReceiptPage is one page of a receipt listing
+type ReceiptPage struct {
+	Receipts   []*models.Receipt `json:"receipts"`
+	Total      int               `json:"total"`
+	Limit      int               `json:"limit"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+	PrevCursor string            `json:"prev_cursor,omitempty"`
+}
+
+// ReceiptUpdate holds the receipt fields to change; nil fields are left as they are.
+// A CategoryID of 0 removes the receipt's category and an empty Note clears the note.
+type ReceiptUpdate struct {
+	StoreName    *string    `json:"store_name"`
+	PurchaseDate *time.Time `json:"purchase_date"`
+	TotalAmount  *float64   `json:"total_amount"`
+	CategoryID   *int64     `json:"category_id"`
+	ReviewStatus *string    `json:"review_status"`
+	Currency     *string    `json:"currency"`
+	Note         *string    `json:"note"`
+}
+
+// Validate checks the update for unsupported values
+func (u *ReceiptUpdate) Validate() error {
+	if u.ReviewStatus != nil && *u.ReviewStatus != ReviewPending && *u.ReviewStatus != ReviewConfirmed {
+		return fmt.Errorf("review_status must be %q or %q", ReviewPending, ReviewConfirmed)
+	}
+	if u.StoreName != nil && strings.TrimSpace(*u.StoreName) == "" {
+		return errors.New("store_name cannot be empty")
+	}
+	if u.Note != nil && len(*u.Note) > maxNoteLength {
+		return fmt.Errorf("note cannot be longer than %d characters", maxNoteLength)
+	}
+	if u.Currency != nil {
+		currency, err := normalizeCurrency(*u.Currency)
+		if err != nil {
+			return err
+		}
+		u.Currency = &currency
+	}
+	return nil
+}
+
+// pageCursor marks the row a page starts after (or before, when walking backward)
+type pageCursor struct {
+	Key      string `json:"k"`
+	ID       int64  `json:"id"`
+	Backward bool   `json:"b,omitempty"`
+}
+
+// encodeCursor encodes a cursor as an opaque URL-safe string
+func encodeCursor(c *pageCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor decodes a cursor produced by encodeCursor; an empty string yields nil
+func decodeCursor(s string) (*pageCursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c pageCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// normalize applies defaults and bounds to the sort and page size
+func (f *ReceiptFilter) normalize() {
+	if _, ok := sortExpressions[f.Sort]; !ok {
+		f.Sort = SortDate
+	}
+	if f.Order != OrderAsc {
+		f.Order = OrderDesc
+	}
+	if f.Limit < 1 {
+		f.Limit = defaultPageSize
+	}
+	if f.Limit > maxPageSize {
+		f.Limit = maxPageSize
+	}
+}
+
+// where builds the SQL conditions and arguments for the filter, against receiptTables
+func (f *ReceiptFilter) where() ([]string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	add := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	add("r.user_id = $%d", f.UserID)
+	if f.From != nil {
+		add("r.purchase_date >= $%d", *f.From)
+	}
+	if f.To != nil {
+		add("r.purchase_date < $%d", *f.To)
+	}
+	if f.StoreID > 0 {
+		add("r.store_id = $%d", f.StoreID)
+	}
+	if f.Store != "" {
+		add(`r.store_name ILIKE $%d ESCAPE '\'`, containsPattern(f.Store))
+	}
+	if f.MinAmount != nil {
+		add("r.total_amount >= $%d", *f.MinAmount)
+	}
+	if f.MaxAmount != nil {
+		add("r.total_amount <= $%d", *f.MaxAmount)
+	}
+	if f.CategoryID > 0 {
+		add("r.category_id = $%d", f.CategoryID)
+	}
+	if f.Tag != "" {
+		add(`EXISTS (
+			SELECT 1 FROM tags t
+			WHERE LOWER(t.name) = LOWER($%d)
+			  AND (EXISTS (SELECT 1 FROM receipt_tags rt WHERE rt.receipt_id = r.id AND rt.tag_id = t.id)
+			    OR EXISTS (SELECT 1 FROM receipt_item_tags it JOIN receipt_items ri ON ri.id = it.item_id
+			               WHERE ri.receipt_id = r.id AND it.tag_id = t.id)))`, f.Tag)
+	}
+	if f.ReviewStatus != "" {
+		add("r.review_status = $%d", f.ReviewStatus)
+	}
+	if f.CreatedAfter != nil {
+		add("r.created_at > $%d", *f.CreatedAfter)
+	}
+	if f.CreatedBefore != nil {
+		add("r.created_at <= $%d", *f.CreatedBefore)
+	}
+	if tsquery := prefixQuery(f.Search); tsquery != "" {
+		args = append(args, tsquery)
+		conditions = append(conditions, searchCondition(len(args)))
+	}
+
+	return conditions, args
+}
+
+// whereClause joins conditions into a WHERE clause, or returns an empty string
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(conditions, " AND ")
+}
+
+// filterFromQuery reads a receipt filter from the request's query parameters
+func filterFromQuery(c *gin.Context) (*ReceiptFilter, error) {
+	filter := &ReceiptFilter{
+		UserID:       auth.UserID(c),
+		Store:        c.Query("store"),
+		Tag:          c.Query("tag"),
+		ReviewStatus: c.Query("review_status"),
+		Search:       c.Query("search"),
+		Sort:         c.Query("sort"),
+		Order:        c.Query("order"),
+		Cursor:       c.Query("cursor"),
+	}
+
+	var err error
+	if filter.From, err = queryDate(c, "from", false); err != nil {
+		return nil, err
+	}
+	if filter.To, err = queryDate(c, "to", true); err != nil {
+		return nil, err
+	}
+	if filter.MinAmount, err = queryFloat(c, "min_amount"); err != nil {
+		return nil, err
+	}
+	if filter.MaxAmount, err = queryFloat(c, "max_amount"); err != nil {
+		return nil, err
+	}
+	if filter.StoreID, err = queryInt(c, "store_id"); err != nil {
+		return nil, err
+	}
+	if filter.CategoryID, err = queryInt(c, "category_id"); err != nil {
+		return nil, err
+	}
+
+	limit, err := queryInt(c, "limit")
+	if err != nil {
+		return nil, err
+	}
+	filter.Limit = int(limit)
+
+	if filter.ReviewStatus != "" && filter.ReviewStatus != ReviewPending && filter.ReviewStatus != ReviewConfirmed {
+		return nil, fmt.Errorf("review_status must be %q or %q", ReviewPending, ReviewConfirmed)
+	}
+
+	return filter, nil
+}
+
+// queryDate parses a YYYY-MM-DD or RFC 3339 query parameter. A plain date used
+// as an upper bound is moved to the next day so that the whole day is included.
+func queryDate(c *gin.Context, name string, upperBound bool) (*time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a date (YYYY-MM-DD)", name)
+	}
+	if upperBound {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+// queryFloat parses an optional decimal query parameter
+func queryFloat(c *gin.Context, name string) (*float64, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	f, err := strconv.ParseFloat(strings.ReplaceAll(value, ",", "."), 64)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a number", name)
+	}
+	return &f, nil
+}
+
+// queryInt parses an optional integer query parameter, returning 0 when absent
+func queryInt(c *gin.Context, name string) (int64, error) {
+	value := c.Query(name)
+	if value == "" {
+		return 0, nil
+	}
+
+	i, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an integer", name)
+	}
+	return i, nil
+}
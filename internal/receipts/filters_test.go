@@ -0,0 +1,120 @@
+package receipts
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor *pageCursor
+	}{
+		{"date", &pageCursor{Key: "2024-05-10T18:32:11Z", ID: 42}},
+		{"amount backward", &pageCursor{Key: "123.45", ID: 7, Backward: true}},
+		{"store with unicode", &pageCursor{Key: "pão & cia/ltda?", ID: 1}},
+		{"empty key", &pageCursor{ID: 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded := encodeCursor(tt.cursor)
+			if strings.ContainsAny(encoded, "+/=") {
+				t.Errorf("cursor %q is not URL-safe", encoded)
+			}
+			decoded, err := decodeCursor(encoded)
+			if err != nil {
+				t.Fatalf("decodeCursor(%q): %v", encoded, err)
+			}
+			if !reflect.DeepEqual(decoded, tt.cursor) {
+				t.Errorf("decoded = %+v, want %+v", decoded, tt.cursor)
+			}
+		})
+	}
+}
+
+func TestDecodeCursor(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor string
+		err    error
+	}{
+		{"empty", "", nil},
+		{"not base64", "not a cursor!", ErrInvalidCursor},
+		{"padded base64", "eyJrIjoiYSIsImlkIjoxfQ==", ErrInvalidCursor},
+		{"not json", "bm90IGpzb24", ErrInvalidCursor},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cursor, err := decodeCursor(tt.cursor)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("decodeCursor(%q) error = %v, want %v", tt.cursor, err, tt.err)
+			}
+			if tt.cursor == "" && cursor != nil {
+				t.Errorf("decodeCursor(\"\") = %+v, want nil", cursor)
+			}
+		})
+	}
+}
+
+func TestFilterNormalize(t *testing.T) {
+	tests := []struct {
+		name  string
+		in    ReceiptFilter
+		sort  string
+		order string
+		limit int
+	}{
+		{"defaults", ReceiptFilter{}, SortDate, OrderDesc, defaultPageSize},
+		{"kept", ReceiptFilter{Sort: SortAmount, Order: OrderAsc, Limit: 25}, SortAmount, OrderAsc, 25},
+		{"unknown sort", ReceiptFilter{Sort: "r.id; DROP TABLE receipts", Order: "sideways"}, SortDate, OrderDesc, defaultPageSize},
+		{"negative limit", ReceiptFilter{Limit: -5}, SortDate, OrderDesc, defaultPageSize},
+		{"limit capped", ReceiptFilter{Sort: SortStore, Limit: 1000}, SortStore, OrderDesc, maxPageSize},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := tt.in
+			f.normalize()
+			if f.Sort != tt.sort || f.Order != tt.order || f.Limit != tt.limit {
+				t.Errorf("normalize() = %s %s %d, want %s %s %d", f.Sort, f.Order, f.Limit, tt.sort, tt.order, tt.limit)
+			}
+		})
+	}
+}
+
+func TestFilterWhere(t *testing.T) {
+	from := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	min := 10.0
+
+	tests := []struct {
+		name       string
+		filter     ReceiptFilter
+		conditions []string
+		args       []interface{}
+	}{
+		{"user only", ReceiptFilter{UserID: 1}, []string{"r.user_id = $1"}, []interface{}{int64(1)}},
+		{"store name is matched literally", ReceiptFilter{UserID: 1, Store: "50%_off"},
+			[]string{"r.user_id = $1", `r.store_name ILIKE $2 ESCAPE '\'`},
+			[]interface{}{int64(1), `%50\%\_off%`}},
+		{"placeholders follow the arguments", ReceiptFilter{UserID: 2, From: &from, MinAmount: &min, CategoryID: 3},
+			[]string{"r.user_id = $1", "r.purchase_date >= $2", "r.total_amount >= $3", "r.category_id = $4"},
+			[]interface{}{int64(2), from, min, int64(3)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conditions, args := tt.filter.where()
+			if !reflect.DeepEqual(conditions, tt.conditions) {
+				t.Errorf("conditions = %q, want %q", conditions, tt.conditions)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("args = %v, want %v", args, tt.args)
+			}
+		})
+	}
+}
@@ -1,53 +1,110 @@
 package receipts
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"os"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
-	"github.com/mauroue/cereja-corp/internal/db"
+	"github.com/mauroue/cereja-corp/config"
+	"github.com/mauroue/cereja-corp/internal/auth"
 )
 
 // Handler manages HTTP requests for receipts
 type Handler struct {
-	repo       *Repository
-	ocrService *OCRService
+	repo      *Repository
+	users     *auth.Repository
+	processor *Processor
+	// maxUploadMB is the largest receipt image accepted, in megabytes
+	maxUploadMB int
 }
 
 // NewHandler creates a new receipt handler
-func NewHandler(uploadDir string) (*Handler, error) {
-	database, err := db.GetDB()
-	if err != nil {
-		return nil, err
-	}
-
+func NewHandler(database *sql.DB, uploadDir string) (*Handler, error) {
 	repo := NewRepository(database)
 
-	// Get AWS region from environment variable or use a default
-	awsRegion := os.Getenv("AWS_REGION")
-	if awsRegion == "" {
-		awsRegion = "us-east-1" // Default region if not specified
-	}
-
-	ocrService := NewOCRService(uploadDir, awsRegion)
-
 	return &Handler{
-		repo:       repo,
-		ocrService: ocrService,
+		repo:        repo,
+		users:       auth.NewRepository(database),
+		processor:   NewProcessor(repo, uploadDir),
+		maxUploadMB: config.Get().Upload.MaxSizeMB,
 	}, nil
 }
 
-// RegisterRoutes registers the receipt handler routes
-func (h *Handler) RegisterRoutes(router *gin.Engine) {
-	receipts := router.Group("/receipts")
+// RegisterRoutes registers the receipt handler routes. Every receipt route acts
+// on the signed-in user's data, so the router must authenticate the user first;
+// scripts sign in with a personal API token carrying the receipts scopes.
+func (h *Handler) RegisterRoutes(router gin.IRouter) {
+	receipts := router.Group("/receipts", auth.RequireScope("receipts"))
 	{
 		receipts.POST("/upload", h.UploadReceipt)
+		receipts.GET("/search", h.SearchReceipts)
+		receipts.GET("/export", h.ExportReceipts)
+		receipts.GET("/ledger", h.ExportLedger)
+		receipts.GET("/ledger/exports", h.ListLedgerExports)
+		receipts.POST("/import", h.ImportReceipts)
+		receipts.GET("/import/batches", h.ListImportBatches)
+		receipts.DELETE("/import/batches/:id", h.RollbackImport)
+		receipts.GET("/prices", h.GetPriceHistory)
+		receipts.GET("/analytics/spending", h.GetSpendingOverTime)
+		receipts.GET("/analytics/breakdown", h.GetSpendingBreakdown)
+		receipts.POST("/basket", h.OptimizeBasket)
+		receipts.GET("/stores", h.ListStores)
+		receipts.PUT("/stores/:id", h.UpdateStore)
+		receipts.GET("/categories", h.ListCategories)
+		receipts.GET("/tags", h.ListTags)
+		receipts.GET("/budgets", h.ListBudgets)
+		receipts.POST("/budgets", h.CreateBudget)
+		receipts.GET("/budgets/alerts", h.ListBudgetAlerts)
+		receipts.PUT("/budgets/:id", h.UpdateBudget)
+		receipts.DELETE("/budgets/:id", h.DeleteBudget)
+		receipts.POST("/categories", h.CreateCategory)
+		receipts.GET("/exchange-rates", h.ListExchangeRates)
+		receipts.POST("/exchange-rates", h.CreateExchangeRate)
+		receipts.POST("/exchange-rates/import", h.ImportExchangeRates)
+		receipts.DELETE("/exchange-rates/:id", h.DeleteExchangeRate)
+		receipts.GET("/warranties", h.ListWarranties)
+		receipts.PUT("/items/:item_id/warranty", h.SetWarranty)
+		receipts.DELETE("/items/:item_id/warranty", h.RemoveWarranty)
+		receipts.PUT("/items/:item_id/tags", h.SetItemTags)
 		receipts.GET("/:id", h.GetReceipt)
+		receipts.PATCH("/:id", h.UpdateReceipt)
 		receipts.GET("/:id/items", h.GetReceiptItems)
+		receipts.GET("/:id/image", h.GetReceiptImage)
+		receipts.PUT("/:id/tags", h.SetReceiptTags)
 		receipts.GET("/", h.ListReceipts)
 	}
+
+	transactions := router.Group("/transactions", auth.RequireScope("receipts"))
+	{
+		transactions.GET("", h.ListTransactions)
+		transactions.POST("/import", h.ImportStatement)
+		transactions.POST("/match", h.MatchTransactions)
+		transactions.GET("/unmatched-receipts", h.ListUnmatchedReceipts)
+		transactions.PUT("/:id/receipt", h.LinkTransaction)
+		transactions.DELETE("/:id/receipt", h.UnlinkTransaction)
+	}
+
+	households := router.Group("/households", auth.RequireScope("receipts"))
+	{
+		households.GET("", h.ListHouseholds)
+		households.POST("", h.CreateHousehold)
+		households.GET("/:id", h.GetHousehold)
+		households.DELETE("/:id", h.DeleteHousehold)
+		households.POST("/:id/members", h.AddHouseholdMember)
+		households.DELETE("/:id/members/:user_id", h.RemoveHouseholdMember)
+		households.GET("/:id/receipts", h.ListSharedReceipts)
+		households.PUT("/:id/receipts/:receipt_id", h.ShareReceipt)
+		households.DELETE("/:id/receipts/:receipt_id", h.UnshareReceipt)
+		households.GET("/:id/balances", h.GetHouseholdBalances)
+		households.GET("/:id/settlements", h.ListSettlements)
+		households.POST("/:id/settlements", h.RecordSettlement)
+	}
 }
 
 // UploadReceipt handles upload of receipt images
@@ -66,53 +123,37 @@ func (h *Handler) UploadReceipt(c *gin.Context) {
 	}
 	defer file.Close()
 
-	// Read file data
-	fileData, err := io.ReadAll(file)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+	if header.Size > int64(h.maxUploadMB)<<20 {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("File is too large. Maximum file size is %dMB.", h.maxUploadMB)})
 		return
 	}
 
-	// Save the image
-	imagePath, err := h.ocrService.SaveImage(fileData, header.Filename)
+	currency, err := formCurrency(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save image"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Process the receipt
-	receipt, items, err := h.ocrService.ProcessReceipt(imagePath)
+	// Read file data
+	fileData, err := io.ReadAll(file)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process receipt"})
-		return
-	}
-
-	// Ensure the default store exists
-	if err := h.repo.EnsureDefaultStore(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to ensure store exists"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
 		return
 	}
 
-	// Save receipt data to database
-	receiptID, err := h.repo.CreateReceipt(receipt)
+	// Save the image, process it and store the receipt
+	receipt, items, err := h.processor.Ingest(auth.UserID(c), fileData, header.Filename, currency)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save receipt"})
+		log.Printf("Failed to process uploaded receipt: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process receipt"})
 		return
 	}
 
-	// Save receipt items
-	for _, item := range items {
-		item.ReceiptID = receiptID
-		_, err := h.repo.CreateReceiptItem(item)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save receipt items"})
-			return
-		}
-	}
+	h.repo.refreshAnalyticsAsync()
 
 	// Return receipt data
 	c.JSON(http.StatusOK, gin.H{
-		"id":            receiptID,
+		"id":            receipt.ID,
 		"store_name":    receipt.StoreName,
 		"purchase_date": receipt.PurchaseDate,
 		"total_amount":  receipt.TotalAmount,
@@ -129,7 +170,7 @@ func (h *Handler) GetReceipt(c *gin.Context) {
 		return
 	}
 
-	receipt, err := h.repo.GetReceiptByID(id)
+	receipt, err := h.repo.GetReceiptByID(auth.UserID(c), id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Receipt not found"})
 		return
@@ -147,7 +188,7 @@ func (h *Handler) GetReceiptItems(c *gin.Context) {
 		return
 	}
 
-	items, err := h.repo.GetReceiptItems(id)
+	items, err := h.repo.GetReceiptItems(auth.UserID(c), id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve receipt items"})
 		return
@@ -156,8 +197,89 @@ func (h *Handler) GetReceiptItems(c *gin.Context) {
 	c.JSON(http.StatusOK, items)
 }
 
-// ListReceipts handles listing all receipts with pagination
+// GetReceiptImage serves a receipt's stored image, e.g. as proof of purchase
+func (h *Handler) GetReceiptImage(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid receipt ID"})
+		return
+	}
+
+	receipt, err := h.repo.GetReceiptByID(auth.UserID(c), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Receipt not found"})
+		return
+	}
+	if receipt.ImagePath == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Receipt has no image"})
+		return
+	}
+	if info, err := os.Stat(receipt.ImagePath); err != nil || info.IsDir() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Receipt image not found"})
+		return
+	}
+
+	c.File(receipt.ImagePath)
+}
+
+// ListReceipts handles listing receipts with filters, sorting and cursor pagination
 func (h *Handler) ListReceipts(c *gin.Context) {
-	// Implement pagination and filtering here
-	c.JSON(http.StatusOK, gin.H{"message": "List receipts - Not implemented yet"})
+	filter, err := filterFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := h.repo.ListReceipts(filter)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCursor) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list receipts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// UpdateReceipt handles partial updates of a receipt, such as its category or review status
+func (h *Handler) UpdateReceipt(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid receipt ID"})
+		return
+	}
+
+	var update ReceiptUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := update.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	receipt, confirmed, err := h.repo.UpdateReceipt(auth.UserID(c), id, &update)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Receipt not found"})
+			return
+		}
+		if errors.Is(err, ErrCategoryNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "category_id does not exist"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update receipt"})
+		return
+	}
+
+	h.repo.refreshAnalyticsAsync()
+	if confirmed {
+		h.repo.receiptConfirmed(receipt)
+	}
+
+	c.JSON(http.StatusOK, receipt)
 }
@@ -0,0 +1,1269 @@
+package receipts
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/mauroue/cereja-corp/internal/auth"
+	"github.com/mauroue/cereja-corp/internal/models"
+)
+
+// Ways a shared receipt's total can be split between its participants
+const (
+	SplitEqual      = "equal"
+	SplitPercentage = "percentage"
+	SplitItem       = "item"
+)
+
+var (
+	// ErrNotHouseholdOwner is returned when a member attempts an owner-only change
+	ErrNotHouseholdOwner = errors.New("only the household owner can do this")
+	// ErrHouseholdUserNotFound is returned when adding a username that does not exist
+	ErrHouseholdUserNotFound = errors.New("user not found")
+	// ErrHouseholdOwnerLeaving is returned when the owner is removed from their household
+	ErrHouseholdOwnerLeaving = errors.New("the owner cannot leave the household")
+	// ErrSharedReceiptNotFound is returned when sharing a receipt the user does not have
+	ErrSharedReceiptNotFound = errors.New("receipt not found")
+	// ErrInvalidShare wraps problems with a share's payer, participants or items
+	ErrInvalidShare = errors.New("invalid share")
+	// ErrInvalidSettlement wraps problems with a settlement's members or amount
+	ErrInvalidSettlement = errors.New("invalid settlement")
+)
+
+// MemberAmount is one member's part of an amount
+type MemberAmount struct {
+	UserID   int64   `json:"user_id"`
+	Username string  `json:"username"`
+	Amount   float64 `json:"amount"`
+}
+
+// SharedReceipt is a receipt shared with a household, with what each participant owes
+type SharedReceipt struct {
+	Receipt    *models.Receipt      `json:"receipt"`
+	Share      *models.ReceiptShare `json:"share"`
+	PaidByName string               `json:"paid_by_name"`
+	Owed       []*MemberAmount      `json:"owed"`
+}
+
+// MemberBalance is a member's running balance in a household. A positive balance
+// is owed to the member, a negative one is owed by them.
+type MemberBalance struct {
+	UserID   int64   `json:"user_id"`
+	Username string  `json:"username"`
+	Paid     float64 `json:"paid"`
+	Owed     float64 `json:"owed"`
+	Sent     float64 `json:"settlements_sent"`
+	Received float64 `json:"settlements_received"`
+	Balance  float64 `json:"balance"`
+}
+
+// Transfer is a suggested payment that settles balances
+type Transfer struct {
+	FromUserID   int64   `json:"from_user_id"`
+	FromUsername string  `json:"from_username"`
+	ToUserID     int64   `json:"to_user_id"`
+	ToUsername   string  `json:"to_username"`
+	Amount       float64 `json:"amount"`
+}
+
+// HouseholdBalances are the members' balances and the transfers that settle them
+type HouseholdBalances struct {
+	Currency    string           `json:"currency"`
+	Balances    []*MemberBalance `json:"balances"`
+	Transfers   []*Transfer      `json:"settle_up"`
+	Unconverted int              `json:"unconverted"`
+}
+
+// shareItemCost is the cost of one item of a shared receipt
+type shareItemCost struct {
+	id    int64
+	name  string
+	cents int64
+}
+
+// toCents converts an amount to whole cents, so splits always add up exactly
+func toCents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+// fromCents converts whole cents back to an amount
+func fromCents(cents int64) float64 {
+	return float64(cents) / 100
+}
+
+// splitCents divides cents in proportion to the weights. The cents lost to
+// rounding go to the largest remainders, so the parts always add up to cents.
+// Without any positive weight the cents are split equally.
+func splitCents(cents int64, weights []float64) []int64 {
+	parts := make([]int64, len(weights))
+	if len(weights) == 0 {
+		return parts
+	}
+
+	sign := int64(1)
+	if cents < 0 {
+		sign, cents = -1, -cents
+	}
+
+	sum := 0.0
+	for _, w := range weights {
+		if w > 0 {
+			sum += w
+		}
+	}
+
+	type remainder struct {
+		index int
+		frac  float64
+	}
+	remainders := make([]remainder, len(weights))
+	var given int64
+	for i, w := range weights {
+		exact := float64(cents) / float64(len(weights))
+		if sum > 0 {
+			exact = float64(cents) * math.Max(w, 0) / sum
+		}
+		parts[i] = int64(math.Floor(exact))
+		given += parts[i]
+		remainders[i] = remainder{index: i, frac: exact - float64(parts[i])}
+	}
+
+	sort.SliceStable(remainders, func(i, j int) bool { return remainders[i].frac > remainders[j].frac })
+	for k := 0; given < cents; k++ {
+		parts[remainders[k%len(remainders)].index]++
+		given++
+	}
+
+	for i := range parts {
+		parts[i] *= sign
+	}
+	return parts
+}
+
+// splitShare returns the cents each participant owes for a shared receipt.
+// Per-item splits charge each item to the members it is assigned to, or to every
+// participant when it has none, and spread the rest of the total (taxes,
+// discounts) in proportion.
+func splitShare(total float64, share *models.ReceiptShare, items []shareItemCost) map[int64]int64 {
+	weights := make([]float64, len(share.Participants))
+	index := make(map[int64]int, len(share.Participants))
+	for i, p := range share.Participants {
+		index[p.UserID] = i
+	}
+
+	switch share.SplitMethod {
+	case SplitPercentage:
+		for i, p := range share.Participants {
+			if p.Percent != nil {
+				weights[i] = *p.Percent
+			}
+		}
+	case SplitItem:
+		assigned := make(map[int64][]int64, len(share.Items))
+		for _, item := range share.Items {
+			assigned[item.ItemID] = item.UserIDs
+		}
+		for _, item := range items {
+			var users []int
+			for _, userID := range assigned[item.id] {
+				if i, ok := index[userID]; ok {
+					users = append(users, i)
+				}
+			}
+			if len(users) == 0 {
+				for i := range share.Participants {
+					users = append(users, i)
+				}
+			}
+			for _, i := range users {
+				weights[i] += float64(item.cents) / float64(len(users))
+			}
+		}
+	default:
+		for i := range weights {
+			weights[i] = 1
+		}
+	}
+
+	owed := make(map[int64]int64, len(share.Participants))
+	for i, part := range splitCents(toCents(total), weights) {
+		owed[share.Participants[i].UserID] = part
+	}
+	return owed
+}
+
+// settleUp suggests transfers that bring every balance to zero. Each transfer
+// pays the largest creditor from the largest debtor, settling at least one of
+// them, so n members never need more than n-1 transfers.
+func settleUp(balances map[int64]int64) [][3]int64 {
+	remaining := make(map[int64]int64, len(balances))
+	for userID, cents := range balances {
+		if cents != 0 {
+			remaining[userID] = cents
+		}
+	}
+
+	var transfers [][3]int64
+	for {
+		var debtor, creditor int64
+		for userID, cents := range remaining {
+			if cents < 0 && (debtor == 0 || cents < remaining[debtor] || (cents == remaining[debtor] && userID < debtor)) {
+				debtor = userID
+			}
+			if cents > 0 && (creditor == 0 || cents > remaining[creditor] || (cents == remaining[creditor] && userID < creditor)) {
+				creditor = userID
+			}
+		}
+		if debtor == 0 || creditor == 0 {
+			return transfers
+		}
+
+		amount := -remaining[debtor]
+		if remaining[creditor] < amount {
+			amount = remaining[creditor]
+		}
+		transfers = append(transfers, [3]int64{debtor, creditor, amount})
+
+		remaining[debtor] += amount
+		remaining[creditor] -= amount
+		if remaining[debtor] == 0 {
+			delete(remaining, debtor)
+		}
+		if remaining[creditor] == 0 {
+			delete(remaining, creditor)
+		}
+	}
+}
+
+// householdOwner returns the owner of a household, or sql.ErrNoRows unless the
+// user is one of its members
+func (r *Repository) householdOwner(userID, householdID int64) (int64, error) {
+	var ownerID int64
+	err := r.db.QueryRow(`
+		SELECT h.owner_id
+		FROM households h
+		JOIN household_members m ON m.household_id = h.id AND m.user_id = $2
+		WHERE h.id = $1
+	`, householdID, userID).Scan(&ownerID)
+	return ownerID, err
+}
+
+// ListHouseholds returns the households the user belongs to
+func (r *Repository) ListHouseholds(userID int64) ([]*models.Household, error) {
+	rows, err := r.db.Query(`
+		SELECT h.id, h.name, h.owner_id, h.created_at, h.updated_at
+		FROM households h
+		JOIN household_members m ON m.household_id = h.id
+		WHERE m.user_id = $1
+		ORDER BY LOWER(h.name), h.id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var households []*models.Household
+	for rows.Next() {
+		var household models.Household
+		if err := rows.Scan(&household.ID, &household.Name, &household.OwnerID, &household.CreatedAt, &household.UpdatedAt); err != nil {
+			return nil, err
+		}
+		households = append(households, &household)
+	}
+
+	return households, rows.Err()
+}
+
+// GetHousehold returns one of the user's households with its members
+func (r *Repository) GetHousehold(userID, id int64) (*models.Household, error) {
+	var household models.Household
+	err := r.db.QueryRow(`
+		SELECT h.id, h.name, h.owner_id, h.created_at, h.updated_at
+		FROM households h
+		JOIN household_members m ON m.household_id = h.id AND m.user_id = $2
+		WHERE h.id = $1
+	`, id, userID).Scan(&household.ID, &household.Name, &household.OwnerID, &household.CreatedAt, &household.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(`
+		SELECT m.user_id, u.username, m.joined_at
+		FROM household_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.household_id = $1
+		ORDER BY LOWER(u.username)
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var member models.HouseholdMember
+		if err := rows.Scan(&member.UserID, &member.Username, &member.JoinedAt); err != nil {
+			return nil, err
+		}
+		household.Members = append(household.Members, &member)
+	}
+
+	return &household, rows.Err()
+}
+
+// CreateHousehold creates a household owned by the user, who becomes its first member
+func (r *Repository) CreateHousehold(userID int64, name string) (*models.Household, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("name is required")
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	household := &models.Household{Name: name, OwnerID: userID}
+	err = tx.QueryRow(`
+		INSERT INTO households (name, owner_id)
+		VALUES ($1, $2)
+		RETURNING id, created_at, updated_at
+	`, household.Name, household.OwnerID).Scan(&household.ID, &household.CreatedAt, &household.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`INSERT INTO household_members (household_id, user_id) VALUES ($1, $2)`, household.ID, userID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return household, nil
+}
+
+// DeleteHousehold deletes a household along with its shares and settlements.
+// The shared receipts stay with their owners.
+func (r *Repository) DeleteHousehold(userID, id int64) error {
+	ownerID, err := r.householdOwner(userID, id)
+	if err != nil {
+		return err
+	}
+	if ownerID != userID {
+		return ErrNotHouseholdOwner
+	}
+
+	_, err = r.db.Exec(`DELETE FROM households WHERE id = $1`, id)
+	return err
+}
+
+// AddHouseholdMember adds the user with the given username to a household
+func (r *Repository) AddHouseholdMember(userID, householdID int64, username string) (*models.HouseholdMember, error) {
+	ownerID, err := r.householdOwner(userID, householdID)
+	if err != nil {
+		return nil, err
+	}
+	if ownerID != userID {
+		return nil, ErrNotHouseholdOwner
+	}
+
+	var member models.HouseholdMember
+	err = r.db.QueryRow(`SELECT id, username FROM users WHERE LOWER(username) = LOWER($1)`,
+		strings.TrimSpace(username)).Scan(&member.UserID, &member.Username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrHouseholdUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.db.QueryRow(`
+		INSERT INTO household_members (household_id, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT (household_id, user_id) DO UPDATE SET joined_at = household_members.joined_at
+		RETURNING joined_at
+	`, householdID, member.UserID).Scan(&member.JoinedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// RemoveHouseholdMember removes a member from a household. The owner can remove
+// anyone else; other members can only leave. Past shares and settlements keep
+// counting towards the balances.
+func (r *Repository) RemoveHouseholdMember(userID, householdID, memberID int64) error {
+	ownerID, err := r.householdOwner(userID, householdID)
+	if err != nil {
+		return err
+	}
+	if memberID == ownerID {
+		return ErrHouseholdOwnerLeaving
+	}
+	if memberID != userID && ownerID != userID {
+		return ErrNotHouseholdOwner
+	}
+
+	result, err := r.db.Exec(`DELETE FROM household_members WHERE household_id = $1 AND user_id = $2`, householdID, memberID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// normalizeShare validates a share against the household's members and the
+// receipt's items. Participants default to every member, and the percentages
+// and item assignments the split method does not use are dropped.
+func normalizeShare(share *models.ReceiptShare, members []*models.HouseholdMember, items []*models.ReceiptItem) error {
+	isMember := make(map[int64]bool, len(members))
+	for _, member := range members {
+		isMember[member.UserID] = true
+	}
+
+	switch share.SplitMethod {
+	case "":
+		share.SplitMethod = SplitEqual
+	case SplitEqual, SplitPercentage, SplitItem:
+	default:
+		return fmt.Errorf("%w: split_method must be %q, %q or %q", ErrInvalidShare, SplitEqual, SplitPercentage, SplitItem)
+	}
+
+	if !isMember[share.PaidBy] {
+		return fmt.Errorf("%w: paid_by must be a household member", ErrInvalidShare)
+	}
+
+	if len(share.Participants) == 0 {
+		if share.SplitMethod == SplitPercentage {
+			return fmt.Errorf("%w: a percentage split needs participants with percentages", ErrInvalidShare)
+		}
+		for _, member := range members {
+			share.Participants = append(share.Participants, &models.ShareParticipant{UserID: member.UserID})
+		}
+	}
+
+	seen := make(map[int64]bool, len(share.Participants))
+	var percentTotal float64
+	for _, p := range share.Participants {
+		if !isMember[p.UserID] {
+			return fmt.Errorf("%w: participant %d is not a household member", ErrInvalidShare, p.UserID)
+		}
+		if seen[p.UserID] {
+			return fmt.Errorf("%w: participant %d is listed twice", ErrInvalidShare, p.UserID)
+		}
+		seen[p.UserID] = true
+
+		if share.SplitMethod != SplitPercentage {
+			p.Percent = nil
+			continue
+		}
+		if p.Percent == nil || *p.Percent < 0 || *p.Percent > 100 {
+			return fmt.Errorf("%w: every participant needs a percentage between 0 and 100", ErrInvalidShare)
+		}
+		percentTotal += *p.Percent
+	}
+	if share.SplitMethod == SplitPercentage && math.Abs(percentTotal-100) > 0.01 {
+		return fmt.Errorf("%w: percentages add up to %.2f, not 100", ErrInvalidShare, percentTotal)
+	}
+
+	if share.SplitMethod != SplitItem {
+		share.Items = nil
+		return nil
+	}
+
+	onReceipt := make(map[int64]bool, len(items))
+	for _, item := range items {
+		onReceipt[item.ID] = true
+	}
+	assignments := share.Items[:0]
+	assigned := make(map[int64]bool, len(share.Items))
+	for _, item := range share.Items {
+		if !onReceipt[item.ItemID] {
+			return fmt.Errorf("%w: item %d is not on this receipt", ErrInvalidShare, item.ItemID)
+		}
+		if assigned[item.ItemID] {
+			return fmt.Errorf("%w: item %d is listed twice", ErrInvalidShare, item.ItemID)
+		}
+		assigned[item.ItemID] = true
+
+		users := item.UserIDs[:0]
+		added := make(map[int64]bool, len(item.UserIDs))
+		for _, userID := range item.UserIDs {
+			if !seen[userID] {
+				return fmt.Errorf("%w: item %d is assigned to %d, who is not a participant", ErrInvalidShare, item.ItemID, userID)
+			}
+			if !added[userID] {
+				added[userID] = true
+				users = append(users, userID)
+			}
+		}
+		if len(users) > 0 {
+			item.UserIDs = users
+			assignments = append(assignments, item)
+		}
+	}
+	share.Items = assignments
+
+	return nil
+}
+
+// ShareReceipt shares one of the user's receipts with a household they belong
+// to, replacing any previous share of the receipt
+func (r *Repository) ShareReceipt(userID, householdID int64, share *models.ReceiptShare) error {
+	household, err := r.GetHousehold(userID, householdID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := r.GetReceiptByID(userID, share.ReceiptID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrSharedReceiptNotFound
+		}
+		return err
+	}
+	items, err := r.GetReceiptItems(userID, share.ReceiptID)
+	if err != nil {
+		return err
+	}
+
+	share.HouseholdID = householdID
+	if err := normalizeShare(share, household.Members, items); err != nil {
+		return err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
+		INSERT INTO receipt_shares (receipt_id, household_id, paid_by, split_method)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (receipt_id) DO UPDATE SET
+			household_id = EXCLUDED.household_id,
+			paid_by = EXCLUDED.paid_by,
+			split_method = EXCLUDED.split_method,
+			updated_at = NOW()
+		RETURNING created_at, updated_at
+	`, share.ReceiptID, share.HouseholdID, share.PaidBy, share.SplitMethod).Scan(&share.CreatedAt, &share.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM receipt_share_participants WHERE receipt_id = $1`, share.ReceiptID); err != nil {
+		return err
+	}
+	for _, p := range share.Participants {
+		if _, err := tx.Exec(`
+			INSERT INTO receipt_share_participants (receipt_id, user_id, percent)
+			VALUES ($1, $2, $3)
+		`, share.ReceiptID, p.UserID, p.Percent); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(`
+		DELETE FROM receipt_item_assignments
+		WHERE item_id IN (SELECT id FROM receipt_items WHERE receipt_id = $1)
+	`, share.ReceiptID); err != nil {
+		return err
+	}
+	for _, item := range share.Items {
+		for _, assignee := range item.UserIDs {
+			if _, err := tx.Exec(`INSERT INTO receipt_item_assignments (item_id, user_id) VALUES ($1, $2)`, item.ItemID, assignee); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UnshareReceipt removes one of the user's receipts from a household
+func (r *Repository) UnshareReceipt(userID, householdID, receiptID int64) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		DELETE FROM receipt_shares s
+		USING receipts r
+		WHERE s.receipt_id = r.id AND s.receipt_id = $1 AND s.household_id = $2 AND r.user_id = $3
+	`, receiptID, householdID, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	if _, err := tx.Exec(`
+		DELETE FROM receipt_item_assignments
+		WHERE item_id IN (SELECT id FROM receipt_items WHERE receipt_id = $1)
+	`, receiptID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetReceiptShare returns the share of one of the user's receipts
+func (r *Repository) GetReceiptShare(userID, receiptID int64) (*models.ReceiptShare, error) {
+	if _, err := r.GetReceiptByID(userID, receiptID); err != nil {
+		return nil, err
+	}
+
+	shares, err := r.loadShares(`s.receipt_id = $1`, receiptID)
+	if err != nil {
+		return nil, err
+	}
+	if len(shares) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return shares[receiptID], nil
+}
+
+// loadShares loads the shares matching condition, a filter on receipt_shares s
+// with a single parameter, along with their participants and item assignments
+func (r *Repository) loadShares(condition string, arg int64) (map[int64]*models.ReceiptShare, error) {
+	rows, err := r.db.Query(`
+		SELECT s.receipt_id, s.household_id, s.paid_by, s.split_method, s.created_at, s.updated_at
+		FROM receipt_shares s
+		WHERE `+condition, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shares := make(map[int64]*models.ReceiptShare)
+	for rows.Next() {
+		var share models.ReceiptShare
+		if err := rows.Scan(&share.ReceiptID, &share.HouseholdID, &share.PaidBy, &share.SplitMethod, &share.CreatedAt, &share.UpdatedAt); err != nil {
+			return nil, err
+		}
+		share.Participants = []*models.ShareParticipant{}
+		shares[share.ReceiptID] = &share
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	participants, err := r.db.Query(`
+		SELECT p.receipt_id, p.user_id, p.percent::float8
+		FROM receipt_share_participants p
+		JOIN receipt_shares s ON s.receipt_id = p.receipt_id
+		WHERE `+condition+`
+		ORDER BY p.receipt_id, p.user_id
+	`, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer participants.Close()
+
+	for participants.Next() {
+		var receiptID int64
+		var p models.ShareParticipant
+		if err := participants.Scan(&receiptID, &p.UserID, &p.Percent); err != nil {
+			return nil, err
+		}
+		if share, ok := shares[receiptID]; ok {
+			share.Participants = append(share.Participants, &p)
+		}
+	}
+	if err := participants.Err(); err != nil {
+		return nil, err
+	}
+
+	assignments, err := r.db.Query(`
+		SELECT ri.receipt_id, a.item_id, a.user_id
+		FROM receipt_item_assignments a
+		JOIN receipt_items ri ON ri.id = a.item_id
+		JOIN receipt_shares s ON s.receipt_id = ri.receipt_id
+		WHERE `+condition+`
+		ORDER BY a.item_id, a.user_id
+	`, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer assignments.Close()
+
+	for assignments.Next() {
+		var receiptID, itemID, userID int64
+		if err := assignments.Scan(&receiptID, &itemID, &userID); err != nil {
+			return nil, err
+		}
+		share, ok := shares[receiptID]
+		if !ok {
+			continue
+		}
+		if n := len(share.Items); n > 0 && share.Items[n-1].ItemID == itemID {
+			share.Items[n-1].UserIDs = append(share.Items[n-1].UserIDs, userID)
+			continue
+		}
+		share.Items = append(share.Items, &models.ShareItem{ItemID: itemID, UserIDs: []int64{userID}})
+	}
+
+	return shares, assignments.Err()
+}
+
+// usernames returns the usernames of the given users
+func (r *Repository) usernames(ids []int64) (map[int64]string, error) {
+	rows, err := r.db.Query(`SELECT id, username FROM users WHERE id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := make(map[int64]string, len(ids))
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		names[id] = name
+	}
+
+	return names, rows.Err()
+}
+
+// ListSharedReceipts returns the receipts shared with one of the user's
+// households, newest first, with what each participant owes
+func (r *Repository) ListSharedReceipts(userID, householdID int64) ([]*SharedReceipt, error) {
+	if _, err := r.householdOwner(userID, householdID); err != nil {
+		return nil, err
+	}
+
+	shares, err := r.loadShares(`s.household_id = $1`, householdID)
+	if err != nil {
+		return nil, err
+	}
+
+	itemRows, err := r.db.Query(`
+		SELECT ri.receipt_id, ri.id, ri.name, ri.total_price
+		FROM receipt_items ri
+		JOIN receipt_shares s ON s.receipt_id = ri.receipt_id
+		WHERE s.household_id = $1
+		ORDER BY ri.id
+	`, householdID)
+	if err != nil {
+		return nil, err
+	}
+	defer itemRows.Close()
+
+	items := make(map[int64][]shareItemCost)
+	for itemRows.Next() {
+		var receiptID int64
+		var item shareItemCost
+		var total float64
+		if err := itemRows.Scan(&receiptID, &item.id, &item.name, &total); err != nil {
+			return nil, err
+		}
+		item.cents = toCents(total)
+		items[receiptID] = append(items[receiptID], item)
+	}
+	if err := itemRows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(`
+		SELECT `+receiptColumns+`
+		FROM `+receiptTables+`
+		JOIN receipt_shares s ON s.receipt_id = r.id
+		WHERE s.household_id = $1
+		ORDER BY r.purchase_date DESC, r.id DESC
+	`, householdID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shared []*SharedReceipt
+	involved := []int64{}
+	for rows.Next() {
+		receipt, err := scanReceipt(rows)
+		if err != nil {
+			return nil, err
+		}
+		share, ok := shares[receipt.ID]
+		if !ok {
+			continue
+		}
+
+		entry := &SharedReceipt{Receipt: receipt, Share: share}
+		owed := splitShare(receipt.TotalAmount, share, items[receipt.ID])
+		for _, p := range share.Participants {
+			entry.Owed = append(entry.Owed, &MemberAmount{UserID: p.UserID, Amount: fromCents(owed[p.UserID])})
+			involved = append(involved, p.UserID)
+		}
+		involved = append(involved, share.PaidBy)
+		shared = append(shared, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	names, err := r.usernames(involved)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range shared {
+		entry.PaidByName = names[entry.Share.PaidBy]
+		for _, owed := range entry.Owed {
+			owed.Username = names[owed.UserID]
+		}
+	}
+
+	return shared, nil
+}
+
+// ListSettlements returns the settlements recorded in one of the user's households, newest first
+func (r *Repository) ListSettlements(userID, householdID int64) ([]*models.Settlement, error) {
+	if _, err := r.householdOwner(userID, householdID); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(`
+		SELECT id, household_id, from_user_id, to_user_id, amount, created_at
+		FROM household_settlements
+		WHERE household_id = $1
+		ORDER BY created_at DESC, id DESC
+	`, householdID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var settlements []*models.Settlement
+	for rows.Next() {
+		var s models.Settlement
+		if err := rows.Scan(&s.ID, &s.HouseholdID, &s.FromUserID, &s.ToUserID, &s.Amount, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		settlements = append(settlements, &s)
+	}
+
+	return settlements, rows.Err()
+}
+
+// RecordSettlement records a payment between two members of a household. Only
+// the members paying or being paid can record it.
+func (r *Repository) RecordSettlement(userID, householdID int64, settlement *models.Settlement) error {
+	household, err := r.GetHousehold(userID, householdID)
+	if err != nil {
+		return err
+	}
+
+	isMember := make(map[int64]bool, len(household.Members))
+	for _, member := range household.Members {
+		isMember[member.UserID] = true
+	}
+	switch {
+	case !isMember[settlement.FromUserID] || !isMember[settlement.ToUserID]:
+		return fmt.Errorf("%w: both members must belong to the household", ErrInvalidSettlement)
+	case settlement.FromUserID == settlement.ToUserID:
+		return fmt.Errorf("%w: a member cannot pay themselves", ErrInvalidSettlement)
+	case userID != settlement.FromUserID && userID != settlement.ToUserID:
+		return fmt.Errorf("%w: only the members paying or being paid can record a settlement", ErrInvalidSettlement)
+	case toCents(settlement.Amount) <= 0:
+		return fmt.Errorf("%w: amount must be positive", ErrInvalidSettlement)
+	}
+
+	settlement.HouseholdID = householdID
+	settlement.Amount = fromCents(toCents(settlement.Amount))
+	return r.db.QueryRow(`
+		INSERT INTO household_settlements (household_id, from_user_id, to_user_id, amount)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`, settlement.HouseholdID, settlement.FromUserID, settlement.ToUserID, settlement.Amount).Scan(&settlement.ID, &settlement.CreatedAt)
+}
+
+// HouseholdBalances computes the members' running balances from the shared
+// receipts and settlements, and the transfers that would settle them. Balances
+// are in the base currency, converted with the rates of each receipt's owner;
+// receipts without a known exchange rate are left out.
+func (r *Repository) HouseholdBalances(userID, householdID int64) (*HouseholdBalances, error) {
+	household, err := r.GetHousehold(userID, householdID)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := r.ListSharedReceipts(userID, householdID)
+	if err != nil {
+		return nil, err
+	}
+	settlements, err := r.ListSettlements(userID, householdID)
+	if err != nil {
+		return nil, err
+	}
+
+	type totals struct{ paid, owed, sent, received int64 }
+	byUser := make(map[int64]*totals)
+	get := func(id int64) *totals {
+		if byUser[id] == nil {
+			byUser[id] = &totals{}
+		}
+		return byUser[id]
+	}
+
+	names := make(map[int64]string)
+	for _, member := range household.Members {
+		get(member.UserID)
+		names[member.UserID] = member.Username
+	}
+	base := baseCurrency()
+	unconverted := 0
+	for _, entry := range shared {
+		rate := 1.0
+		if entry.Receipt.Currency != base {
+			rate, err = r.ExchangeRate(entry.Receipt.UserID, entry.Receipt.Currency, base, entry.Receipt.PurchaseDate)
+			if errors.Is(err, ErrNoExchangeRate) {
+				unconverted++
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// The payer is credited with the converted shares so that rounding
+		// never leaves the balances off by a cent
+		var split int64
+		for _, owed := range entry.Owed {
+			cents := toCents(owed.Amount * rate)
+			get(owed.UserID).owed += cents
+			split += cents
+			names[owed.UserID] = owed.Username
+		}
+		get(entry.Share.PaidBy).paid += split
+		names[entry.Share.PaidBy] = entry.PaidByName
+	}
+
+	var missing []int64
+	for _, s := range settlements {
+		get(s.FromUserID).sent += toCents(s.Amount)
+		get(s.ToUserID).received += toCents(s.Amount)
+		for _, id := range []int64{s.FromUserID, s.ToUserID} {
+			if _, ok := names[id]; !ok {
+				missing = append(missing, id)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		former, err := r.usernames(missing)
+		if err != nil {
+			return nil, err
+		}
+		for id, name := range former {
+			names[id] = name
+		}
+	}
+
+	result := &HouseholdBalances{Currency: base, Balances: []*MemberBalance{}, Transfers: []*Transfer{}, Unconverted: unconverted}
+	net := make(map[int64]int64, len(byUser))
+	for id, t := range byUser {
+		net[id] = t.paid - t.owed + t.sent - t.received
+		result.Balances = append(result.Balances, &MemberBalance{
+			UserID:   id,
+			Username: names[id],
+			Paid:     fromCents(t.paid),
+			Owed:     fromCents(t.owed),
+			Sent:     fromCents(t.sent),
+			Received: fromCents(t.received),
+			Balance:  fromCents(net[id]),
+		})
+	}
+	sort.Slice(result.Balances, func(i, j int) bool {
+		return strings.ToLower(result.Balances[i].Username) < strings.ToLower(result.Balances[j].Username)
+	})
+
+	for _, t := range settleUp(net) {
+		result.Transfers = append(result.Transfers, &Transfer{
+			FromUserID:   t[0],
+			FromUsername: names[t[0]],
+			ToUserID:     t[1],
+			ToUsername:   names[t[1]],
+			Amount:       fromCents(t[2]),
+		})
+	}
+
+	return result, nil
+}
+
+// householdID parses the :id path parameter
+func householdID(c *gin.Context) (int64, error) {
+	return strconv.ParseInt(c.Param("id"), 10, 64)
+}
+
+// householdError writes the JSON response for errors shared by the household handlers
+func householdError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Household not found"})
+	case errors.Is(err, ErrNotHouseholdOwner):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrHouseholdUserNotFound), errors.Is(err, ErrSharedReceiptNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrHouseholdOwnerLeaving), errors.Is(err, ErrInvalidShare), errors.Is(err, ErrInvalidSettlement):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// ListHouseholds handles listing the user's households
+func (h *Handler) ListHouseholds(c *gin.Context) {
+	households, err := h.repo.ListHouseholds(auth.UserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve households"})
+		return
+	}
+
+	c.JSON(http.StatusOK, households)
+}
+
+// CreateHousehold handles creating a household owned by the user
+func (h *Handler) CreateHousehold(c *gin.Context) {
+	var household models.Household
+	if err := c.ShouldBindJSON(&household); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	created, err := h.repo.CreateHousehold(auth.UserID(c), household.Name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create household"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, created)
+}
+
+// GetHousehold handles retrieval of a household with its members
+func (h *Handler) GetHousehold(c *gin.Context) {
+	id, err := householdID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid household ID"})
+		return
+	}
+
+	household, err := h.repo.GetHousehold(auth.UserID(c), id)
+	if err != nil {
+		householdError(c, err, "Failed to retrieve household")
+		return
+	}
+
+	c.JSON(http.StatusOK, household)
+}
+
+// DeleteHousehold handles deleting a household
+func (h *Handler) DeleteHousehold(c *gin.Context) {
+	id, err := householdID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid household ID"})
+		return
+	}
+
+	if err := h.repo.DeleteHousehold(auth.UserID(c), id); err != nil {
+		householdError(c, err, "Failed to delete household")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// AddHouseholdMember handles adding a user to a household by username
+func (h *Handler) AddHouseholdMember(c *gin.Context) {
+	id, err := householdID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid household ID"})
+		return
+	}
+
+	var body struct {
+		Username string `json:"username" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	member, err := h.repo.AddHouseholdMember(auth.UserID(c), id, body.Username)
+	if err != nil {
+		householdError(c, err, "Failed to add member")
+		return
+	}
+
+	c.JSON(http.StatusCreated, member)
+}
+
+// RemoveHouseholdMember handles removing a member from a household, or leaving it
+func (h *Handler) RemoveHouseholdMember(c *gin.Context) {
+	id, err := householdID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid household ID"})
+		return
+	}
+	memberID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if err := h.repo.RemoveHouseholdMember(auth.UserID(c), id, memberID); err != nil {
+		householdError(c, err, "Failed to remove member")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListSharedReceipts handles listing a household's shared receipts and what each member owes
+func (h *Handler) ListSharedReceipts(c *gin.Context) {
+	id, err := householdID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid household ID"})
+		return
+	}
+
+	shared, err := h.repo.ListSharedReceipts(auth.UserID(c), id)
+	if err != nil {
+		householdError(c, err, "Failed to retrieve shared receipts")
+		return
+	}
+
+	c.JSON(http.StatusOK, shared)
+}
+
+// ShareReceipt handles sharing one of the user's receipts with a household
+func (h *Handler) ShareReceipt(c *gin.Context) {
+	id, err := householdID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid household ID"})
+		return
+	}
+	receiptID, err := strconv.ParseInt(c.Param("receipt_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid receipt ID"})
+		return
+	}
+
+	var share models.ReceiptShare
+	if err := c.ShouldBindJSON(&share); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	share.ReceiptID = receiptID
+	if share.PaidBy == 0 {
+		share.PaidBy = auth.UserID(c)
+	}
+
+	if err := h.repo.ShareReceipt(auth.UserID(c), id, &share); err != nil {
+		householdError(c, err, "Failed to share receipt")
+		return
+	}
+
+	c.JSON(http.StatusOK, share)
+}
+
+// UnshareReceipt handles removing one of the user's receipts from a household
+func (h *Handler) UnshareReceipt(c *gin.Context) {
+	id, err := householdID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid household ID"})
+		return
+	}
+	receiptID, err := strconv.ParseInt(c.Param("receipt_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid receipt ID"})
+		return
+	}
+
+	if err := h.repo.UnshareReceipt(auth.UserID(c), id, receiptID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Shared receipt not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unshare receipt"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetHouseholdBalances handles retrieval of the members' balances and the settle-up suggestion
+func (h *Handler) GetHouseholdBalances(c *gin.Context) {
+	id, err := householdID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid household ID"})
+		return
+	}
+
+	balances, err := h.repo.HouseholdBalances(auth.UserID(c), id)
+	if err != nil {
+		householdError(c, err, "Failed to compute balances")
+		return
+	}
+
+	c.JSON(http.StatusOK, balances)
+}
+
+// ListSettlements handles listing a household's settlements
+func (h *Handler) ListSettlements(c *gin.Context) {
+	id, err := householdID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid household ID"})
+		return
+	}
+
+	settlements, err := h.repo.ListSettlements(auth.UserID(c), id)
+	if err != nil {
+		householdError(c, err, "Failed to retrieve settlements")
+		return
+	}
+
+	c.JSON(http.StatusOK, settlements)
+}
+
+// RecordSettlement handles recording a payment between two members
+func (h *Handler) RecordSettlement(c *gin.Context) {
+	id, err := householdID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid household ID"})
+		return
+	}
+
+	var settlement models.Settlement
+	if err := c.ShouldBindJSON(&settlement); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.repo.RecordSettlement(auth.UserID(c), id, &settlement); err != nil {
+		householdError(c, err, "Failed to record settlement")
+		return
+	}
+
+	c.JSON(http.StatusCreated, settlement)
+}
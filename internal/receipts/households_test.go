@@ -0,0 +1,202 @@
+package receipts
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/mauroue/cereja-corp/internal/models"
+)
+
+func TestSplitCents(t *testing.T) {
+	tests := []struct {
+		name    string
+		cents   int64
+		weights []float64
+		want    []int64
+	}{
+		{"even", 900, []float64{1, 1, 1}, []int64{300, 300, 300}},
+		{"remainder to the first largest", 1000, []float64{1, 1, 1}, []int64{334, 333, 333}},
+		{"remainder to the largest fractions", 100, []float64{1, 2, 4}, []int64{14, 29, 57}},
+		{"proportional", 1000, []float64{70, 30}, []int64{700, 300}},
+		{"negative total", -1000, []float64{1, 1, 1}, []int64{-334, -333, -333}},
+		{"negative weights count as zero", 500, []float64{1, -3, 1}, []int64{250, 0, 250}},
+		{"all-zero weights split equally", 101, []float64{0, 0}, []int64{51, 50}},
+		{"zero total", 0, []float64{1, 2}, []int64{0, 0}},
+		{"one part", 1234, []float64{5}, []int64{1234}},
+		{"no parts", 500, nil, []int64{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitCents(tt.cents, tt.weights)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitCents(%d, %v) = %v, want %v", tt.cents, tt.weights, got, tt.want)
+			}
+			var sum int64
+			for _, part := range got {
+				sum += part
+			}
+			if len(got) > 0 && sum != tt.cents {
+				t.Errorf("parts add up to %d, want %d", sum, tt.cents)
+			}
+		})
+	}
+}
+
+func TestSplitShare(t *testing.T) {
+	percent := func(p float64) *float64 { return &p }
+	participants := func(ids ...int64) []*models.ShareParticipant {
+		var list []*models.ShareParticipant
+		for _, id := range ids {
+			list = append(list, &models.ShareParticipant{UserID: id})
+		}
+		return list
+	}
+	items := []shareItemCost{
+		{id: 10, name: "CERVEJA", cents: 3000},
+		{id: 11, name: "PAO", cents: 600},
+		{id: 12, name: "QUEIJO", cents: 1400},
+	}
+
+	tests := []struct {
+		name  string
+		total float64
+		share *models.ReceiptShare
+		want  map[int64]int64
+	}{
+		{"equal", 100, &models.ReceiptShare{SplitMethod: SplitEqual, Participants: participants(1, 2, 3)},
+			map[int64]int64{1: 3334, 2: 3333, 3: 3333}},
+		{"percentage", 80, &models.ReceiptShare{SplitMethod: SplitPercentage, Participants: []*models.ShareParticipant{
+			{UserID: 1, Percent: percent(75)}, {UserID: 2, Percent: percent(25)},
+		}}, map[int64]int64{1: 6000, 2: 2000}},
+		{"per item", 50, &models.ReceiptShare{SplitMethod: SplitItem, Participants: participants(1, 2),
+			Items: []*models.ShareItem{{ItemID: 10, UserIDs: []int64{1}}, {ItemID: 12, UserIDs: []int64{2}}}},
+			map[int64]int64{1: 3300, 2: 1700}},
+		{"unassigned items split between everyone", 50, &models.ReceiptShare{SplitMethod: SplitItem, Participants: participants(1, 2, 3),
+			Items: []*models.ShareItem{{ItemID: 10, UserIDs: []int64{1, 2}}}},
+			map[int64]int64{1: 2167, 2: 2166, 3: 667}},
+		{"rest of the total spread in proportion", 45, &models.ReceiptShare{SplitMethod: SplitItem, Participants: participants(1, 2),
+			Items: []*models.ShareItem{{ItemID: 10, UserIDs: []int64{1}}, {ItemID: 11, UserIDs: []int64{2}}, {ItemID: 12, UserIDs: []int64{2}}}},
+			map[int64]int64{1: 2700, 2: 1800}},
+		{"assignments to non-participants ignored", 50, &models.ReceiptShare{SplitMethod: SplitItem, Participants: participants(1, 2),
+			Items: []*models.ShareItem{{ItemID: 10, UserIDs: []int64{9}}, {ItemID: 11, UserIDs: []int64{1}}, {ItemID: 12, UserIDs: []int64{1}}}},
+			map[int64]int64{1: 3500, 2: 1500}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitShare(tt.total, tt.share, items)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitShare() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSettleUp(t *testing.T) {
+	tests := []struct {
+		name     string
+		balances map[int64]int64
+		want     [][3]int64
+	}{
+		{"settled", map[int64]int64{1: 0, 2: 0}, nil},
+		{"two members", map[int64]int64{1: 500, 2: -500}, [][3]int64{{2, 1, 500}}},
+		{"one creditor", map[int64]int64{1: 900, 2: -300, 3: -600}, [][3]int64{{3, 1, 600}, {2, 1, 300}}},
+		{"one debtor", map[int64]int64{1: -900, 2: 300, 3: 600}, [][3]int64{{1, 3, 600}, {1, 2, 300}}},
+		{"ties broken by user", map[int64]int64{1: 100, 2: 100, 3: -100, 4: -100}, [][3]int64{{3, 1, 100}, {4, 2, 100}}},
+		{"chain", map[int64]int64{1: 1000, 2: 200, 3: -700, 4: -500}, [][3]int64{{3, 1, 700}, {4, 1, 300}, {4, 2, 200}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := settleUp(tt.balances)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("settleUp(%v) = %v, want %v", tt.balances, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSettleUpSettlesEveryone(t *testing.T) {
+	tests := []map[int64]int64{
+		{1: 1, 2: 2, 3: 3, 4: 4, 5: -10},
+		{1: 250, 2: -100, 3: -100, 4: -50},
+		{1: 333, 2: 333, 3: -333, 4: -333, 5: 1, 6: -1},
+		{1: 700, 2: -150, 3: -150, 4: -150, 5: -150, 6: -100},
+	}
+
+	for _, balances := range tests {
+		members := 0
+		remaining := map[int64]int64{}
+		for userID, cents := range balances {
+			remaining[userID] = cents
+			if cents != 0 {
+				members++
+			}
+		}
+
+		transfers := settleUp(balances)
+		if len(transfers) > members-1 {
+			t.Errorf("settleUp(%v) made %d transfers, want at most %d", balances, len(transfers), members-1)
+		}
+		for _, transfer := range transfers {
+			if transfer[2] <= 0 {
+				t.Errorf("settleUp(%v) suggested a transfer of %d", balances, transfer[2])
+			}
+			remaining[transfer[0]] += transfer[2]
+			remaining[transfer[1]] -= transfer[2]
+		}
+		for userID, cents := range remaining {
+			if cents != 0 {
+				t.Errorf("settleUp(%v) leaves user %d at %d", balances, userID, cents)
+			}
+		}
+	}
+}
+
+func TestNormalizeShare(t *testing.T) {
+	percent := func(p float64) *float64 { return &p }
+	members := []*models.HouseholdMember{{UserID: 1}, {UserID: 2}, {UserID: 3}}
+	items := []*models.ReceiptItem{{ID: 10}, {ID: 11}}
+
+	tests := []struct {
+		name  string
+		share models.ReceiptShare
+		ok    bool
+	}{
+		{"defaults to everyone equally", models.ReceiptShare{PaidBy: 1}, true},
+		{"percentages", models.ReceiptShare{PaidBy: 1, SplitMethod: SplitPercentage, Participants: []*models.ShareParticipant{
+			{UserID: 1, Percent: percent(60)}, {UserID: 2, Percent: percent(40)}}}, true},
+		{"percentages not adding up", models.ReceiptShare{PaidBy: 1, SplitMethod: SplitPercentage, Participants: []*models.ShareParticipant{
+			{UserID: 1, Percent: percent(60)}, {UserID: 2, Percent: percent(30)}}}, false},
+		{"percentage without participants", models.ReceiptShare{PaidBy: 1, SplitMethod: SplitPercentage}, false},
+		{"payer outside the household", models.ReceiptShare{PaidBy: 9}, false},
+		{"participant outside the household", models.ReceiptShare{PaidBy: 1, Participants: []*models.ShareParticipant{{UserID: 9}}}, false},
+		{"participant twice", models.ReceiptShare{PaidBy: 1, Participants: []*models.ShareParticipant{{UserID: 2}, {UserID: 2}}}, false},
+		{"unknown method", models.ReceiptShare{PaidBy: 1, SplitMethod: "random"}, false},
+		{"items", models.ReceiptShare{PaidBy: 1, SplitMethod: SplitItem, Items: []*models.ShareItem{{ItemID: 10, UserIDs: []int64{1, 1}}}}, true},
+		{"item not on the receipt", models.ReceiptShare{PaidBy: 1, SplitMethod: SplitItem, Items: []*models.ShareItem{{ItemID: 99, UserIDs: []int64{1}}}}, false},
+		{"item assigned to a non-participant", models.ReceiptShare{PaidBy: 1, SplitMethod: SplitItem,
+			Participants: []*models.ShareParticipant{{UserID: 1}, {UserID: 2}}, Items: []*models.ShareItem{{ItemID: 10, UserIDs: []int64{3}}}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			share := tt.share
+			err := normalizeShare(&share, members, items)
+			if (err == nil) != tt.ok {
+				t.Fatalf("normalizeShare() = %v, want ok = %v", err, tt.ok)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidShare) {
+				t.Errorf("error %v does not wrap ErrInvalidShare", err)
+			}
+			if err == nil && share.SplitMethod == SplitEqual && len(share.Participants) != len(members) {
+				t.Errorf("%d participants, want every member", len(share.Participants))
+			}
+			if err == nil && share.SplitMethod == SplitItem && !reflect.DeepEqual(share.Items[0].UserIDs, []int64{1}) {
+				t.Errorf("item assigned to %v, want duplicates dropped", share.Items[0].UserIDs)
+			}
+		})
+	}
+}
@@ -0,0 +1,653 @@
+package receipts
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mauroue/cereja-corp/internal/auth"
+	"github.com/mauroue/cereja-corp/internal/models"
+)
+
+// householdHTMLError returns the HTMX error message for errors shared by the household pages
+func householdHTMLError(err error, fallback string) string {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return createErrorResponse("Household not found")
+	case errors.Is(err, ErrNotHouseholdOwner), errors.Is(err, ErrHouseholdUserNotFound),
+		errors.Is(err, ErrHouseholdOwnerLeaving), errors.Is(err, ErrSharedReceiptNotFound),
+		errors.Is(err, ErrInvalidShare), errors.Is(err, ErrInvalidSettlement):
+		return createErrorResponse(template.HTMLEscapeString(err.Error()))
+	default:
+		return createErrorResponse(fallback)
+	}
+}
+
+// HouseholdsPage renders the list of households with the form creating one
+func (h *WebHandler) HouseholdsPage(c *gin.Context) {
+	content := `
+<div class="card">
+    <div class="card-header">
+        <h1 class="card-title">Households</h1>
+    </div>
+    <p>Share receipts with the people you live with, record who paid, and see who owes whom.</p>
+
+    <div id="households-list" hx-get="/receipts-web/htmx/households" hx-trigger="load">
+        <div class="loading-spinner"></div>
+    </div>
+</div>
+
+<div class="card">
+    <div class="card-header">
+        <h2 class="card-title">New Household</h2>
+    </div>
+    <form hx-post="/receipts-web/htmx/households" hx-target="#households-list">
+        <div class="form-group">
+            <label for="household-name">Name</label>
+            <input type="text" id="household-name" name="name" placeholder="Home" required>
+        </div>
+        <button type="submit" class="btn btn-primary">Create Household</button>
+    </form>
+</div>
+`
+
+	page := renderPageWithLayout("Households", content)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(page))
+}
+
+// HtmxHouseholds returns the user's households
+func (h *WebHandler) HtmxHouseholds(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html", []byte(h.renderHouseholds(auth.UserID(c))))
+}
+
+// HtmxCreateHousehold creates a household from the household form and returns the updated list
+func (h *WebHandler) HtmxCreateHousehold(c *gin.Context) {
+	userID := auth.UserID(c)
+	if _, err := h.repo.CreateHousehold(userID, c.PostForm("name")); err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Failed to create household")+h.renderHouseholds(userID)))
+		return
+	}
+	c.Data(http.StatusOK, "text/html", []byte(h.renderHouseholds(userID)))
+}
+
+// renderHouseholds renders links to the user's households
+func (h *WebHandler) renderHouseholds(userID int64) string {
+	households, err := h.repo.ListHouseholds(userID)
+	if err != nil {
+		return createErrorResponse("Failed to load households")
+	}
+	if len(households) == 0 {
+		return `<p>You are not in a household yet.</p>`
+	}
+
+	var out strings.Builder
+	out.WriteString(`<table class="table"><thead><tr><th>Household</th><th>Created</th><th>Role</th></tr></thead><tbody>`)
+	for _, household := range households {
+		role := "Member"
+		if household.OwnerID == userID {
+			role = "Owner"
+		}
+		out.WriteString(fmt.Sprintf(`<tr><td><a href="/receipts-web/households/%d">%s</a></td><td>%s</td><td>%s</td></tr>`,
+			household.ID, template.HTMLEscapeString(household.Name), formatDate(household.CreatedAt), role))
+	}
+	out.WriteString(`</tbody></table>`)
+
+	return out.String()
+}
+
+// HouseholdPage renders a household's members, balances and shared receipts
+func (h *WebHandler) HouseholdPage(c *gin.Context) {
+	id, err := householdID(c)
+	if err != nil {
+		c.Redirect(http.StatusSeeOther, "/receipts-web/households")
+		return
+	}
+
+	household, err := h.repo.GetHousehold(auth.UserID(c), id)
+	if err != nil {
+		page := renderPageWithLayout("Household", householdHTMLError(err, "Failed to load household"))
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(page))
+		return
+	}
+
+	content := fmt.Sprintf(`
+<div class="card">
+    <div class="card-header">
+        <h1 class="card-title">%s</h1>
+        <a href="/receipts-web/households" class="btn btn-secondary">All Households</a>
+    </div>
+    <h2>Balances</h2>
+    <div id="household-balances" hx-get="/receipts-web/htmx/households/%d/balances" hx-trigger="load">
+        <div class="loading-spinner"></div>
+    </div>
+</div>
+
+<div class="card">
+    <div class="card-header">
+        <h2 class="card-title">Members</h2>
+    </div>
+    <div id="household-members" hx-get="/receipts-web/htmx/households/%d/members" hx-trigger="load">
+        <div class="loading-spinner"></div>
+    </div>
+</div>
+
+<div class="card">
+    <div class="card-header">
+        <h2 class="card-title">Shared Receipts</h2>
+    </div>
+    <p>Share a receipt from its page under My Receipts.</p>
+    <div id="household-receipts" hx-get="/receipts-web/htmx/households/%d/receipts" hx-trigger="load">
+        <div class="loading-spinner"></div>
+    </div>
+</div>
+`, template.HTMLEscapeString(household.Name), id, id, id)
+
+	page := renderPageWithLayout(household.Name, content)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(page))
+}
+
+// HtmxHouseholdMembers returns a household's members
+func (h *WebHandler) HtmxHouseholdMembers(c *gin.Context) {
+	id, err := householdID(c)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Invalid household ID")))
+		return
+	}
+	c.Data(http.StatusOK, "text/html", []byte(h.renderHouseholdMembers(auth.UserID(c), id)))
+}
+
+// HtmxAddHouseholdMember adds a member by username and returns the updated members
+func (h *WebHandler) HtmxAddHouseholdMember(c *gin.Context) {
+	id, err := householdID(c)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Invalid household ID")))
+		return
+	}
+
+	userID := auth.UserID(c)
+	message := ""
+	if _, err := h.repo.AddHouseholdMember(userID, id, c.PostForm("username")); err != nil {
+		message = householdHTMLError(err, "Failed to add member")
+	}
+	c.Data(http.StatusOK, "text/html", []byte(message+h.renderHouseholdMembers(userID, id)))
+}
+
+// HtmxRemoveHouseholdMember removes a member, or the user leaving, and returns the updated members
+func (h *WebHandler) HtmxRemoveHouseholdMember(c *gin.Context) {
+	id, err := householdID(c)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Invalid household ID")))
+		return
+	}
+	memberID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Invalid user ID")))
+		return
+	}
+
+	userID := auth.UserID(c)
+	if err := h.repo.RemoveHouseholdMember(userID, id, memberID); err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(householdHTMLError(err, "Failed to remove member")+h.renderHouseholdMembers(userID, id)))
+		return
+	}
+	if memberID == userID {
+		c.Header("HX-Redirect", "/receipts-web/households")
+	}
+	c.Data(http.StatusOK, "text/html", []byte(h.renderHouseholdMembers(userID, id)))
+}
+
+// renderHouseholdMembers renders a household's members. The owner gets the form
+// adding members and can remove them; everyone else can leave.
+func (h *WebHandler) renderHouseholdMembers(userID, householdID int64) string {
+	household, err := h.repo.GetHousehold(userID, householdID)
+	if err != nil {
+		return householdHTMLError(err, "Failed to load members")
+	}
+
+	var out strings.Builder
+	out.WriteString(`<table class="table"><thead><tr><th>Member</th><th>Joined</th><th>Actions</th></tr></thead><tbody>`)
+	for _, member := range household.Members {
+		action := ""
+		switch {
+		case member.UserID == household.OwnerID:
+			action = "Owner"
+		case member.UserID == userID:
+			action = fmt.Sprintf(`
+				<button class="btn btn-sm btn-secondary"
+						hx-delete="/receipts-web/htmx/households/%d/members/%d"
+						hx-target="#household-members"
+						hx-confirm="Leave this household?">
+					Leave
+				</button>`, householdID, member.UserID)
+		case userID == household.OwnerID:
+			action = fmt.Sprintf(`
+				<button class="btn btn-sm btn-secondary"
+						hx-delete="/receipts-web/htmx/households/%d/members/%d"
+						hx-target="#household-members"
+						hx-confirm="Remove %s from this household?">
+					Remove
+				</button>`, householdID, member.UserID, template.HTMLEscapeString(member.Username))
+		}
+
+		out.WriteString(fmt.Sprintf(`<tr><td>%s</td><td>%s</td><td>%s</td></tr>`,
+			template.HTMLEscapeString(member.Username), formatDate(member.JoinedAt), action))
+	}
+	out.WriteString(`</tbody></table>`)
+
+	if userID == household.OwnerID {
+		out.WriteString(fmt.Sprintf(`
+	<form hx-post="/receipts-web/htmx/households/%d/members" hx-target="#household-members">
+		<div class="filter-form">
+			<div class="form-group">
+				<label for="member-username">Username</label>
+				<input type="text" id="member-username" name="username" required>
+			</div>
+		</div>
+		<button type="submit" class="btn btn-primary">Add Member</button>
+	</form>`, householdID))
+	}
+
+	return out.String()
+}
+
+// HtmxHouseholdBalances returns the members' balances with the settle-up suggestion
+func (h *WebHandler) HtmxHouseholdBalances(c *gin.Context) {
+	id, err := householdID(c)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Invalid household ID")))
+		return
+	}
+	c.Data(http.StatusOK, "text/html", []byte(h.renderHouseholdBalances(auth.UserID(c), id)))
+}
+
+// HtmxRecordSettlement records a suggested transfer as paid and returns the updated balances
+func (h *WebHandler) HtmxRecordSettlement(c *gin.Context) {
+	id, err := householdID(c)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Invalid household ID")))
+		return
+	}
+
+	settlement := models.Settlement{}
+	settlement.FromUserID, _ = strconv.ParseInt(c.PostForm("from_user_id"), 10, 64)
+	settlement.ToUserID, _ = strconv.ParseInt(c.PostForm("to_user_id"), 10, 64)
+	amount, err := strconv.ParseFloat(strings.ReplaceAll(c.PostForm("amount"), ",", "."), 64)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Please enter a valid amount")))
+		return
+	}
+	settlement.Amount = amount
+
+	userID := auth.UserID(c)
+	message := createSuccessResponse("Payment recorded")
+	if err := h.repo.RecordSettlement(userID, id, &settlement); err != nil {
+		message = householdHTMLError(err, "Failed to record payment")
+	}
+	c.Data(http.StatusOK, "text/html", []byte(message+h.renderHouseholdBalances(userID, id)))
+}
+
+// renderHouseholdBalances renders each member's balance and the suggested
+// transfers. Members paying or being paid can mark a transfer as done.
+func (h *WebHandler) renderHouseholdBalances(userID, householdID int64) string {
+	balances, err := h.repo.HouseholdBalances(userID, householdID)
+	if err != nil {
+		return householdHTMLError(err, "Failed to load balances")
+	}
+
+	var out strings.Builder
+	out.WriteString(`<table class="table"><thead><tr><th>Member</th><th>Paid</th><th>Share</th><th>Settled</th><th>Balance</th></tr></thead><tbody>`)
+	for _, b := range balances.Balances {
+		status := "Settled"
+		if b.Balance > 0 {
+			status = "Is owed " + formatCurrency(b.Balance)
+		} else if b.Balance < 0 {
+			status = "Owes " + formatCurrency(-b.Balance)
+		}
+		out.WriteString(fmt.Sprintf(`<tr><td>%s</td><td>%s</td><td>%s</td><td>%s sent, %s received</td><td>%s</td></tr>`,
+			template.HTMLEscapeString(b.Username), formatCurrency(b.Paid), formatCurrency(b.Owed),
+			formatCurrency(b.Sent), formatCurrency(b.Received), status))
+	}
+	out.WriteString(`</tbody></table>`)
+
+	if balances.Unconverted > 0 {
+		out.WriteString(fmt.Sprintf(`<p>%d shared receipts are left out until an <a href="/receipts-web/exchange-rates">exchange rate</a> to %s is known.</p>`,
+			balances.Unconverted, balances.Currency))
+	}
+
+	if len(balances.Transfers) == 0 {
+		out.WriteString(`<p>Everyone is settled up.</p>`)
+		return out.String()
+	}
+
+	out.WriteString(`<h3>Settle Up</h3><ul class="settle-up">`)
+	for _, t := range balances.Transfers {
+		action := ""
+		if userID == t.FromUserID || userID == t.ToUserID {
+			action = fmt.Sprintf(`
+				<button class="btn btn-sm btn-primary"
+						hx-post="/receipts-web/htmx/households/%d/settlements"
+						hx-vals='{"from_user_id": "%d", "to_user_id": "%d", "amount": "%.2f"}'
+						hx-target="#household-balances"
+						hx-confirm="Record this payment?">
+					Mark as Paid
+				</button>`, householdID, t.FromUserID, t.ToUserID, t.Amount)
+		}
+		out.WriteString(fmt.Sprintf(`<li><strong>%s</strong> pays <strong>%s</strong> %s %s</li>`,
+			template.HTMLEscapeString(t.FromUsername), template.HTMLEscapeString(t.ToUsername),
+			formatCurrency(t.Amount), action))
+	}
+	out.WriteString(`</ul>`)
+
+	return out.String()
+}
+
+// HtmxHouseholdReceipts returns a household's shared receipts
+func (h *WebHandler) HtmxHouseholdReceipts(c *gin.Context) {
+	id, err := householdID(c)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Invalid household ID")))
+		return
+	}
+
+	userID := auth.UserID(c)
+	shared, err := h.repo.ListSharedReceipts(userID, id)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(householdHTMLError(err, "Failed to load shared receipts")))
+		return
+	}
+	if len(shared) == 0 {
+		c.Data(http.StatusOK, "text/html", []byte(`<p>No receipts shared yet.</p>`))
+		return
+	}
+
+	var out strings.Builder
+	out.WriteString(`<table class="table"><thead><tr><th>Store</th><th>Date</th><th>Total</th><th>Paid By</th><th>Split</th><th>Shares</th></tr></thead><tbody>`)
+	for _, entry := range shared {
+		store := template.HTMLEscapeString(entry.Receipt.StoreName)
+		if entry.Receipt.UserID == userID {
+			store = fmt.Sprintf(`<a href="/receipts-web/view/%d">%s</a>`, entry.Receipt.ID, store)
+		}
+
+		parts := make([]string, 0, len(entry.Owed))
+		for _, owed := range entry.Owed {
+			parts = append(parts, fmt.Sprintf("%s %s", template.HTMLEscapeString(owed.Username), formatMoney(owed.Amount, entry.Receipt.Currency)))
+		}
+
+		out.WriteString(fmt.Sprintf(`<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>`,
+			store, formatDate(entry.Receipt.PurchaseDate), formatMoney(entry.Receipt.TotalAmount, entry.Receipt.Currency),
+			template.HTMLEscapeString(entry.PaidByName), formatSplitMethod(entry.Share.SplitMethod),
+			strings.Join(parts, ", ")))
+	}
+	out.WriteString(`</tbody></table>`)
+
+	c.Data(http.StatusOK, "text/html", []byte(out.String()))
+}
+
+// formatSplitMethod returns a label for a split method
+func formatSplitMethod(method string) string {
+	switch method {
+	case SplitPercentage:
+		return "By percentage"
+	case SplitItem:
+		return "Per item"
+	default:
+		return "Equally"
+	}
+}
+
+// HtmxReceiptShare returns the form sharing a receipt with a household. The
+// household_id query parameter picks the household whose members are listed.
+func (h *WebHandler) HtmxReceiptShare(c *gin.Context) {
+	receiptID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Invalid receipt ID")))
+		return
+	}
+
+	householdID, _ := strconv.ParseInt(c.Query("household_id"), 10, 64)
+	c.Data(http.StatusOK, "text/html", []byte(h.renderReceiptShare(auth.UserID(c), receiptID, householdID, "")))
+}
+
+// HtmxShareReceipt shares a receipt from the share form and returns the form
+func (h *WebHandler) HtmxShareReceipt(c *gin.Context) {
+	receiptID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Invalid receipt ID")))
+		return
+	}
+	householdID, err := strconv.ParseInt(c.PostForm("household_id"), 10, 64)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Please choose a household")))
+		return
+	}
+
+	share := models.ReceiptShare{
+		ReceiptID:   receiptID,
+		SplitMethod: c.PostForm("split_method"),
+	}
+	share.PaidBy, _ = strconv.ParseInt(c.PostForm("paid_by"), 10, 64)
+
+	for _, value := range c.PostFormArray("participants") {
+		participantID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		participant := &models.ShareParticipant{UserID: participantID}
+		if share.SplitMethod == SplitPercentage {
+			percent, err := strconv.ParseFloat(strings.ReplaceAll(c.PostForm(fmt.Sprintf("percent_%d", participantID)), ",", "."), 64)
+			if err == nil {
+				participant.Percent = &percent
+			}
+		}
+		share.Participants = append(share.Participants, participant)
+	}
+
+	if share.SplitMethod == SplitItem {
+		if err := c.Request.ParseForm(); err == nil {
+			for key, values := range c.Request.PostForm {
+				itemID, err := strconv.ParseInt(strings.TrimPrefix(key, "item_"), 10, 64)
+				if !strings.HasPrefix(key, "item_") || err != nil {
+					continue
+				}
+				item := &models.ShareItem{ItemID: itemID}
+				for _, value := range values {
+					if assignee, err := strconv.ParseInt(value, 10, 64); err == nil {
+						item.UserIDs = append(item.UserIDs, assignee)
+					}
+				}
+				share.Items = append(share.Items, item)
+			}
+			sort.Slice(share.Items, func(i, j int) bool { return share.Items[i].ItemID < share.Items[j].ItemID })
+		}
+	}
+
+	userID := auth.UserID(c)
+	message := createSuccessResponse("Receipt shared")
+	if err := h.repo.ShareReceipt(userID, householdID, &share); err != nil {
+		message = householdHTMLError(err, "Failed to share receipt")
+	}
+	c.Data(http.StatusOK, "text/html", []byte(h.renderReceiptShare(userID, receiptID, householdID, message)))
+}
+
+// HtmxUnshareReceipt stops sharing a receipt and returns the share form
+func (h *WebHandler) HtmxUnshareReceipt(c *gin.Context) {
+	receiptID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Invalid receipt ID")))
+		return
+	}
+
+	userID := auth.UserID(c)
+	message := createSuccessResponse("Receipt is no longer shared")
+	share, err := h.repo.GetReceiptShare(userID, receiptID)
+	if err == nil {
+		err = h.repo.UnshareReceipt(userID, share.HouseholdID, receiptID)
+	}
+	if err != nil {
+		message = createErrorResponse("Failed to unshare receipt")
+	}
+	c.Data(http.StatusOK, "text/html", []byte(h.renderReceiptShare(userID, receiptID, 0, message)))
+}
+
+// renderReceiptShare renders the form sharing a receipt with one of the user's
+// households: who paid, how the total is split, and per item who shares it
+func (h *WebHandler) renderReceiptShare(userID, receiptID, householdID int64, message string) string {
+	households, err := h.repo.ListHouseholds(userID)
+	if err != nil {
+		return createErrorResponse("Failed to load households")
+	}
+	if len(households) == 0 {
+		return message + `<p>Create a <a href="/receipts-web/households">household</a> to split this receipt with others.</p>`
+	}
+
+	share, err := h.repo.GetReceiptShare(userID, receiptID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return createErrorResponse("Failed to load the receipt's share")
+	}
+	if share == nil {
+		share = &models.ReceiptShare{PaidBy: userID, SplitMethod: SplitEqual}
+	}
+	if householdID == 0 {
+		householdID = share.HouseholdID
+	}
+	if householdID == 0 {
+		householdID = households[0].ID
+	}
+	if share.HouseholdID != 0 && share.HouseholdID != householdID {
+		// Switching households starts from a fresh split
+		share = &models.ReceiptShare{PaidBy: userID, SplitMethod: SplitEqual}
+	}
+
+	household, err := h.repo.GetHousehold(userID, householdID)
+	if err != nil {
+		return householdHTMLError(err, "Failed to load household")
+	}
+	items, err := h.repo.GetReceiptItems(userID, receiptID)
+	if err != nil {
+		return createErrorResponse("Failed to load receipt items")
+	}
+
+	var householdOptions strings.Builder
+	for _, hh := range households {
+		selected := ""
+		if hh.ID == householdID {
+			selected = " selected"
+		}
+		householdOptions.WriteString(fmt.Sprintf(`<option value="%d"%s>%s</option>`, hh.ID, selected, template.HTMLEscapeString(hh.Name)))
+	}
+
+	participating := make(map[int64]*models.ShareParticipant, len(share.Participants))
+	for _, p := range share.Participants {
+		participating[p.UserID] = p
+	}
+	assigned := make(map[int64]map[int64]bool, len(share.Items))
+	for _, item := range share.Items {
+		assigned[item.ItemID] = make(map[int64]bool, len(item.UserIDs))
+		for _, assignee := range item.UserIDs {
+			assigned[item.ItemID][assignee] = true
+		}
+	}
+
+	var payerOptions, participants, itemHeader strings.Builder
+	for _, member := range household.Members {
+		name := template.HTMLEscapeString(member.Username)
+
+		selected := ""
+		if member.UserID == share.PaidBy {
+			selected = " selected"
+		}
+		payerOptions.WriteString(fmt.Sprintf(`<option value="%d"%s>%s</option>`, member.UserID, selected, name))
+
+		checked, percent := " checked", ""
+		if p, ok := participating[member.UserID]; ok {
+			if p.Percent != nil {
+				percent = strconv.FormatFloat(*p.Percent, 'f', -1, 64)
+			}
+		} else if len(participating) > 0 {
+			checked = ""
+		}
+		participants.WriteString(fmt.Sprintf(`
+				<tr>
+					<td><label><input type="checkbox" name="participants" value="%d"%s> %s</label></td>
+					<td><input type="number" name="percent_%d" value="%s" min="0" max="100" step="0.01" placeholder="%%"></td>
+				</tr>`, member.UserID, checked, name, member.UserID, percent))
+
+		itemHeader.WriteString(fmt.Sprintf(`<th>%s</th>`, name))
+	}
+
+	var itemRows strings.Builder
+	for _, item := range items {
+		itemRows.WriteString(fmt.Sprintf(`<tr><td>%s</td><td>%s</td>`,
+			template.HTMLEscapeString(item.Name), formatCurrency(item.TotalPrice)))
+		for _, member := range household.Members {
+			checked := ""
+			if assigned[item.ID][member.UserID] {
+				checked = " checked"
+			}
+			itemRows.WriteString(fmt.Sprintf(`<td><input type="checkbox" name="item_%d" value="%d"%s></td>`, item.ID, member.UserID, checked))
+		}
+		itemRows.WriteString(`</tr>`)
+	}
+
+	methodOptions := ""
+	for _, method := range []string{SplitEqual, SplitPercentage, SplitItem} {
+		selected := ""
+		if method == share.SplitMethod {
+			selected = " selected"
+		}
+		methodOptions += fmt.Sprintf(`<option value="%s"%s>%s</option>`, method, selected, formatSplitMethod(method))
+	}
+
+	unshare := ""
+	status := `<p>This receipt is not shared.</p>`
+	if share.HouseholdID != 0 {
+		status = fmt.Sprintf(`<p>Shared with <a href="/receipts-web/households/%d">%s</a>.</p>`,
+			share.HouseholdID, template.HTMLEscapeString(household.Name))
+		unshare = fmt.Sprintf(`
+			<button type="button" class="btn btn-secondary"
+					hx-delete="/receipts-web/htmx/receipt/%d/share"
+					hx-target="#receipt-share"
+					hx-confirm="Stop sharing this receipt?">
+				Stop Sharing
+			</button>`, receiptID)
+	}
+
+	return fmt.Sprintf(`
+	%s
+	%s
+	<form hx-post="/receipts-web/htmx/receipt/%d/share" hx-target="#receipt-share">
+		<div class="filter-form">
+			<div class="form-group">
+				<label for="share-household">Household</label>
+				<select id="share-household" name="household_id"
+						hx-get="/receipts-web/htmx/receipt/%d/share"
+						hx-trigger="change"
+						hx-target="#receipt-share">%s</select>
+			</div>
+			<div class="form-group">
+				<label for="paid_by">Paid By</label>
+				<select id="paid_by" name="paid_by">%s</select>
+			</div>
+			<div class="form-group">
+				<label for="split_method">Split</label>
+				<select id="split_method" name="split_method">%s</select>
+			</div>
+		</div>
+		<h3>Participants</h3>
+		<p>Percentages are only used when splitting by percentage and must add up to 100.</p>
+		<table class="table"><tbody>%s</tbody></table>
+		<h3>Items</h3>
+		<p>For per-item splits, tick who shares each item. Items nobody is ticked for are split between all participants.</p>
+		<table class="table"><thead><tr><th>Item</th><th>Price</th>%s</tr></thead><tbody>%s</tbody></table>
+		<button type="submit" class="btn btn-primary">Save Split</button>
+		%s
+	</form>
+	`, message, status, receiptID, receiptID, householdOptions.String(), payerOptions.String(), methodOptions,
+		participants.String(), itemHeader.String(), itemRows.String(), unshare)
+}
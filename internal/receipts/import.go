@@ -0,0 +1,889 @@
+package receipts
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/mauroue/cereja-corp/internal/auth"
+	"github.com/mauroue/cereja-corp/internal/models"
+)
+
+// Fields a CSV column can be mapped to
+const (
+	ImportFieldReceipt   = "receipt"
+	ImportFieldStore     = "store"
+	ImportFieldDate      = "date"
+	ImportFieldTotal     = "total"
+	ImportFieldCategory  = "category"
+	ImportFieldCurrency  = "currency"
+	ImportFieldItemName  = "item_name"
+	ImportFieldQuantity  = "quantity"
+	ImportFieldUnit      = "unit"
+	ImportFieldPrice     = "price"
+	ImportFieldItemTotal = "item_total"
+)
+
+const (
+	maxImportSize    = 10 << 20
+	importPreviewLen = 20
+)
+
+// importFields lists the mappable fields in form order, with the header names
+// each one is guessed from
+var importFields = []struct {
+	key, label string
+	aliases    []string
+}{
+	{ImportFieldReceipt, "Receipt ID", []string{"receipt", "receipt_id", "nota", "cupom", "id"}},
+	{ImportFieldStore, "Store", []string{"store", "store_name", "loja", "estabelecimento", "merchant", "vendor"}},
+	{ImportFieldDate, "Date", []string{"date", "purchase_date", "data", "data_compra"}},
+	{ImportFieldTotal, "Receipt Total", []string{"total", "total_amount", "valor_total", "amount"}},
+	{ImportFieldCategory, "Category", []string{"category", "categoria"}},
+	{ImportFieldCurrency, "Currency", []string{"currency", "moeda"}},
+	{ImportFieldItemName, "Item Name", []string{"item", "item_name", "product", "produto", "name", "nome", "descricao", "description"}},
+	{ImportFieldQuantity, "Quantity", []string{"quantity", "qty", "quantidade", "qtd", "qtde"}},
+	{ImportFieldUnit, "Unit", []string{"unit", "unidade", "un"}},
+	{ImportFieldPrice, "Unit Price", []string{"price", "unit_price", "preco", "preco_unitario", "valor_unitario"}},
+	{ImportFieldItemTotal, "Item Total", []string{"item_total", "total_price", "valor_item", "subtotal"}},
+}
+
+// importDateLayouts are the date formats accepted by imports. Slashed dates are read day first.
+var importDateLayouts = []string{
+	"2006-01-02",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	time.RFC3339,
+	"02/01/2006",
+	"02/01/2006 15:04:05",
+	"02/01/2006 15:04",
+	"02-01-2006",
+	"02.01.2006",
+}
+
+// ImportMapping maps import fields to the CSV header of the column holding them
+type ImportMapping map[string]string
+
+// ImportError is a problem with one CSV row
+type ImportError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// ImportReceipt is a receipt assembled from one or more CSV rows
+type ImportReceipt struct {
+	Row     int                   `json:"row"`
+	Receipt *models.Receipt       `json:"receipt"`
+	Items   []*models.ReceiptItem `json:"items"`
+}
+
+// ImportResult reports what an import found and, unless it was a dry run, what it created
+type ImportResult struct {
+	DryRun   bool                `json:"dry_run"`
+	Headers  []string            `json:"headers"`
+	Mapping  ImportMapping       `json:"mapping"`
+	Receipts int                 `json:"receipts"`
+	Items    int                 `json:"items"`
+	Errors   []*ImportError      `json:"errors"`
+	Preview  []*ImportReceipt    `json:"preview"`
+	Batch    *models.ImportBatch `json:"batch,omitempty"`
+}
+
+// normalizeHeader lowercases a CSV header and strips accents and separators so
+// that "Preço Unitário" matches "preco_unitario"
+func normalizeHeader(s string) string {
+	replacer := strings.NewReplacer(
+		"á", "a", "à", "a", "â", "a", "ã", "a", "é", "e", "ê", "e", "í", "i",
+		"ó", "o", "ô", "o", "õ", "o", "ú", "u", "ç", "c",
+		" ", "_", "-", "_", ".", "",
+	)
+	return replacer.Replace(strings.ToLower(strings.TrimSpace(s)))
+}
+
+// guessImportMapping maps every field whose aliases match one of the headers
+func guessImportMapping(headers []string) ImportMapping {
+	mapping := ImportMapping{}
+	used := map[string]bool{}
+	for _, field := range importFields {
+		for _, alias := range field.aliases {
+			for _, header := range headers {
+				if !used[header] && normalizeHeader(header) == alias {
+					mapping[field.key] = header
+					used[header] = true
+					break
+				}
+			}
+			if mapping[field.key] != "" {
+				break
+			}
+		}
+	}
+	return mapping
+}
+
+// readImportCSV reads a CSV file separated by commas or semicolons, whichever the header uses
+func readImportCSV(data []byte) ([][]string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	firstLine := data
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		firstLine = data[:i]
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	if bytes.Count(firstLine, []byte(";")) > bytes.Count(firstLine, []byte(",")) {
+		reader.Comma = ';'
+	}
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.LazyQuotes = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("the file is empty")
+	}
+	return records, nil
+}
+
+// parseImportAmount parses amounts such as "12.50", "12,50", "R$ 1.234,56" or "1,234.56"
+func parseImportAmount(s string) (float64, error) {
+	s = strings.NewReplacer("R$", "", "$", "", " ", "", " ", "").Replace(strings.TrimSpace(s))
+
+	if strings.Contains(s, ",") && strings.Contains(s, ".") {
+		if strings.LastIndex(s, ",") > strings.LastIndex(s, ".") {
+			s = strings.ReplaceAll(s, ".", "")
+		} else {
+			s = strings.ReplaceAll(s, ",", "")
+		}
+	}
+	return strconv.ParseFloat(strings.ReplaceAll(s, ",", "."), 64)
+}
+
+// parseImportDate parses a date in one of importDateLayouts
+func parseImportDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range importDateLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized date %q, use YYYY-MM-DD or DD/MM/YYYY", s)
+}
+
+// parseImport validates a CSV file against a mapping and groups its rows into
+// receipts. Rows with the same receipt ID, or without one the same store, date
+// and total, become one receipt. Rows with errors are reported and left out.
+// An empty mapping is guessed from the headers.
+func parseImport(data []byte, mapping ImportMapping) (*ImportResult, []*ImportReceipt, error) {
+	records, err := readImportCSV(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read CSV: %w", err)
+	}
+
+	headers := records[0]
+	if len(mapping) == 0 {
+		mapping = guessImportMapping(headers)
+	}
+
+	result := &ImportResult{DryRun: true, Headers: headers, Mapping: mapping, Errors: []*ImportError{}}
+
+	columns := map[string]int{}
+	for field, header := range mapping {
+		if header == "" {
+			continue
+		}
+		index := -1
+		for i, h := range headers {
+			if h == header {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			return nil, nil, fmt.Errorf("column %q mapped to %s is not in the file", header, field)
+		}
+		columns[field] = index
+	}
+
+	_, hasStore := columns[ImportFieldStore]
+	_, hasDate := columns[ImportFieldDate]
+	_, hasTotal := columns[ImportFieldTotal]
+	_, hasItems := columns[ImportFieldItemName]
+	if !hasStore || !hasDate {
+		return nil, nil, errors.New("the store and date columns must be mapped")
+	}
+	if !hasTotal && !hasItems {
+		return nil, nil, errors.New("either the receipt total or the item name column must be mapped")
+	}
+
+	var receipts []*ImportReceipt
+	byKey := map[string]*ImportReceipt{}
+
+	for n, record := range records[1:] {
+		row := n + 2
+		value := func(field string) string {
+			if i, ok := columns[field]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		fail := func(field, format string, args ...interface{}) {
+			result.Errors = append(result.Errors, &ImportError{Row: row, Field: field, Message: fmt.Sprintf(format, args...)})
+		}
+
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+
+		errorCount := len(result.Errors)
+		store := value(ImportFieldStore)
+		if store == "" {
+			fail(ImportFieldStore, "store is required")
+		}
+		date, err := parseImportDate(value(ImportFieldDate))
+		if err != nil {
+			fail(ImportFieldDate, "%v", err)
+		}
+
+		var total *float64
+		if raw := value(ImportFieldTotal); raw != "" {
+			amount, err := parseImportAmount(raw)
+			if err != nil || amount < 0 {
+				fail(ImportFieldTotal, "invalid total %q", raw)
+			}
+			total = &amount
+		}
+
+		currency := baseCurrency()
+		if raw := value(ImportFieldCurrency); raw != "" {
+			if currency, err = normalizeCurrency(raw); err != nil {
+				fail(ImportFieldCurrency, "invalid currency %q", raw)
+			}
+		}
+
+		var item *models.ReceiptItem
+		if name := value(ImportFieldItemName); name != "" {
+			item = &models.ReceiptItem{Name: name, Quantity: 1, Unit: UnitPiece}
+
+			if raw := value(ImportFieldQuantity); raw != "" {
+				qty, unit, ok := ParseQuantity(raw)
+				if !ok || qty <= 0 {
+					fail(ImportFieldQuantity, "invalid quantity %q", raw)
+				}
+				item.Quantity, item.Unit = qty, unit
+			}
+			if raw := value(ImportFieldUnit); raw != "" {
+				unit, ok := ParseUnit(raw)
+				if !ok {
+					fail(ImportFieldUnit, "unknown unit %q", raw)
+				}
+				item.Unit = unit
+			}
+
+			price, itemTotal := value(ImportFieldPrice), value(ImportFieldItemTotal)
+			if price == "" && itemTotal == "" {
+				fail(ImportFieldPrice, "the item needs a unit price or an item total")
+			}
+			if price != "" {
+				if item.UnitPrice, err = parseImportAmount(price); err != nil {
+					fail(ImportFieldPrice, "invalid price %q", price)
+				}
+			}
+			if itemTotal != "" {
+				if item.TotalPrice, err = parseImportAmount(itemTotal); err != nil {
+					fail(ImportFieldItemTotal, "invalid item total %q", itemTotal)
+				}
+			}
+			if price == "" && item.Quantity > 0 {
+				item.UnitPrice = item.TotalPrice / item.Quantity
+			}
+			if itemTotal == "" {
+				item.TotalPrice = item.UnitPrice * item.Quantity
+			}
+		} else if total == nil {
+			fail(ImportFieldTotal, "the row has neither a receipt total nor an item")
+		}
+
+		if len(result.Errors) > errorCount {
+			continue
+		}
+
+		key := value(ImportFieldReceipt)
+		if key == "" {
+			key = strings.Join([]string{strings.ToLower(store), value(ImportFieldDate), value(ImportFieldTotal)}, "\x00")
+		}
+
+		receipt, ok := byKey[key]
+		if !ok {
+			receipt = &ImportReceipt{
+				Row: row,
+				Receipt: &models.Receipt{
+					StoreName:    store,
+					PurchaseDate: date,
+					CategoryName: value(ImportFieldCategory),
+					Currency:     currency,
+					ReviewStatus: ReviewConfirmed,
+				},
+				Items: []*models.ReceiptItem{},
+			}
+			if total != nil {
+				receipt.Receipt.TotalAmount = *total
+			}
+			byKey[key] = receipt
+			receipts = append(receipts, receipt)
+		}
+
+		if item != nil {
+			NormalizeItemUnits(item)
+			receipt.Items = append(receipt.Items, item)
+			result.Items++
+			if total == nil {
+				receipt.Receipt.TotalAmount += item.TotalPrice
+			}
+		}
+	}
+
+	result.Receipts = len(receipts)
+	result.Preview = receipts
+	if len(result.Preview) > importPreviewLen {
+		result.Preview = result.Preview[:importPreviewLen]
+	}
+	if result.Preview == nil {
+		result.Preview = []*ImportReceipt{}
+	}
+
+	return result, receipts, nil
+}
+
+// ImportReceipts creates the parsed receipts and their items for the user in a new
+// import batch, recording the stores and categories it created. If any receipt
+// fails, the receipts created so far are rolled back.
+func (r *Repository) ImportReceipts(userID int64, filename string, receipts []*ImportReceipt) (*models.ImportBatch, error) {
+	batch := &models.ImportBatch{Filename: filename, CreatedStoreIDs: []int64{}, CreatedCategoryIDs: []int64{}}
+	err := r.db.QueryRow(
+		`INSERT INTO import_batches (user_id, filename, created_at) VALUES ($1, $2, $3) RETURNING id, created_at`,
+		userID, filename, time.Now(),
+	).Scan(&batch.ID, &batch.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	importErr := r.importBatch(userID, batch, receipts)
+
+	// The created stores and categories are recorded even when the import
+	// failed, so that rolling it back deletes them
+	_, err = r.db.Exec(
+		`UPDATE import_batches SET receipt_count = $1, item_count = $2, created_store_ids = $3, created_category_ids = $4
+		 WHERE id = $5`,
+		batch.ReceiptCount, batch.ItemCount, pq.Array(batch.CreatedStoreIDs), pq.Array(batch.CreatedCategoryIDs), batch.ID,
+	)
+	if importErr != nil {
+		if err != nil {
+			return nil, fmt.Errorf("%w (recording the batch failed: %v)", importErr, err)
+		}
+		if _, rollbackErr := r.RollbackImport(userID, batch.ID); rollbackErr != nil {
+			return nil, fmt.Errorf("%w (rollback failed: %v)", importErr, rollbackErr)
+		}
+		return nil, importErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r.refreshAnalyticsAsync()
+	for _, month := range importMonths(receipts) {
+		r.spendingConfirmed(userID, month)
+	}
+	return batch, nil
+}
+
+// importMonths returns the months the confirmed imported receipts are dated in,
+// oldest first, so budget alerts are checked once per month
+func importMonths(receipts []*ImportReceipt) []time.Time {
+	seen := map[string]bool{}
+	var months []time.Time
+	for _, imported := range receipts {
+		if imported.Receipt.ReviewStatus != ReviewConfirmed {
+			continue
+		}
+		month := startOfMonth(imported.Receipt.PurchaseDate)
+		if !seen[monthKey(month)] {
+			seen[monthKey(month)] = true
+			months = append(months, month)
+		}
+	}
+	sort.Slice(months, func(i, j int) bool { return months[i].Before(months[j]) })
+	return months
+}
+
+// importBatch creates the receipts of a batch through the same path as uploads
+func (r *Repository) importBatch(userID int64, batch *models.ImportBatch, receipts []*ImportReceipt) error {
+	for _, imported := range receipts {
+		receipt := imported.Receipt
+		receipt.UserID = userID
+		receipt.ImportBatchID = &batch.ID
+
+		storeID, created, err := findOrCreateStore(r.db, userID, receipt.StoreName)
+		if err != nil {
+			return fmt.Errorf("row %d: failed to create store: %w", imported.Row, err)
+		}
+		receipt.StoreID = storeID
+		if created {
+			batch.CreatedStoreIDs = append(batch.CreatedStoreIDs, storeID)
+		}
+
+		if receipt.CategoryName != "" {
+			category, created, err := r.findOrCreateCategory(userID, receipt.CategoryName)
+			if err != nil {
+				return fmt.Errorf("row %d: failed to create category: %w", imported.Row, err)
+			}
+			receipt.CategoryID = &category.ID
+			if created {
+				batch.CreatedCategoryIDs = append(batch.CreatedCategoryIDs, category.ID)
+			}
+		}
+
+		receipt.ID, err = r.CreateReceipt(receipt)
+		if err != nil {
+			return fmt.Errorf("row %d: failed to save receipt: %w", imported.Row, err)
+		}
+		batch.ReceiptCount++
+
+		for _, item := range imported.Items {
+			item.ReceiptID = receipt.ID
+			if item.ID, err = r.CreateReceiptItem(item); err != nil {
+				return fmt.Errorf("row %d: failed to save item %q: %w", imported.Row, item.Name, err)
+			}
+			batch.ItemCount++
+		}
+	}
+	return nil
+}
+
+// RollbackImport deletes every receipt of one of the user's import batches and marks
+// the batch as rolled back. The stores and categories the import created are
+// deleted too, unless other receipts or budgets use them. It returns
+// sql.ErrNoRows when the batch does not exist or was already rolled back.
+func (r *Repository) RollbackImport(userID, id int64) (*models.ImportBatch, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	batch := &models.ImportBatch{}
+	err = tx.QueryRow(`
+		UPDATE import_batches SET rolled_back_at = $1
+		WHERE id = $2 AND user_id = $3 AND rolled_back_at IS NULL
+		RETURNING id, filename, receipt_count, item_count, created_store_ids, created_category_ids, rolled_back_at, created_at
+	`, time.Now(), id, userID).Scan(
+		&batch.ID,
+		&batch.Filename,
+		&batch.ReceiptCount,
+		&batch.ItemCount,
+		pq.Array(&batch.CreatedStoreIDs),
+		pq.Array(&batch.CreatedCategoryIDs),
+		&batch.RolledBackAt,
+		&batch.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM receipts WHERE import_batch_id = $1 AND user_id = $2`, id, userID); err != nil {
+		return nil, err
+	}
+
+	result, err := tx.Exec(`
+		DELETE FROM stores s
+		WHERE s.id = ANY($1) AND s.user_id = $2
+			AND NOT EXISTS (SELECT 1 FROM receipts r WHERE r.store_id = s.id)
+			AND NOT EXISTS (SELECT 1 FROM budgets b WHERE b.store_id = s.id)
+	`, pq.Array(batch.CreatedStoreIDs), userID)
+	if err != nil {
+		return nil, err
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	batch.RemovedStores = int(removed)
+
+	result, err = tx.Exec(`
+		DELETE FROM categories c
+		WHERE c.id = ANY($1) AND c.user_id = $2
+			AND NOT EXISTS (SELECT 1 FROM receipts r WHERE r.category_id = c.id)
+			AND NOT EXISTS (SELECT 1 FROM budgets b WHERE b.category_id = c.id)
+	`, pq.Array(batch.CreatedCategoryIDs), userID)
+	if err != nil {
+		return nil, err
+	}
+	removed, err = result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	batch.RemovedCategories = int(removed)
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	r.refreshAnalyticsAsync()
+	return batch, nil
+}
+
+// ListImportBatches retrieves all import batches of the user, newest first
+func (r *Repository) ListImportBatches(userID int64) ([]*models.ImportBatch, error) {
+	query := `
+		SELECT id, filename, receipt_count, item_count, created_store_ids, created_category_ids, rolled_back_at, created_at
+		FROM import_batches
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC
+	`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	batches := []*models.ImportBatch{}
+	for rows.Next() {
+		var batch models.ImportBatch
+		if err := rows.Scan(
+			&batch.ID,
+			&batch.Filename,
+			&batch.ReceiptCount,
+			&batch.ItemCount,
+			pq.Array(&batch.CreatedStoreIDs),
+			pq.Array(&batch.CreatedCategoryIDs),
+			&batch.RolledBackAt,
+			&batch.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		batches = append(batches, &batch)
+	}
+
+	return batches, rows.Err()
+}
+
+// readImportFile reads the uploaded CSV from the "file" form field
+func readImportFile(c *gin.Context) ([]byte, string, error) {
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		return nil, "", errors.New("no file uploaded")
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxImportSize+1))
+	if err != nil {
+		return nil, "", errors.New("failed to read file")
+	}
+	if len(data) > maxImportSize {
+		return nil, "", fmt.Errorf("the file is larger than %d MB", maxImportSize>>20)
+	}
+	return data, header.Filename, nil
+}
+
+// ImportReceipts handles CSV imports. The optional "mapping" form field is a JSON
+// object from field to column header; without it the mapping is guessed. With
+// dry_run=true the file is only validated and previewed.
+func (h *Handler) ImportReceipts(c *gin.Context) {
+	data, filename, err := readImportFile(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var mapping ImportMapping
+	if raw := c.PostForm("mapping"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "mapping must be a JSON object of field to column"})
+			return
+		}
+	}
+
+	result, receipts, err := parseImport(data, mapping)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.Query("dry_run") == "true" || c.PostForm("dry_run") == "true" {
+		c.JSON(http.StatusOK, result)
+		return
+	}
+	if len(result.Errors) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, result)
+		return
+	}
+
+	result.DryRun = false
+	result.Batch, err = h.repo.ImportReceipts(auth.UserID(c), filename, receipts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import receipts"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, result)
+}
+
+// ListImportBatches handles listing import batches
+func (h *Handler) ListImportBatches(c *gin.Context) {
+	batches, err := h.repo.ListImportBatches(auth.UserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve import batches"})
+		return
+	}
+
+	c.JSON(http.StatusOK, batches)
+}
+
+// RollbackImport handles deleting the receipts of an import batch
+func (h *Handler) RollbackImport(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid batch ID"})
+		return
+	}
+
+	batch, err := h.repo.RollbackImport(auth.UserID(c), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Import batch not found or already rolled back"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to roll back import"})
+		return
+	}
+
+	c.JSON(http.StatusOK, batch)
+}
+
+// ImportPage renders the CSV import page
+func (h *WebHandler) ImportPage(c *gin.Context) {
+	content := `
+<div class="card">
+    <div class="card-header">
+        <h1 class="card-title">Import Receipts</h1>
+    </div>
+    <p>Import receipts from a CSV file with one row per item (or per receipt). Rows with the same receipt ID,
+       or otherwise the same store, date and total, become one receipt. Dates may be YYYY-MM-DD or DD/MM/YYYY.</p>
+
+    <form id="import-form" hx-encoding="multipart/form-data">
+        <div class="form-group">
+            <label for="import-file">CSV File</label>
+            <input type="file" id="import-file" name="file" accept=".csv,text/csv" required
+                   hx-post="/receipts-web/htmx/import/columns"
+                   hx-trigger="change"
+                   hx-target="#import-mapping">
+        </div>
+        <div id="import-mapping"></div>
+    </form>
+
+    <div id="import-loading" class="loading-spinner htmx-indicator"></div>
+    <div id="import-result" class="mt-3"></div>
+</div>
+
+<div class="card">
+    <div class="card-header">
+        <h2 class="card-title">Previous Imports</h2>
+    </div>
+    <div id="import-batches" hx-get="/receipts-web/htmx/import/batches" hx-trigger="load, importDone from:body">
+        <div class="loading-spinner"></div>
+    </div>
+</div>
+`
+	page := renderPageWithLayout("Import Receipts", content)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(page))
+}
+
+// HtmxImportColumns reads the CSV headers and returns the column mapping form
+func (h *WebHandler) HtmxImportColumns(c *gin.Context) {
+	data, _, err := readImportFile(c)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse(template.HTMLEscapeString(err.Error()))))
+		return
+	}
+
+	records, err := readImportCSV(data)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Failed to read CSV: "+template.HTMLEscapeString(err.Error()))))
+		return
+	}
+
+	headers := records[0]
+	guessed := guessImportMapping(headers)
+
+	var out strings.Builder
+	out.WriteString(`<h2>Column Mapping</h2><div class="filter-form">`)
+	for _, field := range importFields {
+		out.WriteString(fmt.Sprintf(`<div class="form-group"><label for="map_%[1]s">%[2]s</label><select id="map_%[1]s" name="map_%[1]s"><option value="">Not in file</option>`,
+			field.key, field.label))
+		for _, header := range headers {
+			selected := ""
+			if guessed[field.key] == header {
+				selected = " selected"
+			}
+			out.WriteString(fmt.Sprintf(`<option value="%s"%s>%s</option>`,
+				template.HTMLEscapeString(header), selected, template.HTMLEscapeString(header)))
+		}
+		out.WriteString(`</select></div>`)
+	}
+	out.WriteString(`</div>
+	<button type="button" class="btn btn-secondary"
+			hx-post="/receipts-web/htmx/import?dry_run=true"
+			hx-target="#import-result"
+			hx-indicator="#import-loading">
+		Preview
+	</button>
+	<button type="button" class="btn btn-primary"
+			hx-post="/receipts-web/htmx/import"
+			hx-target="#import-result"
+			hx-indicator="#import-loading">
+		Import
+	</button>`)
+
+	c.Data(http.StatusOK, "text/html", []byte(out.String()))
+}
+
+// HtmxImport validates and previews the CSV, or imports it unless it is a dry run
+func (h *WebHandler) HtmxImport(c *gin.Context) {
+	data, filename, err := readImportFile(c)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse(template.HTMLEscapeString(err.Error()))))
+		return
+	}
+
+	mapping := ImportMapping{}
+	for _, field := range importFields {
+		if header := c.PostForm("map_" + field.key); header != "" {
+			mapping[field.key] = header
+		}
+	}
+
+	result, receipts, err := parseImport(data, mapping)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse(template.HTMLEscapeString(err.Error()))))
+		return
+	}
+
+	if c.Query("dry_run") == "true" {
+		c.Data(http.StatusOK, "text/html", []byte(renderImportResult(result)))
+		return
+	}
+	if len(result.Errors) > 0 {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Fix the errors below before importing")+renderImportResult(result)))
+		return
+	}
+
+	batch, err := h.repo.ImportReceipts(auth.UserID(c), filename, receipts)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Failed to import receipts: "+template.HTMLEscapeString(err.Error()))))
+		return
+	}
+
+	c.Header("HX-Trigger", "importDone")
+	c.Data(http.StatusOK, "text/html", []byte(createSuccessResponse(
+		fmt.Sprintf("Imported %d receipts with %d items as batch #%d", batch.ReceiptCount, batch.ItemCount, batch.ID))))
+}
+
+// HtmxImportBatches returns the list of import batches
+func (h *WebHandler) HtmxImportBatches(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html", []byte(h.renderImportBatches(auth.UserID(c))))
+}
+
+// HtmxRollbackImport rolls back an import batch and returns the updated list
+func (h *WebHandler) HtmxRollbackImport(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Invalid batch ID")))
+		return
+	}
+
+	if _, err := h.repo.RollbackImport(auth.UserID(c), id); err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Failed to roll back import")))
+		return
+	}
+
+	c.Data(http.StatusOK, "text/html", []byte(h.renderImportBatches(auth.UserID(c))))
+}
+
+// renderImportBatches renders the import batches with a rollback button for each active one
+func (h *WebHandler) renderImportBatches(userID int64) string {
+	batches, err := h.repo.ListImportBatches(userID)
+	if err != nil {
+		return createErrorResponse("Failed to load import batches")
+	}
+	if len(batches) == 0 {
+		return `<p>No imports yet.</p>`
+	}
+
+	var out strings.Builder
+	out.WriteString(`<table class="table"><thead><tr><th>Batch</th><th>File</th><th>Imported</th><th>Receipts</th><th>Items</th><th>Actions</th></tr></thead><tbody>`)
+	for _, batch := range batches {
+		action := fmt.Sprintf(`
+				<button class="btn btn-sm btn-secondary"
+						hx-delete="/receipts-web/htmx/import/batches/%d"
+						hx-target="#import-batches"
+						hx-confirm="Delete the %d receipts of this import?">
+					Roll Back
+				</button>`, batch.ID, batch.ReceiptCount)
+		if batch.RolledBackAt != nil {
+			action = "Rolled back " + formatDate(*batch.RolledBackAt)
+		}
+
+		out.WriteString(fmt.Sprintf(`<tr><td>#%d</td><td>%s</td><td>%s</td><td>%d</td><td>%d</td><td>%s</td></tr>`,
+			batch.ID, template.HTMLEscapeString(batch.Filename), formatDate(batch.CreatedAt),
+			batch.ReceiptCount, batch.ItemCount, action))
+	}
+	out.WriteString(`</tbody></table>`)
+
+	return out.String()
+}
+
+// renderImportResult renders the validation errors and a preview of the receipts found
+func renderImportResult(result *ImportResult) string {
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf(`<p>Found %d receipts with %d items and %d errors.</p>`,
+		result.Receipts, result.Items, len(result.Errors)))
+
+	if len(result.Errors) > 0 {
+		out.WriteString(`<h2>Errors</h2><table class="table"><thead><tr><th>Row</th><th>Field</th><th>Problem</th></tr></thead><tbody>`)
+		for _, e := range result.Errors {
+			out.WriteString(fmt.Sprintf(`<tr><td>%d</td><td>%s</td><td>%s</td></tr>`,
+				e.Row, e.Field, template.HTMLEscapeString(e.Message)))
+		}
+		out.WriteString(`</tbody></table>`)
+	}
+
+	if len(result.Preview) > 0 {
+		out.WriteString(fmt.Sprintf(`<h2>Preview (first %d receipts)</h2>`, len(result.Preview)))
+		out.WriteString(`<table class="table"><thead><tr><th>Row</th><th>Store</th><th>Date</th><th>Total</th><th>Category</th><th>Items</th></tr></thead><tbody>`)
+		for _, p := range result.Preview {
+			out.WriteString(fmt.Sprintf(`<tr><td>%d</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%d</td></tr>`,
+				p.Row, template.HTMLEscapeString(p.Receipt.StoreName), formatDate(p.Receipt.PurchaseDate),
+				formatMoney(p.Receipt.TotalAmount, p.Receipt.Currency), template.HTMLEscapeString(p.Receipt.CategoryName), len(p.Items)))
+		}
+		out.WriteString(`</tbody></table>`)
+	}
+
+	return out.String()
+}
@@ -0,0 +1,245 @@
+package receipts
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mauroue/cereja-corp/internal/models"
+)
+
+func TestNormalizeHeader(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Preço Unitário", "preco_unitario"},
+		{" Data-Compra ", "data_compra"},
+		{"Qtd.", "qtd"},
+		{"STORE_NAME", "store_name"},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeHeader(tt.in); got != tt.want {
+			t.Errorf("normalizeHeader(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestGuessImportMapping(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []string
+		want    ImportMapping
+	}{
+		{"english", []string{"Date", "Store", "Total"},
+			ImportMapping{ImportFieldDate: "Date", ImportFieldStore: "Store", ImportFieldTotal: "Total"}},
+		{"portuguese", []string{"Data", "Loja", "Produto", "Qtd", "Preço Unitário"},
+			ImportMapping{ImportFieldDate: "Data", ImportFieldStore: "Loja", ImportFieldItemName: "Produto",
+				ImportFieldQuantity: "Qtd", ImportFieldPrice: "Preço Unitário"}},
+		{"a header is used once", []string{"id", "name", "store", "date"},
+			ImportMapping{ImportFieldReceipt: "id", ImportFieldItemName: "name", ImportFieldStore: "store", ImportFieldDate: "date"}},
+		{"unknown headers", []string{"foo", "bar"}, ImportMapping{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := guessImportMapping(tt.headers); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("guessImportMapping(%q) = %v, want %v", tt.headers, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadImportCSV(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want [][]string
+		ok   bool
+	}{
+		{"commas", "store,total\nA,1.50\n", [][]string{{"store", "total"}, {"A", "1.50"}}, true},
+		{"semicolons", "store;total\nA;1,50\n", [][]string{{"store", "total"}, {"A", "1,50"}}, true},
+		{"byte order mark", "\xef\xbb\xbfstore,total\nA,2\n", [][]string{{"store", "total"}, {"A", "2"}}, true},
+		{"ragged rows", "a,b,c\n1,2\n", [][]string{{"a", "b", "c"}, {"1", "2"}}, true},
+		{"empty", "", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readImportCSV([]byte(tt.data))
+			if (err == nil) != tt.ok {
+				t.Fatalf("readImportCSV() error = %v, want ok = %v", err, tt.ok)
+			}
+			if tt.ok && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readImportCSV() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseImportAmount(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+		ok   bool
+	}{
+		{"12.50", 12.5, true},
+		{"12,50", 12.5, true},
+		{"R$ 1.234,56", 1234.56, true},
+		{"1,234.56", 1234.56, true},
+		{"$ 3", 3, true},
+		{"-4,20", -4.2, true},
+		{"abc", 0, false},
+		{"", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseImportAmount(tt.in)
+			if (err == nil) != tt.ok || (tt.ok && !approx(got, tt.want)) {
+				t.Errorf("parseImportAmount(%q) = %v, %v; want %v, ok = %v", tt.in, got, err, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestParseImportDate(t *testing.T) {
+	may10 := time.Date(2024, 5, 10, 0, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		in   string
+		want time.Time
+		ok   bool
+	}{
+		{"2024-05-10", may10, true},
+		{"10/05/2024", may10, true},
+		{"10-05-2024", may10, true},
+		{"10.05.2024", may10, true},
+		{" 2024-05-10 18:30 ", may10.Add(18*time.Hour + 30*time.Minute), true},
+		{"10/05/2024 18:30:15", may10.Add(18*time.Hour + 30*time.Minute + 15*time.Second), true},
+		{"05/13/2024", time.Time{}, false},
+		{"yesterday", time.Time{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseImportDate(tt.in)
+			if (err == nil) != tt.ok || !got.Equal(tt.want) {
+				t.Errorf("parseImportDate(%q) = %v, %v; want %v, ok = %v", tt.in, got, err, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestParseImport(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		mapping  ImportMapping
+		receipts int
+		items    int
+		totals   []float64
+		errors   []int
+	}{
+		{"grouped by receipt ID", "id,store,date,item,qty,price\n" +
+			"1,Mercado,2024-05-10,ARROZ,2,10\n" +
+			"1,Mercado,2024-05-10,FEIJAO,1,8\n" +
+			"2,Padaria,2024-05-11,PAO,6 un,0.5\n",
+			nil, 2, 3, []float64{28, 3}, nil},
+		{"grouped by store, date and total", "store;date;total;item;item_total\n" +
+			"Mercado;10/05/2024;15,00;ARROZ;10,00\n" +
+			"MERCADO;10/05/2024;15,00;CAFE;5,00\n" +
+			"Mercado;11/05/2024;15,00;CAFE;15,00\n",
+			nil, 2, 3, []float64{15, 15}, nil},
+		{"totals only", "store,date,total\nMercado,2024-05-10,42.10\n",
+			nil, 1, 0, []float64{42.1}, nil},
+		{"rows with errors are left out", "store,date,total,currency\n" +
+			"Mercado,2024-05-10,10,BRL\n" +
+			",2024-05-10,10,BRL\n" +
+			"Mercado,someday,10,BRL\n" +
+			"Mercado,2024-05-10,-1,BRL\n" +
+			"Mercado,2024-05-12,5,REAIS\n" +
+			",,,\n",
+			nil, 1, 0, []float64{10}, []int{3, 4, 5, 6}},
+		{"item without a price", "store,date,item\nMercado,2024-05-10,ARROZ\n",
+			nil, 0, 0, nil, []int{2}},
+		{"explicit mapping", "Onde,Quando,Quanto\nMercado,2024-05-10,7\n",
+			ImportMapping{ImportFieldStore: "Onde", ImportFieldDate: "Quando", ImportFieldTotal: "Quanto"},
+			1, 0, []float64{7}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, receipts, err := parseImport([]byte(tt.data), tt.mapping)
+			if err != nil {
+				t.Fatalf("parseImport: %v", err)
+			}
+			if result.Receipts != tt.receipts || result.Items != tt.items {
+				t.Errorf("%d receipts with %d items, want %d with %d", result.Receipts, result.Items, tt.receipts, tt.items)
+			}
+			var totals []float64
+			for _, r := range receipts {
+				totals = append(totals, r.Receipt.TotalAmount)
+			}
+			if len(totals) != len(tt.totals) {
+				t.Fatalf("totals = %v, want %v", totals, tt.totals)
+			}
+			for i := range totals {
+				if !approx(totals[i], tt.totals[i]) {
+					t.Errorf("totals = %v, want %v", totals, tt.totals)
+					break
+				}
+			}
+			var rows []int
+			for _, e := range result.Errors {
+				rows = append(rows, e.Row)
+			}
+			if !reflect.DeepEqual(rows, tt.errors) {
+				t.Errorf("error rows = %v, want %v", rows, tt.errors)
+			}
+		})
+	}
+}
+
+func TestParseImportMappingErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		mapping ImportMapping
+		err     string
+	}{
+		{"no store", "date,total\n2024-05-10,1\n", nil, "store and date"},
+		{"no total or items", "store,date\nA,2024-05-10\n", nil, "receipt total or the item name"},
+		{"unknown column", "store,date,total\n", ImportMapping{ImportFieldStore: "loja"}, `"loja"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := parseImport([]byte(tt.data), tt.mapping)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("parseImport() error = %v, want it to mention %s", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestImportMonths(t *testing.T) {
+	receipt := func(status string, y int, m time.Month, d int) *ImportReceipt {
+		return &ImportReceipt{Receipt: &models.Receipt{ReviewStatus: status, PurchaseDate: time.Date(y, m, d, 12, 0, 0, 0, time.Local)}}
+	}
+	receipts := []*ImportReceipt{
+		receipt(ReviewConfirmed, 2024, time.May, 20),
+		receipt(ReviewConfirmed, 2024, time.March, 2),
+		receipt(ReviewConfirmed, 2024, time.May, 1),
+		receipt(ReviewPending, 2024, time.April, 9),
+	}
+
+	var got []string
+	for _, month := range importMonths(receipts) {
+		got = append(got, monthKey(month))
+	}
+	if want := []string{"2024-03", "2024-05"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("importMonths = %v, want %v", got, want)
+	}
+}
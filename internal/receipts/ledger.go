@@ -0,0 +1,390 @@
+package receipts
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mauroue/cereja-corp/config"
+	"github.com/mauroue/cereja-corp/internal/auth"
+	"github.com/mauroue/cereja-corp/internal/models"
+)
+
+// Journal formats for plain-text accounting
+const (
+	LedgerBeancount = "beancount"
+	LedgerHledger   = "hledger"
+	LedgerLedger    = "ledger"
+)
+
+// Posting modes: one expense posting per item, or one per category
+const (
+	PostingsItem     = "item"
+	PostingsCategory = "category"
+)
+
+// ledgerExtensions are the file extensions of each journal format
+var ledgerExtensions = map[string]string{
+	LedgerBeancount: "beancount",
+	LedgerHledger:   "journal",
+	LedgerLedger:    "ledger",
+}
+
+// LastLedgerExport returns the user's most recent incremental export of a format,
+// or sql.ErrNoRows if there has been none
+func (r *Repository) LastLedgerExport(userID int64, format string) (*models.LedgerExport, error) {
+	query := `
+		SELECT id, format, since, until, receipt_count, created_at
+		FROM ledger_exports
+		WHERE format = $1 AND user_id = $2
+		ORDER BY until DESC, id DESC
+		LIMIT 1
+	`
+
+	var export models.LedgerExport
+	err := r.db.QueryRow(query, format, userID).Scan(
+		&export.ID,
+		&export.Format,
+		&export.Since,
+		&export.Until,
+		&export.ReceiptCount,
+		&export.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// RecordLedgerExport stores an incremental export of the user so the next one continues after it
+func (r *Repository) RecordLedgerExport(userID int64, export *models.LedgerExport) error {
+	query := `
+		INSERT INTO ledger_exports (user_id, format, since, until, receipt_count)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`
+	return r.db.QueryRow(query, userID, export.Format, export.Since, export.Until, export.ReceiptCount).
+		Scan(&export.ID, &export.CreatedAt)
+}
+
+// ListLedgerExports returns the user's incremental journal exports, most recent first
+func (r *Repository) ListLedgerExports(userID int64) ([]*models.LedgerExport, error) {
+	query := `
+		SELECT id, format, since, until, receipt_count, created_at
+		FROM ledger_exports
+		WHERE user_id = $1
+		ORDER BY until DESC, id DESC
+	`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exports := []*models.LedgerExport{}
+	for rows.Next() {
+		var export models.LedgerExport
+		if err := rows.Scan(
+			&export.ID,
+			&export.Format,
+			&export.Since,
+			&export.Until,
+			&export.ReceiptCount,
+			&export.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		exports = append(exports, &export)
+	}
+
+	return exports, rows.Err()
+}
+
+// ledgerWriter writes receipts as balanced double-entry transactions
+type ledgerWriter struct {
+	w        io.Writer
+	format   string
+	postings string
+	mapping  config.LedgerConfig
+	// opened records the first date each account was used, for beancount's open directives
+	opened map[string]time.Time
+	// currencies records the currencies posted to each account
+	currencies map[string]map[string]bool
+}
+
+// newLedgerWriter fills in the mapping defaults missing from the configuration
+func newLedgerWriter(w io.Writer, format, postings string, mapping config.LedgerConfig) *ledgerWriter {
+	if mapping.Currency == "" {
+		mapping.Currency = "BRL"
+	}
+	if mapping.DefaultExpense == "" {
+		mapping.DefaultExpense = "Expenses:Uncategorized"
+	}
+	if mapping.DefaultPayment == "" {
+		mapping.DefaultPayment = "Assets:Cash"
+	}
+	return &ledgerWriter{
+		w:          w,
+		format:     format,
+		postings:   postings,
+		mapping:    mapping,
+		opened:     map[string]time.Time{},
+		currencies: map[string]map[string]bool{},
+	}
+}
+
+// ledgerAccountName turns a category name into an account component such as
+// "FoodAndDrinks", since account names may not contain spaces or accents
+func ledgerAccountName(name string) string {
+	var b strings.Builder
+	for _, word := range strings.FieldsFunc(normalizeHeader(name), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	}) {
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		b.WriteString(string(runes))
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+	// Beancount requires every component to start with a capital letter
+	if first := b.String()[0]; first >= '0' && first <= '9' {
+		return "X" + b.String()
+	}
+	return b.String()
+}
+
+// expenseAccount returns the configured account of a category, or one derived from its name
+func (lw *ledgerWriter) expenseAccount(category string) string {
+	if account, ok := lw.mapping.Categories[category]; ok && account != "" {
+		return account
+	}
+	if name := ledgerAccountName(category); name != "" {
+		return "Expenses:" + name
+	}
+	return lw.mapping.DefaultExpense
+}
+
+// paymentAccount returns the asset or liability account a receipt was paid from
+func (lw *ledgerWriter) paymentAccount(statementAccount string) string {
+	if account, ok := lw.mapping.PaymentAccounts[statementAccount]; ok && account != "" {
+		return account
+	}
+	return lw.mapping.DefaultPayment
+}
+
+// ledgerQuote escapes a string for a quoted beancount field
+func ledgerQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", " ").Replace(s) + `"`
+}
+
+// ledgerText flattens a string onto one line for ledger and hledger descriptions and comments
+func ledgerText(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// ledgerPosting is one account and amount of a transaction
+type ledgerPosting struct {
+	account string
+	amount  float64
+	comment string
+}
+
+// receiptPostings splits a receipt into expense postings and the payment posting.
+// When the items do not add up to the total (discounts, fees or OCR misses) the
+// difference is posted to the receipt's expense account so the entry balances.
+func (lw *ledgerWriter) receiptPostings(receipt *ExportReceipt) []ledgerPosting {
+	expense := lw.expenseAccount(receipt.CategoryName)
+	total := math.Round(receipt.TotalAmount*100) / 100
+
+	var postings []ledgerPosting
+	itemsTotal := 0.0
+	if lw.postings == PostingsItem {
+		for _, item := range receipt.Items {
+			amount := math.Round(item.TotalPrice*100) / 100
+			if amount == 0 {
+				continue
+			}
+			postings = append(postings, ledgerPosting{account: expense, amount: amount, comment: item.Name})
+			itemsTotal += amount
+		}
+	}
+
+	if diff := math.Round((total-itemsTotal)*100) / 100; diff != 0 {
+		comment := ""
+		if len(postings) > 0 {
+			comment = "difference between the items and the receipt total"
+		}
+		postings = append(postings, ledgerPosting{account: expense, amount: diff, comment: comment})
+	}
+
+	return append(postings, ledgerPosting{
+		account: lw.paymentAccount(receipt.PaymentAccount),
+		amount:  -total,
+	})
+}
+
+// writeReceipt writes a receipt as one journal transaction
+func (lw *ledgerWriter) writeReceipt(receipt *ExportReceipt) error {
+	date := receipt.PurchaseDate.Format("2006-01-02")
+	flag := "*"
+	if receipt.ReviewStatus == ReviewPending {
+		flag = "!"
+	}
+	narration := fmt.Sprintf("Receipt #%d", receipt.ID)
+	if receipt.CategoryName != "" {
+		narration += " - " + receipt.CategoryName
+	}
+
+	var b strings.Builder
+	if lw.format == LedgerBeancount {
+		fmt.Fprintf(&b, "%s %s %s %s\n", date, flag, ledgerQuote(receipt.StoreName), ledgerQuote(narration))
+		fmt.Fprintf(&b, "  receipt_id: \"%d\"\n", receipt.ID)
+	} else {
+		fmt.Fprintf(&b, "%s %s %s  ; %s, receipt_id:%d\n", date, flag, ledgerText(receipt.StoreName), ledgerText(narration), receipt.ID)
+	}
+
+	// Receipts are posted in their own currency
+	currency := receipt.Currency
+	if currency == "" {
+		currency = lw.mapping.Currency
+	}
+
+	for _, posting := range lw.receiptPostings(receipt) {
+		if first, ok := lw.opened[posting.account]; !ok || receipt.PurchaseDate.Before(first) {
+			lw.opened[posting.account] = receipt.PurchaseDate
+		}
+		if lw.currencies[posting.account] == nil {
+			lw.currencies[posting.account] = map[string]bool{}
+		}
+		lw.currencies[posting.account][currency] = true
+
+		line := fmt.Sprintf("    %-40s  %10.2f %s", posting.account, posting.amount, currency)
+		if posting.comment != "" {
+			line += "  ; " + ledgerText(posting.comment)
+		}
+		b.WriteString(line + "\n")
+	}
+	b.WriteString("\n")
+
+	_, err := io.WriteString(lw.w, b.String())
+	return err
+}
+
+// writeOpenDirectives declares every account used, as beancount requires. Beancount
+// directives are order independent, so they can follow the transactions.
+func (lw *ledgerWriter) writeOpenDirectives() error {
+	accounts := make([]string, 0, len(lw.opened))
+	for account := range lw.opened {
+		accounts = append(accounts, account)
+	}
+	sort.Strings(accounts)
+
+	var b strings.Builder
+	for _, account := range accounts {
+		currencies := make([]string, 0, len(lw.currencies[account]))
+		for currency := range lw.currencies[account] {
+			currencies = append(currencies, currency)
+		}
+		sort.Strings(currencies)
+		fmt.Fprintf(&b, "%s open %s %s\n", lw.opened[account].Format("2006-01-02"), account, strings.Join(currencies, ","))
+	}
+	_, err := io.WriteString(lw.w, b.String())
+	return err
+}
+
+// ExportLedger handles streaming receipts as a beancount, hledger or ledger journal.
+// With incremental=true only the receipts created since the last incremental export
+// of the same format are written, and the export is recorded; otherwise the usual
+// list filters apply.
+func (h *Handler) ExportLedger(c *gin.Context) {
+	format := c.DefaultQuery("format", LedgerHledger)
+	if _, ok := ledgerExtensions[format]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be beancount, hledger or ledger"})
+		return
+	}
+	postings := c.DefaultQuery("postings", PostingsItem)
+	if postings != PostingsItem && postings != PostingsCategory {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "postings must be item or category"})
+		return
+	}
+
+	filter, err := filterFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// Journals are chronological
+	filter.Sort = SortDate
+	filter.Order = OrderAsc
+
+	incremental := c.Query("incremental") == "true"
+	var record *models.LedgerExport
+	if incremental {
+		record = &models.LedgerExport{Format: format, Until: time.Now()}
+		last, err := h.repo.LastLedgerExport(filter.UserID, format)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load the last export"})
+			return
+		}
+		if last != nil {
+			record.Since = &last.Until
+		}
+		filter = &ReceiptFilter{UserID: filter.UserID, CreatedAfter: record.Since, CreatedBefore: &record.Until, Sort: SortDate, Order: OrderAsc}
+	}
+
+	filename := fmt.Sprintf("receipts-%s.%s", time.Now().Format("20060102"), ledgerExtensions[format])
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+
+	lw := newLedgerWriter(c.Writer, format, postings, config.Get().Ledger)
+	count := 0
+	err = h.repo.ExportReceipts(filter, func(receipt *ExportReceipt) error {
+		if err := lw.writeReceipt(receipt); err != nil {
+			return err
+		}
+		if count++; count%exportFlushEvery == 0 {
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to export journal after %d receipts: %v", count, err)
+		return
+	}
+
+	// Later incremental exports rely on the accounts opened by the first one
+	if format == LedgerBeancount && (record == nil || record.Since == nil) {
+		if err := lw.writeOpenDirectives(); err != nil {
+			log.Printf("Failed to write open directives: %v", err)
+			return
+		}
+	}
+
+	if record != nil {
+		record.ReceiptCount = count
+		if err := h.repo.RecordLedgerExport(filter.UserID, record); err != nil {
+			log.Printf("Failed to record journal export: %v", err)
+		}
+	}
+}
+
+// ListLedgerExports handles listing the incremental journal exports
+func (h *Handler) ListLedgerExports(c *gin.Context) {
+	exports, err := h.repo.ListLedgerExports(auth.UserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list exports"})
+		return
+	}
+	c.JSON(http.StatusOK, exports)
+}
@@ -0,0 +1,205 @@
+package receipts
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mauroue/cereja-corp/config"
+	"github.com/mauroue/cereja-corp/internal/models"
+)
+
+func TestLedgerAccountName(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Food and drinks", "FoodAndDrinks"},
+		{"Alimentação", "Alimentacao"},
+		{"  higiene/limpeza ", "HigieneLimpeza"},
+		{"24h market", "X24hMarket"},
+		{"Pet-shop", "PetShop"},
+		{"!!!", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := ledgerAccountName(tt.in); got != tt.want {
+				t.Errorf("ledgerAccountName(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLedgerAccounts(t *testing.T) {
+	lw := newLedgerWriter(nil, LedgerBeancount, PostingsItem, config.LedgerConfig{
+		Categories:      map[string]string{"Mercado": "Expenses:Food:Groceries", "Vazia": ""},
+		PaymentAccounts: map[string]string{"12345-6": "Liabilities:CreditCard"},
+	})
+
+	expense := []struct {
+		category, want string
+	}{
+		{"Mercado", "Expenses:Food:Groceries"},
+		{"Farmácia", "Expenses:Farmacia"},
+		{"Vazia", "Expenses:Vazia"},
+		{"", "Expenses:Uncategorized"},
+		{"???", "Expenses:Uncategorized"},
+	}
+	for _, tt := range expense {
+		if got := lw.expenseAccount(tt.category); got != tt.want {
+			t.Errorf("expenseAccount(%q) = %q, want %q", tt.category, got, tt.want)
+		}
+	}
+
+	payment := []struct {
+		account, want string
+	}{
+		{"12345-6", "Liabilities:CreditCard"},
+		{"unknown", "Assets:Cash"},
+		{"", "Assets:Cash"},
+	}
+	for _, tt := range payment {
+		if got := lw.paymentAccount(tt.account); got != tt.want {
+			t.Errorf("paymentAccount(%q) = %q, want %q", tt.account, got, tt.want)
+		}
+	}
+}
+
+func TestLedgerQuote(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Mercado", `"Mercado"`},
+		{`Say "hi"`, `"Say \"hi\""`},
+		{`C:\receipts`, `"C:\\receipts"`},
+		{"two\nlines", `"two lines"`},
+	}
+
+	for _, tt := range tests {
+		if got := ledgerQuote(tt.in); got != tt.want {
+			t.Errorf("ledgerQuote(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestReceiptPostings(t *testing.T) {
+	items := func(prices ...float64) []*models.ReceiptItem {
+		var list []*models.ReceiptItem
+		for _, p := range prices {
+			list = append(list, &models.ReceiptItem{Name: "ITEM", TotalPrice: p})
+		}
+		return list
+	}
+
+	tests := []struct {
+		name     string
+		postings string
+		total    float64
+		items    []*models.ReceiptItem
+		amounts  []float64
+	}{
+		{"one posting per item", PostingsItem, 15, items(10, 5), []float64{10, 5, -15}},
+		{"discount posted as difference", PostingsItem, 14.5, items(10, 5), []float64{10, 5, -0.5, -14.5}},
+		{"zero items skipped", PostingsItem, 10, items(10, 0), []float64{10, -10}},
+		{"rounded to cents", PostingsItem, 0.3, items(0.1, 0.2), []float64{0.1, 0.2, -0.3}},
+		{"no items", PostingsItem, 42.1, nil, []float64{42.1, -42.1}},
+		{"one posting per category", PostingsCategory, 15, items(10, 5), []float64{15, -15}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lw := newLedgerWriter(nil, LedgerHledger, tt.postings, config.LedgerConfig{})
+			receipt := &ExportReceipt{Receipt: &models.Receipt{TotalAmount: tt.total, CategoryName: "Mercado"}, Items: tt.items}
+			postings := lw.receiptPostings(receipt)
+
+			if len(postings) != len(tt.amounts) {
+				t.Fatalf("got %d postings, want %d", len(postings), len(tt.amounts))
+			}
+			sum := 0.0
+			for i, p := range postings {
+				if !approx(p.amount, tt.amounts[i]) {
+					t.Errorf("posting %d = %v, want %v", i+1, p.amount, tt.amounts[i])
+				}
+				sum += p.amount
+			}
+			if math.Abs(sum) > 0.001 {
+				t.Errorf("postings sum to %v, want 0", sum)
+			}
+			if last := postings[len(postings)-1]; last.account != "Assets:Cash" {
+				t.Errorf("payment account = %q, want Assets:Cash", last.account)
+			}
+		})
+	}
+}
+
+func TestWriteReceipt(t *testing.T) {
+	receipt := &ExportReceipt{
+		Receipt: &models.Receipt{
+			ID:           7,
+			StoreName:    `Mercado "Bom"`,
+			PurchaseDate: time.Date(2024, 5, 10, 0, 0, 0, 0, time.Local),
+			TotalAmount:  12,
+			Currency:     "BRL",
+			CategoryName: "Mercado",
+			ReviewStatus: ReviewPending,
+		},
+		Items: []*models.ReceiptItem{{Name: "ARROZ\n5KG", TotalPrice: 12}},
+	}
+
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{LedgerBeancount, []string{
+			`2024-05-10 ! "Mercado \"Bom\"" "Receipt #7 - Mercado"`,
+			`  receipt_id: "7"`,
+			"Expenses:Mercado", "12.00 BRL  ; ARROZ 5KG",
+			"Assets:Cash", "-12.00 BRL",
+		}},
+		{LedgerLedger, []string{
+			`2024-05-10 ! Mercado "Bom"  ; Receipt #7 - Mercado, receipt_id:7`,
+			"Expenses:Mercado", "Assets:Cash",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var b strings.Builder
+			lw := newLedgerWriter(&b, tt.format, PostingsItem, config.LedgerConfig{})
+			if err := lw.writeReceipt(receipt); err != nil {
+				t.Fatalf("writeReceipt: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(b.String(), want) {
+					t.Errorf("journal is missing %q:\n%s", want, b.String())
+				}
+			}
+		})
+	}
+}
+
+func TestWriteOpenDirectives(t *testing.T) {
+	var b strings.Builder
+	lw := newLedgerWriter(&b, LedgerBeancount, PostingsCategory, config.LedgerConfig{})
+
+	receipts := []*ExportReceipt{
+		{Receipt: &models.Receipt{ID: 1, PurchaseDate: time.Date(2024, 5, 10, 0, 0, 0, 0, time.Local), TotalAmount: 5, Currency: "USD", CategoryName: "Food"}},
+		{Receipt: &models.Receipt{ID: 2, PurchaseDate: time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local), TotalAmount: 5, Currency: "BRL", CategoryName: "Food"}},
+	}
+	for _, r := range receipts {
+		if err := lw.writeReceipt(r); err != nil {
+			t.Fatalf("writeReceipt: %v", err)
+		}
+	}
+
+	b.Reset()
+	if err := lw.writeOpenDirectives(); err != nil {
+		t.Fatalf("writeOpenDirectives: %v", err)
+	}
+	want := "2024-03-01 open Assets:Cash BRL,USD\n2024-03-01 open Expenses:Food BRL,USD\n"
+	if b.String() != want {
+		t.Errorf("open directives =\n%s\nwant\n%s", b.String(), want)
+	}
+}
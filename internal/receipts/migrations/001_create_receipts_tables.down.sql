@@ -0,0 +1,4 @@
+-- Drop the receipt tables
+DROP TABLE IF EXISTS receipt_items;
+DROP TABLE IF EXISTS receipts;
+DROP TABLE IF EXISTS stores;
@@ -0,0 +1,7 @@
+-- Drop units of measure and normalized pricing from receipt items
+DROP INDEX IF EXISTS idx_receipt_items_base_unit;
+
+ALTER TABLE receipt_items DROP COLUMN IF EXISTS normalized_unit_price;
+ALTER TABLE receipt_items DROP COLUMN IF EXISTS base_quantity;
+ALTER TABLE receipt_items DROP COLUMN IF EXISTS base_unit;
+ALTER TABLE receipt_items DROP COLUMN IF EXISTS unit;
@@ -0,0 +1,14 @@
+-- Add unit of measure and normalized pricing to receipt items
+ALTER TABLE receipt_items ADD COLUMN IF NOT EXISTS unit VARCHAR(8) NOT NULL DEFAULT 'un';
+ALTER TABLE receipt_items ADD COLUMN IF NOT EXISTS base_unit VARCHAR(8) NOT NULL DEFAULT 'un';
+ALTER TABLE receipt_items ADD COLUMN IF NOT EXISTS base_quantity DECIMAL(12, 4) NOT NULL DEFAULT 1;
+ALTER TABLE receipt_items ADD COLUMN IF NOT EXISTS normalized_unit_price DECIMAL(12, 4) NOT NULL DEFAULT 0;
+
+-- Backfill existing items as sold by piece
+UPDATE receipt_items
+SET base_quantity = quantity,
+    normalized_unit_price = CASE WHEN quantity > 0 THEN total_price / quantity ELSE unit_price END
+WHERE normalized_unit_price = 0;
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_receipt_items_base_unit ON receipt_items(base_unit);
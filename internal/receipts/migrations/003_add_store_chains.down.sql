@@ -0,0 +1,6 @@
+-- Drop store chains and the unique store names. Stores merged or created by
+-- the up migration stay as they are.
+DROP INDEX IF EXISTS idx_stores_chain;
+DROP INDEX IF EXISTS idx_stores_name_lower;
+
+ALTER TABLE stores DROP COLUMN IF EXISTS chain;
@@ -0,0 +1,30 @@
+-- Add chain to stores so prices can be compared across branches of the same chain
+ALTER TABLE stores ADD COLUMN IF NOT EXISTS chain VARCHAR(255);
+
+-- Store names are unique regardless of case: merge stores whose names only
+-- differ by case into the oldest one before indexing
+UPDATE receipts r
+SET store_id = keep.id
+FROM stores s, (SELECT LOWER(name) AS name, MIN(id) AS id FROM stores GROUP BY LOWER(name)) keep
+WHERE s.id = r.store_id AND LOWER(s.name) = keep.name AND s.id <> keep.id;
+
+DELETE FROM stores s
+USING (SELECT LOWER(name) AS name, MIN(id) AS id FROM stores GROUP BY LOWER(name)) keep
+WHERE LOWER(s.name) = keep.name AND s.id <> keep.id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_stores_name_lower ON stores(LOWER(name));
+CREATE INDEX IF NOT EXISTS idx_stores_chain ON stores(chain);
+
+-- The default store was inserted with an explicit ID, so move the sequence past it
+SELECT setval(pg_get_serial_sequence('stores', 'id'), GREATEST((SELECT MAX(id) FROM stores), 1));
+
+-- Create a store for every vendor name seen so far and link its receipts
+INSERT INTO stores (name)
+SELECT DISTINCT store_name FROM receipts
+ON CONFLICT ((LOWER(name))) DO NOTHING;
+
+UPDATE receipts r
+SET store_id = s.id
+FROM stores s
+WHERE LOWER(s.name) = LOWER(r.store_name)
+  AND r.store_id IS DISTINCT FROM s.id;
@@ -0,0 +1,13 @@
+-- Drop categories, tags and review status
+DROP INDEX IF EXISTS idx_receipts_store_name_id;
+DROP INDEX IF EXISTS idx_receipts_total_amount_id;
+DROP INDEX IF EXISTS idx_receipts_purchase_date_id;
+DROP INDEX IF EXISTS idx_receipts_review_status;
+DROP INDEX IF EXISTS idx_receipts_category_id;
+
+ALTER TABLE receipts DROP COLUMN IF EXISTS review_status;
+ALTER TABLE receipts DROP COLUMN IF EXISTS category_id;
+
+DROP TABLE IF EXISTS receipt_tags;
+DROP TABLE IF EXISTS tags;
+DROP TABLE IF EXISTS categories;
@@ -0,0 +1,37 @@
+-- Create categories table
+CREATE TABLE IF NOT EXISTS categories (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_name_lower ON categories(LOWER(name));
+
+-- Create tags tables
+CREATE TABLE IF NOT EXISTS tags (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tags_name_lower ON tags(LOWER(name));
+
+CREATE TABLE IF NOT EXISTS receipt_tags (
+    receipt_id INTEGER NOT NULL REFERENCES receipts(id) ON DELETE CASCADE,
+    tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    PRIMARY KEY (receipt_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_receipt_tags_tag_id ON receipt_tags(tag_id);
+
+-- Add category and review status to receipts
+ALTER TABLE receipts ADD COLUMN IF NOT EXISTS category_id INTEGER REFERENCES categories(id) ON DELETE SET NULL;
+ALTER TABLE receipts ADD COLUMN IF NOT EXISTS review_status VARCHAR(20) NOT NULL DEFAULT 'pending';
+
+-- Create indexes for listing filters and keyset pagination
+CREATE INDEX IF NOT EXISTS idx_receipts_category_id ON receipts(category_id);
+CREATE INDEX IF NOT EXISTS idx_receipts_review_status ON receipts(review_status);
+CREATE INDEX IF NOT EXISTS idx_receipts_purchase_date_id ON receipts(purchase_date, id);
+CREATE INDEX IF NOT EXISTS idx_receipts_total_amount_id ON receipts(total_amount, id);
+CREATE INDEX IF NOT EXISTS idx_receipts_store_name_id ON receipts(LOWER(store_name), id);
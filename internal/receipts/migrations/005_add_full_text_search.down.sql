@@ -0,0 +1,9 @@
+-- Drop full-text search. The unaccent extension stays installed, as other
+-- databases objects may use it.
+DROP INDEX IF EXISTS idx_receipt_items_search_vector;
+DROP INDEX IF EXISTS idx_receipts_search_vector;
+
+ALTER TABLE receipt_items DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE receipts DROP COLUMN IF EXISTS search_vector;
+
+DROP TEXT SEARCH CONFIGURATION IF EXISTS portuguese_unaccent;
@@ -0,0 +1,27 @@
+-- Portuguese text search configuration that ignores accents, so "protetor solar"
+-- matches "PROTETOR SOLAR" and "açúcar" matches "ACUCAR"
+CREATE EXTENSION IF NOT EXISTS unaccent;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_ts_config WHERE cfgname = 'portuguese_unaccent') THEN
+        CREATE TEXT SEARCH CONFIGURATION portuguese_unaccent (COPY = portuguese);
+        ALTER TEXT SEARCH CONFIGURATION portuguese_unaccent
+            ALTER MAPPING FOR hword, hword_part, word WITH unaccent, portuguese_stem;
+    END IF;
+END
+$$;
+
+-- Search vectors are generated columns, so Postgres keeps them up to date on every insert and update
+ALTER TABLE receipts ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (to_tsvector('portuguese_unaccent', COALESCE(store_name, ''))) STORED;
+
+ALTER TABLE receipt_items ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('portuguese_unaccent', COALESCE(name, '')), 'A') ||
+        setweight(to_tsvector('portuguese_unaccent', COALESCE(description, '')), 'B')
+    ) STORED;
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_receipts_search_vector ON receipts USING GIN(search_vector);
+CREATE INDEX IF NOT EXISTS idx_receipt_items_search_vector ON receipt_items USING GIN(search_vector);
@@ -0,0 +1,3 @@
+-- Drop the spending views
+DROP MATERIALIZED VIEW IF EXISTS product_spending_daily;
+DROP MATERIALIZED VIEW IF EXISTS spending_daily;
@@ -0,0 +1,31 @@
+-- Daily spending per store, chain and category. Analytics aggregate these rows
+-- instead of scanning every receipt, and the view is refreshed after each ingest.
+CREATE MATERIALIZED VIEW IF NOT EXISTS spending_daily AS
+SELECT
+    r.purchase_date::date AS day,
+    r.store_name,
+    COALESCE(NULLIF(s.chain, ''), r.store_name) AS chain,
+    COALESCE(c.name, 'Uncategorized') AS category,
+    COUNT(*) AS receipt_count,
+    SUM(r.total_amount) AS total
+FROM receipts r
+LEFT JOIN stores s ON s.id = r.store_id
+LEFT JOIN categories c ON c.id = r.category_id
+GROUP BY 1, 2, 3, 4;
+
+-- Daily spending per product, by item name and base unit
+CREATE MATERIALIZED VIEW IF NOT EXISTS product_spending_daily AS
+SELECT
+    r.purchase_date::date AS day,
+    ri.name AS product,
+    ri.base_unit,
+    SUM(ri.base_quantity) AS quantity,
+    COUNT(*) AS item_count,
+    SUM(ri.total_price) AS total
+FROM receipt_items ri
+JOIN receipts r ON r.id = ri.receipt_id
+GROUP BY 1, 2, 3;
+
+-- Unique indexes are required to refresh the views concurrently
+CREATE UNIQUE INDEX IF NOT EXISTS idx_spending_daily_key ON spending_daily(day, store_name, chain, category);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_product_spending_daily_key ON product_spending_daily(day, product, base_unit);
@@ -0,0 +1,31 @@
+-- Create budgets table. Each budget targets exactly one category, store or chain.
+CREATE TABLE IF NOT EXISTS budgets (
+    id SERIAL PRIMARY KEY,
+    scope VARCHAR(20) NOT NULL CHECK (scope IN ('category', 'store', 'chain')),
+    category_id INTEGER REFERENCES categories(id) ON DELETE CASCADE,
+    store_id INTEGER REFERENCES stores(id) ON DELETE CASCADE,
+    chain VARCHAR(255),
+    amount DECIMAL(10, 2) NOT NULL CHECK (amount > 0),
+    rollover BOOLEAN NOT NULL DEFAULT FALSE,
+    thresholds INTEGER[] NOT NULL DEFAULT '{80,100}',
+    start_month DATE NOT NULL DEFAULT date_trunc('month', NOW()),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    CHECK ((scope = 'category') = (category_id IS NOT NULL)),
+    CHECK ((scope = 'store') = (store_id IS NOT NULL)),
+    CHECK ((scope = 'chain') = (chain IS NOT NULL))
+);
+
+-- Create budget_alerts table. A threshold alerts at most once per budget and month.
+CREATE TABLE IF NOT EXISTS budget_alerts (
+    id SERIAL PRIMARY KEY,
+    budget_id INTEGER NOT NULL REFERENCES budgets(id) ON DELETE CASCADE,
+    month DATE NOT NULL,
+    threshold INTEGER NOT NULL,
+    spent DECIMAL(10, 2) NOT NULL,
+    budget_limit DECIMAL(10, 2) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (budget_id, month, threshold)
+);
+
+CREATE INDEX IF NOT EXISTS idx_budget_alerts_created_at ON budget_alerts(created_at);
@@ -0,0 +1,5 @@
+-- Drop import batches. Imported receipts are kept.
+DROP INDEX IF EXISTS idx_receipts_import_batch_id;
+ALTER TABLE receipts DROP COLUMN IF EXISTS import_batch_id;
+
+DROP TABLE IF EXISTS import_batches;
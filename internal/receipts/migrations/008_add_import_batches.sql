@@ -0,0 +1,14 @@
+-- Create import_batches table. Every CSV import creates one batch so it can be rolled back.
+CREATE TABLE IF NOT EXISTS import_batches (
+    id SERIAL PRIMARY KEY,
+    filename VARCHAR(255) NOT NULL DEFAULT '',
+    receipt_count INTEGER NOT NULL DEFAULT 0,
+    item_count INTEGER NOT NULL DEFAULT 0,
+    rolled_back_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Tag receipts with the batch that imported them
+ALTER TABLE receipts ADD COLUMN IF NOT EXISTS import_batch_id INTEGER REFERENCES import_batches(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_receipts_import_batch_id ON receipts(import_batch_id);
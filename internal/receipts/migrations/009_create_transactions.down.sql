@@ -0,0 +1,2 @@
+-- Drop imported statement transactions
+DROP TABLE IF EXISTS transactions;
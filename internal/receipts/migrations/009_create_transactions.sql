@@ -0,0 +1,19 @@
+-- Create transactions table for imported bank and credit card statements
+CREATE TABLE IF NOT EXISTS transactions (
+    id SERIAL PRIMARY KEY,
+    account VARCHAR(100) NOT NULL DEFAULT '',
+    posted_at DATE NOT NULL,
+    amount DECIMAL(10, 2) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    fit_id VARCHAR(255) NOT NULL,
+    source VARCHAR(10) NOT NULL,
+    receipt_id INTEGER UNIQUE REFERENCES receipts(id) ON DELETE SET NULL,
+    match_method VARCHAR(10),
+    match_score DECIMAL(5, 4),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    -- Re-importing an overlapping statement skips the transactions already imported
+    UNIQUE (account, fit_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_transactions_posted_at ON transactions(posted_at);
+CREATE INDEX IF NOT EXISTS idx_transactions_unmatched ON transactions(posted_at) WHERE receipt_id IS NULL;
@@ -0,0 +1,2 @@
+-- Drop the incremental ledger export history
+DROP TABLE IF EXISTS ledger_exports;
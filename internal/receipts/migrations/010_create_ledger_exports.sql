@@ -0,0 +1,12 @@
+-- Create ledger_exports table recording incremental journal exports
+CREATE TABLE IF NOT EXISTS ledger_exports (
+    id SERIAL PRIMARY KEY,
+    format VARCHAR(20) NOT NULL,
+    -- Receipts created after since and up to until were exported
+    since TIMESTAMP WITH TIME ZONE,
+    until TIMESTAMP WITH TIME ZONE NOT NULL,
+    receipt_count INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_ledger_exports_format ON ledger_exports(format, until DESC);
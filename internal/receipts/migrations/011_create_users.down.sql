@@ -0,0 +1,68 @@
+-- Drop users and sessions. Owned rows are kept and shared again; stores and
+-- statement entries that only differ by owner are merged into the oldest one.
+DROP MATERIALIZED VIEW IF EXISTS product_spending_daily;
+DROP MATERIALIZED VIEW IF EXISTS spending_daily;
+
+DROP INDEX IF EXISTS idx_stores_user_name_lower;
+DROP INDEX IF EXISTS idx_transactions_user_account_fit_id;
+
+CREATE TEMPORARY TABLE kept_stores ON COMMIT DROP AS
+SELECT s.id, keep.id AS keep_id
+FROM stores s
+JOIN (SELECT LOWER(name) AS name, MIN(id) AS id FROM stores GROUP BY LOWER(name)) keep
+  ON keep.name = LOWER(s.name);
+
+UPDATE receipts r SET store_id = k.keep_id FROM kept_stores k WHERE k.id = r.store_id AND k.id <> k.keep_id;
+UPDATE budgets b SET store_id = k.keep_id FROM kept_stores k WHERE k.id = b.store_id AND k.id <> k.keep_id;
+DELETE FROM stores s USING kept_stores k WHERE k.id = s.id AND k.id <> k.keep_id;
+
+DELETE FROM transactions t
+USING transactions older
+WHERE older.account = t.account AND older.fit_id = t.fit_id AND older.id < t.id;
+
+DROP INDEX IF EXISTS idx_ledger_exports_user_id;
+DROP INDEX IF EXISTS idx_import_batches_user_id;
+DROP INDEX IF EXISTS idx_budgets_user_id;
+DROP INDEX IF EXISTS idx_receipts_user_id;
+
+ALTER TABLE ledger_exports DROP COLUMN IF EXISTS user_id;
+ALTER TABLE transactions DROP COLUMN IF EXISTS user_id;
+ALTER TABLE import_batches DROP COLUMN IF EXISTS user_id;
+ALTER TABLE budgets DROP COLUMN IF EXISTS user_id;
+ALTER TABLE receipts DROP COLUMN IF EXISTS user_id;
+ALTER TABLE stores DROP COLUMN IF EXISTS user_id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_stores_name_lower ON stores(LOWER(name));
+ALTER TABLE transactions ADD CONSTRAINT transactions_account_fit_id_key UNIQUE (account, fit_id);
+
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS users;
+
+-- The spending views go back to their shape from before users existed
+CREATE MATERIALIZED VIEW IF NOT EXISTS spending_daily AS
+SELECT
+    r.purchase_date::date AS day,
+    r.store_name,
+    COALESCE(NULLIF(s.chain, ''), r.store_name) AS chain,
+    COALESCE(c.name, 'Uncategorized') AS category,
+    COUNT(*) AS receipt_count,
+    SUM(r.total_amount) AS total
+FROM receipts r
+LEFT JOIN stores s ON s.id = r.store_id
+LEFT JOIN categories c ON c.id = r.category_id
+GROUP BY 1, 2, 3, 4;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS product_spending_daily AS
+SELECT
+    r.purchase_date::date AS day,
+    ri.name AS product,
+    ri.base_unit,
+    SUM(ri.base_quantity) AS quantity,
+    COUNT(*) AS item_count,
+    SUM(ri.total_price) AS total
+FROM receipt_items ri
+JOIN receipts r ON r.id = ri.receipt_id
+GROUP BY 1, 2, 3;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_spending_daily_key ON spending_daily(day, store_name, chain, category);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_product_spending_daily_key ON product_spending_daily(day, product, base_unit);
@@ -0,0 +1,86 @@
+-- Create users table. Usernames are unique regardless of case.
+CREATE TABLE IF NOT EXISTS users (
+    id SERIAL PRIMARY KEY,
+    username VARCHAR(100) NOT NULL,
+    password_hash VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username_lower ON users(LOWER(username));
+
+-- Create sessions table. Only the SHA-256 of the cookie token is stored.
+CREATE TABLE IF NOT EXISTS sessions (
+    token_hash CHAR(64) PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
+CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);
+
+-- Owned data. Rows recorded before users existed have no owner until the
+-- first account is created, which claims them.
+ALTER TABLE stores ADD COLUMN IF NOT EXISTS user_id INTEGER REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE receipts ADD COLUMN IF NOT EXISTS user_id INTEGER REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE budgets ADD COLUMN IF NOT EXISTS user_id INTEGER REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE import_batches ADD COLUMN IF NOT EXISTS user_id INTEGER REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS user_id INTEGER REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE ledger_exports ADD COLUMN IF NOT EXISTS user_id INTEGER REFERENCES users(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_receipts_user_id ON receipts(user_id, purchase_date);
+CREATE INDEX IF NOT EXISTS idx_budgets_user_id ON budgets(user_id);
+CREATE INDEX IF NOT EXISTS idx_import_batches_user_id ON import_batches(user_id);
+CREATE INDEX IF NOT EXISTS idx_ledger_exports_user_id ON ledger_exports(user_id, format, until DESC);
+
+-- Store names are unique per user, and statement entries per user and account
+DROP INDEX IF EXISTS idx_stores_name_lower;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_stores_user_name_lower ON stores(user_id, LOWER(name));
+
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_account_fit_id_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_transactions_user_account_fit_id ON transactions(user_id, account, fit_id);
+
+-- Spending views are aggregated per user. Views created before users existed
+-- are rebuilt with the user_id column.
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_attribute
+                   WHERE attrelid = 'spending_daily'::regclass AND attname = 'user_id') THEN
+        DROP MATERIALIZED VIEW spending_daily;
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_attribute
+                   WHERE attrelid = 'product_spending_daily'::regclass AND attname = 'user_id') THEN
+        DROP MATERIALIZED VIEW product_spending_daily;
+    END IF;
+END $$;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS spending_daily AS
+SELECT
+    COALESCE(r.user_id, 0) AS user_id,
+    r.purchase_date::date AS day,
+    r.store_name,
+    COALESCE(NULLIF(s.chain, ''), r.store_name) AS chain,
+    COALESCE(c.name, 'Uncategorized') AS category,
+    COUNT(*) AS receipt_count,
+    SUM(r.total_amount) AS total
+FROM receipts r
+LEFT JOIN stores s ON s.id = r.store_id
+LEFT JOIN categories c ON c.id = r.category_id
+GROUP BY 1, 2, 3, 4, 5;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS product_spending_daily AS
+SELECT
+    COALESCE(r.user_id, 0) AS user_id,
+    r.purchase_date::date AS day,
+    ri.name AS product,
+    ri.base_unit,
+    SUM(ri.base_quantity) AS quantity,
+    COUNT(*) AS item_count,
+    SUM(ri.total_price) AS total
+FROM receipt_items ri
+JOIN receipts r ON r.id = ri.receipt_id
+GROUP BY 1, 2, 3, 4;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_spending_daily_key ON spending_daily(user_id, day, store_name, chain, category);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_product_spending_daily_key ON product_spending_daily(user_id, day, product, base_unit);
@@ -0,0 +1,7 @@
+-- Drop households with their shared receipts, splits and settlements
+DROP TABLE IF EXISTS household_settlements;
+DROP TABLE IF EXISTS receipt_item_assignments;
+DROP TABLE IF EXISTS receipt_share_participants;
+DROP TABLE IF EXISTS receipt_shares;
+DROP TABLE IF EXISTS household_members;
+DROP TABLE IF EXISTS households;
@@ -0,0 +1,60 @@
+-- Create households, groups of users who share receipts and split their costs
+CREATE TABLE IF NOT EXISTS households (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    owner_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS household_members (
+    household_id INTEGER NOT NULL REFERENCES households(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    joined_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (household_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_household_members_user_id ON household_members(user_id);
+
+-- A receipt shared with a household: who paid it and how its total is split.
+-- A receipt is shared with at most one household.
+CREATE TABLE IF NOT EXISTS receipt_shares (
+    receipt_id INTEGER PRIMARY KEY REFERENCES receipts(id) ON DELETE CASCADE,
+    household_id INTEGER NOT NULL REFERENCES households(id) ON DELETE CASCADE,
+    paid_by INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    split_method VARCHAR(20) NOT NULL DEFAULT 'equal'
+        CHECK (split_method IN ('equal', 'percentage', 'item')),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_receipt_shares_household_id ON receipt_shares(household_id);
+
+-- Members taking part in a shared receipt, with their percentage for percentage splits
+CREATE TABLE IF NOT EXISTS receipt_share_participants (
+    receipt_id INTEGER NOT NULL REFERENCES receipt_shares(receipt_id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    percent NUMERIC(5, 2),
+    PRIMARY KEY (receipt_id, user_id)
+);
+
+-- Members an item is split between, for per-item splits. Items without
+-- assignments are split between all participants.
+CREATE TABLE IF NOT EXISTS receipt_item_assignments (
+    item_id INTEGER NOT NULL REFERENCES receipt_items(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    PRIMARY KEY (item_id, user_id)
+);
+
+-- Payments between members that settle their balances
+CREATE TABLE IF NOT EXISTS household_settlements (
+    id SERIAL PRIMARY KEY,
+    household_id INTEGER NOT NULL REFERENCES households(id) ON DELETE CASCADE,
+    from_user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    to_user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    amount NUMERIC(10, 2) NOT NULL CHECK (amount > 0),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    CHECK (from_user_id <> to_user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_household_settlements_household_id ON household_settlements(household_id);
@@ -0,0 +1,40 @@
+-- Drop currencies and exchange rates. Receipts keep their amounts, now all
+-- read as the base currency.
+DROP FUNCTION IF EXISTS exchange_rate(TEXT, TEXT, DATE);
+DROP TABLE IF EXISTS exchange_rates;
+
+DROP MATERIALIZED VIEW IF EXISTS product_spending_daily;
+DROP MATERIALIZED VIEW IF EXISTS spending_daily;
+
+ALTER TABLE receipts DROP COLUMN IF EXISTS currency;
+
+-- The spending views go back to one row per user, day and store or product
+CREATE MATERIALIZED VIEW IF NOT EXISTS spending_daily AS
+SELECT
+    COALESCE(r.user_id, 0) AS user_id,
+    r.purchase_date::date AS day,
+    r.store_name,
+    COALESCE(NULLIF(s.chain, ''), r.store_name) AS chain,
+    COALESCE(c.name, 'Uncategorized') AS category,
+    COUNT(*) AS receipt_count,
+    SUM(r.total_amount) AS total
+FROM receipts r
+LEFT JOIN stores s ON s.id = r.store_id
+LEFT JOIN categories c ON c.id = r.category_id
+GROUP BY 1, 2, 3, 4, 5;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS product_spending_daily AS
+SELECT
+    COALESCE(r.user_id, 0) AS user_id,
+    r.purchase_date::date AS day,
+    ri.name AS product,
+    ri.base_unit,
+    SUM(ri.base_quantity) AS quantity,
+    COUNT(*) AS item_count,
+    SUM(ri.total_price) AS total
+FROM receipt_items ri
+JOIN receipts r ON r.id = ri.receipt_id
+GROUP BY 1, 2, 3, 4;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_spending_daily_key ON spending_daily(user_id, day, store_name, chain, category);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_product_spending_daily_key ON product_spending_daily(user_id, day, product, base_unit);
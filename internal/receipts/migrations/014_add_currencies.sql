@@ -0,0 +1,88 @@
+-- Every receipt has an ISO 4217 currency. Receipts recorded before currencies
+-- existed are assumed to be in reais.
+ALTER TABLE receipts ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'BRL';
+
+-- Exchange rates, shared by every user: one unit of currency is worth rate
+-- units of quote_currency on the given date
+CREATE TABLE IF NOT EXISTS exchange_rates (
+    id SERIAL PRIMARY KEY,
+    rate_date DATE NOT NULL,
+    currency CHAR(3) NOT NULL,
+    quote_currency CHAR(3) NOT NULL,
+    rate NUMERIC(18, 8) NOT NULL CHECK (rate > 0),
+    source VARCHAR(20) NOT NULL DEFAULT 'manual',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (rate_date, currency, quote_currency),
+    CHECK (currency <> quote_currency)
+);
+
+CREATE INDEX IF NOT EXISTS idx_exchange_rates_pair ON exchange_rates(currency, quote_currency, rate_date);
+
+-- exchange_rate returns what one unit of from_currency is worth in to_currency
+-- on a date: the latest rate on or before it, else the earliest rate after it.
+-- Rates are used in either direction. NULL means no rate is known.
+CREATE OR REPLACE FUNCTION exchange_rate(from_currency TEXT, to_currency TEXT, on_date DATE)
+RETURNS NUMERIC AS $$
+    SELECT CASE WHEN from_currency = to_currency THEN 1 ELSE (
+        SELECT rate
+        FROM (
+            SELECT rate_date, rate
+            FROM exchange_rates
+            WHERE currency = from_currency AND quote_currency = to_currency
+            UNION ALL
+            SELECT rate_date, 1 / rate
+            FROM exchange_rates
+            WHERE currency = to_currency AND quote_currency = from_currency
+        ) rates
+        ORDER BY rate_date > on_date, ABS(rate_date - on_date)
+        LIMIT 1
+    ) END
+$$ LANGUAGE SQL STABLE;
+
+-- The spending views keep each currency apart so analytics can convert them
+-- with the rate of the day. Views created before currencies existed are rebuilt;
+-- their indexes keep the names used by earlier migrations so re-runs skip them.
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_attribute
+                   WHERE attrelid = 'spending_daily'::regclass AND attname = 'currency') THEN
+        DROP MATERIALIZED VIEW spending_daily;
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_attribute
+                   WHERE attrelid = 'product_spending_daily'::regclass AND attname = 'currency') THEN
+        DROP MATERIALIZED VIEW product_spending_daily;
+    END IF;
+END $$;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS spending_daily AS
+SELECT
+    COALESCE(r.user_id, 0) AS user_id,
+    r.purchase_date::date AS day,
+    r.currency,
+    r.store_name,
+    COALESCE(NULLIF(s.chain, ''), r.store_name) AS chain,
+    COALESCE(c.name, 'Uncategorized') AS category,
+    COUNT(*) AS receipt_count,
+    SUM(r.total_amount) AS total
+FROM receipts r
+LEFT JOIN stores s ON s.id = r.store_id
+LEFT JOIN categories c ON c.id = r.category_id
+GROUP BY 1, 2, 3, 4, 5, 6;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS product_spending_daily AS
+SELECT
+    COALESCE(r.user_id, 0) AS user_id,
+    r.purchase_date::date AS day,
+    r.currency,
+    ri.name AS product,
+    ri.base_unit,
+    SUM(ri.base_quantity) AS quantity,
+    COUNT(*) AS item_count,
+    SUM(ri.total_price) AS total
+FROM receipt_items ri
+JOIN receipts r ON r.id = ri.receipt_id
+GROUP BY 1, 2, 3, 4, 5;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_spending_daily_key ON spending_daily(user_id, day, currency, store_name, chain, category);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_product_spending_daily_key ON product_spending_daily(user_id, day, currency, product, base_unit);
@@ -0,0 +1,2 @@
+-- Drop item warranties
+DROP TABLE IF EXISTS warranties;
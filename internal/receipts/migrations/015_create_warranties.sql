@@ -0,0 +1,9 @@
+-- Items tracked for warranty. The expiry date is computed from the receipt's
+-- purchase date, so correcting the date moves it along.
+CREATE TABLE IF NOT EXISTS warranties (
+    item_id INTEGER PRIMARY KEY REFERENCES receipt_items(id) ON DELETE CASCADE,
+    duration_months INTEGER NOT NULL CHECK (duration_months > 0),
+    serial_number VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,3 @@
+-- Drop item tags and receipt notes
+DROP TABLE IF EXISTS receipt_item_tags;
+ALTER TABLE receipts DROP COLUMN IF EXISTS note;
@@ -0,0 +1,11 @@
+-- Free-text note on each receipt
+ALTER TABLE receipts ADD COLUMN IF NOT EXISTS note TEXT NOT NULL DEFAULT '';
+
+-- Tags on individual items, sharing the tags used on receipts
+CREATE TABLE IF NOT EXISTS receipt_item_tags (
+    item_id INTEGER NOT NULL REFERENCES receipt_items(id) ON DELETE CASCADE,
+    tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    PRIMARY KEY (item_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_receipt_item_tags_tag_id ON receipt_item_tags(tag_id);
@@ -0,0 +1,38 @@
+-- Merge the users' categories and tags into shared ones, keeping the oldest of each name
+DROP INDEX IF EXISTS idx_categories_user_name_lower;
+DROP INDEX IF EXISTS idx_tags_user_name_lower;
+
+CREATE TEMPORARY TABLE kept_categories ON COMMIT DROP AS
+SELECT c.id, keep.id AS keep_id
+FROM categories c
+JOIN (SELECT LOWER(name) AS name, MIN(id) AS id FROM categories GROUP BY LOWER(name)) keep
+  ON keep.name = LOWER(c.name);
+
+UPDATE receipts r SET category_id = k.keep_id FROM kept_categories k WHERE k.id = r.category_id AND k.id <> k.keep_id;
+UPDATE budgets b SET category_id = k.keep_id FROM kept_categories k WHERE k.id = b.category_id AND k.id <> k.keep_id;
+DELETE FROM categories c USING kept_categories k WHERE k.id = c.id AND k.id <> k.keep_id;
+
+CREATE TEMPORARY TABLE kept_tags ON COMMIT DROP AS
+SELECT t.id, keep.id AS keep_id
+FROM tags t
+JOIN (SELECT LOWER(name) AS name, MIN(id) AS id FROM tags GROUP BY LOWER(name)) keep
+  ON keep.name = LOWER(t.name);
+
+-- A receipt or item tagged with two users' copies of a tag keeps one link
+DELETE FROM receipt_tags rt USING kept_tags k
+WHERE k.id = rt.tag_id AND k.id <> k.keep_id
+  AND EXISTS (SELECT 1 FROM receipt_tags o WHERE o.receipt_id = rt.receipt_id AND o.tag_id = k.keep_id);
+UPDATE receipt_tags rt SET tag_id = k.keep_id FROM kept_tags k WHERE k.id = rt.tag_id AND k.id <> k.keep_id;
+
+DELETE FROM receipt_item_tags it USING kept_tags k
+WHERE k.id = it.tag_id AND k.id <> k.keep_id
+  AND EXISTS (SELECT 1 FROM receipt_item_tags o WHERE o.item_id = it.item_id AND o.tag_id = k.keep_id);
+UPDATE receipt_item_tags it SET tag_id = k.keep_id FROM kept_tags k WHERE k.id = it.tag_id AND k.id <> k.keep_id;
+
+DELETE FROM tags t USING kept_tags k WHERE k.id = t.id AND k.id <> k.keep_id;
+
+ALTER TABLE categories DROP COLUMN IF EXISTS user_id;
+ALTER TABLE tags DROP COLUMN IF EXISTS user_id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_name_lower ON categories(LOWER(name));
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tags_name_lower ON tags(LOWER(name));
@@ -0,0 +1,75 @@
+-- Categories and tags belong to users, with names unique per user. Shared
+-- categories and tags are copied to every user who uses them and the copies
+-- take over that user's receipts, items and budgets. Rows recorded before
+-- users existed keep no owner until the first account claims them.
+ALTER TABLE categories ADD COLUMN IF NOT EXISTS user_id INTEGER REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE tags ADD COLUMN IF NOT EXISTS user_id INTEGER REFERENCES users(id) ON DELETE CASCADE;
+
+DROP INDEX IF EXISTS idx_categories_name_lower;
+DROP INDEX IF EXISTS idx_tags_name_lower;
+
+-- Categories
+INSERT INTO categories (user_id, name, created_at, updated_at)
+SELECT DISTINCT used.user_id, c.name, c.created_at, c.updated_at
+FROM categories c
+JOIN (
+    SELECT user_id, category_id FROM receipts
+    UNION
+    SELECT user_id, category_id FROM budgets
+) used ON used.category_id = c.id
+WHERE c.user_id IS NULL AND used.user_id IS NOT NULL;
+
+UPDATE receipts r
+SET category_id = mine.id
+FROM categories shared, categories mine
+WHERE shared.id = r.category_id AND shared.user_id IS NULL
+  AND mine.user_id = r.user_id AND mine.name = shared.name;
+
+UPDATE budgets b
+SET category_id = mine.id
+FROM categories shared, categories mine
+WHERE shared.id = b.category_id AND shared.user_id IS NULL
+  AND mine.user_id = b.user_id AND mine.name = shared.name;
+
+-- Tags
+INSERT INTO tags (user_id, name, created_at)
+SELECT DISTINCT used.user_id, t.name, t.created_at
+FROM tags t
+JOIN (
+    SELECT r.user_id, rt.tag_id
+    FROM receipt_tags rt JOIN receipts r ON r.id = rt.receipt_id
+    UNION
+    SELECT r.user_id, it.tag_id
+    FROM receipt_item_tags it
+    JOIN receipt_items ri ON ri.id = it.item_id
+    JOIN receipts r ON r.id = ri.receipt_id
+) used ON used.tag_id = t.id
+WHERE t.user_id IS NULL AND used.user_id IS NOT NULL;
+
+UPDATE receipt_tags rt
+SET tag_id = mine.id
+FROM receipts r, tags shared, tags mine
+WHERE r.id = rt.receipt_id
+  AND shared.id = rt.tag_id AND shared.user_id IS NULL
+  AND mine.user_id = r.user_id AND mine.name = shared.name;
+
+UPDATE receipt_item_tags it
+SET tag_id = mine.id
+FROM receipt_items ri, receipts r, tags shared, tags mine
+WHERE ri.id = it.item_id AND r.id = ri.receipt_id
+  AND shared.id = it.tag_id AND shared.user_id IS NULL
+  AND mine.user_id = r.user_id AND mine.name = shared.name;
+
+-- Once accounts exist, shared rows nobody uses any more are dropped
+DELETE FROM categories c
+WHERE c.user_id IS NULL AND EXISTS (SELECT 1 FROM users)
+  AND NOT EXISTS (SELECT 1 FROM receipts WHERE category_id = c.id)
+  AND NOT EXISTS (SELECT 1 FROM budgets WHERE category_id = c.id);
+
+DELETE FROM tags t
+WHERE t.user_id IS NULL AND EXISTS (SELECT 1 FROM users)
+  AND NOT EXISTS (SELECT 1 FROM receipt_tags WHERE tag_id = t.id)
+  AND NOT EXISTS (SELECT 1 FROM receipt_item_tags WHERE tag_id = t.id);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_user_name_lower ON categories(user_id, LOWER(name));
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tags_user_name_lower ON tags(user_id, LOWER(name));
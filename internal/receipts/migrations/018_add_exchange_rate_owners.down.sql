@@ -0,0 +1,32 @@
+-- Merge the users' exchange rates into shared ones, keeping the latest update of each day
+DROP FUNCTION IF EXISTS exchange_rate(INTEGER, TEXT, TEXT, DATE);
+DROP INDEX IF EXISTS idx_exchange_rates_user_pair;
+
+DELETE FROM exchange_rates e
+USING exchange_rates newer
+WHERE newer.rate_date = e.rate_date
+  AND newer.currency = e.currency
+  AND newer.quote_currency = e.quote_currency
+  AND (newer.updated_at, newer.id) > (e.updated_at, e.id);
+
+ALTER TABLE exchange_rates DROP COLUMN IF EXISTS user_id;
+ALTER TABLE exchange_rates ADD CONSTRAINT exchange_rates_rate_date_currency_quote_currency_key UNIQUE (rate_date, currency, quote_currency);
+CREATE INDEX IF NOT EXISTS idx_exchange_rates_pair ON exchange_rates(currency, quote_currency, rate_date);
+
+CREATE OR REPLACE FUNCTION exchange_rate(from_currency TEXT, to_currency TEXT, on_date DATE)
+RETURNS NUMERIC AS $$
+    SELECT CASE WHEN from_currency = to_currency THEN 1 ELSE (
+        SELECT rate
+        FROM (
+            SELECT rate_date, rate
+            FROM exchange_rates
+            WHERE currency = from_currency AND quote_currency = to_currency
+            UNION ALL
+            SELECT rate_date, 1 / rate
+            FROM exchange_rates
+            WHERE currency = to_currency AND quote_currency = from_currency
+        ) rates
+        ORDER BY rate_date > on_date, ABS(rate_date - on_date)
+        LIMIT 1
+    ) END
+$$ LANGUAGE SQL STABLE;
@@ -0,0 +1,38 @@
+-- Exchange rates belong to users. Shared rates are copied to every account;
+-- rates recorded before users existed keep no owner until the first account
+-- claims them.
+ALTER TABLE exchange_rates ADD COLUMN IF NOT EXISTS user_id INTEGER REFERENCES users(id) ON DELETE CASCADE;
+
+ALTER TABLE exchange_rates DROP CONSTRAINT IF EXISTS exchange_rates_rate_date_currency_quote_currency_key;
+DROP INDEX IF EXISTS idx_exchange_rates_pair;
+
+INSERT INTO exchange_rates (user_id, rate_date, currency, quote_currency, rate, source, created_at, updated_at)
+SELECT u.id, e.rate_date, e.currency, e.quote_currency, e.rate, e.source, e.created_at, e.updated_at
+FROM exchange_rates e
+CROSS JOIN users u
+WHERE e.user_id IS NULL;
+
+DELETE FROM exchange_rates WHERE user_id IS NULL AND EXISTS (SELECT 1 FROM users);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_exchange_rates_user_pair ON exchange_rates(user_id, currency, quote_currency, rate_date);
+
+-- exchange_rate now only uses the rates of one user
+DROP FUNCTION IF EXISTS exchange_rate(TEXT, TEXT, DATE);
+
+CREATE OR REPLACE FUNCTION exchange_rate(owner_id INTEGER, from_currency TEXT, to_currency TEXT, on_date DATE)
+RETURNS NUMERIC AS $$
+    SELECT CASE WHEN from_currency = to_currency THEN 1 ELSE (
+        SELECT rate
+        FROM (
+            SELECT rate_date, rate
+            FROM exchange_rates
+            WHERE user_id = owner_id AND currency = from_currency AND quote_currency = to_currency
+            UNION ALL
+            SELECT rate_date, 1 / rate
+            FROM exchange_rates
+            WHERE user_id = owner_id AND currency = to_currency AND quote_currency = from_currency
+        ) rates
+        ORDER BY rate_date > on_date, ABS(rate_date - on_date)
+        LIMIT 1
+    ) END
+$$ LANGUAGE SQL STABLE;
@@ -0,0 +1,2 @@
+-- Drop the currencies of statement transactions
+ALTER TABLE transactions DROP COLUMN IF EXISTS currency;
@@ -0,0 +1,4 @@
+-- Every statement transaction has an ISO 4217 currency, so it is only matched
+-- to receipts in the same one. Transactions imported before are assumed to be
+-- in reais, like receipts were.
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'BRL';
@@ -0,0 +1,3 @@
+-- Forget the stores and categories created by imports
+ALTER TABLE import_batches DROP COLUMN IF EXISTS created_category_ids;
+ALTER TABLE import_batches DROP COLUMN IF EXISTS created_store_ids;
@@ -0,0 +1,4 @@
+-- Remember the stores and categories an import created, so rolling it back can
+-- delete those nothing else uses anymore
+ALTER TABLE import_batches ADD COLUMN IF NOT EXISTS created_store_ids INTEGER[] NOT NULL DEFAULT '{}';
+ALTER TABLE import_batches ADD COLUMN IF NOT EXISTS created_category_ids INTEGER[] NOT NULL DEFAULT '{}';
@@ -0,0 +1,89 @@
+package receipts
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mauroue/cereja-corp/config"
+	"github.com/mauroue/cereja-corp/internal/server"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Module is the receipt scanner: its JSON API under /api/v1 and its web
+// interface under /receipts-web
+type Module struct {
+	api *Handler
+	web *WebHandler
+}
+
+// NewModule creates the receipt scanner module, storing uploads in uploadDir
+func NewModule(database *sql.DB, uploadDir string) (*Module, error) {
+	api, err := NewHandler(database, uploadDir)
+	if err != nil {
+		return nil, err
+	}
+
+	web, err := NewWebHandler(api, filepath.Join("internal", "receipts", "templates"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Module{api: api, web: web}, nil
+}
+
+// Name returns the module name
+func (m *Module) Name() string { return "receipts" }
+
+// legacyPrefixes are the paths the receipt API was served at before it moved
+// under /api/v1
+var legacyPrefixes = []string{"/receipts", "/transactions", "/households"}
+
+// RegisterRoutes mounts the receipt API under /api/v1, the web interface and
+// the sign-in pages. With server.legacy_redirects, requests to the API's
+// original unprefixed paths are redirected to /api/v1.
+func (m *Module) RegisterRoutes(routes server.Routes) {
+	m.api.RegisterRoutes(routes.API)
+	if config.Get().Server.LegacyRedirects {
+		for _, prefix := range legacyPrefixes {
+			routes.Engine.Any(prefix, redirectToAPI)
+			routes.Engine.Any(prefix+"/*path", redirectToAPI)
+		}
+	}
+	m.web.RegisterRoutes(routes.Engine)
+}
+
+// redirectToAPI permanently redirects a request to the same path under
+// /api/v1, keeping its method, body and query
+func redirectToAPI(c *gin.Context) {
+	target := server.APIPrefix + c.Request.URL.EscapedPath()
+	if c.Request.URL.RawQuery != "" {
+		target += "?" + c.Request.URL.RawQuery
+	}
+	c.Redirect(http.StatusPermanentRedirect, target)
+}
+
+// Migrations returns the receipt scanner migrations, which also create the
+// users table other modules reference
+func (m *Module) Migrations() (fs.FS, error) {
+	return fs.Sub(migrationFiles, "migrations")
+}
+
+// MigrationsRequire returns nil; the receipt scanner tables come first
+func (m *Module) MigrationsRequire() []string { return nil }
+
+// Start does nothing; uploads and OCR run within their requests
+func (m *Module) Start(ctx context.Context) error { return nil }
+
+// Stop waits for the analytics refreshes started by recent uploads and
+// imports. Uploads and their OCR run within their requests, which the server
+// drains before stopping the modules.
+func (m *Module) Stop(ctx context.Context) error {
+	return m.api.repo.WaitBackground(ctx)
+}
@@ -0,0 +1,77 @@
+package receipts
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRedirectToAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	for _, prefix := range legacyPrefixes {
+		router.Any(prefix, redirectToAPI)
+		router.Any(prefix+"/*path", redirectToAPI)
+	}
+	router.GET("/receipts-web", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		method, path, location string
+	}{
+		{http.MethodGet, "/receipts", "/api/v1/receipts"},
+		{http.MethodPost, "/receipts/upload", "/api/v1/receipts/upload"},
+		{http.MethodGet, "/receipts/search?q=caf%C3%A9&limit=5", "/api/v1/receipts/search?q=caf%C3%A9&limit=5"},
+		{http.MethodPut, "/transactions/7/match", "/api/v1/transactions/7/match"},
+		{http.MethodDelete, "/households/3", "/api/v1/households/3"},
+		{http.MethodGet, "/receipts/a%2Fb", "/api/v1/receipts/a%2Fb"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+			if w.Code != http.StatusPermanentRedirect {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusPermanentRedirect)
+			}
+			if got := w.Header().Get("Location"); got != tt.location {
+				t.Errorf("Location = %q, want %q", got, tt.location)
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/receipts-web", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("GET /receipts-web = %d, want it left alone", w.Code)
+	}
+}
+
+func TestMigrationsReversible(t *testing.T) {
+	files, err := (&Module{}).Migrations()
+	if err != nil {
+		t.Fatalf("Migrations: %v", err)
+	}
+	names, err := fs.Glob(files, "*.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	downs := map[string]bool{}
+	for _, name := range names {
+		if base, ok := strings.CutSuffix(name, ".down.sql"); ok {
+			downs[base] = true
+		}
+	}
+	for _, name := range names {
+		if strings.HasSuffix(name, ".down.sql") {
+			continue
+		}
+		if base := strings.TrimSuffix(name, ".sql"); !downs[base] {
+			t.Errorf("%s has no %s.down.sql", name, base)
+		}
+	}
+}
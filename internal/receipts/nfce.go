@@ -0,0 +1,119 @@
+package receipts
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mauroue/cereja-corp/internal/models"
+)
+
+// ErrNotNFCe is returned when an XML document holds no NFC-e invoice
+var ErrNotNFCe = errors.New("document is not an NFC-e invoice")
+
+// nfceInvoice is the part of an NFC-e (nota fiscal de consumidor eletrônica)
+// infNFe element read into a receipt. Quantities and prices use a dot as the
+// decimal separator, whatever the locale.
+type nfceInvoice struct {
+	Issued   string `xml:"ide>dhEmi"`
+	Issuer   string `xml:"emit>xNome"`
+	Trade    string `xml:"emit>xFant"`
+	Products []struct {
+		Name      string `xml:"xProd"`
+		Unit      string `xml:"uCom"`
+		Quantity  string `xml:"qCom"`
+		UnitPrice string `xml:"vUnCom"`
+		Total     string `xml:"vProd"`
+	} `xml:"det>prod"`
+	Total string `xml:"total>ICMSTot>vNF"`
+}
+
+// IsNFCeFile reports whether a file name is an NFC-e XML document
+func IsNFCeFile(name string) bool {
+	return strings.EqualFold(filepath.Ext(name), ".xml")
+}
+
+// ParseNFCe reads a receipt and its items from an NFC-e XML document, either
+// the signed NFe or the nfeProc wrapping it. Items carry the unit of their
+// uCom field; units not recognised are taken as pieces.
+func ParseNFCe(r io.Reader) (*models.Receipt, []*models.ReceiptItem, error) {
+	decoder := xml.NewDecoder(r)
+	var invoice nfceInvoice
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil, nil, ErrNotNFCe
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid NFC-e XML: %w", err)
+		}
+		if start, ok := token.(xml.StartElement); ok && start.Name.Local == "infNFe" {
+			if err := decoder.DecodeElement(&invoice, &start); err != nil {
+				return nil, nil, fmt.Errorf("invalid NFC-e XML: %w", err)
+			}
+			break
+		}
+	}
+
+	receipt := &models.Receipt{StoreName: strings.TrimSpace(invoice.Trade)}
+	if receipt.StoreName == "" {
+		receipt.StoreName = strings.TrimSpace(invoice.Issuer)
+	}
+	if receipt.StoreName == "" {
+		receipt.StoreName = "Unknown Store"
+	}
+
+	// dhEmi is an RFC 3339 timestamp with the issuer's UTC offset
+	issued, err := time.Parse(time.RFC3339, strings.TrimSpace(invoice.Issued))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid NFC-e issue date %q", invoice.Issued)
+	}
+	receipt.PurchaseDate = issued
+
+	var items []*models.ReceiptItem
+	var sum float64
+	for i, product := range invoice.Products {
+		item := &models.ReceiptItem{Name: strings.TrimSpace(product.Name)}
+		if item.Quantity, err = nfceNumber(product.Quantity); err != nil {
+			return nil, nil, fmt.Errorf("item %d: invalid quantity %q", i+1, product.Quantity)
+		}
+		if item.UnitPrice, err = nfceNumber(product.UnitPrice); err != nil {
+			return nil, nil, fmt.Errorf("item %d: invalid unit price %q", i+1, product.UnitPrice)
+		}
+		if item.TotalPrice, err = nfceNumber(product.Total); err != nil {
+			return nil, nil, fmt.Errorf("item %d: invalid total %q", i+1, product.Total)
+		}
+
+		item.Unit = UnitPiece
+		if unit, ok := ParseUnit(product.Unit); ok {
+			item.Unit = unit
+		}
+		NormalizeItemUnits(item)
+
+		sum += item.TotalPrice
+		items = append(items, item)
+	}
+
+	receipt.TotalAmount = sum
+	if invoice.Total != "" {
+		if receipt.TotalAmount, err = nfceNumber(invoice.Total); err != nil {
+			return nil, nil, fmt.Errorf("invalid NFC-e total %q", invoice.Total)
+		}
+	}
+
+	return receipt, items, nil
+}
+
+// nfceNumber parses a decimal NFC-e field. Empty fields are zero.
+func nfceNumber(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
@@ -1,7 +1,11 @@
 package receipts
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -11,19 +15,35 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/textract"
+	"github.com/mauroue/cereja-corp/config"
 	"github.com/mauroue/cereja-corp/internal/models"
 )
 
+// ErrOCRUnavailable is returned when processing receipts without AWS credentials
+var ErrOCRUnavailable = errors.New("AWS Textract client not available")
+
 // Global AWS session cache
 var (
 	awsSessionCache     *session.Session
 	awsSessionCacheLock sync.RWMutex
 )
 
+// awsConfig returns the AWS settings for Textract. Credentials from the ocr
+// configuration are used when set; otherwise the SDK looks them up itself
+// (environment, shared credentials file, instance or task role).
+func awsConfig(cfg config.OCRConfig) aws.Config {
+	awsCfg := aws.Config{Region: aws.String(cfg.AWSRegion)}
+	if cfg.AWSAccessKeyID != "" && cfg.AWSSecretAccessKey != "" {
+		awsCfg.Credentials = credentials.NewStaticCredentials(cfg.AWSAccessKeyID, cfg.AWSSecretAccessKey, "")
+	}
+	return awsCfg
+}
+
 // getOrCreateAWSSession creates or retrieves a cached AWS session
-func getOrCreateAWSSession(region string) (*session.Session, error) {
+func getOrCreateAWSSession(cfg config.OCRConfig) (*session.Session, error) {
 	// Check if we have a cached session first
 	awsSessionCacheLock.RLock()
 	if awsSessionCache != nil {
@@ -42,36 +62,21 @@ func getOrCreateAWSSession(region string) (*session.Session, error) {
 		return awsSessionCache, nil
 	}
 
-	// Set a default region if empty
-	if region == "" {
-		region = "us-east-1"
-		fmt.Println("AWS region not specified, using default: us-east-1")
-	} else {
-		fmt.Printf("Using AWS region: %s\n", region)
-	}
-
-	// Create the session with better error handling
-	sessionOptions := session.Options{
-		Config: aws.Config{
-			Region: aws.String(region),
-		},
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            awsConfig(cfg),
 		SharedConfigState: session.SharedConfigEnable,
-	}
-
-	sess, err := session.NewSessionWithOptions(sessionOptions)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create AWS session: %w", err)
 	}
 
-	// Validate credentials
-	_, err = sess.Config.Credentials.Get()
-	if err != nil {
-		return nil, fmt.Errorf("invalid AWS credentials: %w", err)
+	// Resolve the credentials now, so that missing ones are reported at startup
+	if _, err := sess.Config.Credentials.Get(); err != nil {
+		return nil, fmt.Errorf("no usable AWS credentials: %w", err)
 	}
 
-	// Store in cache for future use
 	awsSessionCache = sess
-	fmt.Println("AWS session created and cached successfully")
+	log.Printf("Using AWS Textract in %s", cfg.AWSRegion)
 
 	return sess, nil
 }
@@ -79,33 +84,23 @@ func getOrCreateAWSSession(region string) (*session.Session, error) {
 // OCRService handles the optical character recognition for receipts
 type OCRService struct {
 	uploadDir      string
-	awsRegion      string
 	textractClient *textract.Textract
 }
 
-// NewOCRService creates a new OCR service
-func NewOCRService(uploadDir string, awsRegion string) *OCRService {
+// NewOCRService creates a new OCR service. Without usable AWS credentials it
+// still serves NFC-e uploads, but cannot process images.
+func NewOCRService(uploadDir string, cfg config.OCRConfig) *OCRService {
 	var textractClient *textract.Textract
 
-	// Check if AWS credentials are set
-	accessKey := os.Getenv("AWS_ACCESS_KEY_ID")
-	secretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
-
-	if accessKey == "" || secretKey == "" {
-		fmt.Println("AWS credentials not properly configured. AWS_ACCESS_KEY_ID or AWS_SECRET_ACCESS_KEY environment variables are missing.")
+	sess, err := getOrCreateAWSSession(cfg)
+	if err != nil {
+		log.Printf("OCR disabled: %v. Set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, the ocr section of the config file, or any other AWS credential source.", err)
 	} else {
-		// Try to get or create AWS session
-		sess, err := getOrCreateAWSSession(awsRegion)
-		if err != nil {
-			fmt.Printf("AWS session error: %v\n", err)
-		} else {
-			textractClient = textract.New(sess)
-		}
+		textractClient = textract.New(sess)
 	}
 
 	return &OCRService{
 		uploadDir:      uploadDir,
-		awsRegion:      awsRegion,
 		textractClient: textractClient,
 	}
 }
@@ -118,7 +113,7 @@ func (s *OCRService) ProcessReceipt(imagePath string) (*models.Receipt, []*model
 	}
 
 	// If Textract client is not available, return an error
-	return nil, nil, fmt.Errorf("AWS Textract client not available: please configure AWS credentials")
+	return nil, nil, fmt.Errorf("%w: please configure AWS credentials", ErrOCRUnavailable)
 }
 
 // processWithTextract processes the receipt using AWS Textract
@@ -153,7 +148,6 @@ func (s *OCRService) processWithTextract(imagePath string) (*models.Receipt, []*
 // parseTextractResult extracts structured data from Textract AnalyzeExpense result
 func (s *OCRService) parseTextractResult(result *textract.AnalyzeExpenseOutput, imagePath string) (*models.Receipt, []*models.ReceiptItem, error) {
 	receipt := &models.Receipt{
-		StoreID:      1, // Default store ID - should be determined by matching vendor name
 		StoreName:    "Unknown Store",
 		PurchaseDate: time.Now(),
 		TotalAmount:  0.0,
@@ -193,6 +187,7 @@ func (s *OCRService) parseTextractResult(result *textract.AnalyzeExpenseOutput,
 					UnitPrice:   0.0,
 					TotalPrice:  0.0,
 				}
+				var row string
 
 				// Process each field in the line item
 				for _, field := range lineItem.LineItemExpenseFields {
@@ -207,7 +202,10 @@ func (s *OCRService) parseTextractResult(result *textract.AnalyzeExpenseOutput,
 							item.TotalPrice = price
 						}
 					case "QUANTITY":
-						if qty, err := parseFloat(fieldValue); err == nil {
+						if qty, unit, ok := ParseQuantity(fieldValue); ok {
+							item.Quantity = qty
+							item.Unit = unit
+						} else if qty, err := parseFloat(fieldValue); err == nil {
 							item.Quantity = qty
 						}
 					case "UNIT_PRICE":
@@ -216,6 +214,17 @@ func (s *OCRService) parseTextractResult(result *textract.AnalyzeExpenseOutput,
 						}
 					case "DESCRIPTION":
 						item.Description = fieldValue
+					case "EXPENSE_ROW":
+						row = fieldValue
+					}
+				}
+
+				// Weighed items usually only carry their unit in the full row text,
+				// e.g. "TOMATE ITALIANO 0,482 KG X 8,99"
+				if item.Unit == "" || item.Unit == UnitPiece {
+					if qty, unit, ok := parseRowUnit(row); ok {
+						item.Quantity = qty
+						item.Unit = unit
 					}
 				}
 
@@ -229,6 +238,8 @@ func (s *OCRService) parseTextractResult(result *textract.AnalyzeExpenseOutput,
 					item.TotalPrice = item.UnitPrice * item.Quantity
 				}
 
+				NormalizeItemUnits(item)
+
 				items = append(items, item)
 			}
 		}
@@ -277,10 +288,15 @@ func (s *OCRService) SaveImage(fileData []byte, fileName string) (string, error)
 		return "", fmt.Errorf("failed to create upload directory: %w", err)
 	}
 
-	// Generate a unique filename
+	// Generate a unique filename; the random suffix keeps images saved within
+	// the same second, as in a bulk import, apart
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", fmt.Errorf("failed to name image: %w", err)
+	}
 	timestamp := time.Now().Format("20060102-150405")
 	ext := filepath.Ext(fileName)
-	newFileName := fmt.Sprintf("receipt-%s%s", timestamp, ext)
+	newFileName := fmt.Sprintf("receipt-%s-%s%s", timestamp, hex.EncodeToString(suffix), ext)
 	filePath := filepath.Join(s.uploadDir, newFileName)
 
 	// Write file to disk
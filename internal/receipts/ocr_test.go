@@ -0,0 +1,45 @@
+package receipts
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/mauroue/cereja-corp/config"
+)
+
+func TestAWSConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    config.OCRConfig
+		static bool
+	}{
+		{"both keys", config.OCRConfig{AWSRegion: "sa-east-1", AWSAccessKeyID: "AKIA", AWSSecretAccessKey: "secret"}, true},
+		{"no keys", config.OCRConfig{AWSRegion: "sa-east-1"}, false},
+		{"only the key ID", config.OCRConfig{AWSRegion: "sa-east-1", AWSAccessKeyID: "AKIA"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			awsCfg := awsConfig(tt.cfg)
+			if aws.StringValue(awsCfg.Region) != tt.cfg.AWSRegion {
+				t.Errorf("region = %q, want %q", aws.StringValue(awsCfg.Region), tt.cfg.AWSRegion)
+			}
+			if !tt.static {
+				if awsCfg.Credentials != nil {
+					t.Error("credentials set, want the SDK's default chain")
+				}
+				return
+			}
+			if awsCfg.Credentials == nil {
+				t.Fatal("no credentials, want the configured keys")
+			}
+			value, err := awsCfg.Credentials.Get()
+			if err != nil {
+				t.Fatalf("Credentials.Get: %v", err)
+			}
+			if value.AccessKeyID != tt.cfg.AWSAccessKeyID || value.SecretAccessKey != tt.cfg.AWSSecretAccessKey {
+				t.Errorf("credentials = %q, want the configured keys", value.AccessKeyID)
+			}
+		})
+	}
+}
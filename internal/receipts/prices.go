@@ -0,0 +1,353 @@
+package receipts
+
+import (
+	"database/sql"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mauroue/cereja-corp/internal/auth"
+)
+
+// PricePoint is the normalized price paid for an item on one receipt. Chain is
+// the store's chain, or the store name for stores without one. Price is in the
+// base currency, converted from OriginalPrice in the receipt's Currency;
+// without a known exchange rate the point is not Converted.
+type PricePoint struct {
+	ReceiptID     int64     `json:"receipt_id"`
+	PurchaseDate  time.Time `json:"purchase_date"`
+	StoreName     string    `json:"store_name"`
+	Chain         string    `json:"chain"`
+	ItemName      string    `json:"item_name"`
+	Price         float64   `json:"price"`
+	Currency      string    `json:"currency"`
+	OriginalPrice float64   `json:"original_price"`
+	BaseUnit      string    `json:"base_unit"`
+	Converted     bool      `json:"-"`
+}
+
+// StorePriceSeries holds the price timeline of a product at a single store
+type StorePriceSeries struct {
+	StoreName string        `json:"store_name"`
+	LastPrice float64       `json:"last_price"`
+	LastDate  time.Time     `json:"last_date"`
+	Points    []*PricePoint `json:"points"`
+}
+
+// PriceHistory summarises the prices paid for a product across stores and time,
+// in the base currency. The changes compare the latest price with an older one
+// paid at the same chain, ChangeChain, so switching stores does not show up as
+// a price change. Prices without a known exchange rate are left out and
+// counted as Unconverted.
+type PriceHistory struct {
+	Product     string              `json:"product"`
+	Currency    string              `json:"currency"`
+	BaseUnit    string              `json:"base_unit"`
+	Count       int                 `json:"count"`
+	Unconverted int                 `json:"unconverted"`
+	Min         float64             `json:"min"`
+	Median      float64             `json:"median"`
+	Max         float64             `json:"max"`
+	ChangeChain string              `json:"change_chain,omitempty"`
+	Change30    *float64            `json:"change_30d"`
+	Change90    *float64            `json:"change_90d"`
+	Change365   *float64            `json:"change_365d"`
+	Stores      []*StorePriceSeries `json:"stores"`
+}
+
+// GetPricePoints retrieves the normalized prices the user paid for items whose
+// name matches product, converted to the base currency with the rate of each
+// purchase date
+func (r *Repository) GetPricePoints(userID int64, product string) ([]*PricePoint, error) {
+	query := `
+		SELECT r.id, r.purchase_date, r.store_name, COALESCE(NULLIF(s.chain, ''), r.store_name),
+			ri.name, ri.normalized_unit_price, r.currency,
+			ri.normalized_unit_price * exchange_rate(r.user_id, r.currency, $3, r.purchase_date::date),
+			ri.base_unit
+		FROM receipt_items ri
+		JOIN receipts r ON r.id = ri.receipt_id
+		LEFT JOIN stores s ON s.id = r.store_id
+		WHERE ri.name ILIKE $1 ESCAPE '\' AND ri.normalized_unit_price > 0 AND r.user_id = $2
+		ORDER BY r.purchase_date, r.id
+	`
+
+	rows, err := r.db.Query(query, containsPattern(product), userID, baseCurrency())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var points []*PricePoint
+	for rows.Next() {
+		var p PricePoint
+		var converted sql.NullFloat64
+		if err := rows.Scan(
+			&p.ReceiptID,
+			&p.PurchaseDate,
+			&p.StoreName,
+			&p.Chain,
+			&p.ItemName,
+			&p.OriginalPrice,
+			&p.Currency,
+			&converted,
+			&p.BaseUnit,
+		); err != nil {
+			return nil, err
+		}
+		p.Price, p.Converted = converted.Float64, converted.Valid
+		points = append(points, &p)
+	}
+
+	return points, rows.Err()
+}
+
+// buildPriceHistory groups price points by store and computes summary statistics.
+// Prices are only comparable within one base unit and currency, so points in
+// any other unit than the most common one, and points that could not be
+// converted to the base currency, are left out.
+func buildPriceHistory(product string, points []*PricePoint, now time.Time) *PriceHistory {
+	history := &PriceHistory{Product: product, Currency: baseCurrency(), Stores: []*StorePriceSeries{}}
+
+	var converted []*PricePoint
+	for _, p := range points {
+		if !p.Converted {
+			history.Unconverted++
+			continue
+		}
+		converted = append(converted, p)
+	}
+	points = converted
+
+	unitCounts := map[string]int{}
+	for _, p := range points {
+		unitCounts[p.BaseUnit]++
+		if unitCounts[p.BaseUnit] > unitCounts[history.BaseUnit] {
+			history.BaseUnit = p.BaseUnit
+		}
+	}
+
+	var prices []float64
+	var comparable []*PricePoint
+	byStore := map[string]*StorePriceSeries{}
+	for _, p := range points {
+		if p.BaseUnit != history.BaseUnit {
+			continue
+		}
+		comparable = append(comparable, p)
+		prices = append(prices, p.Price)
+
+		series, ok := byStore[p.StoreName]
+		if !ok {
+			series = &StorePriceSeries{StoreName: p.StoreName}
+			byStore[p.StoreName] = series
+			history.Stores = append(history.Stores, series)
+		}
+		series.Points = append(series.Points, p)
+		series.LastPrice = p.Price
+		series.LastDate = p.PurchaseDate
+	}
+
+	history.Count = len(prices)
+	if len(prices) == 0 {
+		return history
+	}
+
+	sort.Float64s(prices)
+	history.Min = prices[0]
+	history.Max = prices[len(prices)-1]
+	if mid := len(prices) / 2; len(prices)%2 == 0 {
+		history.Median = (prices[mid-1] + prices[mid]) / 2
+	} else {
+		history.Median = prices[mid]
+	}
+
+	// Changes are measured at the chain of the latest purchase
+	latest := comparable[len(comparable)-1]
+	var sameChain []*PricePoint
+	for _, p := range comparable {
+		if p.Chain == latest.Chain {
+			sameChain = append(sameChain, p)
+		}
+	}
+	history.ChangeChain = latest.Chain
+	history.Change30 = priceChange(sameChain, latest.Price, now.AddDate(0, 0, -30))
+	history.Change90 = priceChange(sameChain, latest.Price, now.AddDate(0, 0, -90))
+	history.Change365 = priceChange(sameChain, latest.Price, now.AddDate(-1, 0, 0))
+
+	return history
+}
+
+// priceChange returns the percentage change from the last price paid on or
+// before since to latest, or nil when there is no price that old. The points
+// must all be from the same chain.
+func priceChange(points []*PricePoint, latest float64, since time.Time) *float64 {
+	var reference *PricePoint
+	for _, p := range points {
+		if p.PurchaseDate.After(since) {
+			break
+		}
+		reference = p
+	}
+	if reference == nil || reference.Price == 0 {
+		return nil
+	}
+
+	change := (latest - reference.Price) / reference.Price * 100
+	return &change
+}
+
+// GetPriceHistory handles retrieval of a product's price timeline
+func (h *Handler) GetPriceHistory(c *gin.Context) {
+	product := strings.TrimSpace(c.Query("product"))
+	if product == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Query parameter 'product' is required"})
+		return
+	}
+
+	points, err := h.repo.GetPricePoints(auth.UserID(c), product)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve price history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, buildPriceHistory(product, points, time.Now()))
+}
+
+// PricesPage renders the price history page
+func (h *WebHandler) PricesPage(c *gin.Context) {
+	product := c.Query("product")
+
+	// Load the history straight away when arriving from a receipt item link
+	trigger := "submit"
+	if product != "" {
+		trigger = "submit, load"
+	}
+
+	content := fmt.Sprintf(`
+<div class="card">
+    <div class="card-header">
+        <h1 class="card-title">Price History</h1>
+    </div>
+
+    <form hx-get="/receipts-web/htmx/prices"
+          hx-target="#price-history"
+          hx-trigger="%s"
+          hx-indicator="#prices-loading"
+          class="search-form">
+        <div class="form-group">
+            <label for="product">Product</label>
+            <input type="text" id="product" name="product" value="%s" placeholder="e.g. tomate, leite, arroz" required>
+        </div>
+        <button type="submit" class="btn btn-primary">Show History</button>
+    </form>
+
+    <div id="prices-loading" class="loading-spinner htmx-indicator"></div>
+    <div id="price-history" class="mt-3"></div>
+</div>
+`, trigger, template.HTMLEscapeString(product))
+
+	page := renderPageWithLayout("Price History", content)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(page))
+}
+
+// HtmxPriceHistory returns the price chart and statistics for HTMX
+func (h *WebHandler) HtmxPriceHistory(c *gin.Context) {
+	product := strings.TrimSpace(c.Query("product"))
+	if product == "" {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Please enter a product name")))
+		return
+	}
+
+	points, err := h.repo.GetPricePoints(auth.UserID(c), product)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Failed to retrieve price history")))
+		return
+	}
+
+	history := buildPriceHistory(product, points, time.Now())
+	unconverted := ""
+	if history.Unconverted > 0 {
+		unconverted = fmt.Sprintf(`<p>%d prices are left out until an <a href="/receipts-web/exchange-rates">exchange rate</a> to %s is known.</p>`,
+			history.Unconverted, history.Currency)
+	}
+	if history.Count == 0 {
+		c.Data(http.StatusOK, "text/html", []byte(`<p>No prices found for this product.</p>`+unconverted))
+		return
+	}
+
+	perUnit := func(v float64) string {
+		return formatCurrency(v) + "/" + history.BaseUnit
+	}
+
+	var series []chartSeries
+	for _, store := range history.Stores {
+		s := chartSeries{Label: store.StoreName}
+		for _, p := range store.Points {
+			s.Points = append(s.Points, chartPoint{X: p.PurchaseDate, Y: p.Price})
+		}
+		series = append(series, s)
+	}
+
+	var out strings.Builder
+	out.WriteString(renderLineChart(series, 720, 300, perUnit))
+
+	out.WriteString(fmt.Sprintf(`
+	<dl class="receipt-info mt-3">
+		<dt>Minimum:</dt>
+		<dd>%s</dd>
+		<dt>Median:</dt>
+		<dd>%s</dd>
+		<dt>Maximum:</dt>
+		<dd>%s</dd>
+		<dt>Changes at:</dt>
+		<dd>%s</dd>
+		<dt>Change (30 days):</dt>
+		<dd>%s</dd>
+		<dt>Change (90 days):</dt>
+		<dd>%s</dd>
+		<dt>Change (365 days):</dt>
+		<dd>%s</dd>
+	</dl>
+	`,
+		perUnit(history.Min),
+		perUnit(history.Median),
+		perUnit(history.Max),
+		template.HTMLEscapeString(history.ChangeChain),
+		formatPercentChange(history.Change30),
+		formatPercentChange(history.Change90),
+		formatPercentChange(history.Change365)))
+
+	out.WriteString(`<div class="table-responsive"><table class="table"><thead><tr><th>Store</th><th>Last Price</th><th>Last Paid</th><th>Purchases</th></tr></thead><tbody>`)
+	for _, store := range history.Stores {
+		out.WriteString(fmt.Sprintf(`
+		<tr>
+			<td>%s</td>
+			<td>%s</td>
+			<td>%s</td>
+			<td>%d</td>
+		</tr>
+		`, template.HTMLEscapeString(store.StoreName), perUnit(store.LastPrice), formatDate(store.LastDate), len(store.Points)))
+	}
+	out.WriteString(`</tbody></table></div>`)
+	out.WriteString(unconverted)
+
+	c.Data(http.StatusOK, "text/html", []byte(out.String()))
+}
+
+// priceHistoryURL returns the price history page URL for a product
+func priceHistoryURL(product string) string {
+	return "/receipts-web/prices?product=" + url.QueryEscape(product)
+}
+
+// formatPercentChange formats an optional percentage change with its sign
+func formatPercentChange(change *float64) string {
+	if change == nil {
+		return "n/a"
+	}
+	return fmt.Sprintf("%+.1f%%", *change)
+}
@@ -0,0 +1,113 @@
+package receipts
+
+import (
+	"testing"
+	"time"
+)
+
+func TestContainsPattern(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"leite", "%leite%"},
+		{"100%", `%100\%%`},
+		{"a_b", `%a\_b%`},
+		{`c:\x`, `%c:\\x%`},
+		{"", "%%"},
+	}
+
+	for _, tt := range tests {
+		if got := containsPattern(tt.in); got != tt.want {
+			t.Errorf("containsPattern(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestBuildPriceHistory(t *testing.T) {
+	now := time.Date(2024, 6, 30, 12, 0, 0, 0, time.UTC)
+	day := func(daysAgo int) time.Time { return now.AddDate(0, 0, -daysAgo) }
+	point := func(daysAgo int, store, chain string, price float64, unit string) *PricePoint {
+		return &PricePoint{PurchaseDate: day(daysAgo), StoreName: store, Chain: chain, Price: price, BaseUnit: unit, Converted: true}
+	}
+	// A price in a currency without a known exchange rate, which would
+	// otherwise be the latest and most expensive one
+	unconverted := &PricePoint{PurchaseDate: day(0), StoreName: "Mercado B", Chain: "Mercado B", OriginalPrice: 1.5, Currency: "USD", BaseUnit: UnitLiter}
+
+	points := []*PricePoint{
+		point(400, "Mercado A Centro", "Mercado A", 4, UnitLiter),
+		point(100, "Mercado B", "Mercado B", 2, UnitLiter),
+		point(60, "Mercado A Bairro", "Mercado A", 5, UnitLiter),
+		point(50, "Mercado B", "Mercado B", 3, UnitKilogram),
+		point(10, "Mercado B", "Mercado B", 2.5, UnitLiter),
+		point(1, "Mercado A Centro", "Mercado A", 6, UnitLiter),
+		unconverted,
+	}
+
+	history := buildPriceHistory("leite", points, now)
+
+	if history.BaseUnit != UnitLiter || history.Count != 5 {
+		t.Fatalf("base unit %q with %d points, want %q with 5", history.BaseUnit, history.Count, UnitLiter)
+	}
+	if history.Unconverted != 1 || history.Currency != baseCurrency() {
+		t.Errorf("%d unconverted prices in %q, want 1 in %q", history.Unconverted, history.Currency, baseCurrency())
+	}
+	if history.Min != 2 || history.Median != 4 || history.Max != 6 {
+		t.Errorf("min/median/max = %v/%v/%v, want 2/4/6", history.Min, history.Median, history.Max)
+	}
+	if len(history.Stores) != 3 {
+		t.Errorf("got %d store series, want 3", len(history.Stores))
+	}
+
+	// The latest price is at Mercado A, so Mercado B's cheaper prices are not
+	// compared against it
+	if history.ChangeChain != "Mercado A" {
+		t.Errorf("change chain = %q, want Mercado A", history.ChangeChain)
+	}
+	changes := []struct {
+		name string
+		got  *float64
+		want float64
+	}{
+		{"30 days", history.Change30, 20},
+		{"90 days", history.Change90, 50},
+		{"365 days", history.Change365, 50},
+	}
+	for _, c := range changes {
+		if c.got == nil || !approx(*c.got, c.want) {
+			t.Errorf("change over %s = %v, want %v", c.name, c.got, c.want)
+		}
+	}
+}
+
+func TestPriceChange(t *testing.T) {
+	since := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	before := since.AddDate(0, 0, -1)
+	after := since.AddDate(0, 0, 1)
+
+	tests := []struct {
+		name   string
+		points []*PricePoint
+		latest float64
+		want   *float64
+	}{
+		{"no points", nil, 5, nil},
+		{"only newer points", []*PricePoint{{PurchaseDate: after, Price: 4}}, 5, nil},
+		{"zero reference", []*PricePoint{{PurchaseDate: before, Price: 0}}, 5, nil},
+		{"increase", []*PricePoint{{PurchaseDate: before, Price: 4}, {PurchaseDate: after, Price: 1}}, 5, ptr(25.0)},
+		{"decrease", []*PricePoint{{PurchaseDate: since, Price: 10}}, 5, ptr(-50.0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := priceChange(tt.points, tt.latest, since)
+			if (got == nil) != (tt.want == nil) || (got != nil && !approx(*got, *tt.want)) {
+				t.Errorf("priceChange = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// ptr returns a pointer to v
+func ptr[T any](v T) *T {
+	return &v
+}
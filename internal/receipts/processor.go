@@ -0,0 +1,226 @@
+package receipts
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mauroue/cereja-corp/config"
+	"github.com/mauroue/cereja-corp/internal/models"
+)
+
+// receiptImageExtensions are the file types accepted as receipt images
+var receiptImageExtensions = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".bmp": true, ".pdf": true}
+
+// IsReceiptImage reports whether a file name has a receipt image extension
+func IsReceiptImage(name string) bool {
+	return receiptImageExtensions[strings.ToLower(filepath.Ext(name))]
+}
+
+// IsReceiptFile reports whether a file can be ingested: a receipt image or an
+// NFC-e XML document
+func IsReceiptFile(name string) bool {
+	return IsReceiptImage(name) || IsNFCeFile(name)
+}
+
+// Processor turns receipt images into stored receipts. It is shared by the
+// upload handlers and the command line.
+type Processor struct {
+	repo *Repository
+	ocr  *OCRService
+}
+
+// NewProcessor creates a processor storing images in uploadDir and running
+// OCR with the configured AWS credentials
+func NewProcessor(repo *Repository, uploadDir string) *Processor {
+	return &Processor{repo: repo, ocr: NewOCRService(uploadDir, config.Get().OCR)}
+}
+
+// Repository returns the repository receipts are stored with
+func (p *Processor) Repository() *Repository {
+	return p.repo
+}
+
+// Ingest stores a receipt and its items for the user, in the given currency
+// or the base currency if empty. Images are saved and run through OCR, and
+// removed again if OCR fails; NFC-e XML documents are read directly and not
+// kept. Analytics are not refreshed; callers do so once they are done.
+func (p *Processor) Ingest(userID int64, data []byte, filename, currency string) (*models.Receipt, []*models.ReceiptItem, error) {
+	if currency != "" {
+		var err error
+		if currency, err = normalizeCurrency(currency); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var receipt *models.Receipt
+	var items []*models.ReceiptItem
+	if IsNFCeFile(filename) {
+		var err error
+		if receipt, items, err = ParseNFCe(bytes.NewReader(data)); err != nil {
+			return nil, nil, fmt.Errorf("error reading NFC-e: %w", err)
+		}
+	} else {
+		imagePath, err := p.ocr.SaveImage(data, filename)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if receipt, items, err = p.ocr.ProcessReceipt(imagePath); err != nil {
+			os.Remove(imagePath)
+			return nil, nil, fmt.Errorf("error processing receipt: %w", err)
+		}
+	}
+
+	// Match the vendor name to a store
+	var err error
+	receipt.StoreID, err = p.repo.FindOrCreateStore(userID, receipt.StoreName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to ensure store exists: %w", err)
+	}
+
+	receipt.UserID = userID
+	receipt.Currency = currency
+	receipt.ID, err = p.repo.CreateReceipt(receipt)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to save receipt: %w", err)
+	}
+
+	for _, item := range items {
+		item.ReceiptID = receipt.ID
+		if item.ID, err = p.repo.CreateReceiptItem(item); err != nil {
+			return nil, nil, fmt.Errorf("failed to save receipt items: %w", err)
+		}
+	}
+
+	return receipt, items, nil
+}
+
+// Reprocess re-runs OCR on a stored receipt's image and replaces its store,
+// date, total and items. The currency, category, tags and note are kept and
+// the receipt goes back to pending review. Item tags and warranties go with
+// the old items.
+func (p *Processor) Reprocess(receipt *models.Receipt) ([]*models.ReceiptItem, error) {
+	if receipt.ImagePath == "" {
+		return nil, fmt.Errorf("receipt %d has no image", receipt.ID)
+	}
+
+	parsed, items, err := p.ocr.ProcessReceipt(receipt.ImagePath)
+	if err != nil {
+		return nil, fmt.Errorf("error processing receipt %d: %w", receipt.ID, err)
+	}
+
+	storeID, err := p.repo.FindOrCreateStore(receipt.UserID, parsed.StoreName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to ensure store exists: %w", err)
+	}
+
+	receipt.StoreID = storeID
+	receipt.StoreName = parsed.StoreName
+	receipt.PurchaseDate = parsed.PurchaseDate
+	receipt.TotalAmount = parsed.TotalAmount
+	receipt.ReviewStatus = ReviewPending
+	if err := p.repo.ReplaceReceiptContents(receipt, items); err != nil {
+		return nil, fmt.Errorf("failed to save receipt %d: %w", receipt.ID, err)
+	}
+	return items, nil
+}
+
+// ReceiptsInRange returns the receipts with IDs from fromID to toID, either
+// bound being 0 for none, of the user or of every user when userID is 0
+func (r *Repository) ReceiptsInRange(userID, fromID, toID int64) ([]*models.Receipt, error) {
+	rows, err := r.db.Query(`
+		SELECT `+receiptColumns+`
+		FROM `+receiptTables+`
+		WHERE ($1 = 0 OR r.user_id = $1) AND ($2 = 0 OR r.id >= $2) AND ($3 = 0 OR r.id <= $3)
+		ORDER BY r.id
+	`, userID, fromID, toID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var receipts []*models.Receipt
+	for rows.Next() {
+		receipt, err := scanReceipt(rows)
+		if err != nil {
+			return nil, err
+		}
+		receipts = append(receipts, receipt)
+	}
+	return receipts, rows.Err()
+}
+
+// ReplaceReceiptContents replaces a receipt's store, date, total, review
+// status and items in one transaction
+func (r *Repository) ReplaceReceiptContents(receipt *models.Receipt, items []*models.ReceiptItem) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	receipt.UpdatedAt = time.Now()
+	if _, err := tx.Exec(`
+		UPDATE receipts
+		SET store_id = $1, store_name = $2, purchase_date = $3, total_amount = $4, review_status = $5, updated_at = $6
+		WHERE id = $7
+	`, receipt.StoreID, receipt.StoreName, receipt.PurchaseDate, receipt.TotalAmount, receipt.ReviewStatus,
+		receipt.UpdatedAt, receipt.ID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM receipt_items WHERE receipt_id = $1`, receipt.ID); err != nil {
+		return err
+	}
+	for _, item := range items {
+		item.ReceiptID = receipt.ID
+		if item.ID, err = insertReceiptItem(tx, item); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// RenormalizeItems parses the units of a receipt's items again, without OCR,
+// and returns the number of items updated
+func (r *Repository) RenormalizeItems(receiptID int64) (int, error) {
+	rows, err := r.db.Query(`
+		SELECT id, name, quantity, unit, unit_price, total_price
+		FROM receipt_items
+		WHERE receipt_id = $1
+	`, receiptID)
+	if err != nil {
+		return 0, err
+	}
+
+	var items []*models.ReceiptItem
+	for rows.Next() {
+		var item models.ReceiptItem
+		if err := rows.Scan(&item.ID, &item.Name, &item.Quantity, &item.Unit, &item.UnitPrice, &item.TotalPrice); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		items = append(items, &item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, item := range items {
+		NormalizeItemUnits(item)
+		if _, err := r.db.Exec(`
+			UPDATE receipt_items
+			SET quantity = $1, unit = $2, base_unit = $3, base_quantity = $4, normalized_unit_price = $5, updated_at = NOW()
+			WHERE id = $6
+		`, item.Quantity, item.Unit, item.BaseUnit, item.BaseQuantity, item.NormalizedUnitPrice, item.ID); err != nil {
+			return 0, err
+		}
+	}
+	return len(items), nil
+}
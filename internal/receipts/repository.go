@@ -2,14 +2,26 @@ package receipts
 
 import (
 	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/lib/pq"
 	"github.com/mauroue/cereja-corp/internal/models"
 )
 
 // Repository handles database operations for receipts
 type Repository struct {
-	db *sql.DB
+	db        *sql.DB
+	refreshMu sync.Mutex
+	// refreshState guards refreshing, set while a background refresh runs,
+	// and refreshQueued, set when another refresh must follow it
+	refreshState  sync.Mutex
+	refreshing    bool
+	refreshQueued bool
+	// background tracks the analytics refreshes still running after their request
+	background sync.WaitGroup
 }
 
 // NewRepository creates a new receipt repository
@@ -17,14 +29,63 @@ func NewRepository(db *sql.DB) *Repository {
 	return &Repository{db: db}
 }
 
-// CreateReceipt inserts a new receipt into the database
+// receiptColumns lists the receipt columns read by scanReceipt, selected from receiptTables
+const receiptColumns = `
+	r.id, COALESCE(r.user_id, 0), COALESCE(r.store_id, 0), r.store_name, r.purchase_date, r.total_amount, r.currency, COALESCE(r.image_path, ''),
+	r.category_id, COALESCE(c.name, ''), r.review_status, r.import_batch_id, r.note, ` + receiptTagsColumn + `,
+	r.created_at, r.updated_at`
+
+// receiptTables joins receipts with the tables needed by receiptColumns
+const receiptTables = `receipts r LEFT JOIN categories c ON c.id = r.category_id`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanReceipt scans a row selected with receiptColumns, followed by any extra columns
+func scanReceipt(row rowScanner, extra ...interface{}) (*models.Receipt, error) {
+	var receipt models.Receipt
+	dest := []interface{}{
+		&receipt.ID,
+		&receipt.UserID,
+		&receipt.StoreID,
+		&receipt.StoreName,
+		&receipt.PurchaseDate,
+		&receipt.TotalAmount,
+		&receipt.Currency,
+		&receipt.ImagePath,
+		&receipt.CategoryID,
+		&receipt.CategoryName,
+		&receipt.ReviewStatus,
+		&receipt.ImportBatchID,
+		&receipt.Note,
+		pq.Array(&receipt.Tags),
+		&receipt.CreatedAt,
+		&receipt.UpdatedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	return &receipt, nil
+}
+
+// CreateReceipt inserts a new receipt owned by receipt.UserID into the database
 func (r *Repository) CreateReceipt(receipt *models.Receipt) (int64, error) {
 	query := `
-		INSERT INTO receipts (store_id, store_name, purchase_date, total_amount, image_path, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		INSERT INTO receipts (user_id, store_id, store_name, purchase_date, total_amount, currency, image_path,
+			category_id, review_status, import_batch_id, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 		RETURNING id
 	`
 
+	if receipt.ReviewStatus == "" {
+		receipt.ReviewStatus = ReviewPending
+	}
+	if receipt.Currency == "" {
+		receipt.Currency = baseCurrency()
+	}
+
 	now := time.Now()
 	receipt.CreatedAt = now
 	receipt.UpdatedAt = now
@@ -32,11 +93,16 @@ func (r *Repository) CreateReceipt(receipt *models.Receipt) (int64, error) {
 	var id int64
 	err := r.db.QueryRow(
 		query,
+		receipt.UserID,
 		receipt.StoreID,
 		receipt.StoreName,
 		receipt.PurchaseDate,
 		receipt.TotalAmount,
+		receipt.Currency,
 		receipt.ImagePath,
+		receipt.CategoryID,
+		receipt.ReviewStatus,
+		receipt.ImportBatchID,
 		receipt.CreatedAt,
 		receipt.UpdatedAt,
 	).Scan(&id)
@@ -46,25 +112,50 @@ func (r *Repository) CreateReceipt(receipt *models.Receipt) (int64, error) {
 
 // CreateReceiptItem inserts a new receipt item into the database
 func (r *Repository) CreateReceiptItem(item *models.ReceiptItem) (int64, error) {
+	return insertReceiptItem(r.db, item)
+}
+
+// likeEscaper escapes the LIKE wildcards, and the escape character itself
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// containsPattern returns a pattern for "ILIKE $n ESCAPE '\'" matching values
+// that contain s literally, so "%" and "_" typed by a user are not wildcards
+func containsPattern(s string) string {
+	return "%" + likeEscaper.Replace(s) + "%"
+}
+
+// insertReceiptItem inserts a receipt item with the database or a transaction
+func insertReceiptItem(q interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}, item *models.ReceiptItem) (int64, error) {
 	query := `
-		INSERT INTO receipt_items (receipt_id, name, description, quantity, unit_price, total_price, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		INSERT INTO receipt_items (receipt_id, name, description, quantity, unit, unit_price, total_price,
+			base_unit, base_quantity, normalized_unit_price, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 		RETURNING id
 	`
 
+	if item.BaseUnit == "" {
+		NormalizeItemUnits(item)
+	}
+
 	now := time.Now()
 	item.CreatedAt = now
 	item.UpdatedAt = now
 
 	var id int64
-	err := r.db.QueryRow(
+	err := q.QueryRow(
 		query,
 		item.ReceiptID,
 		item.Name,
 		item.Description,
 		item.Quantity,
+		item.Unit,
 		item.UnitPrice,
 		item.TotalPrice,
+		item.BaseUnit,
+		item.BaseQuantity,
+		item.NormalizedUnitPrice,
 		item.CreatedAt,
 		item.UpdatedAt,
 	).Scan(&id)
@@ -72,43 +163,108 @@ func (r *Repository) CreateReceiptItem(item *models.ReceiptItem) (int64, error)
 	return id, err
 }
 
-// GetReceiptByID retrieves a receipt by its ID
-func (r *Repository) GetReceiptByID(id int64) (*models.Receipt, error) {
+// GetReceiptByID retrieves a receipt of the user by its ID
+func (r *Repository) GetReceiptByID(userID, id int64) (*models.Receipt, error) {
+	query := `SELECT ` + receiptColumns + ` FROM ` + receiptTables + ` WHERE r.id = $1 AND r.user_id = $2`
+
+	return scanReceipt(r.db.QueryRow(query, id, userID))
+}
+
+// UpdateReceipt applies a partial update to a receipt and returns the updated
+// receipt, and whether the update confirmed a receipt that was not confirmed
+// before. A new store name moves the receipt to the user's store of that name,
+// created if needed. It returns ErrCategoryNotFound if the category is not the
+// user's.
+func (r *Repository) UpdateReceipt(userID, id int64, update *ReceiptUpdate) (*models.Receipt, bool, error) {
 	query := `
-		SELECT id, store_id, store_name, purchase_date, total_amount, image_path, created_at, updated_at
-		FROM receipts
-		WHERE id = $1
+		WITH previous AS (
+			SELECT id, review_status FROM receipts WHERE id = $10 AND user_id = $11 FOR UPDATE
+		)
+		UPDATE receipts r SET
+			store_name = COALESCE($1, r.store_name),
+			store_id = COALESCE($12, r.store_id),
+			purchase_date = COALESCE($2, r.purchase_date),
+			total_amount = COALESCE($3, r.total_amount),
+			category_id = CASE WHEN $4 THEN $5 ELSE r.category_id END,
+			review_status = COALESCE($6, r.review_status),
+			currency = COALESCE($7, r.currency),
+			note = COALESCE($8, r.note),
+			updated_at = $9
+		FROM previous
+		WHERE r.id = previous.id
+		RETURNING previous.review_status
 	`
 
-	var receipt models.Receipt
-	err := r.db.QueryRow(query, id).Scan(
-		&receipt.ID,
-		&receipt.StoreID,
-		&receipt.StoreName,
-		&receipt.PurchaseDate,
-		&receipt.TotalAmount,
-		&receipt.ImagePath,
-		&receipt.CreatedAt,
-		&receipt.UpdatedAt,
-	)
+	var categoryID *int64
+	clearCategory := update.CategoryID != nil
+	if clearCategory && *update.CategoryID > 0 {
+		categoryID = update.CategoryID
+	}
 
+	tx, err := r.db.Begin()
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
+	defer tx.Rollback()
 
-	return &receipt, nil
+	if err := checkCategory(tx, userID, categoryID); err != nil {
+		return nil, false, err
+	}
+
+	var storeID *int64
+	if update.StoreName != nil {
+		store, _, err := findOrCreateStore(tx, userID, *update.StoreName)
+		if err != nil {
+			return nil, false, err
+		}
+		storeID = &store
+	}
+
+	var previousStatus string
+	err = tx.QueryRow(
+		query,
+		update.StoreName,
+		update.PurchaseDate,
+		update.TotalAmount,
+		clearCategory,
+		categoryID,
+		update.ReviewStatus,
+		update.Currency,
+		update.Note,
+		time.Now(),
+		id,
+		userID,
+		storeID,
+	).Scan(&previousStatus)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, false, err
+	}
+
+	receipt, err := r.GetReceiptByID(userID, id)
+	if err != nil {
+		return nil, false, err
+	}
+	return receipt, previousStatus != ReviewConfirmed && receipt.ReviewStatus == ReviewConfirmed, nil
 }
 
-// GetReceiptItems retrieves all items for a specific receipt
-func (r *Repository) GetReceiptItems(receiptID int64) ([]*models.ReceiptItem, error) {
+// GetReceiptItems retrieves all items for a specific receipt of the user
+func (r *Repository) GetReceiptItems(userID, receiptID int64) ([]*models.ReceiptItem, error) {
 	query := `
-		SELECT id, receipt_id, name, description, quantity, unit_price, total_price, created_at, updated_at
-		FROM receipt_items
-		WHERE receipt_id = $1
-		ORDER BY id
+		SELECT ri.id, ri.receipt_id, ri.name, ri.description, ri.quantity, ri.unit, ri.unit_price, ri.total_price,
+			ri.base_unit, ri.base_quantity, ri.normalized_unit_price, ri.created_at, ri.updated_at,
+			` + itemTagsColumn + `, r.store_name, r.purchase_date, w.duration_months, w.serial_number, ` + warrantyExpiry + `,
+			w.created_at, w.updated_at
+		FROM receipt_items ri
+		JOIN receipts r ON r.id = ri.receipt_id
+		LEFT JOIN warranties w ON w.item_id = ri.id
+		WHERE ri.receipt_id = $1 AND r.user_id = $2
+		ORDER BY ri.id
 	`
 
-	rows, err := r.db.Query(query, receiptID)
+	rows, err := r.db.Query(query, receiptID, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -117,72 +273,119 @@ func (r *Repository) GetReceiptItems(receiptID int64) ([]*models.ReceiptItem, er
 	var items []*models.ReceiptItem
 	for rows.Next() {
 		var item models.ReceiptItem
+		var storeName string
+		var purchaseDate time.Time
+		var months sql.NullInt64
+		var serial sql.NullString
+		var expires, warrantyCreated, warrantyUpdated sql.NullTime
 		if err := rows.Scan(
 			&item.ID,
 			&item.ReceiptID,
 			&item.Name,
 			&item.Description,
 			&item.Quantity,
+			&item.Unit,
 			&item.UnitPrice,
 			&item.TotalPrice,
+			&item.BaseUnit,
+			&item.BaseQuantity,
+			&item.NormalizedUnitPrice,
 			&item.CreatedAt,
 			&item.UpdatedAt,
+			pq.Array(&item.Tags),
+			&storeName,
+			&purchaseDate,
+			&months,
+			&serial,
+			&expires,
+			&warrantyCreated,
+			&warrantyUpdated,
 		); err != nil {
 			return nil, err
 		}
+		if months.Valid {
+			item.Warranty = &models.Warranty{
+				ItemID:         item.ID,
+				ReceiptID:      item.ReceiptID,
+				ItemName:       item.Name,
+				StoreName:      storeName,
+				PurchaseDate:   purchaseDate,
+				DurationMonths: int(months.Int64),
+				SerialNumber:   serial.String,
+				ExpiresOn:      expires.Time,
+				CreatedAt:      warrantyCreated.Time,
+				UpdatedAt:      warrantyUpdated.Time,
+			}
+		}
 		items = append(items, &item)
 	}
 
 	return items, rows.Err()
 }
 
-// EnsureDefaultStore creates a default store with ID 1 if it doesn't exist
-func (r *Repository) EnsureDefaultStore() error {
+// FindOrCreateStore returns the ID of the user's store with the given name, creating
+// it if needed. Store names are matched case-insensitively.
+func (r *Repository) FindOrCreateStore(userID int64, name string) (int64, error) {
+	id, _, err := findOrCreateStore(r.db, userID, name)
+	return id, err
+}
+
+// findOrCreateStore finds or creates a store with the database or a transaction,
+// reporting whether it was created
+func findOrCreateStore(q interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}, userID int64, name string) (int64, bool, error) {
 	query := `
-		INSERT INTO stores (id, name, address, created_at, updated_at)
-		VALUES (1, 'Sample Store', '123 Sample St, Sample City', $1, $2)
-		ON CONFLICT (id) DO NOTHING
+		INSERT INTO stores (user_id, name, created_at, updated_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, (LOWER(name))) DO UPDATE SET name = stores.name
+		RETURNING id, xmax = 0
 	`
 
 	now := time.Now()
-	_, err := r.db.Exec(query, now, now)
-	return err
+	var id int64
+	var created bool
+	err := q.QueryRow(query, userID, name, now, now).Scan(&id, &created)
+	return id, created, err
 }
 
-// ListReceipts retrieves receipts with pagination
-func (r *Repository) ListReceipts(page, pageSize int, search string) ([]*models.Receipt, error) {
-	// Default pagination values if not provided
-	if page < 1 {
-		page = 1
-	}
-	if pageSize < 1 {
-		pageSize = 10
-	}
+// ListReceipts retrieves one page of receipts matching the filter.
+// Pages are addressed by keyset cursors on (sort key, id) rather than offsets,
+// so paging stays stable and fast while receipts are being added.
+func (r *Repository) ListReceipts(filter *ReceiptFilter) (*ReceiptPage, error) {
+	filter.normalize()
+
+	where, args := filter.where()
+	sortExpr := sortExpressions[filter.Sort]
 
-	offset := (page - 1) * pageSize
+	cursor, err := decodeCursor(filter.Cursor)
+	if err != nil {
+		return nil, err
+	}
 
-	var query string
-	var args []interface{}
+	// Walking backwards flips both the keyset comparison and the ordering;
+	// the rows are reversed again below
+	descending := filter.Order == OrderDesc
+	if cursor != nil && cursor.Backward {
+		descending = !descending
+	}
+	direction, comparison := "ASC", ">"
+	if descending {
+		direction, comparison = "DESC", "<"
+	}
 
-	if search != "" {
-		query = `
-			SELECT id, store_id, store_name, purchase_date, total_amount, image_path, created_at, updated_at
-			FROM receipts
-			WHERE store_name ILIKE $1
-			ORDER BY purchase_date DESC
-			LIMIT $2 OFFSET $3
-		`
-		args = []interface{}{"%" + search + "%", pageSize, offset}
-	} else {
-		query = `
-			SELECT id, store_id, store_name, purchase_date, total_amount, image_path, created_at, updated_at
-			FROM receipts
-			ORDER BY purchase_date DESC
-			LIMIT $1 OFFSET $2
-		`
-		args = []interface{}{pageSize, offset}
+	conditions := where
+	if cursor != nil {
+		args = append(args, cursor.Key, cursor.ID)
+		conditions = append(conditions, fmt.Sprintf("(%s, r.id) %s ($%d::%s, $%d)",
+			sortExpr, comparison, len(args)-1, sortCasts[filter.Sort], len(args)))
 	}
 
+	args = append(args, filter.Limit+1)
+	query := fmt.Sprintf(`SELECT %s, (%s)::text FROM %s %s ORDER BY %s %s, r.id %s LIMIT $%d`,
+		receiptColumns, sortExpr, receiptTables, whereClause(conditions),
+		sortExpr, direction, direction, len(args))
+
 	rows, err := r.db.Query(query, args...)
 	if err != nil {
 		return nil, err
@@ -190,38 +393,63 @@ func (r *Repository) ListReceipts(page, pageSize int, search string) ([]*models.
 	defer rows.Close()
 
 	var receipts []*models.Receipt
+	var keys []string
 	for rows.Next() {
-		var receipt models.Receipt
-		if err := rows.Scan(
-			&receipt.ID,
-			&receipt.StoreID,
-			&receipt.StoreName,
-			&receipt.PurchaseDate,
-			&receipt.TotalAmount,
-			&receipt.ImagePath,
-			&receipt.CreatedAt,
-			&receipt.UpdatedAt,
-		); err != nil {
+		var key string
+		receipt, err := scanReceipt(rows, &key)
+		if err != nil {
 			return nil, err
 		}
-		receipts = append(receipts, &receipt)
+		receipts = append(receipts, receipt)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
-	return receipts, rows.Err()
-}
+	hasMore := len(receipts) > filter.Limit
+	if hasMore {
+		receipts = receipts[:filter.Limit]
+		keys = keys[:filter.Limit]
+	}
+	if cursor != nil && cursor.Backward {
+		for i, j := 0, len(receipts)-1; i < j; i, j = i+1, j-1 {
+			receipts[i], receipts[j] = receipts[j], receipts[i]
+			keys[i], keys[j] = keys[j], keys[i]
+		}
+	}
 
-// GetReceiptsCount returns the total number of receipts matching the search criteria
-func (r *Repository) GetReceiptsCount(search string) (int, error) {
-	var query string
-	var args []interface{}
+	page := &ReceiptPage{Receipts: receipts, Limit: filter.Limit}
+	if page.Receipts == nil {
+		page.Receipts = []*models.Receipt{}
+	}
 
-	if search != "" {
-		query = `SELECT COUNT(*) FROM receipts WHERE store_name ILIKE $1`
-		args = []interface{}{"%" + search + "%"}
-	} else {
-		query = `SELECT COUNT(*) FROM receipts`
+	// There is a next page when more rows follow going forward, or when we came
+	// back from one; likewise for the previous page
+	if len(receipts) > 0 {
+		first, last := 0, len(receipts)-1
+		forward := cursor == nil || !cursor.Backward
+		if (forward && hasMore) || (cursor != nil && cursor.Backward) {
+			page.NextCursor = encodeCursor(&pageCursor{Key: keys[last], ID: receipts[last].ID})
+		}
+		if (!forward && hasMore) || (cursor != nil && !cursor.Backward) {
+			page.PrevCursor = encodeCursor(&pageCursor{Key: keys[first], ID: receipts[first].ID, Backward: true})
+		}
 	}
 
+	page.Total, err = r.CountReceipts(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// CountReceipts returns the total number of receipts matching the filter, ignoring the cursor
+func (r *Repository) CountReceipts(filter *ReceiptFilter) (int, error) {
+	where, args := filter.where()
+	query := `SELECT COUNT(*) FROM ` + receiptTables + ` ` + whereClause(where)
+
 	var count int
 	err := r.db.QueryRow(query, args...).Scan(&count)
 
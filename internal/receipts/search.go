@@ -0,0 +1,237 @@
+package receipts
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/mauroue/cereja-corp/internal/models"
+)
+
+// searchConfig is the text search configuration created by the full-text search migration
+const searchConfig = "portuguese_unaccent"
+
+// Highlight markers returned by ts_headline. They are control characters so that
+// the text around them can be HTML-escaped before they are turned into <mark> tags.
+const (
+	highlightStart = "\x01"
+	highlightStop  = "\x02"
+)
+
+// SearchResult is a receipt matching a full-text search, with highlighted matches
+type SearchResult struct {
+	Receipt      *models.Receipt `json:"receipt"`
+	Rank         float64         `json:"rank"`
+	StoreName    string          `json:"store_name_highlight"`
+	MatchedItems []string        `json:"matched_items"`
+}
+
+// SearchPage is one page of ranked search results
+type SearchPage struct {
+	Query   string          `json:"query"`
+	Results []*SearchResult `json:"results"`
+	Total   int             `json:"total"`
+	Limit   int             `json:"limit"`
+	Offset  int             `json:"offset"`
+}
+
+// prefixQuery turns free text into a to_tsquery expression that requires every
+// word and matches the last one as a prefix, so results appear while typing.
+// It returns an empty string when the text has no searchable words.
+func prefixQuery(text string) string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return ""
+	}
+
+	words[len(words)-1] += ":*"
+	return strings.Join(words, " & ")
+}
+
+// searchCondition returns the SQL condition matching receipts by store name or
+// by any of their items' names and descriptions, for the tsquery in parameter n
+func searchCondition(n int) string {
+	return fmt.Sprintf(`(r.search_vector @@ to_tsquery('%[1]s', $%[2]d) OR EXISTS (
+		SELECT 1 FROM receipt_items ri
+		WHERE ri.receipt_id = r.id AND ri.search_vector @@ to_tsquery('%[1]s', $%[2]d)))`, searchConfig, n)
+}
+
+// SearchReceipts runs a ranked full-text search over store names, item names
+// and item descriptions. The filter's other conditions also apply.
+func (r *Repository) SearchReceipts(text string, filter *ReceiptFilter, offset int) (*SearchPage, error) {
+	filter.normalize()
+	if offset < 0 {
+		offset = 0
+	}
+
+	page := &SearchPage{Query: text, Results: []*SearchResult{}, Limit: filter.Limit, Offset: offset}
+
+	tsquery := prefixQuery(text)
+	if tsquery == "" {
+		return page, nil
+	}
+
+	// The filter's own search would repeat the full-text condition below
+	filter.Search = ""
+	conditions, args := filter.where()
+	args = append(args, tsquery)
+	queryParam := len(args)
+	conditions = append(conditions, searchCondition(queryParam))
+
+	options := fmt.Sprintf("StartSel=%s, StopSel=%s, HighlightAll=true", highlightStart, highlightStop)
+	args = append(args, options, filter.Limit, offset)
+
+	query := fmt.Sprintf(`
+		WITH q AS (SELECT to_tsquery('%[1]s', $%[2]d) AS query)
+		SELECT %[3]s,
+			ts_rank(r.search_vector, q.query) * 2 + COALESCE(matched.rank, 0) AS rank,
+			ts_headline('%[1]s', r.store_name, q.query, $%[4]d),
+			COALESCE(matched.items, '{}')
+		FROM q CROSS JOIN %[5]s
+		LEFT JOIN LATERAL (
+			SELECT SUM(ts_rank(ri.search_vector, q.query)) AS rank,
+				array_agg(ts_headline('%[1]s', ri.name, q.query, $%[4]d) ORDER BY ri.id) AS items
+			FROM receipt_items ri
+			WHERE ri.receipt_id = r.id AND ri.search_vector @@ q.query
+		) matched ON true
+		%[6]s
+		ORDER BY rank DESC, r.purchase_date DESC, r.id DESC
+		LIMIT $%[7]d OFFSET $%[8]d
+	`, searchConfig, queryParam, receiptColumns, queryParam+1, receiptTables,
+		whereClause(conditions), queryParam+2, queryParam+3)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var result SearchResult
+		var items pq.StringArray
+		result.Receipt, err = scanReceipt(rows, &result.Rank, &result.StoreName, &items)
+		if err != nil {
+			return nil, err
+		}
+
+		result.StoreName = highlightHTML(result.StoreName)
+		result.MatchedItems = make([]string, 0, len(items))
+		for _, item := range items {
+			result.MatchedItems = append(result.MatchedItems, highlightHTML(item))
+		}
+		page.Results = append(page.Results, &result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	countQuery := `SELECT COUNT(*) FROM ` + receiptTables + ` ` + whereClause(conditions)
+	if err := r.db.QueryRow(countQuery, args[:queryParam]...).Scan(&page.Total); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// highlightHTML escapes text returned by ts_headline and wraps the matches in <mark> tags
+func highlightHTML(s string) string {
+	s = template.HTMLEscapeString(s)
+	s = strings.ReplaceAll(s, highlightStart, "<mark>")
+	return strings.ReplaceAll(s, highlightStop, "</mark>")
+}
+
+// SearchReceipts handles ranked full-text search over receipts and their items
+func (h *Handler) SearchReceipts(c *gin.Context) {
+	text := strings.TrimSpace(c.Query("q"))
+	if text == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Query parameter 'q' is required"})
+		return
+	}
+
+	filter, err := filterFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	offset, err := queryInt(c, "offset")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := h.repo.SearchReceipts(text, filter, int(offset))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search receipts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// renderSearchResults renders ranked search results for the HTMX receipt list
+func renderSearchResults(page *SearchPage) string {
+	if len(page.Results) == 0 {
+		return `<p>No receipts match your search.</p>`
+	}
+
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf(`<p>%d receipts match "%s"</p>`, page.Total, template.HTMLEscapeString(page.Query)))
+	out.WriteString(`<div class="table-responsive"><table class="table"><thead><tr><th>Store</th><th>Date</th><th>Amount</th><th>Matching Items</th><th>Actions</th></tr></thead><tbody>`)
+
+	for _, result := range page.Results {
+		out.WriteString(fmt.Sprintf(`
+		<tr>
+			<td>%s</td>
+			<td>%s</td>
+			<td>%s</td>
+			<td>%s</td>
+			<td>
+				<a href="/receipts-web/view/%d" class="btn btn-sm btn-info">View</a>
+			</td>
+		</tr>
+		`,
+			result.StoreName,
+			formatDate(result.Receipt.PurchaseDate),
+			formatMoney(result.Receipt.TotalAmount, result.Receipt.Currency),
+			strings.Join(result.MatchedItems, "<br>"),
+			result.Receipt.ID))
+	}
+	out.WriteString(`</tbody></table></div>`)
+
+	// Ranked results are paged by offset; the filter form is included to keep the filters
+	pageButton := func(offset int, label string) string {
+		return fmt.Sprintf(`
+			<button class="btn btn-secondary"
+					hx-get="/receipts-web/htmx/receipts?offset=%d"
+					hx-include="#receipt-filters"
+					hx-target="#receipts-list">
+				%s
+			</button>
+			`, offset, label)
+	}
+
+	next := page.Offset + page.Limit
+	if page.Offset > 0 || next < page.Total {
+		out.WriteString(`<div class="mt-3 text-center">`)
+		if page.Offset > 0 {
+			prev := page.Offset - page.Limit
+			if prev < 0 {
+				prev = 0
+			}
+			out.WriteString(pageButton(prev, "Previous"))
+		}
+		if next < page.Total {
+			out.WriteString(pageButton(next, "Next"))
+		}
+		out.WriteString(`</div>`)
+	}
+
+	return out.String()
+}
@@ -0,0 +1,47 @@
+package receipts
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPrefixQuery(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"arroz", "arroz:*"},
+		{"  feijão preto ", "feijão & preto:*"},
+		{"leite 1l", "leite & 1l:*"},
+		{"pão & cia | (x) !y", "pão & cia & x & y:*"},
+		{"'; DROP TABLE receipts --", "DROP & TABLE & receipts:*"},
+		{"*:& |", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := prefixQuery(tt.text); got != tt.want {
+				t.Errorf("prefixQuery(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchCondition(t *testing.T) {
+	got := searchCondition(3)
+	if strings.Count(got, "$3") != 2 || strings.Contains(got, "$1") {
+		t.Errorf("searchCondition(3) = %s, want both matches on $3", got)
+	}
+	if !strings.Contains(got, "to_tsquery('"+searchConfig+"'") {
+		t.Errorf("searchCondition(3) = %s, want the %s configuration", got, searchConfig)
+	}
+}
+
+func TestHighlightHTML(t *testing.T) {
+	in := "<b>" + highlightStart + "Arroz" + highlightStop + " & feijão"
+	want := "&lt;b&gt;<mark>Arroz</mark> &amp; feijão"
+	if got := highlightHTML(in); got != want {
+		t.Errorf("highlightHTML = %q, want %q", got, want)
+	}
+}
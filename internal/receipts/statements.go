@@ -0,0 +1,290 @@
+package receipts
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mauroue/cereja-corp/internal/models"
+)
+
+// Statement sources
+const (
+	StatementOFX = "ofx"
+	StatementCSV = "csv"
+)
+
+var (
+	ofxAccountPattern     = regexp.MustCompile(`(?i)<ACCTID>([^<\r\n]+)`)
+	ofxCurrencyPattern    = regexp.MustCompile(`(?i)<CURDEF>\s*([A-Z]{3})`)
+	ofxTransactionPattern = regexp.MustCompile(`(?is)<STMTTRN>(.*?)</STMTTRN>`)
+	ofxFieldPattern       = regexp.MustCompile(`(?i)<(\w+)>([^<\r\n]*)`)
+)
+
+// StatementColumns names the CSV statement columns holding each field.
+// Empty names are guessed from the headers.
+type StatementColumns struct {
+	ID          string `json:"id"`
+	Date        string `json:"date"`
+	Description string `json:"description"`
+	Amount      string `json:"amount"`
+}
+
+// StatementOptions are the optional settings of a statement import. Account
+// and Currency override the ones read from an OFX statement. DebitsPositive
+// is for statements, typically of credit cards, listing purchases as positive
+// amounts.
+type StatementOptions struct {
+	Account        string
+	Currency       string
+	DebitsPositive bool
+	Columns        StatementColumns
+}
+
+// statementAliases are the normalized headers each CSV statement column is guessed from
+var statementAliases = map[string][]string{
+	"id":          {"id", "identificador", "fitid", "transaction_id"},
+	"date":        {"date", "data", "posted_at", "data_lancamento", "data_movimento"},
+	"description": {"description", "descricao", "title", "historico", "lancamento", "estabelecimento", "memo", "name"},
+	"amount":      {"amount", "valor", "value", "valor_(r$)", "quantia"},
+}
+
+// isOFX reports whether a statement file is OFX rather than CSV
+func isOFX(data []byte) bool {
+	head := bytes.ToUpper(data)
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	return bytes.Contains(head, []byte("OFXHEADER")) || bytes.Contains(head, []byte("<OFX>"))
+}
+
+// parseOFX reads the account and transactions of an OFX statement. Both the SGML
+// (OFX 1.x) and XML (OFX 2.x) variants are accepted as long as every transaction
+// block is closed. Transactions are in the statement's CURDEF currency, if any.
+func parseOFX(data []byte) (string, []*models.Transaction, error) {
+	text := string(data)
+
+	account := ""
+	if m := ofxAccountPattern.FindStringSubmatch(text); m != nil {
+		account = strings.TrimSpace(m[1])
+	}
+	currency := ""
+	if m := ofxCurrencyPattern.FindStringSubmatch(text); m != nil {
+		currency = strings.ToUpper(m[1])
+	}
+
+	blocks := ofxTransactionPattern.FindAllStringSubmatch(text, -1)
+	if len(blocks) == 0 {
+		return "", nil, errors.New("no transactions found in the OFX file")
+	}
+
+	var transactions []*models.Transaction
+	for i, block := range blocks {
+		fields := map[string]string{}
+		for _, m := range ofxFieldPattern.FindAllStringSubmatch(block[1], -1) {
+			fields[strings.ToUpper(m[1])] = strings.TrimSpace(m[2])
+		}
+
+		posted := fields["DTPOSTED"]
+		if len(posted) < 8 {
+			return "", nil, fmt.Errorf("transaction %d: missing DTPOSTED", i+1)
+		}
+		date, err := time.ParseInLocation("20060102", posted[:8], time.Local)
+		if err != nil {
+			return "", nil, fmt.Errorf("transaction %d: invalid DTPOSTED %q", i+1, posted)
+		}
+
+		amount, err := parseImportAmount(fields["TRNAMT"])
+		if err != nil {
+			return "", nil, fmt.Errorf("transaction %d: invalid TRNAMT %q", i+1, fields["TRNAMT"])
+		}
+
+		description := fields["NAME"]
+		if memo := fields["MEMO"]; memo != "" && memo != description {
+			if description == "" {
+				description = memo
+			} else {
+				description += " - " + memo
+			}
+		}
+
+		tx := &models.Transaction{
+			PostedAt:    date,
+			Amount:      amount,
+			Currency:    currency,
+			Description: description,
+			FitID:       fields["FITID"],
+			Source:      StatementOFX,
+		}
+		if tx.FitID == "" {
+			tx.FitID = statementFitID(tx, i)
+		}
+		transactions = append(transactions, tx)
+	}
+
+	return account, transactions, nil
+}
+
+// parseStatementCSV reads the transactions of a bank or credit card CSV statement
+func parseStatementCSV(data []byte, columns StatementColumns) ([]*models.Transaction, error) {
+	records, err := readImportCSV(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV: %w", err)
+	}
+
+	headers := records[0]
+	find := func(field, name string) (int, error) {
+		for i, header := range headers {
+			if name != "" && header == name {
+				return i, nil
+			}
+		}
+		if name != "" {
+			return -1, fmt.Errorf("column %q is not in the file", name)
+		}
+		for _, alias := range statementAliases[field] {
+			for i, header := range headers {
+				if normalizeHeader(header) == alias {
+					return i, nil
+				}
+			}
+		}
+		return -1, nil
+	}
+
+	idCol, err := find("id", columns.ID)
+	if err != nil {
+		return nil, err
+	}
+	dateCol, err := find("date", columns.Date)
+	if err != nil {
+		return nil, err
+	}
+	descCol, err := find("description", columns.Description)
+	if err != nil {
+		return nil, err
+	}
+	amountCol, err := find("amount", columns.Amount)
+	if err != nil {
+		return nil, err
+	}
+	if dateCol < 0 || descCol < 0 || amountCol < 0 {
+		return nil, errors.New("the date, description and amount columns could not be found; name them explicitly")
+	}
+
+	var transactions []*models.Transaction
+	seen := map[string]int{}
+	for n, record := range records[1:] {
+		row := n + 2
+		value := func(i int) string {
+			if i >= 0 && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+
+		date, err := parseImportDate(value(dateCol))
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %v", row, err)
+		}
+		amount, err := parseImportAmount(value(amountCol))
+		if err != nil {
+			return nil, fmt.Errorf("row %d: invalid amount %q", row, value(amountCol))
+		}
+
+		tx := &models.Transaction{
+			PostedAt:    date,
+			Amount:      amount,
+			Description: value(descCol),
+			FitID:       value(idCol),
+			Source:      StatementCSV,
+		}
+		if tx.FitID == "" {
+			// Identical rows are distinguished by how often they occurred before
+			key := fmt.Sprintf("%s|%s|%.2f", date.Format("2006-01-02"), tx.Description, amount)
+			tx.FitID = statementFitID(tx, seen[key])
+			seen[key]++
+		}
+		transactions = append(transactions, tx)
+	}
+
+	if len(transactions) == 0 {
+		return nil, errors.New("no transactions found in the CSV file")
+	}
+	return transactions, nil
+}
+
+// normalizeStatement sets the currency of the transactions, overriding the
+// statement's own when one is given and defaulting to the base currency, and
+// flips the sign of statements that list debits as positive amounts
+func normalizeStatement(transactions []*models.Transaction, options StatementOptions) {
+	for _, tx := range transactions {
+		if options.Currency != "" {
+			tx.Currency = options.Currency
+		}
+		if tx.Currency == "" {
+			tx.Currency = baseCurrency()
+		}
+		if options.DebitsPositive {
+			tx.Amount = -tx.Amount
+		}
+	}
+}
+
+// statementFitID derives a stable ID for a transaction that has none, so that
+// importing the same statement twice does not duplicate it
+func statementFitID(tx *models.Transaction, occurrence int) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s|%s|%.2f|%d",
+		tx.PostedAt.Format("2006-01-02"), tx.Description, tx.Amount, occurrence)))
+	return tx.Source + "-" + hex.EncodeToString(sum[:8])
+}
+
+// nameSimilarity compares a statement description with a store name using the
+// Dice coefficient of their letter pairs, ignoring case, accents and punctuation.
+// It returns a value between 0 (nothing in common) and 1 (same letters).
+func nameSimilarity(a, b string) float64 {
+	pairs := func(s string) map[string]int {
+		s = normalizeHeader(s)
+		result := map[string]int{}
+		for _, word := range strings.FieldsFunc(s, func(r rune) bool {
+			return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+		}) {
+			runes := []rune(word)
+			for i := 0; i+1 < len(runes); i++ {
+				result[string(runes[i:i+2])]++
+			}
+		}
+		return result
+	}
+
+	pa, pb := pairs(a), pairs(b)
+	total := 0
+	for _, n := range pa {
+		total += n
+	}
+	for _, n := range pb {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+
+	shared := 0
+	for pair, n := range pa {
+		if m := pb[pair]; m > 0 {
+			if m < n {
+				n = m
+			}
+			shared += n
+		}
+	}
+	return 2 * float64(shared) / float64(total)
+}
@@ -0,0 +1,288 @@
+package receipts
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mauroue/cereja-corp/internal/models"
+)
+
+func TestIsOFX(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want bool
+	}{
+		{"sgml header", "OFXHEADER:100\nDATA:OFXSGML\n<OFX>", true},
+		{"xml", `<?xml version="1.0"?><?OFX OFXHEADER="200"?><ofx>`, true},
+		{"csv", "date,description,amount\n2024-05-10,MERCADO,-10\n", false},
+		{"header too late", strings.Repeat("x", 2000) + "<OFX>", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isOFX([]byte(tt.data)); got != tt.want {
+				t.Errorf("isOFX() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseOFX(t *testing.T) {
+	const sgml = `OFXHEADER:100
+DATA:OFXSGML
+<OFX><BANKMSGSRSV1><STMTTRNRS><STMTRS><CURDEF>brl
+<BANKACCTFROM><ACCTID>12345-6</BANKACCTFROM>
+<BANKTRANLIST>
+<STMTTRN><TRNTYPE>DEBIT<DTPOSTED>20240510120000[-3:BRT]<TRNAMT>-42,10<FITID>A1<NAME>MERCADO EXEMPLO<MEMO>COMPRA CARTAO</STMTTRN>
+<STMTTRN><TRNTYPE>DEBIT<DTPOSTED>20240511<TRNAMT>-8.50<MEMO>PADARIA</STMTTRN>
+</BANKTRANLIST></STMTRS></STMTTRNRS></BANKMSGSRSV1></OFX>`
+
+	const xml = `<?xml version="1.0"?>
+<OFX><CREDITCARDMSGSRSV1><CCSTMTTRNRS><CCSTMTRS>
+<CCACCTFROM><ACCTID>9999</ACCTID></CCACCTFROM>
+<BANKTRANLIST>
+<STMTTRN><DTPOSTED>20240601</DTPOSTED><TRNAMT>-10.00</TRNAMT><FITID>X9</FITID><NAME>FARMACIA</NAME><MEMO>FARMACIA</MEMO></STMTTRN>
+</BANKTRANLIST></CCSTMTRS></CCSTMTTRNRS></CREDITCARDMSGSRSV1></OFX>`
+
+	type tx struct {
+		date        time.Time
+		amount      float64
+		description string
+		fitID       string
+	}
+	date := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.Local) }
+
+	tests := []struct {
+		name     string
+		data     string
+		account  string
+		currency string
+		want     []tx
+	}{
+		{"sgml", sgml, "12345-6", "BRL", []tx{
+			{date(2024, 5, 10), -42.1, "MERCADO EXEMPLO - COMPRA CARTAO", "A1"},
+			{date(2024, 5, 11), -8.5, "PADARIA", ""},
+		}},
+		{"xml", xml, "9999", "", []tx{
+			{date(2024, 6, 1), -10, "FARMACIA", "X9"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			account, transactions, err := parseOFX([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("parseOFX: %v", err)
+			}
+			if account != tt.account {
+				t.Errorf("account = %q, want %q", account, tt.account)
+			}
+			if len(transactions) != len(tt.want) {
+				t.Fatalf("got %d transactions, want %d", len(transactions), len(tt.want))
+			}
+			for i, w := range tt.want {
+				got := transactions[i]
+				if !got.PostedAt.Equal(w.date) || !approx(got.Amount, w.amount) || got.Description != w.description || got.Source != StatementOFX {
+					t.Errorf("transaction %d = %v %v %q %s, want %v %v %q", i+1, got.PostedAt, got.Amount, got.Description, got.Source, w.date, w.amount, w.description)
+				}
+				if got.Currency != tt.currency {
+					t.Errorf("transaction %d currency = %q, want %q", i+1, got.Currency, tt.currency)
+				}
+				if w.fitID != "" && got.FitID != w.fitID {
+					t.Errorf("transaction %d FITID = %q, want %q", i+1, got.FitID, w.fitID)
+				}
+				if w.fitID == "" && !strings.HasPrefix(got.FitID, StatementOFX+"-") {
+					t.Errorf("transaction %d FITID = %q, want a derived one", i+1, got.FitID)
+				}
+			}
+		})
+	}
+}
+
+func TestParseOFXErrors(t *testing.T) {
+	tests := []struct {
+		name, data string
+	}{
+		{"no transactions", "<OFX><BANKTRANLIST></BANKTRANLIST></OFX>"},
+		{"unclosed transaction", "<OFX><STMTTRN><DTPOSTED>20240510<TRNAMT>-1</OFX>"},
+		{"missing date", "<OFX><STMTTRN><TRNAMT>-1</STMTTRN></OFX>"},
+		{"bad date", "<OFX><STMTTRN><DTPOSTED>2024XX10<TRNAMT>-1</STMTTRN></OFX>"},
+		{"bad amount", "<OFX><STMTTRN><DTPOSTED>20240510<TRNAMT>ten</STMTTRN></OFX>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := parseOFX([]byte(tt.data)); err == nil {
+				t.Errorf("parseOFX accepted %s", tt.name)
+			}
+		})
+	}
+}
+
+func TestParseStatementCSV(t *testing.T) {
+	tests := []struct {
+		name         string
+		data         string
+		columns      StatementColumns
+		descriptions []string
+		amounts      []float64
+		fitIDs       []string
+	}{
+		{"guessed portuguese headers", "Data;Histórico;Valor\n10/05/2024;MERCADO EXEMPLO;-42,10\n11/05/2024;PIX RECEBIDO;100,00\n",
+			StatementColumns{}, []string{"MERCADO EXEMPLO", "PIX RECEBIDO"}, []float64{-42.1, 100}, nil},
+		{"explicit columns", "when,what,how much,ref\n2024-05-10,PADARIA,-8.50,T1\n",
+			StatementColumns{Date: "when", Description: "what", Amount: "how much", ID: "ref"},
+			[]string{"PADARIA"}, []float64{-8.5}, []string{"T1"}},
+		{"blank rows skipped", "date,description,amount\n\n2024-05-10,CAFE,-5\n,,\n",
+			StatementColumns{}, []string{"CAFE"}, []float64{-5}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transactions, err := parseStatementCSV([]byte(tt.data), tt.columns)
+			if err != nil {
+				t.Fatalf("parseStatementCSV: %v", err)
+			}
+			if len(transactions) != len(tt.descriptions) {
+				t.Fatalf("got %d transactions, want %d", len(transactions), len(tt.descriptions))
+			}
+			for i, tx := range transactions {
+				if tx.Description != tt.descriptions[i] || !approx(tx.Amount, tt.amounts[i]) || tx.Source != StatementCSV {
+					t.Errorf("transaction %d = %q %v %s, want %q %v", i+1, tx.Description, tx.Amount, tx.Source, tt.descriptions[i], tt.amounts[i])
+				}
+				if tt.fitIDs != nil && tx.FitID != tt.fitIDs[i] {
+					t.Errorf("transaction %d FITID = %q, want %q", i+1, tx.FitID, tt.fitIDs[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseStatementCSVDuplicateRows(t *testing.T) {
+	data := []byte("date,description,amount\n2024-05-10,CAFE,-5\n2024-05-10,CAFE,-5\n2024-05-11,CAFE,-5\n")
+
+	first, err := parseStatementCSV(data, StatementColumns{})
+	if err != nil {
+		t.Fatalf("parseStatementCSV: %v", err)
+	}
+	again, err := parseStatementCSV(data, StatementColumns{})
+	if err != nil {
+		t.Fatalf("parseStatementCSV: %v", err)
+	}
+
+	seen := map[string]bool{}
+	for i, tx := range first {
+		if seen[tx.FitID] {
+			t.Errorf("transaction %d reuses FITID %q", i+1, tx.FitID)
+		}
+		seen[tx.FitID] = true
+		if again[i].FitID != tx.FitID {
+			t.Errorf("transaction %d FITID changed between imports: %q, %q", i+1, tx.FitID, again[i].FitID)
+		}
+	}
+}
+
+func TestParseStatementCSVErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		columns StatementColumns
+	}{
+		{"columns not found", "foo,bar\n1,2\n", StatementColumns{}},
+		{"explicit column missing", "date,description,amount\n", StatementColumns{Amount: "valor"}},
+		{"bad date", "date,description,amount\nsoon,CAFE,-5\n", StatementColumns{}},
+		{"bad amount", "date,description,amount\n2024-05-10,CAFE,five\n", StatementColumns{}},
+		{"no rows", "date,description,amount\n", StatementColumns{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseStatementCSV([]byte(tt.data), tt.columns); err == nil {
+				t.Errorf("parseStatementCSV accepted %s", tt.name)
+			}
+		})
+	}
+}
+
+func TestNormalizeStatement(t *testing.T) {
+	tests := []struct {
+		name     string
+		currency string
+		options  StatementOptions
+		want     string
+		amount   float64
+	}{
+		{"statement currency", "USD", StatementOptions{}, "USD", -10},
+		{"base currency by default", "", StatementOptions{}, baseCurrency(), -10},
+		{"given currency overrides", "USD", StatementOptions{Currency: "EUR"}, "EUR", -10},
+		{"positive debits flipped", "", StatementOptions{DebitsPositive: true}, baseCurrency(), 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := &models.Transaction{Amount: -10, Currency: tt.currency}
+			normalizeStatement([]*models.Transaction{tx}, tt.options)
+			if tx.Currency != tt.want || !approx(tx.Amount, tt.amount) {
+				t.Errorf("got %v %s, want %v %s", tx.Amount, tx.Currency, tt.amount, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchScore(t *testing.T) {
+	day := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+	receipt := &models.Receipt{StoreName: "Mercado Exemplo", TotalAmount: 42.1, Currency: "BRL", PurchaseDate: day}
+	debit := func(amount float64, currency string, daysLater int) *models.Transaction {
+		return &models.Transaction{Description: "MERCADO EXEMPLO", Amount: amount, Currency: currency, PostedAt: day.AddDate(0, 0, daysLater)}
+	}
+
+	tests := []struct {
+		name string
+		tx   *models.Transaction
+		ok   bool
+	}{
+		{"purchase", debit(-42.1, "BRL", 1), true},
+		{"refund", debit(42.1, "BRL", 1), false},
+		{"other currency", debit(-42.1, "USD", 0), false},
+		{"other amount", debit(-42.0, "BRL", 0), false},
+		{"outside the window", debit(-42.1, "BRL", matchWindowDays+1), false},
+		{"unrelated merchant", &models.Transaction{Description: "POSTO SHELL", Amount: -42.1, Currency: "BRL", PostedAt: day.AddDate(0, 0, 3)}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score, ok := matchScore(tt.tx, receipt)
+			if ok != tt.ok {
+				t.Errorf("matchScore = %v, %v; want ok %v", score, ok, tt.ok)
+			}
+		})
+	}
+}
+
+func TestNameSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		min, max float64
+	}{
+		{"MERCADO EXEMPLO", "Mercado Exemplo", 1, 1},
+		{"PAG*PADARIA SÃO JOÃO", "Padaria Sao Joao", 0.8, 1},
+		{"MERCADO EXEMPLO LTDA", "Mercado Exemplo", 0.7, 0.95},
+		{"FARMACIA", "Posto Shell", 0, 0.2},
+		{"", "Mercado", 0, 0},
+		{"**", "--", 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+"|"+tt.b, func(t *testing.T) {
+			got := nameSimilarity(tt.a, tt.b)
+			if got < tt.min-1e-9 || got > tt.max+1e-9 {
+				t.Errorf("nameSimilarity(%q, %q) = %v, want between %v and %v", tt.a, tt.b, got, tt.min, tt.max)
+			}
+			if back := nameSimilarity(tt.b, tt.a); !approx(back, got) {
+				t.Errorf("nameSimilarity is not symmetric: %v, %v", got, back)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package receipts
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mauroue/cereja-corp/internal/auth"
+	"github.com/mauroue/cereja-corp/internal/models"
+)
+
+// ListStores retrieves all stores of the user ordered by name
+func (r *Repository) ListStores(userID int64) ([]*models.Store, error) {
+	query := `
+		SELECT id, name, COALESCE(address, ''), COALESCE(chain, ''), created_at, updated_at
+		FROM stores
+		WHERE user_id = $1
+		ORDER BY name
+	`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stores []*models.Store
+	for rows.Next() {
+		var store models.Store
+		if err := rows.Scan(
+			&store.ID,
+			&store.Name,
+			&store.Address,
+			&store.Chain,
+			&store.CreatedAt,
+			&store.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		stores = append(stores, &store)
+	}
+
+	return stores, rows.Err()
+}
+
+// UpdateStore updates the address and chain of a store of the user
+func (r *Repository) UpdateStore(userID int64, store *models.Store) error {
+	query := `
+		UPDATE stores
+		SET address = $1, chain = NULLIF($2, ''), updated_at = $3
+		WHERE id = $4 AND user_id = $5
+		RETURNING name, created_at
+	`
+
+	store.UpdatedAt = time.Now()
+	return r.db.QueryRow(query, store.Address, store.Chain, store.UpdatedAt, store.ID, userID).Scan(
+		&store.Name,
+		&store.CreatedAt,
+	)
+}
+
+// ListStores handles listing all known stores
+func (h *Handler) ListStores(c *gin.Context) {
+	stores, err := h.repo.ListStores(auth.UserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve stores"})
+		return
+	}
+
+	c.JSON(http.StatusOK, stores)
+}
+
+// UpdateStore handles updating a store's address and chain
+func (h *Handler) UpdateStore(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid store ID"})
+		return
+	}
+
+	var store models.Store
+	if err := c.ShouldBindJSON(&store); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	store.ID = id
+
+	if err := h.repo.UpdateStore(auth.UserID(c), &store); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update store"})
+		return
+	}
+
+	c.JSON(http.StatusOK, store)
+}
@@ -0,0 +1,397 @@
+package receipts
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mauroue/cereja-corp/internal/auth"
+	"github.com/mauroue/cereja-corp/internal/models"
+)
+
+const (
+	// maxTagLength matches the size of tags.name
+	maxTagLength = 100
+	// maxNoteLength bounds receipt notes
+	maxNoteLength = 5000
+)
+
+// receiptTagsColumn selects the names of a receipt's tags, for receipts as r
+const receiptTagsColumn = `ARRAY(SELECT t.name FROM receipt_tags rt JOIN tags t ON t.id = rt.tag_id
+		WHERE rt.receipt_id = r.id ORDER BY LOWER(t.name))`
+
+// itemTagsColumn selects the names of an item's tags, for receipt_items as ri
+const itemTagsColumn = `ARRAY(SELECT t.name FROM receipt_item_tags it JOIN tags t ON t.id = it.tag_id
+		WHERE it.item_id = ri.id ORDER BY LOWER(t.name))`
+
+// ErrInvalidTag is returned for tags that are too long
+var ErrInvalidTag = errors.New("invalid tag")
+
+// normalizeTags trims tag names and drops blanks and case-insensitive duplicates
+func normalizeTags(names []string) ([]string, error) {
+	seen := make(map[string]bool)
+	tags := []string{}
+	for _, name := range names {
+		name = strings.Join(strings.Fields(name), " ")
+		if name == "" || seen[strings.ToLower(name)] {
+			continue
+		}
+		if len(name) > maxTagLength {
+			return nil, fmt.Errorf("%w: %q is longer than %d characters", ErrInvalidTag, name, maxTagLength)
+		}
+		seen[strings.ToLower(name)] = true
+		tags = append(tags, name)
+	}
+	return tags, nil
+}
+
+// parseTagList splits a comma-separated list of tags, as typed in the web forms
+func parseTagList(s string) []string {
+	return strings.Split(s, ",")
+}
+
+// findOrCreateTags returns the IDs of the user's named tags, creating missing
+// ones. Tag names are matched case-insensitively.
+func findOrCreateTags(tx *sql.Tx, userID int64, names []string) ([]int64, error) {
+	ids := make([]int64, 0, len(names))
+	for _, name := range names {
+		var id int64
+		err := tx.QueryRow(`
+			INSERT INTO tags (user_id, name) VALUES ($1, $2)
+			ON CONFLICT (user_id, (LOWER(name))) DO UPDATE SET name = tags.name
+			RETURNING id
+		`, userID, name).Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// ListTags returns every tag the user has put on a receipt or item, with how
+// often it is used
+func (r *Repository) ListTags(userID int64) ([]*models.Tag, error) {
+	rows, err := r.db.Query(`
+		SELECT t.id, t.name, t.created_at,
+			(SELECT COUNT(*) FROM receipt_tags rt JOIN receipts r ON r.id = rt.receipt_id
+			 WHERE rt.tag_id = t.id AND r.user_id = $1),
+			(SELECT COUNT(*) FROM receipt_item_tags it
+			 JOIN receipt_items ri ON ri.id = it.item_id
+			 JOIN receipts r ON r.id = ri.receipt_id
+			 WHERE it.tag_id = t.id AND r.user_id = $1)
+		FROM tags t
+		WHERE t.user_id = $1
+		  AND (EXISTS (SELECT 1 FROM receipt_tags rt WHERE rt.tag_id = t.id)
+		       OR EXISTS (SELECT 1 FROM receipt_item_tags it WHERE it.tag_id = t.id))
+		ORDER BY LOWER(t.name)
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []*models.Tag{}
+	for rows.Next() {
+		var tag models.Tag
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.CreatedAt, &tag.ReceiptCount, &tag.ItemCount); err != nil {
+			return nil, err
+		}
+		tags = append(tags, &tag)
+	}
+
+	return tags, rows.Err()
+}
+
+// SetReceiptTags replaces the tags of one of the user's receipts and returns
+// them. It returns sql.ErrNoRows if the user has no such receipt.
+func (r *Repository) SetReceiptTags(userID, receiptID int64, names []string) ([]string, error) {
+	tags, err := normalizeTags(names)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var owned bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM receipts WHERE id = $1 AND user_id = $2)`, receiptID, userID).Scan(&owned); err != nil {
+		return nil, err
+	}
+	if !owned {
+		return nil, sql.ErrNoRows
+	}
+
+	ids, err := findOrCreateTags(tx, userID, tags)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`DELETE FROM receipt_tags WHERE receipt_id = $1`, receiptID); err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if _, err := tx.Exec(`INSERT INTO receipt_tags (receipt_id, tag_id) VALUES ($1, $2)`, receiptID, id); err != nil {
+			return nil, err
+		}
+	}
+
+	return tags, tx.Commit()
+}
+
+// SetItemTags replaces the tags of one of the user's receipt items and returns
+// them. It returns sql.ErrNoRows if the user has no such item.
+func (r *Repository) SetItemTags(userID, itemID int64, names []string) ([]string, error) {
+	tags, err := normalizeTags(names)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var owned bool
+	err = tx.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM receipt_items ri JOIN receipts r ON r.id = ri.receipt_id
+			WHERE ri.id = $1 AND r.user_id = $2
+		)
+	`, itemID, userID).Scan(&owned)
+	if err != nil {
+		return nil, err
+	}
+	if !owned {
+		return nil, sql.ErrNoRows
+	}
+
+	ids, err := findOrCreateTags(tx, userID, tags)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`DELETE FROM receipt_item_tags WHERE item_id = $1`, itemID); err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if _, err := tx.Exec(`INSERT INTO receipt_item_tags (item_id, tag_id) VALUES ($1, $2)`, itemID, id); err != nil {
+			return nil, err
+		}
+	}
+
+	return tags, tx.Commit()
+}
+
+// tagsRequest is the JSON body replacing a receipt's or item's tags
+type tagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// ListTags returns the tags used on the user's receipts and items
+func (h *Handler) ListTags(c *gin.Context) {
+	tags, err := h.repo.ListTags(auth.UserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve tags"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tags)
+}
+
+// SetReceiptTags replaces a receipt's tags
+func (h *Handler) SetReceiptTags(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid receipt ID"})
+		return
+	}
+
+	var req tagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tags, err := h.repo.SetReceiptTags(auth.UserID(c), id, req.Tags)
+	if err != nil {
+		tagError(c, err, "Receipt not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tags": tags})
+}
+
+// SetItemTags replaces a receipt item's tags
+func (h *Handler) SetItemTags(c *gin.Context) {
+	itemID, err := strconv.ParseInt(c.Param("item_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		return
+	}
+
+	var req tagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tags, err := h.repo.SetItemTags(auth.UserID(c), itemID, req.Tags)
+	if err != nil {
+		tagError(c, err, "Item not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tags": tags})
+}
+
+// tagError writes the JSON response for errors shared by the tag handlers
+func tagError(c *gin.Context, err error, notFound string) {
+	switch {
+	case errors.Is(err, ErrInvalidTag):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save tags"})
+	}
+}
+
+// HtmxReceiptAnnotations returns the tags and note form of a receipt and its items
+func (h *WebHandler) HtmxReceiptAnnotations(c *gin.Context) {
+	receiptID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Invalid receipt ID")))
+		return
+	}
+
+	c.Data(http.StatusOK, "text/html", []byte(h.renderReceiptAnnotations(auth.UserID(c), receiptID, "")))
+}
+
+// HtmxSaveReceiptAnnotations saves a receipt's tags and note from the form
+func (h *WebHandler) HtmxSaveReceiptAnnotations(c *gin.Context) {
+	receiptID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Invalid receipt ID")))
+		return
+	}
+
+	userID := auth.UserID(c)
+	note := strings.TrimSpace(c.PostForm("note"))
+	update := &ReceiptUpdate{Note: &note}
+	if err := update.Validate(); err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(h.renderReceiptAnnotations(userID, receiptID, createErrorResponse(template.HTMLEscapeString(err.Error())))))
+		return
+	}
+
+	message := createSuccessResponse("Tags and note saved")
+	if _, err := h.repo.SetReceiptTags(userID, receiptID, parseTagList(c.PostForm("tags"))); err != nil {
+		message = tagHTMLError(err, "Receipt not found")
+	} else if _, _, err := h.repo.UpdateReceipt(userID, receiptID, update); err != nil {
+		message = createErrorResponse("Failed to save note")
+	}
+	c.Data(http.StatusOK, "text/html", []byte(h.renderReceiptAnnotations(userID, receiptID, message)))
+}
+
+// HtmxSaveItemTags saves an item's tags from the receipt page
+func (h *WebHandler) HtmxSaveItemTags(c *gin.Context) {
+	receiptID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Invalid receipt ID")))
+		return
+	}
+	itemID, err := strconv.ParseInt(c.Param("item_id"), 10, 64)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Invalid item ID")))
+		return
+	}
+
+	userID := auth.UserID(c)
+	message := createSuccessResponse("Item tags saved")
+	if _, err := h.repo.SetItemTags(userID, itemID, parseTagList(c.PostForm("tags"))); err != nil {
+		message = tagHTMLError(err, "Item not found")
+	}
+	c.Data(http.StatusOK, "text/html", []byte(h.renderReceiptAnnotations(userID, receiptID, message)))
+}
+
+// tagHTMLError returns the HTMX error message for errors shared by the tag forms
+func tagHTMLError(err error, notFound string) string {
+	switch {
+	case errors.Is(err, ErrInvalidTag):
+		return createErrorResponse(template.HTMLEscapeString(err.Error()))
+	case errors.Is(err, sql.ErrNoRows):
+		return createErrorResponse(notFound)
+	default:
+		return createErrorResponse("Failed to save tags")
+	}
+}
+
+// renderReceiptAnnotations renders the receipt's tags and note form, followed
+// by a tags field per item
+func (h *WebHandler) renderReceiptAnnotations(userID, receiptID int64, message string) string {
+	receipt, err := h.repo.GetReceiptByID(userID, receiptID)
+	if err != nil {
+		return createErrorResponse("Receipt not found")
+	}
+	items, err := h.repo.GetReceiptItems(userID, receiptID)
+	if err != nil {
+		return createErrorResponse("Failed to load items")
+	}
+
+	var out strings.Builder
+	out.WriteString(message)
+	out.WriteString(fmt.Sprintf(`
+	<form hx-post="/receipts-web/htmx/receipt/%d/annotations" hx-target="#receipt-annotations">
+		<div class="form-group">
+			<label for="receipt-tags">Tags</label>
+			<input type="text" id="receipt-tags" name="tags" value="%s" placeholder="trip-2024, reimbursable">
+		</div>
+		<div class="form-group">
+			<label for="receipt-note">Note</label>
+			<textarea id="receipt-note" name="note" rows="3" maxlength="%d">%s</textarea>
+		</div>
+		<button type="submit" class="btn btn-primary">Save</button>
+	</form>`,
+		receipt.ID, template.HTMLEscapeString(strings.Join(receipt.Tags, ", ")),
+		maxNoteLength, template.HTMLEscapeString(receipt.Note)))
+
+	if len(items) == 0 {
+		return out.String()
+	}
+
+	out.WriteString(`<h3>Item Tags</h3><table class="table"><thead><tr><th>Item</th><th>Tags</th><th>Actions</th></tr></thead><tbody>`)
+	for _, item := range items {
+		form := fmt.Sprintf(`item-tags-%d`, item.ID)
+		out.WriteString(fmt.Sprintf(`
+			<tr>
+				<td>%s</td>
+				<td><input type="text" name="tags" form="%s" value="%s" placeholder="gift"></td>
+				<td>
+					<form id="%s" hx-post="/receipts-web/htmx/receipt/%d/items/%d/tags" hx-target="#receipt-annotations">
+						<button type="submit" class="btn btn-sm btn-primary">Save</button>
+					</form>
+				</td>
+			</tr>`,
+			template.HTMLEscapeString(item.Name), form, template.HTMLEscapeString(strings.Join(item.Tags, ", ")),
+			form, receipt.ID, item.ID))
+	}
+	out.WriteString(`</tbody></table>`)
+
+	return out.String()
+}
+
+// formatTags renders tag names as labels, each preceded by a space
+func formatTags(tags []string) string {
+	var out strings.Builder
+	for _, tag := range tags {
+		out.WriteString(fmt.Sprintf(` <span class="tag">%s</span>`, template.HTMLEscapeString(tag)))
+	}
+	return out.String()
+}
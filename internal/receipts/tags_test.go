@@ -0,0 +1,123 @@
+package receipts
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	long := strings.Repeat("a", maxTagLength+1)
+
+	tests := []struct {
+		name    string
+		input   []string
+		want    []string
+		wantErr bool
+	}{
+		{"nil", nil, []string{}, false},
+		{"whitespace is collapsed", []string{"  home \t office "}, []string{"home office"}, false},
+		{"blanks are dropped", []string{"", "   ", "food"}, []string{"food"}, false},
+		{"duplicates keep the first spelling", []string{"Food", "food", " FOOD "}, []string{"Food"}, false},
+		{"order is kept", []string{"b", "a", "c"}, []string{"b", "a", "c"}, false},
+		{"longest allowed", []string{long[1:]}, []string{long[1:]}, false},
+		{"too long", []string{"ok", long}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeTags(tt.input)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidTag) {
+					t.Errorf("err = %v, want ErrInvalidTag", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizeTags(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTagList(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"", []string{}},
+		{"food", []string{"food"}},
+		{"food, work ,, Food,", []string{"food", "work"}},
+	}
+
+	for _, tt := range tests {
+		got, err := normalizeTags(parseTagList(tt.input))
+		if err != nil {
+			t.Fatalf("parseTagList(%q): unexpected error: %v", tt.input, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseTagList(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestFormatTags(t *testing.T) {
+	tests := []struct {
+		tags []string
+		want string
+	}{
+		{nil, ""},
+		{[]string{"food", "work"}, ` <span class="tag">food</span> <span class="tag">work</span>`},
+		{[]string{"<b>&"}, ` <span class="tag">&lt;b&gt;&amp;</span>`},
+	}
+
+	for _, tt := range tests {
+		if got := formatTags(tt.tags); got != tt.want {
+			t.Errorf("formatTags(%q) = %q, want %q", tt.tags, got, tt.want)
+		}
+	}
+}
+
+func TestTagHTMLError(t *testing.T) {
+	_, invalid := normalizeTags([]string{strings.Repeat("<", maxTagLength+1)})
+
+	tests := []struct {
+		name    string
+		err     error
+		want    string
+		notWant string
+	}{
+		{"invalid tag is shown escaped", invalid, "&lt;&lt;", "<<"},
+		{"missing receipt", sql.ErrNoRows, "Receipt not found", ""},
+		{"other errors are hidden", errors.New("connection refused"), "Failed to save tags", "connection refused"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tagHTMLError(tt.err, "Receipt not found")
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("tagHTMLError() = %q, want it to contain %q", got, tt.want)
+			}
+			if tt.notWant != "" && strings.Contains(got, tt.notWant) {
+				t.Errorf("tagHTMLError() = %q, should not contain %q", got, tt.notWant)
+			}
+		})
+	}
+}
+
+func TestReceiptUpdateValidateNote(t *testing.T) {
+	ok := strings.Repeat("n", maxNoteLength)
+	long := ok + "n"
+
+	if err := (&ReceiptUpdate{Note: &ok}).Validate(); err != nil {
+		t.Errorf("note of %d characters: unexpected error: %v", maxNoteLength, err)
+	}
+	if err := (&ReceiptUpdate{Note: &long}).Validate(); err == nil {
+		t.Errorf("note of %d characters: expected an error", maxNoteLength+1)
+	}
+}
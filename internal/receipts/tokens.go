@@ -0,0 +1,166 @@
+package receipts
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mauroue/cereja-corp/internal/auth"
+)
+
+// TokensPage renders the personal API tokens settings page
+func (h *WebHandler) TokensPage(c *gin.Context) {
+	var scopes strings.Builder
+	for _, scope := range auth.Scopes {
+		scopes.WriteString(fmt.Sprintf(`
+                <label><input type="checkbox" name="scopes" value="%s"> %s</label>`, scope, scope))
+	}
+
+	content := fmt.Sprintf(`
+<div class="card">
+    <div class="card-header">
+        <h1 class="card-title">API Tokens</h1>
+    </div>
+    <p>Personal API tokens let scripts call the JSON API with an <code>Authorization: Bearer</code> header. A token can only do what its scopes allow: <code>read</code> covers GET requests, <code>write</code> everything else and <code>*</code> both.</p>
+
+    <div id="tokens-list" hx-get="/receipts-web/htmx/tokens" hx-trigger="load">
+        <div class="loading-spinner"></div>
+    </div>
+</div>
+
+<div class="card">
+    <div class="card-header">
+        <h2 class="card-title">New Token</h2>
+    </div>
+    <form hx-post="/receipts-web/htmx/tokens" hx-target="#tokens-list">
+        <div class="filter-form">
+            <div class="form-group">
+                <label for="token-name">Name</label>
+                <input type="text" id="token-name" name="name" placeholder="Phone shortcut" required>
+            </div>
+            <div class="form-group">
+                <label for="expires_in">Expires</label>
+                <select id="expires_in" name="expires_in">
+                    <option value="30">In 30 days</option>
+                    <option value="90" selected>In 90 days</option>
+                    <option value="365">In a year</option>
+                    <option value="0">Never</option>
+                </select>
+            </div>
+            <div class="form-group token-scopes">
+                <label>Scopes</label>%s
+            </div>
+        </div>
+        <button type="submit" class="btn btn-primary">Create Token</button>
+    </form>
+</div>
+`, scopes.String())
+
+	page := renderPageWithLayout("API Tokens", content)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(page))
+}
+
+// HtmxTokens returns the user's API tokens
+func (h *WebHandler) HtmxTokens(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html", []byte(h.renderTokens(auth.UserID(c))))
+}
+
+// HtmxCreateToken creates a token from the token form. The token is shown once,
+// above the updated list.
+func (h *WebHandler) HtmxCreateToken(c *gin.Context) {
+	userID := auth.UserID(c)
+
+	var expiresAt *time.Time
+	days, err := strconv.Atoi(c.PostForm("expires_in"))
+	if err != nil || days < 0 {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Please choose when the token expires")+h.renderTokens(userID)))
+		return
+	}
+	if days > 0 {
+		expires := time.Now().AddDate(0, 0, days)
+		expiresAt = &expires
+	}
+
+	token, _, err := h.api.users.CreateToken(userID, c.PostForm("name"), c.PostFormArray("scopes"), expiresAt)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse(template.HTMLEscapeString(err.Error()))+h.renderTokens(userID)))
+		return
+	}
+
+	created := createSuccessResponse(fmt.Sprintf(
+		`Token created. Copy it now, it will not be shown again: <code class="token-value">%s</code>`, token))
+	c.Data(http.StatusOK, "text/html", []byte(created+h.renderTokens(userID)))
+}
+
+// HtmxRevokeToken revokes a token and returns the updated list
+func (h *WebHandler) HtmxRevokeToken(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Invalid token ID")))
+		return
+	}
+
+	userID := auth.UserID(c)
+	if err := h.api.users.RevokeToken(userID, id); err != nil {
+		message := "Failed to revoke token"
+		if errors.Is(err, sql.ErrNoRows) {
+			message = "Token not found"
+		}
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse(message)+h.renderTokens(userID)))
+		return
+	}
+
+	c.Data(http.StatusOK, "text/html", []byte(h.renderTokens(userID)))
+}
+
+// renderTokens renders the user's tokens with their status and a revoke button
+func (h *WebHandler) renderTokens(userID int64) string {
+	tokens, err := h.api.users.ListTokens(userID)
+	if err != nil {
+		return createErrorResponse("Failed to load tokens")
+	}
+	if len(tokens) == 0 {
+		return `<p>No API tokens yet.</p>`
+	}
+
+	var out strings.Builder
+	out.WriteString(`<table class="table"><thead><tr><th>Name</th><th>Token</th><th>Scopes</th><th>Created</th><th>Last Used</th><th>Expires</th><th>Actions</th></tr></thead><tbody>`)
+	for _, token := range tokens {
+		lastUsed := "Never"
+		if token.LastUsedAt != nil {
+			lastUsed = formatDate(*token.LastUsedAt)
+		}
+		expires := "Never"
+		if token.ExpiresAt != nil {
+			expires = formatDate(*token.ExpiresAt)
+		}
+
+		action := fmt.Sprintf(`
+				<button class="btn btn-sm btn-secondary"
+						hx-delete="/receipts-web/htmx/tokens/%d"
+						hx-target="#tokens-list"
+						hx-confirm="Revoke this token? Scripts using it will stop working.">
+					Revoke
+				</button>`, token.ID)
+		switch {
+		case token.RevokedAt != nil:
+			action = "Revoked " + formatDate(*token.RevokedAt)
+		case token.ExpiresAt != nil && token.ExpiresAt.Before(time.Now()):
+			action = "Expired"
+		}
+
+		out.WriteString(fmt.Sprintf(`<tr><td>%s</td><td><code>%s…</code></td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>`,
+			template.HTMLEscapeString(token.Name), template.HTMLEscapeString(token.Prefix),
+			template.HTMLEscapeString(strings.Join(token.Scopes, ", ")),
+			formatDate(token.CreatedAt), lastUsed, expires, action))
+	}
+	out.WriteString(`</tbody></table>`)
+
+	return out.String()
+}
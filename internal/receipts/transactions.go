@@ -0,0 +1,725 @@
+package receipts
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/mauroue/cereja-corp/internal/auth"
+	"github.com/mauroue/cereja-corp/internal/models"
+)
+
+// Match methods recorded on linked transactions
+const (
+	MatchAuto   = "auto"
+	MatchManual = "manual"
+)
+
+const (
+	// matchWindowDays is how many days a receipt may be dated before or after its transaction
+	matchWindowDays = 3
+	// minMatchScore is the lowest score an automatic match is accepted with
+	minMatchScore = 0.5
+	// maxTransactionList bounds the transactions and receipts listed for reconciliation
+	maxTransactionList = 500
+)
+
+// Errors returned when linking a transaction to a receipt
+var (
+	ErrReceiptAlreadyLinked = errors.New("receipt is already linked to a transaction")
+	ErrLinkedReceiptMissing = errors.New("receipt not found")
+)
+
+// StatementImport reports the outcome of a statement import
+type StatementImport struct {
+	Account    string `json:"account"`
+	Source     string `json:"source"`
+	Imported   int    `json:"imported"`
+	Duplicates int    `json:"duplicates"`
+	Matched    int    `json:"matched"`
+}
+
+// transactionColumns lists the transaction columns read by scanTransaction
+const transactionColumns = `
+	id, account, posted_at, amount, currency, description, fit_id, source, receipt_id,
+	COALESCE(match_method, ''), match_score, created_at`
+
+// scanTransaction scans a row selected with transactionColumns
+func scanTransaction(row rowScanner) (*models.Transaction, error) {
+	var tx models.Transaction
+	err := row.Scan(
+		&tx.ID,
+		&tx.Account,
+		&tx.PostedAt,
+		&tx.Amount,
+		&tx.Currency,
+		&tx.Description,
+		&tx.FitID,
+		&tx.Source,
+		&tx.ReceiptID,
+		&tx.MatchMethod,
+		&tx.MatchScore,
+		&tx.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &tx, nil
+}
+
+// ImportTransactions inserts statement transactions for one of the user's accounts,
+// skipping those imported before. It returns the number of new and of duplicate transactions.
+func (r *Repository) ImportTransactions(userID int64, account string, transactions []*models.Transaction) (int, int, error) {
+	query := `
+		INSERT INTO transactions (user_id, account, posted_at, amount, currency, description, fit_id, source, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (user_id, account, fit_id) DO NOTHING
+	`
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	imported := 0
+	for _, t := range transactions {
+		result, err := tx.Exec(query, userID, account, t.PostedAt.Format("2006-01-02"), t.Amount, t.Currency,
+			t.Description, t.FitID, t.Source, now)
+		if err != nil {
+			return 0, 0, err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return 0, 0, err
+		}
+		imported += int(affected)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+	return imported, len(transactions) - imported, nil
+}
+
+// MatchTransactions links unmatched debits to unmatched receipts with the same
+// amount and currency, dated within matchWindowDays of each other. Candidates
+// are scored by matchScore, and the best pairs are linked first so that every
+// transaction and receipt is used at most once. Only the user's own
+// transactions and receipts are matched.
+func (r *Repository) MatchTransactions(userID int64) (int, error) {
+	query := fmt.Sprintf(`
+		SELECT t.id, t.description, t.posted_at, t.amount, t.currency,
+			r.id, r.store_name, r.purchase_date::date, r.total_amount, r.currency
+		FROM transactions t
+		JOIN receipts r
+			ON r.user_id = t.user_id
+			AND r.currency = t.currency
+			AND ABS(r.total_amount + t.amount) < 0.005
+			AND r.purchase_date >= t.posted_at - INTERVAL '%[1]d days'
+			AND r.purchase_date < t.posted_at + INTERVAL '%[2]d days'
+		WHERE t.user_id = $1 AND t.receipt_id IS NULL AND t.amount < 0
+			AND NOT EXISTS (SELECT 1 FROM transactions linked WHERE linked.receipt_id = r.id)
+	`, matchWindowDays, matchWindowDays+1)
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	type candidate struct {
+		transactionID, receiptID int64
+		score                    float64
+	}
+	var candidates []candidate
+	for rows.Next() {
+		var t models.Transaction
+		var receipt models.Receipt
+		if err := rows.Scan(
+			&t.ID, &t.Description, &t.PostedAt, &t.Amount, &t.Currency,
+			&receipt.ID, &receipt.StoreName, &receipt.PurchaseDate, &receipt.TotalAmount, &receipt.Currency,
+		); err != nil {
+			return 0, err
+		}
+
+		if score, ok := matchScore(&t, &receipt); ok {
+			candidates = append(candidates, candidate{transactionID: t.ID, receiptID: receipt.ID, score: score})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].score > candidates[j].score })
+
+	usedTransactions := map[int64]bool{}
+	usedReceipts := map[int64]bool{}
+	matched := 0
+	for _, c := range candidates {
+		if usedTransactions[c.transactionID] || usedReceipts[c.receiptID] {
+			continue
+		}
+		_, err := r.db.Exec(
+			`UPDATE transactions SET receipt_id = $1, match_method = $2, match_score = $3
+			 WHERE id = $4 AND user_id = $5 AND receipt_id IS NULL`,
+			c.receiptID, MatchAuto, math.Round(c.score*10000)/10000, c.transactionID, userID,
+		)
+		if err != nil {
+			return matched, err
+		}
+		usedTransactions[c.transactionID] = true
+		usedReceipts[c.receiptID] = true
+		matched++
+	}
+
+	return matched, nil
+}
+
+// matchScore scores a receipt as the purchase behind a transaction by
+// merchant-name similarity and date distance. Only debits match, and only
+// receipts of the same amount and currency dated within matchWindowDays; ok is
+// false for any other pair and for scores below minMatchScore.
+func matchScore(t *models.Transaction, receipt *models.Receipt) (float64, bool) {
+	if t.Amount >= 0 || t.Currency != receipt.Currency || math.Abs(receipt.TotalAmount+t.Amount) >= 0.005 {
+		return 0, false
+	}
+	days := math.Abs(math.Round(t.PostedAt.Sub(receipt.PurchaseDate).Hours() / 24))
+	if days > matchWindowDays {
+		return 0, false
+	}
+
+	score := 0.7*nameSimilarity(t.Description, receipt.StoreName) + 0.3*(1-days/(matchWindowDays+1))
+	return score, score >= minMatchScore
+}
+
+// ListTransactions retrieves the user's most recent transactions, optionally only
+// the "matched" or "unmatched" ones
+func (r *Repository) ListTransactions(userID int64, status string) ([]*models.Transaction, error) {
+	condition := ""
+	switch status {
+	case "matched":
+		condition = " AND receipt_id IS NOT NULL"
+	case "unmatched":
+		condition = " AND receipt_id IS NULL"
+	}
+
+	query := `SELECT ` + transactionColumns + ` FROM transactions WHERE user_id = $2` + condition +
+		` ORDER BY posted_at DESC, id DESC LIMIT $1`
+
+	rows, err := r.db.Query(query, maxTransactionList, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transactions := []*models.Transaction{}
+	for rows.Next() {
+		tx, err := scanTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, tx)
+	}
+
+	return transactions, rows.Err()
+}
+
+// UnmatchedReceipts retrieves the user's most recent receipts not linked to any transaction
+func (r *Repository) UnmatchedReceipts(userID int64) ([]*models.Receipt, error) {
+	query := `SELECT ` + receiptColumns + ` FROM ` + receiptTables + `
+		WHERE r.user_id = $2 AND NOT EXISTS (SELECT 1 FROM transactions t WHERE t.receipt_id = r.id)
+		ORDER BY r.purchase_date DESC, r.id DESC
+		LIMIT $1`
+
+	rows, err := r.db.Query(query, maxTransactionList, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	receipts := []*models.Receipt{}
+	for rows.Next() {
+		receipt, err := scanReceipt(rows)
+		if err != nil {
+			return nil, err
+		}
+		receipts = append(receipts, receipt)
+	}
+
+	return receipts, rows.Err()
+}
+
+// LinkTransaction manually links one of the user's transactions to one of their
+// receipts, replacing any previous link
+func (r *Repository) LinkTransaction(userID, transactionID, receiptID int64) error {
+	var owned bool
+	err := r.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM receipts WHERE id = $1 AND user_id = $2)`,
+		receiptID, userID).Scan(&owned)
+	if err != nil {
+		return err
+	}
+	if !owned {
+		return ErrLinkedReceiptMissing
+	}
+
+	result, err := r.db.Exec(
+		`UPDATE transactions SET receipt_id = $1, match_method = $2, match_score = NULL WHERE id = $3 AND user_id = $4`,
+		receiptID, MatchManual, transactionID, userID,
+	)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) {
+			switch pqErr.Code {
+			case "23505":
+				return ErrReceiptAlreadyLinked
+			case "23503":
+				return ErrLinkedReceiptMissing
+			}
+		}
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// UnlinkTransaction removes the receipt linked to one of the user's transactions
+func (r *Repository) UnlinkTransaction(userID, transactionID int64) error {
+	result, err := r.db.Exec(
+		`UPDATE transactions SET receipt_id = NULL, match_method = NULL, match_score = NULL WHERE id = $1 AND user_id = $2`,
+		transactionID, userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// importStatement parses an OFX or CSV statement, imports its transactions and
+// runs automatic matching
+func (r *Repository) importStatement(userID int64, data []byte, options StatementOptions) (*StatementImport, error) {
+	result := &StatementImport{Account: options.Account, Source: StatementCSV}
+
+	var transactions []*models.Transaction
+	var err error
+	if isOFX(data) {
+		result.Source = StatementOFX
+		var ofxAccount string
+		ofxAccount, transactions, err = parseOFX(data)
+		if result.Account == "" {
+			result.Account = ofxAccount
+		}
+	} else {
+		transactions, err = parseStatementCSV(data, options.Columns)
+	}
+	if err != nil {
+		return nil, err
+	}
+	normalizeStatement(transactions, options)
+
+	result.Imported, result.Duplicates, err = r.ImportTransactions(userID, result.Account, transactions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save transactions: %w", err)
+	}
+
+	result.Matched, err = r.MatchTransactions(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to match transactions: %w", err)
+	}
+
+	return result, nil
+}
+
+// ListTransactions handles listing transactions, filtered by status=matched|unmatched
+func (h *Handler) ListTransactions(c *gin.Context) {
+	status := c.Query("status")
+	if status != "" && status != "matched" && status != "unmatched" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be matched or unmatched"})
+		return
+	}
+
+	transactions, err := h.repo.ListTransactions(auth.UserID(c), status)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve transactions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, transactions)
+}
+
+// ImportStatement handles importing an OFX or CSV statement from the "file" form field.
+// CSV column names can be given as date_column, description_column, amount_column and id_column.
+func (h *Handler) ImportStatement(c *gin.Context) {
+	data, _, err := readImportFile(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	options, err := statementOptionsFromForm(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.repo.importStatement(auth.UserID(c), data, options)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, result)
+}
+
+// statementOptionsFromForm reads the statement account, currency, sign and
+// CSV column names from the form
+func statementOptionsFromForm(c *gin.Context) (StatementOptions, error) {
+	options := StatementOptions{
+		Account:        strings.TrimSpace(c.PostForm("account")),
+		DebitsPositive: c.PostForm("debits_positive") == "true",
+		Columns: StatementColumns{
+			ID:          c.PostForm("id_column"),
+			Date:        c.PostForm("date_column"),
+			Description: c.PostForm("description_column"),
+			Amount:      c.PostForm("amount_column"),
+		},
+	}
+	if raw := c.PostForm("currency"); strings.TrimSpace(raw) != "" {
+		currency, err := normalizeCurrency(raw)
+		if err != nil {
+			return options, err
+		}
+		options.Currency = currency
+	}
+	return options, nil
+}
+
+// MatchTransactions handles running automatic matching
+func (h *Handler) MatchTransactions(c *gin.Context) {
+	matched, err := h.repo.MatchTransactions(auth.UserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to match transactions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"matched": matched})
+}
+
+// ListUnmatchedReceipts handles listing receipts without a transaction
+func (h *Handler) ListUnmatchedReceipts(c *gin.Context) {
+	receipts, err := h.repo.UnmatchedReceipts(auth.UserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve receipts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, receipts)
+}
+
+// LinkTransaction handles manually linking a transaction to a receipt
+func (h *Handler) LinkTransaction(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transaction ID"})
+		return
+	}
+
+	var body struct {
+		ReceiptID int64 `json:"receipt_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.repo.LinkTransaction(auth.UserID(c), id, body.ReceiptID); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+		case errors.Is(err, ErrReceiptAlreadyLinked):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrLinkedReceiptMissing):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Receipt not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link transaction"})
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// UnlinkTransaction handles removing a transaction's receipt link
+func (h *Handler) UnlinkTransaction(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transaction ID"})
+		return
+	}
+
+	if err := h.repo.UnlinkTransaction(auth.UserID(c), id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlink transaction"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ReconcilePage renders the page for importing statements and linking transactions to receipts
+func (h *WebHandler) ReconcilePage(c *gin.Context) {
+	content := `
+<div class="card">
+    <div class="card-header">
+        <h1 class="card-title">Reconcile Statements</h1>
+        <button class="btn btn-secondary"
+                hx-post="/receipts-web/htmx/reconcile/match"
+                hx-target="#reconcile-result">
+            Auto-match
+        </button>
+    </div>
+    <p>Import an OFX file or a bank or credit card CSV statement. Transactions are matched to receipts with the
+       same amount and currency dated up to ` + strconv.Itoa(matchWindowDays) + ` days apart, preferring similar merchant names.
+       Only debits are matched, so refunds and payments received stay unlinked.</p>
+
+    <form hx-post="/receipts-web/htmx/reconcile/import"
+          hx-encoding="multipart/form-data"
+          hx-target="#reconcile-result"
+          hx-indicator="#reconcile-loading">
+        <div class="filter-form">
+            <div class="form-group">
+                <label for="statement-file">Statement (OFX or CSV)</label>
+                <input type="file" id="statement-file" name="file" accept=".ofx,.qfx,.csv,text/csv" required>
+            </div>
+            <div class="form-group">
+                <label for="account">Account</label>
+                <input type="text" id="account" name="account" placeholder="e.g. Nubank credit card">
+            </div>
+            <div class="form-group">
+                <label for="statement-currency">Currency</label>
+                <input type="text" id="statement-currency" name="currency" maxlength="3" placeholder="From the file, else ` + baseCurrency() + `">
+            </div>
+            <div class="form-group">
+                <label for="debits-positive">
+                    <input type="checkbox" id="debits-positive" name="debits_positive" value="true">
+                    Purchases are positive amounts
+                </label>
+            </div>
+        </div>
+        <button type="submit" class="btn btn-primary">Import Statement</button>
+    </form>
+
+    <div id="reconcile-loading" class="loading-spinner htmx-indicator"></div>
+    <div id="reconcile-result" class="mt-3"></div>
+</div>
+
+<div class="card">
+    <div id="reconcile-lists" hx-get="/receipts-web/htmx/reconcile" hx-trigger="load, reconcileChanged from:body">
+        <div class="loading-spinner"></div>
+    </div>
+</div>
+`
+	page := renderPageWithLayout("Reconcile Statements", content)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(page))
+}
+
+// HtmxImportStatement imports a statement and reports the outcome
+func (h *WebHandler) HtmxImportStatement(c *gin.Context) {
+	data, _, err := readImportFile(c)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse(template.HTMLEscapeString(err.Error()))))
+		return
+	}
+	options, err := statementOptionsFromForm(c)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse(template.HTMLEscapeString(err.Error()))))
+		return
+	}
+
+	result, err := h.repo.importStatement(auth.UserID(c), data, options)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse(template.HTMLEscapeString(err.Error()))))
+		return
+	}
+
+	c.Header("HX-Trigger", "reconcileChanged")
+	c.Data(http.StatusOK, "text/html", []byte(createSuccessResponse(fmt.Sprintf(
+		"Imported %d transactions (%d already imported) and matched %d to receipts",
+		result.Imported, result.Duplicates, result.Matched))))
+}
+
+// HtmxMatchTransactions runs automatic matching and reports how many were linked
+func (h *WebHandler) HtmxMatchTransactions(c *gin.Context) {
+	matched, err := h.repo.MatchTransactions(auth.UserID(c))
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Failed to match transactions")))
+		return
+	}
+
+	c.Header("HX-Trigger", "reconcileChanged")
+	c.Data(http.StatusOK, "text/html", []byte(createSuccessResponse(fmt.Sprintf("Matched %d transactions", matched))))
+}
+
+// HtmxReconcile returns the unmatched transactions and receipts side by side, and the matched transactions
+func (h *WebHandler) HtmxReconcile(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html", []byte(h.renderReconcile(auth.UserID(c), "")))
+}
+
+// HtmxLinkTransaction links the selected transaction and receipt
+func (h *WebHandler) HtmxLinkTransaction(c *gin.Context) {
+	transactionID, err1 := strconv.ParseInt(c.PostForm("transaction_id"), 10, 64)
+	receiptID, err2 := strconv.ParseInt(c.PostForm("receipt_id"), 10, 64)
+	if err1 != nil || err2 != nil {
+		c.Data(http.StatusOK, "text/html", []byte(h.renderReconcile(auth.UserID(c), createErrorResponse("Select a transaction and a receipt to link"))))
+		return
+	}
+
+	if err := h.repo.LinkTransaction(auth.UserID(c), transactionID, receiptID); err != nil {
+		message := "Failed to link transaction"
+		if errors.Is(err, ErrReceiptAlreadyLinked) {
+			message = "That receipt is already linked to another transaction"
+		}
+		c.Data(http.StatusOK, "text/html", []byte(h.renderReconcile(auth.UserID(c), createErrorResponse(message))))
+		return
+	}
+
+	c.Data(http.StatusOK, "text/html", []byte(h.renderReconcile(auth.UserID(c), "")))
+}
+
+// HtmxUnlinkTransaction removes a transaction's link and returns the updated lists
+func (h *WebHandler) HtmxUnlinkTransaction(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Invalid transaction ID")))
+		return
+	}
+
+	message := ""
+	if err := h.repo.UnlinkTransaction(auth.UserID(c), id); err != nil {
+		message = createErrorResponse("Failed to unlink transaction")
+	}
+	c.Data(http.StatusOK, "text/html", []byte(h.renderReconcile(auth.UserID(c), message)))
+}
+
+// renderReconcile renders the reconciliation lists, preceded by an optional message
+func (h *WebHandler) renderReconcile(userID int64, message string) string {
+	transactions, err := h.repo.ListTransactions(userID, "")
+	if err != nil {
+		return createErrorResponse("Failed to load transactions")
+	}
+	receipts, err := h.repo.UnmatchedReceipts(userID)
+	if err != nil {
+		return createErrorResponse("Failed to load receipts")
+	}
+
+	var unmatched, matched strings.Builder
+	for _, tx := range transactions {
+		if tx.ReceiptID == nil {
+			unmatched.WriteString(fmt.Sprintf(`
+			<tr>
+				<td><input type="radio" name="transaction_id" value="%d"></td>
+				<td>%s</td>
+				<td>%s</td>
+				<td>%s</td>
+			</tr>`,
+				tx.ID, tx.PostedAt.Format("2006-01-02"), template.HTMLEscapeString(tx.Description), formatMoney(tx.Amount, tx.Currency)))
+			continue
+		}
+
+		method := tx.MatchMethod
+		if tx.MatchScore != nil {
+			method = fmt.Sprintf("%s (%.0f%%)", method, *tx.MatchScore*100)
+		}
+		matched.WriteString(fmt.Sprintf(`
+		<tr>
+			<td>%s</td>
+			<td>%s</td>
+			<td>%s</td>
+			<td><a href="/receipts-web/view/%d">Receipt #%d</a></td>
+			<td>%s</td>
+			<td>
+				<button class="btn btn-sm btn-secondary"
+						hx-delete="/receipts-web/htmx/reconcile/link/%d"
+						hx-target="#reconcile-lists">
+					Unlink
+				</button>
+			</td>
+		</tr>`,
+			tx.PostedAt.Format("2006-01-02"), template.HTMLEscapeString(tx.Description), formatMoney(tx.Amount, tx.Currency),
+			*tx.ReceiptID, *tx.ReceiptID, method, tx.ID))
+	}
+
+	var receiptRows strings.Builder
+	for _, receipt := range receipts {
+		receiptRows.WriteString(fmt.Sprintf(`
+			<tr>
+				<td><input type="radio" name="receipt_id" value="%d"></td>
+				<td>%s</td>
+				<td><a href="/receipts-web/view/%d">%s</a></td>
+				<td>%s</td>
+			</tr>`,
+			receipt.ID, formatDate(receipt.PurchaseDate), receipt.ID,
+			template.HTMLEscapeString(receipt.StoreName), formatMoney(receipt.TotalAmount, receipt.Currency)))
+	}
+
+	empty := func(rows string, text string) string {
+		if rows == "" {
+			return fmt.Sprintf(`<tr><td colspan="4">%s</td></tr>`, text)
+		}
+		return rows
+	}
+
+	out := message + fmt.Sprintf(`
+	<form hx-post="/receipts-web/htmx/reconcile/link" hx-target="#reconcile-lists">
+		<div class="reconcile-grid">
+			<div>
+				<h2>Transactions Without Receipt</h2>
+				<table class="table"><thead><tr><th></th><th>Date</th><th>Description</th><th>Amount</th></tr></thead>
+				<tbody>%s</tbody></table>
+			</div>
+			<div>
+				<h2>Receipts Without Transaction</h2>
+				<table class="table"><thead><tr><th></th><th>Date</th><th>Store</th><th>Amount</th></tr></thead>
+				<tbody>%s</tbody></table>
+			</div>
+		</div>
+		<button type="submit" class="btn btn-primary">Link Selected</button>
+	</form>
+	`,
+		empty(unmatched.String(), "All transactions have a receipt."),
+		empty(receiptRows.String(), "All receipts have a transaction."))
+
+	if matched.Len() > 0 {
+		out += `<h2 class="mt-4">Matched</h2><div class="table-responsive"><table class="table"><thead><tr><th>Date</th><th>Description</th><th>Amount</th><th>Receipt</th><th>Match</th><th>Actions</th></tr></thead><tbody>` +
+			matched.String() + `</tbody></table></div>`
+	}
+
+	return out
+}
@@ -0,0 +1,160 @@
+package receipts
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/mauroue/cereja-corp/internal/models"
+)
+
+// Units of measure recognised on receipt items
+const (
+	UnitKilogram   = "kg"
+	UnitGram       = "g"
+	UnitLiter      = "l"
+	UnitMilliliter = "ml"
+	UnitPiece      = "un"
+	UnitPack       = "pct"
+	UnitDozen      = "dz"
+)
+
+// unitAliases maps the spellings found in OCR text and in the NFC-e uCom
+// field (see ParseNFCe) to one of the unit constants above
+var unitAliases = map[string]string{
+	"kg": UnitKilogram, "kgs": UnitKilogram, "quilo": UnitKilogram, "quilos": UnitKilogram,
+	"g": UnitGram, "gr": UnitGram, "grs": UnitGram, "gramas": UnitGram,
+	"l": UnitLiter, "lt": UnitLiter, "lts": UnitLiter, "litro": UnitLiter, "litros": UnitLiter,
+	"ml": UnitMilliliter,
+	"un": UnitPiece, "und": UnitPiece, "unid": UnitPiece, "u": UnitPiece, "pc": UnitPiece, "pç": UnitPiece, "peca": UnitPiece,
+	"pct": UnitPack, "pac": UnitPack, "pacote": UnitPack,
+	"dz": UnitDozen, "duz": UnitDozen, "duzia": UnitDozen,
+}
+
+var (
+	// quantityPattern matches a quantity optionally followed by a unit, e.g. "0,482 kg" or "2 UN"
+	quantityPattern = regexp.MustCompile(`(?i)^\s*(\d+(?:[.,]\d+)?)\s*([a-zç.]+)?\s*$`)
+	// packSizePattern matches a pack size inside an item name, e.g. "ARROZ 5KG" or "CERVEJA 6X350ML"
+	packSizePattern = regexp.MustCompile(`(?i)(?:(\d+)\s*x\s*)?(\d+(?:[.,]\d+)?)\s*(kg|g|gr|l|lt|ml)\b`)
+	// rowUnitPattern matches "<quantity> <unit> x <price>" inside a full receipt row
+	rowUnitPattern = regexp.MustCompile(`(?i)(\d+(?:[.,]\d+)?)\s*(kg|g|gr|l|lt|ml|un|und|pct|dz)\s*x`)
+)
+
+// ParseUnit normalises a unit string to one of the unit constants. Trailing
+// dots, as in "kg." or "und.", are ignored.
+func ParseUnit(s string) (string, bool) {
+	unit, ok := unitAliases[strings.TrimRight(strings.ToLower(strings.TrimSpace(s)), ".")]
+	return unit, ok
+}
+
+// ParseQuantity parses a quantity with an optional unit, such as "0,482 kg".
+// When no unit is present the quantity is assumed to be in pieces.
+func ParseQuantity(s string) (float64, string, bool) {
+	matches := quantityPattern.FindStringSubmatch(s)
+	if matches == nil {
+		return 0, "", false
+	}
+
+	qty, err := parseFloat(matches[1])
+	if err != nil {
+		return 0, "", false
+	}
+
+	unit := UnitPiece
+	if matches[2] != "" {
+		parsed, ok := ParseUnit(matches[2])
+		if !ok {
+			return 0, "", false
+		}
+		unit = parsed
+	}
+
+	return qty, unit, true
+}
+
+// parseRowUnit looks for a "<quantity> <unit> x" fragment in a full receipt row
+func parseRowUnit(row string) (float64, string, bool) {
+	matches := rowUnitPattern.FindStringSubmatch(row)
+	if matches == nil {
+		return 0, "", false
+	}
+	return ParseQuantity(matches[1] + " " + matches[2])
+}
+
+// toBaseUnit converts a quantity to kilograms, liters or pieces
+func toBaseUnit(qty float64, unit string) (float64, string) {
+	switch unit {
+	case UnitKilogram:
+		return qty, UnitKilogram
+	case UnitGram:
+		return qty / 1000, UnitKilogram
+	case UnitLiter:
+		return qty, UnitLiter
+	case UnitMilliliter:
+		return qty / 1000, UnitLiter
+	case UnitDozen:
+		return qty * 12, UnitPiece
+	default:
+		return qty, UnitPiece
+	}
+}
+
+// packSize extracts the content of one package from an item name,
+// e.g. "LEITE INTEGRAL 1L" is 1 liter and "CERVEJA 6X350ML" is 2.1 liters
+func packSize(name string) (float64, string, bool) {
+	matches := packSizePattern.FindStringSubmatch(name)
+	if matches == nil {
+		return 0, "", false
+	}
+
+	size, err := parseFloat(matches[2])
+	if err != nil || size <= 0 {
+		return 0, "", false
+	}
+	if matches[1] != "" {
+		count, err := parseFloat(matches[1])
+		if err == nil && count > 0 {
+			size *= count
+		}
+	}
+
+	unit, ok := ParseUnit(matches[3])
+	if !ok {
+		return 0, "", false
+	}
+
+	size, unit = toBaseUnit(size, unit)
+	return size, unit, true
+}
+
+// NormalizeItemUnits fills the base unit, base quantity and normalized unit
+// price of an item from its unit, quantity, name and total price.
+// Items sold by piece or package use the pack size in their name when present,
+// so that "ARROZ 5KG" and "ARROZ 1KG" are both compared per kilogram.
+// An item without a quantity counts as one of its unit; its quantity is left
+// as recorded.
+func NormalizeItemUnits(item *models.ReceiptItem) {
+	if item.Unit == "" {
+		item.Unit = UnitPiece
+	}
+	qty := item.Quantity
+	if qty <= 0 {
+		qty = 1
+	}
+
+	item.BaseQuantity, item.BaseUnit = toBaseUnit(qty, item.Unit)
+
+	if item.Unit == UnitPiece || item.Unit == UnitPack {
+		if size, unit, ok := packSize(item.Name); ok {
+			item.BaseQuantity = qty * size
+			item.BaseUnit = unit
+		}
+	}
+
+	total := item.TotalPrice
+	if total == 0 {
+		total = item.UnitPrice * qty
+	}
+	if item.BaseQuantity > 0 {
+		item.NormalizedUnitPrice = total / item.BaseQuantity
+	}
+}
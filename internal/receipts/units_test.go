@@ -0,0 +1,204 @@
+package receipts
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mauroue/cereja-corp/internal/models"
+)
+
+// approx reports whether two amounts are equal to within rounding
+func approx(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestParseQuantity(t *testing.T) {
+	tests := []struct {
+		in   string
+		qty  float64
+		unit string
+		ok   bool
+	}{
+		{"0,482 kg", 0.482, UnitKilogram, true},
+		{"2 UN", 2, UnitPiece, true},
+		{"3", 3, UnitPiece, true},
+		{"1.5L", 1.5, UnitLiter, true},
+		{" 500 gr ", 500, UnitGram, true},
+		{"1 kg.", 1, UnitKilogram, true},
+		{"2 und.", 2, UnitPiece, true},
+		{"1 PÇ", 1, UnitPiece, true},
+		{"12 dz", 12, UnitDozen, true},
+		{"2 caixas", 0, "", false},
+		{"kg", 0, "", false},
+		{"", 0, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			qty, unit, ok := ParseQuantity(tt.in)
+			if ok != tt.ok || !approx(qty, tt.qty) || unit != tt.unit {
+				t.Errorf("ParseQuantity(%q) = %v, %q, %v; want %v, %q, %v", tt.in, qty, unit, ok, tt.qty, tt.unit, tt.ok)
+			}
+		})
+	}
+}
+
+func TestParseRowUnit(t *testing.T) {
+	tests := []struct {
+		row  string
+		qty  float64
+		unit string
+		ok   bool
+	}{
+		{"TOMATE ITALIANO 0,482 KG X 8,99", 0.482, UnitKilogram, true},
+		{"PAO FRANCES 6 UN x 0,75", 6, UnitPiece, true},
+		{"ARROZ 5KG 24,90", 0, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.row, func(t *testing.T) {
+			qty, unit, ok := parseRowUnit(tt.row)
+			if ok != tt.ok || !approx(qty, tt.qty) || unit != tt.unit {
+				t.Errorf("parseRowUnit(%q) = %v, %q, %v; want %v, %q, %v", tt.row, qty, unit, ok, tt.qty, tt.unit, tt.ok)
+			}
+		})
+	}
+}
+
+func TestPackSize(t *testing.T) {
+	tests := []struct {
+		name string
+		size float64
+		unit string
+		ok   bool
+	}{
+		{"ARROZ TIPO 1 5KG", 5, UnitKilogram, true},
+		{"LEITE INTEGRAL 1L", 1, UnitLiter, true},
+		{"CERVEJA 6X350ML", 2.1, UnitLiter, true},
+		{"CAFE 500G", 0.5, UnitKilogram, true},
+		{"AZEITE 0,5 LT", 0.5, UnitLiter, true},
+		{"PAO FRANCES", 0, "", false},
+		{"SABAO 0KG", 0, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			size, unit, ok := packSize(tt.name)
+			if ok != tt.ok || !approx(size, tt.size) || unit != tt.unit {
+				t.Errorf("packSize(%q) = %v, %q, %v; want %v, %q, %v", tt.name, size, unit, ok, tt.size, tt.unit, tt.ok)
+			}
+		})
+	}
+}
+
+func TestNormalizeItemUnits(t *testing.T) {
+	tests := []struct {
+		name     string
+		item     models.ReceiptItem
+		qty      float64
+		unit     string
+		baseQty  float64
+		baseUnit string
+		price    float64
+	}{
+		{"weighed produce", models.ReceiptItem{Name: "TOMATE", Quantity: 0.5, Unit: UnitKilogram, TotalPrice: 4.5}, 0.5, UnitKilogram, 0.5, UnitKilogram, 9},
+		{"grams", models.ReceiptItem{Name: "QUEIJO", Quantity: 250, Unit: UnitGram, TotalPrice: 10}, 250, UnitGram, 0.25, UnitKilogram, 40},
+		{"pack size in name", models.ReceiptItem{Name: "ARROZ 5KG", Quantity: 2, Unit: UnitPiece, TotalPrice: 50}, 2, UnitPiece, 10, UnitKilogram, 5},
+		{"dozen", models.ReceiptItem{Name: "OVOS", Quantity: 1, Unit: UnitDozen, TotalPrice: 12}, 1, UnitDozen, 12, UnitPiece, 1},
+		{"missing unit is a piece", models.ReceiptItem{Name: "PAO", Quantity: 4, TotalPrice: 2}, 4, UnitPiece, 4, UnitPiece, 0.5},
+		{"total from unit price", models.ReceiptItem{Name: "LEITE 1L", Quantity: 3, Unit: UnitPiece, UnitPrice: 4}, 3, UnitPiece, 3, UnitLiter, 4},
+		{"zero quantity counts as one but is kept", models.ReceiptItem{Name: "SABAO", Quantity: 0, Unit: UnitPiece, TotalPrice: 7}, 0, UnitPiece, 1, UnitPiece, 7},
+		{"negative quantity is kept", models.ReceiptItem{Name: "DEVOLUCAO", Quantity: -1, Unit: UnitPiece, TotalPrice: -3}, -1, UnitPiece, 1, UnitPiece, -3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := tt.item
+			NormalizeItemUnits(&item)
+			if !approx(item.Quantity, tt.qty) || item.Unit != tt.unit {
+				t.Errorf("quantity = %v %q, want %v %q", item.Quantity, item.Unit, tt.qty, tt.unit)
+			}
+			if !approx(item.BaseQuantity, tt.baseQty) || item.BaseUnit != tt.baseUnit {
+				t.Errorf("base quantity = %v %q, want %v %q", item.BaseQuantity, item.BaseUnit, tt.baseQty, tt.baseUnit)
+			}
+			if !approx(item.NormalizedUnitPrice, tt.price) {
+				t.Errorf("normalized unit price = %v, want %v", item.NormalizedUnitPrice, tt.price)
+			}
+		})
+	}
+}
+
+func TestParseNFCe(t *testing.T) {
+	const doc = `<?xml version="1.0" encoding="UTF-8"?>
+<nfeProc xmlns="http://www.portalfiscal.inf.br/nfe" versao="4.00">
+  <NFe>
+    <infNFe Id="NFe35240512345678000190650010000012341000012345" versao="4.00">
+      <ide><dhEmi>2024-05-10T18:32:11-03:00</dhEmi></ide>
+      <emit><xNome>SUPERMERCADO EXEMPLO LTDA</xNome><xFant>Mercado Exemplo</xFant></emit>
+      <det nItem="1"><prod><xProd>TOMATE ITALIANO</xProd><uCom>KG</uCom><qCom>0.4820</qCom><vUnCom>8.99</vUnCom><vProd>4.33</vProd></prod></det>
+      <det nItem="2"><prod><xProd>ARROZ TIPO 1 5KG</xProd><uCom>UN</uCom><qCom>1.0000</qCom><vUnCom>24.90</vUnCom><vProd>24.90</vProd></prod></det>
+      <det nItem="3"><prod><xProd>AGUA 6X1,5L</xProd><uCom>FD</uCom><qCom>2.0000</qCom><vUnCom>9.00</vUnCom><vProd>18.00</vProd></prod></det>
+      <total><ICMSTot><vNF>47.23</vNF></ICMSTot></total>
+    </infNFe>
+  </NFe>
+</nfeProc>`
+
+	receipt, items, err := ParseNFCe(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("ParseNFCe: %v", err)
+	}
+
+	if receipt.StoreName != "Mercado Exemplo" {
+		t.Errorf("store = %q, want the trade name", receipt.StoreName)
+	}
+	if want := time.Date(2024, 5, 10, 21, 32, 11, 0, time.UTC); !receipt.PurchaseDate.Equal(want) {
+		t.Errorf("purchase date = %v, want %v", receipt.PurchaseDate, want)
+	}
+	if !approx(receipt.TotalAmount, 47.23) {
+		t.Errorf("total = %v, want 47.23", receipt.TotalAmount)
+	}
+
+	want := []struct {
+		unit     string
+		qty      float64
+		baseQty  float64
+		baseUnit string
+	}{
+		{UnitKilogram, 0.482, 0.482, UnitKilogram},
+		{UnitPiece, 1, 5, UnitKilogram},
+		{UnitPiece, 2, 18, UnitLiter},
+	}
+	if len(items) != len(want) {
+		t.Fatalf("got %d items, want %d", len(items), len(want))
+	}
+	for i, w := range want {
+		item := items[i]
+		if item.Unit != w.unit || !approx(item.Quantity, w.qty) || !approx(item.BaseQuantity, w.baseQty) || item.BaseUnit != w.baseUnit {
+			t.Errorf("item %d = %v %q (%v %q), want %v %q (%v %q)", i+1,
+				item.Quantity, item.Unit, item.BaseQuantity, item.BaseUnit, w.qty, w.unit, w.baseQty, w.baseUnit)
+		}
+	}
+}
+
+func TestParseNFCeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+	}{
+		{"not an invoice", `<html><body>receipt</body></html>`},
+		{"malformed", `<NFe><infNFe><ide>`},
+		{"bad date", `<NFe><infNFe><ide><dhEmi>yesterday</dhEmi></ide></infNFe></NFe>`},
+		{"bad quantity", `<NFe><infNFe><ide><dhEmi>2024-05-10T18:32:11-03:00</dhEmi></ide>` +
+			`<det><prod><xProd>X</xProd><qCom>1,5</qCom></prod></det></infNFe></NFe>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := ParseNFCe(strings.NewReader(tt.doc)); err == nil {
+				t.Errorf("ParseNFCe accepted %s", tt.name)
+			}
+		})
+	}
+}
@@ -0,0 +1,476 @@
+package receipts
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mauroue/cereja-corp/internal/auth"
+	"github.com/mauroue/cereja-corp/internal/models"
+)
+
+// Warranty statuses accepted by ListWarranties
+const (
+	WarrantyActive  = "active"
+	WarrantyExpired = "expired"
+	WarrantyAll     = "all"
+)
+
+// maxWarrantyMonths bounds warranty durations to catch typos such as days
+// entered as months
+const maxWarrantyMonths = 240
+
+// warrantyExpiry computes a warranty's expiry date from its receipt's
+// purchase date, selected with receipts as r and warranties as w
+const warrantyExpiry = `(r.purchase_date::date + make_interval(months => w.duration_months))::date`
+
+// ErrInvalidWarranty is returned for warranties with an invalid duration or serial number
+var ErrInvalidWarranty = errors.New("invalid warranty")
+
+// warrantyColumns lists the columns read by scanWarranty, selected from
+// warranties w joined with receipt_items ri and receipts r
+const warrantyColumns = `w.item_id, ri.receipt_id, ri.name, r.store_name, r.purchase_date,
+	w.duration_months, w.serial_number, ` + warrantyExpiry + `, w.created_at, w.updated_at`
+
+// scanWarranty scans a row selected with warrantyColumns
+func scanWarranty(row interface{ Scan(...any) error }) (*models.Warranty, error) {
+	var w models.Warranty
+	if err := row.Scan(
+		&w.ItemID,
+		&w.ReceiptID,
+		&w.ItemName,
+		&w.StoreName,
+		&w.PurchaseDate,
+		&w.DurationMonths,
+		&w.SerialNumber,
+		&w.ExpiresOn,
+		&w.CreatedAt,
+		&w.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// warrantyDaysLeft returns the number of days until a warranty expires,
+// negative once it has expired
+func warrantyDaysLeft(w *models.Warranty, now time.Time) int {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	expires := time.Date(w.ExpiresOn.Year(), w.ExpiresOn.Month(), w.ExpiresOn.Day(), 0, 0, 0, 0, time.UTC)
+	return int(expires.Sub(today).Hours() / 24)
+}
+
+// GetWarranty retrieves the warranty of one of the user's items
+func (r *Repository) GetWarranty(userID, itemID int64) (*models.Warranty, error) {
+	return scanWarranty(r.db.QueryRow(`
+		SELECT `+warrantyColumns+`
+		FROM warranties w
+		JOIN receipt_items ri ON ri.id = w.item_id
+		JOIN receipts r ON r.id = ri.receipt_id
+		WHERE w.item_id = $1 AND r.user_id = $2
+	`, itemID, userID))
+}
+
+// SetWarranty starts or updates tracking the warranty of one of the user's
+// items. It returns sql.ErrNoRows if the user has no such item.
+func (r *Repository) SetWarranty(userID, itemID int64, months int, serial string) (*models.Warranty, error) {
+	serial = strings.TrimSpace(serial)
+	if months <= 0 || months > maxWarrantyMonths {
+		return nil, fmt.Errorf("%w: duration must be between 1 and %d months", ErrInvalidWarranty, maxWarrantyMonths)
+	}
+	if len(serial) > 255 {
+		return nil, fmt.Errorf("%w: serial number is too long", ErrInvalidWarranty)
+	}
+
+	result, err := r.db.Exec(`
+		INSERT INTO warranties (item_id, duration_months, serial_number)
+		SELECT ri.id, $3, $4
+		FROM receipt_items ri
+		JOIN receipts r ON r.id = ri.receipt_id
+		WHERE ri.id = $1 AND r.user_id = $2
+		ON CONFLICT (item_id) DO UPDATE
+		SET duration_months = EXCLUDED.duration_months, serial_number = EXCLUDED.serial_number, updated_at = NOW()
+	`, itemID, userID, months, serial)
+	if err != nil {
+		return nil, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	return r.GetWarranty(userID, itemID)
+}
+
+// RemoveWarranty stops tracking an item's warranty. It returns sql.ErrNoRows
+// if the user has no such warranty.
+func (r *Repository) RemoveWarranty(userID, itemID int64) error {
+	result, err := r.db.Exec(`
+		DELETE FROM warranties w
+		USING receipt_items ri, receipts r
+		WHERE w.item_id = $1 AND ri.id = w.item_id AND r.id = ri.receipt_id AND r.user_id = $2
+	`, itemID, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ListWarranties returns the user's warranties with the given status, soonest
+// expiry first. With within > 0 only active warranties expiring in the next
+// within days are returned.
+func (r *Repository) ListWarranties(userID int64, status string, within int) ([]*models.Warranty, error) {
+	condition := ""
+	switch status {
+	case WarrantyActive:
+		condition = `AND ` + warrantyExpiry + ` >= CURRENT_DATE`
+	case WarrantyExpired:
+		condition = `AND ` + warrantyExpiry + ` < CURRENT_DATE`
+	case WarrantyAll:
+	default:
+		return nil, fmt.Errorf("unsupported warranty status %q", status)
+	}
+	if within > 0 {
+		condition = fmt.Sprintf(`AND %[1]s >= CURRENT_DATE AND %[1]s < CURRENT_DATE + %[2]d`, warrantyExpiry, within)
+	}
+
+	rows, err := r.db.Query(`
+		SELECT `+warrantyColumns+`
+		FROM warranties w
+		JOIN receipt_items ri ON ri.id = w.item_id
+		JOIN receipts r ON r.id = ri.receipt_id
+		WHERE r.user_id = $1 `+condition+`
+		ORDER BY `+warrantyExpiry+`, w.item_id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	warranties := []*models.Warranty{}
+	for rows.Next() {
+		w, err := scanWarranty(rows)
+		if err != nil {
+			return nil, err
+		}
+		warranties = append(warranties, w)
+	}
+
+	return warranties, rows.Err()
+}
+
+// warrantyFilterFromQuery reads the status (default active) and
+// expiring_within query parameters
+func warrantyFilterFromQuery(c *gin.Context) (string, int, error) {
+	status := c.DefaultQuery("status", WarrantyActive)
+	if status != WarrantyActive && status != WarrantyExpired && status != WarrantyAll {
+		return "", 0, errors.New("status must be active, expired or all")
+	}
+	within := 0
+	if raw := c.Query("expiring_within"); raw != "" {
+		days, err := strconv.Atoi(raw)
+		if err != nil || days < 0 {
+			return "", 0, errors.New("expiring_within must be a number of days")
+		}
+		within = days
+	}
+	return status, within, nil
+}
+
+// warrantyRequest is the JSON body for tracking an item's warranty
+type warrantyRequest struct {
+	DurationMonths int    `json:"duration_months" binding:"required"`
+	SerialNumber   string `json:"serial_number"`
+}
+
+// ListWarranties returns the user's warranties, filtered by ?status= and ?expiring_within=
+func (h *Handler) ListWarranties(c *gin.Context) {
+	status, within, err := warrantyFilterFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	warranties, err := h.repo.ListWarranties(auth.UserID(c), status, within)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list warranties"})
+		return
+	}
+
+	c.JSON(http.StatusOK, warranties)
+}
+
+// SetWarranty starts or updates tracking an item's warranty
+func (h *Handler) SetWarranty(c *gin.Context) {
+	itemID, err := strconv.ParseInt(c.Param("item_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		return
+	}
+
+	var req warrantyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	warranty, err := h.repo.SetWarranty(auth.UserID(c), itemID, req.DurationMonths, req.SerialNumber)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidWarranty):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, sql.ErrNoRows):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save warranty"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, warranty)
+}
+
+// RemoveWarranty stops tracking an item's warranty
+func (h *Handler) RemoveWarranty(c *gin.Context) {
+	itemID, err := strconv.ParseInt(c.Param("item_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		return
+	}
+
+	if err := h.repo.RemoveWarranty(auth.UserID(c), itemID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Warranty not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove warranty"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Warranty removed"})
+}
+
+// WarrantiesPage renders the warranties page, listing items expiring soon first
+func (h *WebHandler) WarrantiesPage(c *gin.Context) {
+	content := `
+<div class="card">
+    <div class="card-header">
+        <h1 class="card-title">Warranties</h1>
+    </div>
+    <p>Track an item's warranty from its receipt page. Each warranty links to the receipt image as proof of purchase.</p>
+
+    <div class="filter-form" id="warranty-filters">
+        <div class="form-group">
+            <label for="warranty-status">Status</label>
+            <select id="warranty-status" name="status"
+                    hx-get="/receipts-web/htmx/warranties"
+                    hx-include="#warranty-filters"
+                    hx-target="#warranties-list">
+                <option value="active" selected>Active</option>
+                <option value="expired">Expired</option>
+                <option value="all">All</option>
+            </select>
+        </div>
+        <div class="form-group">
+            <label for="expiring-within">Expiring</label>
+            <select id="expiring-within" name="expiring_within"
+                    hx-get="/receipts-web/htmx/warranties"
+                    hx-include="#warranty-filters"
+                    hx-target="#warranties-list">
+                <option value="">Any time</option>
+                <option value="30">Within 30 days</option>
+                <option value="90">Within 90 days</option>
+                <option value="365">Within a year</option>
+            </select>
+        </div>
+    </div>
+
+    <div id="warranties-list" hx-get="/receipts-web/htmx/warranties" hx-include="#warranty-filters" hx-trigger="load">
+        <div class="loading-spinner"></div>
+    </div>
+</div>
+`
+
+	page := renderPageWithLayout("Warranties", content)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(page))
+}
+
+// HtmxWarranties returns the filtered warranties table
+func (h *WebHandler) HtmxWarranties(c *gin.Context) {
+	status, within, err := warrantyFilterFromQuery(c)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse(template.HTMLEscapeString(err.Error()))))
+		return
+	}
+
+	warranties, err := h.repo.ListWarranties(auth.UserID(c), status, within)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Failed to load warranties")))
+		return
+	}
+	if len(warranties) == 0 {
+		c.Data(http.StatusOK, "text/html", []byte(`<p>No warranties found.</p>`))
+		return
+	}
+
+	now := time.Now()
+	var out strings.Builder
+	out.WriteString(`<table class="table"><thead><tr><th>Item</th><th>Serial Number</th><th>Store</th><th>Purchased</th><th>Expires</th><th>Status</th><th>Proof</th></tr></thead><tbody>`)
+	for _, w := range warranties {
+		out.WriteString(fmt.Sprintf(`<tr><td>%s</td><td>%s</td><td><a href="/receipts-web/view/%d">%s</a></td><td>%s</td><td>%s</td><td>%s</td><td><a href="/api/v1/receipts/%d/image" target="_blank">Receipt image</a></td></tr>`,
+			template.HTMLEscapeString(w.ItemName), template.HTMLEscapeString(w.SerialNumber),
+			w.ReceiptID, template.HTMLEscapeString(w.StoreName), formatDate(w.PurchaseDate),
+			formatDate(w.ExpiresOn), formatWarrantyStatus(w, now), w.ReceiptID))
+	}
+	out.WriteString(`</tbody></table>`)
+
+	c.Data(http.StatusOK, "text/html", []byte(out.String()))
+}
+
+// HtmxReceiptWarranties returns the warranty form of a receipt's items
+func (h *WebHandler) HtmxReceiptWarranties(c *gin.Context) {
+	receiptID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Invalid receipt ID")))
+		return
+	}
+
+	c.Data(http.StatusOK, "text/html", []byte(h.renderReceiptWarranties(auth.UserID(c), receiptID, "")))
+}
+
+// HtmxSetWarranty tracks an item's warranty from the receipt page
+func (h *WebHandler) HtmxSetWarranty(c *gin.Context) {
+	receiptID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Invalid receipt ID")))
+		return
+	}
+	itemID, err := strconv.ParseInt(c.Param("item_id"), 10, 64)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Invalid item ID")))
+		return
+	}
+
+	userID := auth.UserID(c)
+	months, err := strconv.Atoi(c.PostForm("duration_months"))
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(h.renderReceiptWarranties(userID, receiptID, createErrorResponse("Please enter the warranty length in months"))))
+		return
+	}
+
+	message := createSuccessResponse("Warranty saved")
+	if _, err := h.repo.SetWarranty(userID, itemID, months, c.PostForm("serial_number")); err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidWarranty):
+			message = createErrorResponse(template.HTMLEscapeString(err.Error()))
+		case errors.Is(err, sql.ErrNoRows):
+			message = createErrorResponse("Item not found")
+		default:
+			message = createErrorResponse("Failed to save warranty")
+		}
+	}
+	c.Data(http.StatusOK, "text/html", []byte(h.renderReceiptWarranties(userID, receiptID, message)))
+}
+
+// HtmxRemoveWarranty stops tracking an item's warranty from the receipt page
+func (h *WebHandler) HtmxRemoveWarranty(c *gin.Context) {
+	receiptID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Invalid receipt ID")))
+		return
+	}
+	itemID, err := strconv.ParseInt(c.Param("item_id"), 10, 64)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Invalid item ID")))
+		return
+	}
+
+	userID := auth.UserID(c)
+	message := createSuccessResponse("Warranty removed")
+	if err := h.repo.RemoveWarranty(userID, itemID); err != nil {
+		message = createErrorResponse("Failed to remove warranty")
+	}
+	c.Data(http.StatusOK, "text/html", []byte(h.renderReceiptWarranties(userID, receiptID, message)))
+}
+
+// renderReceiptWarranties renders a row per receipt item with its warranty
+// and a form to track or update it
+func (h *WebHandler) renderReceiptWarranties(userID, receiptID int64, message string) string {
+	items, err := h.repo.GetReceiptItems(userID, receiptID)
+	if err != nil {
+		return createErrorResponse("Failed to load items")
+	}
+	if len(items) == 0 {
+		return message + `<p>This receipt has no items.</p>`
+	}
+
+	now := time.Now()
+	var out strings.Builder
+	out.WriteString(message)
+	out.WriteString(`<table class="table"><thead><tr><th>Item</th><th>Months</th><th>Serial Number</th><th>Expires</th><th>Actions</th></tr></thead><tbody>`)
+	for _, item := range items {
+		months, serial, expires, remove := "", "", "", ""
+		if w := item.Warranty; w != nil {
+			months = strconv.Itoa(w.DurationMonths)
+			serial = template.HTMLEscapeString(w.SerialNumber)
+			expires = formatDate(w.ExpiresOn) + " · " + formatWarrantyStatus(w, now)
+			remove = fmt.Sprintf(`
+					<button type="button" class="btn btn-sm btn-secondary"
+							hx-delete="/receipts-web/htmx/receipt/%d/warranties/%d"
+							hx-target="#receipt-warranties"
+							hx-confirm="Stop tracking this warranty?">
+						Remove
+					</button>`, receiptID, item.ID)
+		}
+
+		form := fmt.Sprintf(`warranty-%d`, item.ID)
+		out.WriteString(fmt.Sprintf(`
+			<tr>
+				<td>%s</td>
+				<td><input type="number" name="duration_months" form="%s" value="%s" min="1" max="%d" placeholder="12"></td>
+				<td><input type="text" name="serial_number" form="%s" value="%s" maxlength="255"></td>
+				<td>%s</td>
+				<td>
+					<form id="%s" hx-post="/receipts-web/htmx/receipt/%d/warranties/%d" hx-target="#receipt-warranties">
+						<button type="submit" class="btn btn-sm btn-primary">Save</button>%s
+					</form>
+				</td>
+			</tr>`,
+			template.HTMLEscapeString(item.Name), form, months, maxWarrantyMonths, form, serial, expires,
+			form, receiptID, item.ID, remove))
+	}
+	out.WriteString(`</tbody></table>`)
+
+	return out.String()
+}
+
+// formatWarrantyStatus describes how long a warranty has left
+func formatWarrantyStatus(w *models.Warranty, now time.Time) string {
+	days := warrantyDaysLeft(w, now)
+	switch {
+	case days < 0:
+		return "Expired"
+	case days == 0:
+		return "Expires today"
+	case days == 1:
+		return "Expires tomorrow"
+	default:
+		return fmt.Sprintf("%d days left", days)
+	}
+}
@@ -0,0 +1,97 @@
+package receipts
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mauroue/cereja-corp/internal/models"
+)
+
+func TestWarrantyStatus(t *testing.T) {
+	now := time.Date(2024, 5, 10, 23, 30, 0, 0, time.Local)
+	expiring := func(y int, m time.Month, d int) *models.Warranty {
+		return &models.Warranty{ExpiresOn: time.Date(y, m, d, 0, 0, 0, 0, time.UTC)}
+	}
+
+	tests := []struct {
+		name     string
+		warranty *models.Warranty
+		days     int
+		status   string
+	}{
+		{"expired", expiring(2024, 5, 1), -9, "Expired"},
+		{"expired yesterday", expiring(2024, 5, 9), -1, "Expired"},
+		{"today", expiring(2024, 5, 10), 0, "Expires today"},
+		{"tomorrow", expiring(2024, 5, 11), 1, "Expires tomorrow"},
+		{"across months", expiring(2024, 6, 9), 30, "30 days left"},
+		{"a year", expiring(2025, 5, 10), 365, "365 days left"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := warrantyDaysLeft(tt.warranty, now); got != tt.days {
+				t.Errorf("warrantyDaysLeft = %d, want %d", got, tt.days)
+			}
+			if got := formatWarrantyStatus(tt.warranty, now); got != tt.status {
+				t.Errorf("formatWarrantyStatus = %q, want %q", got, tt.status)
+			}
+		})
+	}
+}
+
+func TestWarrantyFilterFromQuery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		query  string
+		status string
+		within int
+		ok     bool
+	}{
+		{"", WarrantyActive, 0, true},
+		{"status=expired", WarrantyExpired, 0, true},
+		{"status=all&expiring_within=30", WarrantyAll, 30, true},
+		{"status=soon", "", 0, false},
+		{"expiring_within=-1", "", 0, false},
+		{"expiring_within=month", "", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", "/?"+tt.query, nil)
+
+			status, within, err := warrantyFilterFromQuery(c)
+			if (err == nil) != tt.ok || status != tt.status || within != tt.within {
+				t.Errorf("warrantyFilterFromQuery = %q, %d, %v; want %q, %d", status, within, err, tt.status, tt.within)
+			}
+		})
+	}
+}
+
+func TestSetWarrantyValidation(t *testing.T) {
+	// Invalid warranties are refused before the database is used
+	repo := &Repository{}
+	tests := []struct {
+		name   string
+		months int
+		serial string
+	}{
+		{"no duration", 0, ""},
+		{"negative duration", -12, ""},
+		{"too long", maxWarrantyMonths + 1, ""},
+		{"serial too long", 12, strings.Repeat("x", 256)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := repo.SetWarranty(1, 1, tt.months, tt.serial); !errors.Is(err, ErrInvalidWarranty) {
+				t.Errorf("SetWarranty = %v, want ErrInvalidWarranty", err)
+			}
+		})
+	}
+}
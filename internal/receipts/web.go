@@ -1,16 +1,17 @@
 package receipts
 
 import (
+	"errors"
 	"fmt"
+	"html/template"
 	"io"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mauroue/cereja-corp/internal/auth"
 )
 
 // WebHandler manages HTTP requests for receipt web interface
@@ -35,24 +36,104 @@ func (h *WebHandler) RegisterRoutes(router *gin.Engine) {
 	// Serve static files
 	router.Static("/static", "./internal/receipts/static")
 
+	h.RegisterAuthRoutes(router)
+
 	// Web routes
-	web := router.Group("/receipts-web")
+	web := router.Group("/receipts-web", auth.Middleware(h.api.users), auth.RequireWebUser())
 	{
 		web.GET("/", h.HomePage)
 		web.GET("/upload", h.UploadPage)
 		web.GET("/list", h.ListPage)
 		web.GET("/view/:id", h.ViewPage)
+		web.GET("/prices", h.PricesPage)
+		web.GET("/basket", h.BasketPage)
+		web.GET("/budgets", h.BudgetsPage)
+		web.GET("/import", h.ImportPage)
+		web.GET("/reconcile", h.ReconcilePage)
+		web.GET("/households", h.HouseholdsPage)
+		web.GET("/households/:id", h.HouseholdPage)
+		web.GET("/settings/tokens", h.TokensPage)
+		web.GET("/exchange-rates", h.ExchangeRatesPage)
+		web.GET("/warranties", h.WarrantiesPage)
 
 		// HTMX endpoints
 		web.POST("/htmx/upload", h.HtmxUpload)
 		web.GET("/htmx/receipts", h.HtmxListReceipts)
 		web.GET("/htmx/receipt/:id", h.HtmxGetReceipt)
 		web.GET("/htmx/receipt/:id/items", h.HtmxGetReceiptItems)
+		web.GET("/htmx/prices", h.HtmxPriceHistory)
+		web.POST("/htmx/basket", h.HtmxBasket)
+		web.GET("/htmx/budgets", h.HtmxBudgets)
+		web.POST("/htmx/budgets", h.HtmxCreateBudget)
+		web.DELETE("/htmx/budgets/:id", h.HtmxDeleteBudget)
+		web.POST("/htmx/import/columns", h.HtmxImportColumns)
+		web.POST("/htmx/import", h.HtmxImport)
+		web.GET("/htmx/import/batches", h.HtmxImportBatches)
+		web.DELETE("/htmx/import/batches/:id", h.HtmxRollbackImport)
+		web.GET("/htmx/reconcile", h.HtmxReconcile)
+		web.POST("/htmx/reconcile/import", h.HtmxImportStatement)
+		web.POST("/htmx/reconcile/match", h.HtmxMatchTransactions)
+		web.POST("/htmx/reconcile/link", h.HtmxLinkTransaction)
+		web.DELETE("/htmx/reconcile/link/:id", h.HtmxUnlinkTransaction)
+		web.GET("/htmx/households", h.HtmxHouseholds)
+		web.POST("/htmx/households", h.HtmxCreateHousehold)
+		web.GET("/htmx/households/:id/members", h.HtmxHouseholdMembers)
+		web.POST("/htmx/households/:id/members", h.HtmxAddHouseholdMember)
+		web.DELETE("/htmx/households/:id/members/:user_id", h.HtmxRemoveHouseholdMember)
+		web.GET("/htmx/households/:id/balances", h.HtmxHouseholdBalances)
+		web.POST("/htmx/households/:id/settlements", h.HtmxRecordSettlement)
+		web.GET("/htmx/households/:id/receipts", h.HtmxHouseholdReceipts)
+		web.GET("/htmx/receipt/:id/share", h.HtmxReceiptShare)
+		web.POST("/htmx/receipt/:id/share", h.HtmxShareReceipt)
+		web.DELETE("/htmx/receipt/:id/share", h.HtmxUnshareReceipt)
+		web.GET("/htmx/receipt/:id/annotations", h.HtmxReceiptAnnotations)
+		web.POST("/htmx/receipt/:id/annotations", h.HtmxSaveReceiptAnnotations)
+		web.POST("/htmx/receipt/:id/items/:item_id/tags", h.HtmxSaveItemTags)
+		web.GET("/htmx/receipt/:id/warranties", h.HtmxReceiptWarranties)
+		web.POST("/htmx/receipt/:id/warranties/:item_id", h.HtmxSetWarranty)
+		web.DELETE("/htmx/receipt/:id/warranties/:item_id", h.HtmxRemoveWarranty)
+		web.GET("/htmx/warranties", h.HtmxWarranties)
+		web.GET("/htmx/tokens", h.HtmxTokens)
+		web.POST("/htmx/tokens", h.HtmxCreateToken)
+		web.DELETE("/htmx/tokens/:id", h.HtmxRevokeToken)
+		web.GET("/htmx/exchange-rates", h.HtmxExchangeRates)
+		web.POST("/htmx/exchange-rates", h.HtmxCreateExchangeRate)
+		web.POST("/htmx/exchange-rates/import", h.HtmxImportExchangeRates)
+		web.DELETE("/htmx/exchange-rates/:id", h.HtmxDeleteExchangeRate)
+		web.POST("/htmx/receipt/:id/confirm", h.HtmxConfirmReceipt)
+		web.GET("/htmx/dashboard/summary", h.HtmxDashboardSummary)
+		web.GET("/htmx/dashboard/categories", h.HtmxDashboardCategories)
+		web.GET("/htmx/dashboard/trend", h.HtmxDashboardTrend)
+		web.GET("/htmx/dashboard/stores", h.HtmxDashboardStores)
+		web.GET("/htmx/dashboard/recent", h.HtmxDashboardRecent)
+		web.GET("/htmx/dashboard/review", h.HtmxDashboardReview)
+		web.GET("/htmx/dashboard/budgets", h.HtmxDashboardBudgets)
 	}
 }
 
 // Common HTML layout handling
 func renderPageWithLayout(title string, content string) string {
+	return renderLayout(title, `
+                <a href="/receipts-web/">Dashboard</a>
+                <a href="/receipts-web/upload">Upload</a>
+                <a href="/receipts-web/import">Import</a>
+                <a href="/receipts-web/list">My Receipts</a>
+                <a href="/receipts-web/prices">Prices</a>
+                <a href="/receipts-web/basket">Basket</a>
+                <a href="/receipts-web/budgets">Budgets</a>
+                <a href="/receipts-web/reconcile">Reconcile</a>
+                <a href="/receipts-web/households">Households</a>
+                <a href="/receipts-web/warranties">Warranties</a>
+                <a href="/receipts-web/exchange-rates">Rates</a>
+                <a href="/receipts-web/settings/tokens">Settings</a>
+                <form method="post" action="/logout" class="nav-logout">
+                    <button type="submit">Log out</button>
+                </form>`, content)
+}
+
+// renderLayout renders a page with the given navigation links, which are left
+// out of the pages shown before signing in
+func renderLayout(title, nav, content string) string {
 	return fmt.Sprintf(`
 <!DOCTYPE html>
 <html lang="en">
@@ -67,10 +148,7 @@ func renderPageWithLayout(title string, content string) string {
     <header>
         <div class="container navbar">
             <div class="logo">Receipt Scanner</div>
-            <nav class="nav-links">
-                <a href="/receipts-web/">Home</a>
-                <a href="/receipts-web/upload">Upload</a>
-                <a href="/receipts-web/list">My Receipts</a>
+            <nav class="nav-links">%s
             </nav>
         </div>
     </header>
@@ -88,32 +166,7 @@ func renderPageWithLayout(title string, content string) string {
     </footer>
 </body>
 </html>
-`, title, content, time.Now().Year())
-}
-
-// HomePage renders the home page
-func (h *WebHandler) HomePage(c *gin.Context) {
-	content := `
-<div class="card">
-    <div class="card-header">
-        <h1 class="card-title">Receipt Scanner App</h1>
-    </div>
-    <p>Welcome to the Receipt Scanner App! This application helps you track your purchases by scanning and storing your receipts.</p>
-    <p>With our app, you can:</p>
-    <ul>
-        <li>Upload images of your receipts</li>
-        <li>Automatically extract store, item, and price information</li>
-        <li>Keep track of all your purchases in one place</li>
-        <li>View detailed reports of your spending</li>
-    </ul>
-    <div class="mt-4">
-        <a href="/receipts-web/upload" class="btn btn-primary">Upload a Receipt</a>
-        <a href="/receipts-web/list" class="btn btn-secondary">View My Receipts</a>
-    </div>
-</div>
-`
-	html := renderPageWithLayout("Home", content)
-	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(html))
+`, title, nav, content, time.Now().Year())
 }
 
 // UploadPage renders the upload page
@@ -147,6 +200,11 @@ func (h *WebHandler) UploadPage(c *gin.Context) {
             </div>
             <div id="file-selected" class="file-selected-info"></div>
         </div>
+
+        <div class="form-group">
+            <label for="currency">Currency</label>
+            <input type="text" id="currency" name="currency" maxlength="3" value="` + baseCurrency() + `">
+        </div>
         
         <div class="form-group text-center">
             <button type="submit" class="btn btn-primary" id="upload-button" onclick="validateUpload(event)">
@@ -205,23 +263,115 @@ func (h *WebHandler) UploadPage(c *gin.Context) {
 
 // ListPage renders the list page
 func (h *WebHandler) ListPage(c *gin.Context) {
-	content := `
+	var categoryOptions, tagOptions strings.Builder
+	if categories, err := h.repo.ListCategories(auth.UserID(c)); err == nil {
+		for _, category := range categories {
+			categoryOptions.WriteString(fmt.Sprintf(`<option value="%d">%s</option>`,
+				category.ID, template.HTMLEscapeString(category.Name)))
+		}
+	}
+	if tags, err := h.repo.ListTags(auth.UserID(c)); err == nil {
+		for _, tag := range tags {
+			tagOptions.WriteString(fmt.Sprintf(`<option value="%s">`, template.HTMLEscapeString(tag.Name)))
+		}
+	}
+
+	content := fmt.Sprintf(`
 <div class="card">
     <div class="card-header">
         <h1 class="card-title">My Receipts</h1>
+        <div>
+            <a href="/api/v1/receipts/export?format=csv" class="btn btn-secondary" data-format="csv" onclick="return exportReceipts(this)">Export CSV</a>
+            <a href="/api/v1/receipts/export?format=json" class="btn btn-secondary" data-format="json" onclick="return exportReceipts(this)">Export JSON</a>
+            <a href="/api/v1/receipts/ledger?format=beancount" class="btn btn-secondary" data-format="beancount" onclick="return exportReceipts(this)">Export Beancount</a>
+            <a href="/api/v1/receipts/ledger?format=hledger" class="btn btn-secondary" data-format="hledger" onclick="return exportReceipts(this)">Export hledger</a>
+        </div>
     </div>
-    
+
+    <form id="receipt-filters"
+          class="filter-form"
+          hx-get="/receipts-web/htmx/receipts"
+          hx-target="#receipts-list"
+          hx-trigger="change, submit, keyup changed delay:300ms from:#search"
+          hx-indicator="#receipts-loading">
+        <div class="form-group">
+            <label for="search">Search</label>
+            <input type="search" id="search" name="search" placeholder="Store, item or description">
+        </div>
+        <div class="form-group">
+            <label for="from">From</label>
+            <input type="date" id="from" name="from">
+        </div>
+        <div class="form-group">
+            <label for="to">To</label>
+            <input type="date" id="to" name="to">
+        </div>
+        <div class="form-group">
+            <label for="min_amount">Min Amount</label>
+            <input type="number" id="min_amount" name="min_amount" step="0.01" min="0">
+        </div>
+        <div class="form-group">
+            <label for="max_amount">Max Amount</label>
+            <input type="number" id="max_amount" name="max_amount" step="0.01" min="0">
+        </div>
+        <div class="form-group">
+            <label for="category_id">Category</label>
+            <select id="category_id" name="category_id">
+                <option value="">All</option>
+                %s
+            </select>
+        </div>
+        <div class="form-group">
+            <label for="tag">Tag</label>
+            <input type="text" id="tag" name="tag" list="tag-options">
+            <datalist id="tag-options">%s</datalist>
+        </div>
+        <div class="form-group">
+            <label for="review_status">Status</label>
+            <select id="review_status" name="review_status">
+                <option value="">All</option>
+                <option value="pending">Needs review</option>
+                <option value="confirmed">Confirmed</option>
+            </select>
+        </div>
+        <div class="form-group">
+            <label for="sort">Sort By</label>
+            <select id="sort" name="sort">
+                <option value="date">Date</option>
+                <option value="amount">Amount</option>
+                <option value="store">Store</option>
+            </select>
+        </div>
+        <div class="form-group">
+            <label for="order">Order</label>
+            <select id="order" name="order">
+                <option value="desc">Descending</option>
+                <option value="asc">Ascending</option>
+            </select>
+        </div>
+    </form>
+
+    <div id="receipts-loading" class="loading-spinner htmx-indicator"></div>
     <div id="receipts-list"
          hx-get="/receipts-web/htmx/receipts"
          hx-trigger="load"
-         hx-indicator="#receipts-loading">
+         hx-include="#receipt-filters">
         <div class="text-center mt-3">
-            <div id="receipts-loading" class="loading-spinner htmx-indicator"></div>
             <p>Loading receipts...</p>
         </div>
     </div>
 </div>
-`
+
+<script>
+    // Downloads the export with the filters currently selected in the form
+    function exportReceipts(link) {
+        const params = new URLSearchParams(new FormData(document.getElementById('receipt-filters')));
+        params.set('format', link.dataset.format);
+        window.location = link.pathname + '?' + params.toString();
+        return false;
+    }
+</script>
+`, categoryOptions.String(), tagOptions.String())
 	html := renderPageWithLayout("My Receipts", content)
 	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(html))
 }
@@ -256,7 +406,34 @@ func (h *WebHandler) ViewPage(c *gin.Context) {
         </div>
     </div>
 </div>
-`, idStr, idStr)
+
+<div class="card">
+    <div class="card-header">
+        <h2 class="card-title">Tags and Note</h2>
+    </div>
+    <div id="receipt-annotations" hx-get="/receipts-web/htmx/receipt/%s/annotations" hx-trigger="load">
+        <div class="loading-spinner"></div>
+    </div>
+</div>
+
+<div class="card">
+    <div class="card-header">
+        <h2 class="card-title">Split with Household</h2>
+    </div>
+    <div id="receipt-share" hx-get="/receipts-web/htmx/receipt/%s/share" hx-trigger="load">
+        <div class="loading-spinner"></div>
+    </div>
+</div>
+
+<div class="card">
+    <div class="card-header">
+        <h2 class="card-title">Warranties</h2>
+    </div>
+    <div id="receipt-warranties" hx-get="/receipts-web/htmx/receipt/%s/warranties" hx-trigger="load">
+        <div class="loading-spinner"></div>
+    </div>
+</div>
+`, idStr, idStr, idStr, idStr, idStr)
 
 	html := renderPageWithLayout("View Receipt", content)
 	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(html))
@@ -296,39 +473,35 @@ func (h *WebHandler) HtmxUpload(c *gin.Context) {
 	}
 	defer file.Close()
 
-	// Validate file size (max 10MB)
-	if header.Size > 10*1024*1024 {
-		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("File is too large. Maximum file size is 10MB.")))
+	// Validate file size
+	if header.Size > int64(h.api.maxUploadMB)<<20 {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse(fmt.Sprintf("File is too large. Maximum file size is %dMB.", h.api.maxUploadMB))))
 		return
 	}
 
 	// Validate file type
-	fileExt := strings.ToLower(filepath.Ext(header.Filename))
-	validExts := map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".bmp": true, ".pdf": true}
-	if !validExts[fileExt] {
-		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Invalid file type. Please upload an image file (jpg, png, gif, bmp) or PDF.")))
+	if !IsReceiptFile(header.Filename) {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Invalid file type. Please upload an image file (jpg, png, gif, bmp), a PDF or an NFC-e XML.")))
 		return
 	}
 
-	// Read file data
-	fileData, err := io.ReadAll(file)
+	currency, err := formCurrency(c)
 	if err != nil {
-		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Failed to read file")))
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse(template.HTMLEscapeString(err.Error()))))
 		return
 	}
 
-	// Save the image
-	imagePath, err := h.api.ocrService.SaveImage(fileData, header.Filename)
+	// Read file data
+	fileData, err := io.ReadAll(file)
 	if err != nil {
-		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Failed to save image: "+err.Error())))
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Failed to read file")))
 		return
 	}
 
-	// Process the receipt
-	receipt, items, err := h.api.ocrService.ProcessReceipt(imagePath)
-	if err != nil {
-		errorMsg := "Failed to process receipt"
-		if strings.Contains(err.Error(), "AWS Textract client not available") {
+	// Save the image, process it and store the receipt
+	if _, _, err := h.api.processor.Ingest(auth.UserID(c), fileData, header.Filename, currency); err != nil {
+		errorMsg := createErrorResponse(template.HTMLEscapeString(err.Error()))
+		if errors.Is(err, ErrOCRUnavailable) {
 			errorMsg = `
 			<div class="alert alert-danger">
 				<strong>AWS credentials not configured</strong>
@@ -341,42 +514,12 @@ func (h *WebHandler) HtmxUpload(c *gin.Context) {
 				<p>These credentials are required to use AWS Textract for receipt processing.</p>
 			</div>
 			`
-		} else {
-			errorMsg = createErrorResponse("Error processing receipt: " + err.Error())
 		}
-
 		c.Data(http.StatusOK, "text/html", []byte(errorMsg))
-
-		// Remove the saved image if processing failed
-		if imagePath != "" {
-			os.Remove(imagePath)
-		}
-
 		return
 	}
 
-	// Ensure the default store exists
-	if err := h.api.repo.EnsureDefaultStore(); err != nil {
-		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Failed to ensure store exists: "+err.Error())))
-		return
-	}
-
-	// Save receipt data to database
-	receiptID, err := h.api.repo.CreateReceipt(receipt)
-	if err != nil {
-		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Failed to save receipt: "+err.Error())))
-		return
-	}
-
-	// Save receipt items
-	for _, item := range items {
-		item.ReceiptID = receiptID
-		_, err := h.api.repo.CreateReceiptItem(item)
-		if err != nil {
-			c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Failed to save receipt items: "+err.Error())))
-			return
-		}
-	}
+	h.repo.refreshAnalyticsAsync()
 
 	// Return success and redirect
 	c.Header("HX-Redirect", "/receipts-web/list")
@@ -384,43 +527,47 @@ func (h *WebHandler) HtmxUpload(c *gin.Context) {
 
 // HtmxListReceipts returns a list of receipts for HTMX
 func (h *WebHandler) HtmxListReceipts(c *gin.Context) {
-	// Parse query parameters
-	pageStr := c.DefaultQuery("page", "1")
-	page, err := strconv.Atoi(pageStr)
-	if err != nil || page < 1 {
-		page = 1
+	filter, err := filterFromQuery(c)
+	if err != nil {
+		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse(err.Error())))
+		return
 	}
 
-	pageSize := 10
-	search := c.Query("search")
+	// Searches are ranked by relevance and show the matching items instead
+	if filter.Search != "" {
+		offset, _ := queryInt(c, "offset")
+		results, err := h.repo.SearchReceipts(filter.Search, filter, int(offset))
+		if err != nil {
+			c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Failed to search receipts")))
+			return
+		}
+		c.Data(http.StatusOK, "text/html", []byte(renderSearchResults(results)))
+		return
+	}
 
-	// Try to get actual data from the database
-	receipts, err := h.repo.ListReceipts(page, pageSize, search)
+	page, err := h.repo.ListReceipts(filter)
 
 	// If we get an error or no receipts found, return a message
-	if err != nil || len(receipts) == 0 {
+	if err != nil || len(page.Receipts) == 0 {
 		c.Data(http.StatusOK, "text/html", []byte(`
 		<p>No receipts found. <a href="/receipts-web/upload">Upload your first receipt</a>.</p>
 		`))
 		return
 	}
 
-	// Get total count for pagination
-	total, err := h.repo.GetReceiptsCount(search)
-	if err != nil {
-		total = 0
-	}
-
 	// Format receipt data and build HTML
 	var html strings.Builder
-	html.WriteString(`<div class="table-responsive"><table class="table"><thead><tr><th>Store</th><th>Date</th><th>Amount</th><th>Actions</th></tr></thead><tbody>`)
+	html.WriteString(fmt.Sprintf(`<p>%d receipts</p>`, page.Total))
+	html.WriteString(`<div class="table-responsive"><table class="table"><thead><tr><th>Store</th><th>Date</th><th>Amount</th><th>Category</th><th>Status</th><th>Actions</th></tr></thead><tbody>`)
 
-	for _, receipt := range receipts {
+	for _, receipt := range page.Receipts {
 		formattedDate := formatDate(receipt.PurchaseDate)
-		formattedAmount := formatCurrency(receipt.TotalAmount)
+		formattedAmount := formatMoney(receipt.TotalAmount, receipt.Currency)
 
 		html.WriteString(fmt.Sprintf(`
 		<tr>
+			<td>%s%s</td>
+			<td>%s</td>
 			<td>%s</td>
 			<td>%s</td>
 			<td>%s</td>
@@ -428,25 +575,42 @@ func (h *WebHandler) HtmxListReceipts(c *gin.Context) {
 				<a href="/receipts-web/view/%d" class="btn btn-sm btn-info">View</a>
 			</td>
 		</tr>
-		`, receipt.StoreName, formattedDate, formattedAmount, receipt.ID))
+		`,
+			template.HTMLEscapeString(receipt.StoreName),
+			formatTags(receipt.Tags),
+			formattedDate,
+			formattedAmount,
+			template.HTMLEscapeString(receipt.CategoryName),
+			formatReviewStatus(receipt.ReviewStatus),
+			receipt.ID))
 	}
 
 	html.WriteString(`</tbody></table></div>`)
 
-	// Add pagination if needed
-	hasMore := total > page*pageSize
-	if hasMore {
-		nextPage := page + 1
-		html.WriteString(fmt.Sprintf(`
-		<div class="mt-3 text-center">
-			<button class="btn btn-secondary" 
-					hx-get="/receipts-web/htmx/receipts?page=%d" 
-					hx-target="#receipts-list" 
-					hx-swap="outerHTML">
-				Load More
+	// Add pagination if needed; the filter form is included so that paging keeps the filters
+	if page.PrevCursor != "" || page.NextCursor != "" {
+		html.WriteString(`<div class="mt-3 text-center">`)
+		if page.PrevCursor != "" {
+			html.WriteString(fmt.Sprintf(`
+			<button class="btn btn-secondary"
+					hx-get="/receipts-web/htmx/receipts?cursor=%s"
+					hx-include="#receipt-filters"
+					hx-target="#receipts-list">
+				Previous
 			</button>
-		</div>
-		`, nextPage))
+			`, page.PrevCursor))
+		}
+		if page.NextCursor != "" {
+			html.WriteString(fmt.Sprintf(`
+			<button class="btn btn-secondary"
+					hx-get="/receipts-web/htmx/receipts?cursor=%s"
+					hx-include="#receipt-filters"
+					hx-target="#receipts-list">
+				Next
+			</button>
+			`, page.NextCursor))
+		}
+		html.WriteString(`</div>`)
 	}
 
 	c.Data(http.StatusOK, "text/html", []byte(html.String()))
@@ -463,7 +627,7 @@ func (h *WebHandler) HtmxGetReceipt(c *gin.Context) {
 	}
 
 	// Try to get the receipt from the database
-	receipt, err := h.repo.GetReceiptByID(id)
+	receipt, err := h.repo.GetReceiptByID(auth.UserID(c), id)
 	if err != nil {
 		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("Receipt not found")))
 		return
@@ -471,7 +635,7 @@ func (h *WebHandler) HtmxGetReceipt(c *gin.Context) {
 
 	// Format the data and build HTML
 	formattedDate := formatDate(receipt.PurchaseDate)
-	formattedAmount := formatCurrency(receipt.TotalAmount)
+	formattedAmount := formatMoney(receipt.TotalAmount, receipt.Currency)
 
 	html := fmt.Sprintf(`
 	<div class="receipt-details">
@@ -488,14 +652,14 @@ func (h *WebHandler) HtmxGetReceipt(c *gin.Context) {
 		</dl>
 		
 		<div class="receipt-image-container">
-			<img src="/uploads/receipts/%s" alt="Receipt Image" class="receipt-image" />
+			<a href="/api/v1/receipts/%d/image" target="_blank"><img src="/api/v1/receipts/%d/image" alt="Receipt Image" class="receipt-image" /></a>
 		</div>
 	</div>
 	`,
 		receipt.StoreName,
 		formattedDate,
 		formattedAmount,
-		filepath.Base(receipt.ImagePath))
+		receipt.ID, receipt.ID)
 
 	c.Data(http.StatusOK, "text/html", []byte(html))
 }
@@ -511,12 +675,17 @@ func (h *WebHandler) HtmxGetReceiptItems(c *gin.Context) {
 	}
 
 	// Try to get the items from the database
-	items, err := h.repo.GetReceiptItems(id)
+	items, err := h.repo.GetReceiptItems(auth.UserID(c), id)
 	if err != nil || len(items) == 0 {
 		c.Data(http.StatusOK, "text/html", []byte(createErrorResponse("No items found for this receipt")))
 		return
 	}
 
+	currency := baseCurrency()
+	if receipt, err := h.repo.GetReceiptByID(auth.UserID(c), id); err == nil {
+		currency = receipt.Currency
+	}
+
 	// Calculate total and build HTML
 	var total float64
 	var html strings.Builder
@@ -532,6 +701,7 @@ func (h *WebHandler) HtmxGetReceiptItems(c *gin.Context) {
 						<th>Description</th>
 						<th>Quantity</th>
 						<th>Unit Price</th>
+						<th>Normalized Price</th>
 						<th>Total</th>
 					</tr>
 				</thead>
@@ -540,26 +710,28 @@ func (h *WebHandler) HtmxGetReceiptItems(c *gin.Context) {
 
 	for _, item := range items {
 		total += item.TotalPrice
-		unitPrice := formatCurrency(item.UnitPrice)
-		totalPrice := formatCurrency(item.TotalPrice)
+		unitPrice := formatMoney(item.UnitPrice, currency)
+		totalPrice := formatMoney(item.TotalPrice, currency)
+		normalizedPrice := formatMoney(item.NormalizedUnitPrice, currency) + "/" + item.BaseUnit
 
 		html.WriteString(fmt.Sprintf(`
 		<tr>
+			<td><a href="%s" title="Price history">%s</a></td>
+			<td>%s</td>
 			<td>%s</td>
 			<td>%s</td>
-			<td>%.2f</td>
 			<td>%s</td>
 			<td>%s</td>
 		</tr>
-		`, item.Name, item.Description, item.Quantity, unitPrice, totalPrice))
+		`, priceHistoryURL(item.Name), item.Name, item.Description, formatQuantity(item.Quantity, item.Unit), unitPrice, normalizedPrice, totalPrice))
 	}
 
-	formattedTotal := formatCurrency(total)
+	formattedTotal := formatMoney(total, currency)
 	html.WriteString(fmt.Sprintf(`
 				</tbody>
 				<tfoot>
 					<tr>
-						<th colspan="4" class="text-right">Total:</th>
+						<th colspan="5" class="text-right">Total:</th>
 						<th>%s</th>
 					</tr>
 				</tfoot>
@@ -578,7 +750,25 @@ func formatDate(t time.Time) string {
 	return t.Format("January 2, 2006")
 }
 
-// formatCurrency formats a float as a currency string
+// formatReviewStatus returns a label for a receipt's review status
+func formatReviewStatus(status string) string {
+	if status == ReviewConfirmed {
+		return "Confirmed"
+	}
+	return "Needs review"
+}
+
+// formatQuantity formats a quantity with its unit, using three decimals for weighed items
+func formatQuantity(qty float64, unit string) string {
+	switch unit {
+	case UnitKilogram, UnitLiter:
+		return strconv.FormatFloat(qty, 'f', 3, 64) + " " + unit
+	default:
+		return strconv.FormatFloat(qty, 'f', -1, 64) + " " + unit
+	}
+}
+
+// formatCurrency formats an amount in the base currency
 func formatCurrency(amount float64) string {
-	return "$" + strconv.FormatFloat(amount, 'f', 2, 64)
+	return formatMoney(amount, baseCurrency())
 }
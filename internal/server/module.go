@@ -0,0 +1,50 @@
+package server
+
+import (
+	"context"
+	"io/fs"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mauroue/cereja-corp/internal/auth"
+)
+
+// Module is a feature area of the application (receipts, tasks, notes, ...).
+// The server mounts every module's routes, runs their migrations in module
+// order and drives their lifecycle.
+type Module interface {
+	// Name identifies the module in logs and in the migration history
+	Name() string
+
+	// RegisterRoutes mounts the module's API and web routes
+	RegisterRoutes(routes Routes)
+
+	// Migrations returns the module's SQL migrations as .sql files at the root
+	// of the returned FS, applied in file name order, or nil if it has none
+	Migrations() (fs.FS, error)
+
+	// MigrationsRequire names the modules whose migrations must be applied
+	// before this module's, e.g. for the tables its own tables reference
+	MigrationsRequire() []string
+
+	// Start is called once the routes are mounted, before the server accepts
+	// requests
+	Start(ctx context.Context) error
+
+	// Stop is called on shutdown, after the server stopped accepting requests.
+	// It should wait for the module's background work until ctx is done.
+	Stop(ctx context.Context) error
+}
+
+// Routes are the mount points handed to each module
+type Routes struct {
+	// Engine is the root router, for web pages, static files and routes that
+	// handle authentication themselves
+	Engine *gin.Engine
+
+	// API is the /api/v1 group. Requests reaching its routes carry a signed-in
+	// user, authenticated by API token or session cookie.
+	API *gin.RouterGroup
+
+	// Users is the account repository the API group authenticates against
+	Users *auth.Repository
+}
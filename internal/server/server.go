@@ -1,21 +1,36 @@
 package server
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/mauroue/cereja-corp/internal/api"
+	"github.com/mauroue/cereja-corp/config"
+	"github.com/mauroue/cereja-corp/internal/auth"
+	"github.com/mauroue/cereja-corp/internal/migrate"
 )
 
+// APIPrefix is the path every module's JSON API is mounted under
+const APIPrefix = "/api/v1"
+
 // Server encapsulates the Gin router and other dependencies
 type Server struct {
-	Router *gin.Engine
+	Router  *gin.Engine
+	Users   *auth.Repository
+	Modules []Module
 }
 
-// NewServer creates a new server instance
-func NewServer(router *gin.Engine) *Server {
+// NewServer creates a new server instance mounting the given modules, in order
+func NewServer(router *gin.Engine, database *sql.DB, modules ...Module) *Server {
 	return &Server{
-		Router: router,
+		Router:  router,
+		Users:   auth.NewRepository(database),
+		Modules: modules,
 	}
 }
 
@@ -25,6 +40,12 @@ func (s *Server) SetupRoutes() {
 	s.Router.Use(gin.Logger())
 	s.Router.Use(gin.Recovery())
 
+	s.Router.GET("/", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Welcome to Cereja Corp",
+		})
+	})
+
 	// Health check endpoint
 	s.Router.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
@@ -32,12 +53,106 @@ func (s *Server) SetupRoutes() {
 		})
 	})
 
-	// API routes
-	apiGroup := s.Router.Group("/api/v1")
-	{
-		// Setup different service endpoints
-		api.SetupTaskRoutes(apiGroup)
-		api.SetupNoteRoutes(apiGroup)
-		// Add more service routes as needed
+	// API routes, scoped to the signed-in user
+	routes := Routes{
+		Engine: s.Router,
+		API:    s.Router.Group(APIPrefix, auth.APIMiddleware(s.Users), auth.RequireUser()),
+		Users:  s.Users,
+	}
+	for _, module := range s.Modules {
+		module.RegisterRoutes(routes)
+	}
+}
+
+// MigrationSources returns the modules' migrations, in module order
+func (s *Server) MigrationSources() ([]migrate.Source, error) {
+	sources := make([]migrate.Source, 0, len(s.Modules))
+	for _, module := range s.Modules {
+		files, err := module.Migrations()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s migrations: %w", module.Name(), err)
+		}
+		sources = append(sources, migrate.Source{
+			Module:   module.Name(),
+			Files:    files,
+			Requires: module.MigrationsRequire(),
+		})
+	}
+	return sources, nil
+}
+
+// Start starts the modules in order. If one fails, the modules already started
+// are stopped again.
+func (s *Server) Start(ctx context.Context) error {
+	for i, module := range s.Modules {
+		if err := module.Start(ctx); err != nil {
+			stopModules(ctx, s.Modules[:i])
+			return fmt.Errorf("failed to start %s: %w", module.Name(), err)
+		}
+	}
+	return nil
+}
+
+// Stop stops the modules in reverse order, waiting for their background work
+// until ctx is done
+func (s *Server) Stop(ctx context.Context) error {
+	return stopModules(ctx, s.Modules)
+}
+
+// stopModules stops the modules in reverse order, collecting their errors
+func stopModules(ctx context.Context, modules []Module) error {
+	var errs []error
+	for i := len(modules) - 1; i >= 0; i-- {
+		if err := modules[i].Stop(ctx); err != nil {
+			log.Printf("Failed to stop %s: %v", modules[i].Name(), err)
+			errs = append(errs, fmt.Errorf("%s: %w", modules[i].Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Run serves HTTP with the address and timeouts from cfg until ctx is done,
+// then shuts down gracefully: the listener closes, in-flight requests (uploads
+// and their OCR included) are drained and the modules are stopped, all within
+// the configured grace period. Requests still running after it are cut off.
+func (s *Server) Run(ctx context.Context, cfg config.ServerConfig) error {
+	httpServer := &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           s.Router,
+		ReadTimeout:       seconds(cfg.ReadTimeout),
+		ReadHeaderTimeout: seconds(cfg.ReadHeaderTimeout),
+		WriteTimeout:      seconds(cfg.WriteTimeout),
+		IdleTimeout:       seconds(cfg.IdleTimeout),
 	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("Starting server on %s", httpServer.Addr)
+		serveErr <- httpServer.ListenAndServe()
+	}()
+
+	var errs []error
+	select {
+	case err := <-serveErr:
+		errs = append(errs, fmt.Errorf("failed to serve: %w", err))
+	case <-ctx.Done():
+		log.Printf("Shutting down, waiting up to %ds for in-flight work", cfg.ShutdownTimeout)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), seconds(cfg.ShutdownTimeout))
+	defer cancel()
+
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		errs = append(errs, fmt.Errorf("failed to drain requests: %w", err))
+		httpServer.Close()
+	}
+	if err := s.Stop(shutdownCtx); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// seconds converts a configured number of seconds to a duration
+func seconds(n int) time.Duration {
+	return time.Duration(n) * time.Second
 }